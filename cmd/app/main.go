@@ -2,30 +2,50 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"marketplace/config"
 	_ "marketplace/docs"
 	"marketplace/internal/database"
 	"marketplace/internal/logger"
 	"marketplace/internal/server"
+	"marketplace/internal/tracing"
 	"marketplace/migrations"
 )
 
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+//
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
 func main() {
-	cfg := config.LoadConfig()
-	slogger.SetLogger(cfg.AppEnv)
+	cfg := loadConfig()
+	slogger.SetLogger(cfg)
+	reloadLogSettingsOnHangup()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		slog.Error("Tracing setup failed", slog.Any("error", err))
+		os.Exit(1)
+	}
 
-	db := database.New(cfg.GetDBURL())
-	migrations.Migrate(cfg.GetDBURL())
+	db, err := database.New(context.Background(), cfg)
+	if err != nil {
+		slog.Error("Database connection failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	migrations.Migrate(cfg.GetMigrationDBURL())
 
 	srv := server.NewGinServer(cfg, db)
 	go func() {
@@ -34,15 +54,112 @@ func main() {
 		}
 	}()
 
+	var adminSrv *server.AdminServer
+	if cfg.AdminEnabled {
+		adminSrv = server.NewAdminServer(cfg)
+		go func() {
+			if err := adminSrv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Admin server error", slog.Any("error", err))
+			}
+		}()
+	}
+
+	var metricsSrv *server.MetricsServer
+	if cfg.MetricsEnabled {
+		metricsSrv = server.NewMetricsServer(cfg)
+		go func() {
+			if err := metricsSrv.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Metrics server error", slog.Any("error", err))
+			}
+		}()
+	}
+
 	// graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	ctx, cancel := context.WithCancel(context.Background())
+	shutdownTimeout := time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.Error("Error during server shutdown", slog.Any("error", err))
 	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			slog.Error("Error during metrics server shutdown", slog.Any("error", err))
+		}
+	}
+	// The admin server stops last, so a slow shutdown can still be profiled.
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			slog.Error("Error during admin server shutdown", slog.Any("error", err))
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Closing the pool would wait for the connections still held by
+		// whatever did not stop.
+		slog.Error("Shutdown timeout exceeded, exiting without waiting for the rest",
+			slog.Duration("timeout", shutdownTimeout))
+		os.Exit(1)
+	}
 	db.Pool.Close()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Error during tracing shutdown", slog.Any("error", err))
+	}
 	slog.Info("App gracefully stopped")
 }
+
+// loadConfig reads and validates the configuration and exits when it is
+// invalid. With --print-config it prints the configuration with secrets
+// redacted and exits, with status 1 when it is invalid.
+func loadConfig() *config.Config {
+	cfg, opts, err := config.Read(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	err = cfg.Validate()
+	if opts.PrintConfig {
+		out, marshalErr := json.MarshalIndent(cfg.Redacted(), "", "    ")
+		if marshalErr != nil {
+			fmt.Fprintln(os.Stderr, marshalErr)
+			os.Exit(1)
+		}
+		fmt.Println(string(out))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if opts.PrintConfig {
+		os.Exit(0)
+	}
+	return cfg
+}
+
+// reloadLogSettingsOnHangup reads the configuration again on SIGHUP and
+// applies its log settings, which also undoes changes made on the admin
+// server.
+func reloadLogSettingsOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			cfg, _, err := config.Read(os.Args[1:])
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err == nil {
+				err = slogger.Configure(cfg)
+			}
+			if err != nil {
+				slog.Error("Log settings are not reloaded", slog.Any("error", err))
+				continue
+			}
+			slog.Info("Log settings reloaded")
+		}
+	}()
+}
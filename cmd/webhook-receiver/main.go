@@ -0,0 +1,37 @@
+// Command webhook-receiver is a local endpoint for trying out webhooks. It
+// verifies signatures and logs every event it accepts. Run the app with
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS=true to deliver to it.
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"marketplace/internal/webhooks"
+)
+
+func main() {
+	addr := flag.String("addr", ":8091", "listen address")
+	secret := flag.String("secret", os.Getenv("WEBHOOK_SECRET"), "webhook secret returned on creation")
+	status := flag.Int("status", http.StatusNoContent, "status returned for signed requests, use 5xx to test retries")
+	flag.Parse()
+
+	receiver := webhooks.NewReceiver(*secret)
+	receiver.SetStatusCode(*status)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Webhook received",
+			slog.String("eventType", r.Header.Get("X-Event-Type")),
+			slog.String("eventID", r.Header.Get("X-Event-ID")),
+			slog.String("deliveryID", r.Header.Get("X-Webhook-ID")),
+		)
+		receiver.ServeHTTP(w, r)
+	})
+
+	slog.Info("Webhook receiver listening", slog.String("addr", *addr))
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		slog.Error("Webhook receiver error", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
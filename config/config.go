@@ -1,23 +1,126 @@
 package config
 
 import (
-	"fmt"
-	"log/slog"
-
-	"github.com/ilyakaznacheev/cleanenv"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	AppPort         int    `env:"APP_PORT"`
-	JWTSecret       string `env:"JWT_SECRET"`
-	AppEnv          AppEnv `env:"APP_ENV"`
-	TokenTTLMinutes int    `env:"TOKEN_TTL_MINUTES"`
-	DBHost          string `env:"DB_HOST"`
-	DBPort          int    `env:"DB_PORT"`
-	DBUsername      string `env:"DB_USERNAME"`
-	DBPassword      string `env:"DB_PASSWORD"`
-	DBName          string `env:"DB_NAME"`
+	AppPort         int    `env:"APP_PORT" validate:"required,min=1,max=65535"`
+	JWTSecret       string `env:"JWT_SECRET" secret:"true" validate:"required,min=32"`
+	AppEnv          AppEnv `env:"APP_ENV" validate:"required,oneof=local dev prod"`
+	TokenTTLMinutes int    `env:"TOKEN_TTL_MINUTES" validate:"required,min=1"`
+	DBHost          string `env:"DB_HOST" validate:"required"`
+	DBPort          int    `env:"DB_PORT" env-default:"5432" validate:"min=1,max=65535"`
+	DBUsername      string `env:"DB_USERNAME" validate:"required"`
+	DBPassword      string `env:"DB_PASSWORD" secret:"true"`
+	DBName          string `env:"DB_NAME" validate:"required"`
 	DBPath          string `env:"DB_PATH"`
+	DBSSLMode       string `env:"DB_SSLMODE" env-default:"disable" validate:"oneof=disable allow prefer require verify-ca verify-full"`
+	DBMaxConns      int    `env:"DB_MAX_CONNS" env-default:"10" validate:"min=1"`
+	DBMinConns      int    `env:"DB_MIN_CONNS" env-default:"0" validate:"min=0,ltefield=DBMaxConns"`
+
+	DBMaxConnLifetimeSeconds   int `env:"DB_MAX_CONN_LIFETIME_SECONDS" env-default:"3600" validate:"min=1"`
+	DBMaxConnIdleSeconds       int `env:"DB_MAX_CONN_IDLE_SECONDS" env-default:"1800" validate:"min=1"`
+	DBHealthCheckPeriodSeconds int `env:"DB_HEALTH_CHECK_PERIOD_SECONDS" env-default:"60" validate:"min=1"`
+	DBStatementTimeoutSeconds  int `env:"DB_STATEMENT_TIMEOUT_SECONDS" env-default:"30" validate:"min=0"`
+	DBConnectTimeoutSeconds    int `env:"DB_CONNECT_TIMEOUT_SECONDS" env-default:"5" validate:"min=1"`
+	DBConnectMaxAttempts       int `env:"DB_CONNECT_MAX_ATTEMPTS" env-default:"10" validate:"min=1"`
+	DBConnectRetryBaseSeconds  int `env:"DB_CONNECT_RETRY_BASE_SECONDS" env-default:"1" validate:"min=1"`
+	DBConnectRetryMaxSeconds   int `env:"DB_CONNECT_RETRY_MAX_SECONDS" env-default:"15" validate:"min=1"`
+	DBTxMaxAttempts            int `env:"DB_TX_MAX_ATTEMPTS" env-default:"3" validate:"min=1"`
+
+	PasswordResetTTLMinutes int    `env:"PASSWORD_RESET_TTL_MINUTES" env-default:"30" validate:"min=1"`
+	TOTPIssuer              string `env:"TOTP_ISSUER" env-default:"Marketplace"`
+
+	OIDCProviders       OIDCProviders `env:"OIDC_PROVIDERS"`
+	OIDCStateTTLMinutes int           `env:"OIDC_STATE_TTL_MINUTES" env-default:"10" validate:"min=1"`
+
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	MetricsEnabled bool   `env:"METRICS_ENABLED" env-default:"false"`
+	MetricsAddr    string `env:"METRICS_ADDR" env-default:"127.0.0.1:9090" validate:"required_if=MetricsEnabled true"`
+
+	HealthCheckTimeoutSeconds int `env:"HEALTH_CHECK_TIMEOUT_SECONDS" env-default:"2" validate:"min=1"`
+	ShutdownDrainSeconds      int `env:"SHUTDOWN_DRAIN_SECONDS" env-default:"5" validate:"min=0"`
+	ShutdownTimeoutSeconds    int `env:"SHUTDOWN_TIMEOUT_SECONDS" env-default:"60" validate:"gtfield=ShutdownDrainSeconds"`
+
+	TracingExporter    TracingExporter `env:"TRACING_EXPORTER" env-default:"none" validate:"oneof=otlp stdout none"`
+	TracingServiceName string          `env:"TRACING_SERVICE_NAME" env-default:"marketplace"`
+	TracingSampleRatio float64         `env:"TRACING_SAMPLE_RATIO" env-default:"1" validate:"gte=0,lte=1"`
+
+	AdminEnabled bool   `env:"ADMIN_ENABLED" env-default:"false"`
+	AdminAddr    string `env:"ADMIN_ADDR" env-default:"127.0.0.1:6060" validate:"required_if=AdminEnabled true"`
+
+	LogLevel                   string            `env:"LOG_LEVEL"`
+	LogLevelOverrides          LogLevelOverrides `env:"LOG_LEVEL_OVERRIDES"`
+	LogSamplingInitial         int               `env:"LOG_SAMPLING_INITIAL" env-default:"0" validate:"min=0"`
+	LogSamplingThereafter      int               `env:"LOG_SAMPLING_THEREAFTER" env-default:"100" validate:"min=0"`
+	LogSamplingIntervalSeconds int               `env:"LOG_SAMPLING_INTERVAL_SECONDS" env-default:"1" validate:"min=1"`
+
+	LoginMaxAccountFailures   int `env:"LOGIN_MAX_ACCOUNT_FAILURES" env-default:"5" validate:"min=1"`
+	LoginMaxIPFailures        int `env:"LOGIN_MAX_IP_FAILURES" env-default:"20" validate:"min=1"`
+	LoginFailureWindowMinutes int `env:"LOGIN_FAILURE_WINDOW_MINUTES" env-default:"15" validate:"min=1"`
+	LoginLockoutBaseSeconds   int `env:"LOGIN_LOCKOUT_BASE_SECONDS" env-default:"30" validate:"min=1"`
+	LoginLockoutMaxSeconds    int `env:"LOGIN_LOCKOUT_MAX_SECONDS" env-default:"3600" validate:"min=1"`
+
+	RateLimitStore               RateLimitStore  `env:"RATE_LIMIT_STORE" env-default:"memory" validate:"oneof=memory postgres"`
+	RateLimitDefault             RateLimitPolicy `env:"RATE_LIMIT_DEFAULT" env-default:"300/1m@ip"`
+	RateLimitAuth                RateLimitPolicy `env:"RATE_LIMIT_AUTH" env-default:"20/1m@ip"`
+	RateLimitAdvertisementsWrite RateLimitPolicy `env:"RATE_LIMIT_ADVERTISEMENTS_WRITE" env-default:"30/1h@user"`
+
+	AdvertisementLifetimeDays        int `env:"ADVERTISEMENT_LIFETIME_DAYS" env-default:"30" validate:"min=1"`
+	AdvertisementExpiryReminderHours int `env:"ADVERTISEMENT_EXPIRY_REMINDER_HOURS" env-default:"72" validate:"min=0"`
+
+	ImportMaxBytes    int64 `env:"IMPORT_MAX_BYTES" env-default:"10485760" validate:"min=1"`
+	ImportSyncMaxRows int   `env:"IMPORT_SYNC_MAX_ROWS" env-default:"500" validate:"min=1"`
+
+	ExportMaxConcurrent  int `env:"EXPORT_MAX_CONCURRENT" env-default:"2" validate:"min=1,ltfield=DBMaxConns"`
+	ExportTimeoutSeconds int `env:"EXPORT_TIMEOUT_SECONDS" env-default:"600" validate:"min=1"`
+
+	OutboxRelayEnabled          bool         `env:"OUTBOX_RELAY_ENABLED" env-default:"true"`
+	OutboxSinks                 []OutboxSink `env:"OUTBOX_SINKS" env-default:"bus,log" validate:"dive,oneof=bus webhook log"`
+	OutboxPollIntervalSeconds   int          `env:"OUTBOX_POLL_INTERVAL_SECONDS" env-default:"1" validate:"min=1"`
+	OutboxBatchSize             int          `env:"OUTBOX_BATCH_SIZE" env-default:"100" validate:"min=1"`
+	OutboxLeaseSeconds          int          `env:"OUTBOX_LEASE_SECONDS" env-default:"120" validate:"min=1"`
+	OutboxMaxAttempts           int          `env:"OUTBOX_MAX_ATTEMPTS" env-default:"10" validate:"min=1"`
+	OutboxRetryBaseSeconds      int          `env:"OUTBOX_RETRY_BASE_SECONDS" env-default:"5" validate:"min=1"`
+	OutboxRetryMaxSeconds       int          `env:"OUTBOX_RETRY_MAX_SECONDS" env-default:"3600" validate:"min=1"`
+	OutboxRetentionHours        int          `env:"OUTBOX_RETENTION_HOURS" env-default:"168" validate:"min=1"`
+	OutboxWebhookURL            string       `env:"OUTBOX_WEBHOOK_URL" validate:"omitempty,url"`
+	OutboxWebhookTimeoutSeconds int          `env:"OUTBOX_WEBHOOK_TIMEOUT_SECONDS" env-default:"10" validate:"min=1"`
+
+	JobsEnabled                  bool `env:"JOBS_ENABLED" env-default:"true"`
+	JobsConcurrency              int  `env:"JOBS_CONCURRENCY" env-default:"10" validate:"min=1"`
+	JobsPollIntervalSeconds      int  `env:"JOBS_POLL_INTERVAL_SECONDS" env-default:"1" validate:"min=1"`
+	JobsVisibilityTimeoutSeconds int  `env:"JOBS_VISIBILITY_TIMEOUT_SECONDS" env-default:"300" validate:"min=1"`
+	JobsShutdownTimeoutSeconds   int  `env:"JOBS_SHUTDOWN_TIMEOUT_SECONDS" env-default:"30" validate:"min=0"`
+	JobsMaxAttempts              int  `env:"JOBS_MAX_ATTEMPTS" env-default:"10" validate:"min=1"`
+	JobsRetryBaseSeconds         int  `env:"JOBS_RETRY_BASE_SECONDS" env-default:"10" validate:"min=1"`
+	JobsRetryMaxSeconds          int  `env:"JOBS_RETRY_MAX_SECONDS" env-default:"3600" validate:"min=1"`
+	JobsRetentionHours           int  `env:"JOBS_RETENTION_HOURS" env-default:"168" validate:"min=1"`
+
+	WebhookPollIntervalSeconds  int  `env:"WEBHOOK_POLL_INTERVAL_SECONDS" env-default:"1" validate:"min=1"`
+	WebhookMaxAttempts          int  `env:"WEBHOOK_MAX_ATTEMPTS" env-default:"8" validate:"min=1"`
+	WebhookRetryBaseSeconds     int  `env:"WEBHOOK_RETRY_BASE_SECONDS" env-default:"30" validate:"min=1"`
+	WebhookRetryMaxSeconds      int  `env:"WEBHOOK_RETRY_MAX_SECONDS" env-default:"21600" validate:"min=1"`
+	WebhookDisableAfterFailures int  `env:"WEBHOOK_DISABLE_AFTER_FAILURES" env-default:"20" validate:"min=0"`
+	WebhookTimeoutSeconds       int  `env:"WEBHOOK_TIMEOUT_SECONDS" env-default:"10" validate:"min=1"`
+	WebhookAllowPrivateNetworks bool `env:"WEBHOOK_ALLOW_PRIVATE_NETWORKS" env-default:"false"`
+
+	EmailVerificationTTLMinutes            int  `env:"EMAIL_VERIFICATION_TTL_MINUTES" env-default:"1440" validate:"min=1"`
+	EmailVerificationResendIntervalSeconds int  `env:"EMAIL_VERIFICATION_RESEND_INTERVAL_SECONDS" env-default:"60" validate:"min=0"`
+	RequireVerifiedEmailForAdvertisements  bool `env:"REQUIRE_VERIFIED_EMAIL_FOR_ADVERTISEMENTS" env-default:"false"`
+
+	MailDriver   MailDriver `env:"MAIL_DRIVER" env-default:"log" validate:"oneof=smtp file log"`
+	MailFrom     string     `env:"MAIL_FROM" env-default:"no-reply@marketplace.local" validate:"required"`
+	MailFilePath string     `env:"MAIL_FILE_PATH"`
+	SMTPHost     string     `env:"SMTP_HOST" validate:"required_if=MailDriver smtp"`
+	SMTPPort     int        `env:"SMTP_PORT" env-default:"587" validate:"min=1,max=65535"`
+	SMTPUsername string     `env:"SMTP_USERNAME"`
+	SMTPPassword string     `env:"SMTP_PASSWORD" secret:"true"`
 }
 
 type AppEnv string
@@ -28,20 +131,63 @@ const (
 	Prod  AppEnv = "prod"
 )
 
-func LoadConfig() *Config {
-	Cfg := &Config{}
-	if err := cleanenv.ReadEnv(Cfg); err != nil {
-		slog.Error("Cannot read .env file: %s", slog.Any("error", err))
+type MailDriver string
+
+const (
+	SMTPMailDriver MailDriver = "smtp"
+	FileMailDriver MailDriver = "file"
+	LogMailDriver  MailDriver = "log"
+)
+
+type TracingExporter string
+
+const (
+	OTLPTracingExporter   TracingExporter = "otlp"
+	StdoutTracingExporter TracingExporter = "stdout"
+	NoneTracingExporter   TracingExporter = "none"
+)
+
+type OutboxSink string
+
+const (
+	BusOutboxSink     OutboxSink = "bus"
+	WebhookOutboxSink OutboxSink = "webhook"
+	LogOutboxSink     OutboxSink = "log"
+)
+
+// GetDBURL returns the URL of the application pool, with the pool settings
+// as pgx pool_* parameters and the statement timeout as a server setting.
+func (cfg *Config) GetDBURL() string {
+	dbURL := cfg.dbURL()
+	query := dbURL.Query()
+	query.Set("pool_max_conns", strconv.Itoa(cfg.DBMaxConns))
+	query.Set("pool_min_conns", strconv.Itoa(cfg.DBMinConns))
+	query.Set("pool_max_conn_lifetime", seconds(cfg.DBMaxConnLifetimeSeconds).String())
+	query.Set("pool_max_conn_idle_time", seconds(cfg.DBMaxConnIdleSeconds).String())
+	query.Set("pool_health_check_period", seconds(cfg.DBHealthCheckPeriodSeconds).String())
+	query.Set("connect_timeout", strconv.Itoa(cfg.DBConnectTimeoutSeconds))
+	query.Set("statement_timeout", strconv.Itoa(cfg.DBStatementTimeoutSeconds*1000))
+	dbURL.RawQuery = query.Encode()
+	return dbURL.String()
+}
+
+// GetMigrationDBURL returns the URL without the pool parameters, which the
+// migration driver would send to the server as unknown settings, and
+// without the statement timeout, which long migrations may exceed.
+func (cfg *Config) GetMigrationDBURL() string {
+	return cfg.dbURL().String()
+}
+
+func (cfg *Config) dbURL() *url.URL {
+	return &url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.DBUsername, cfg.DBPassword),
+		Host:     net.JoinHostPort(cfg.DBHost, strconv.Itoa(cfg.DBPort)),
+		Path:     "/" + cfg.DBName,
+		RawQuery: url.Values{"sslmode": {cfg.DBSSLMode}}.Encode(),
 	}
-	return Cfg
 }
 
-func (cfg *Config) GetDBURL() string {
-	DBURL := fmt.Sprintf("postgres://%s:%s@%s:5432/%s?sslmode=disable",
-		cfg.DBUsername,
-		cfg.DBPassword,
-		cfg.DBHost,
-		cfg.DBName,
-	)
-	return DBURL
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
 }
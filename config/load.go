@@ -0,0 +1,265 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Options are the flags of Read that are not configuration fields.
+type Options struct {
+	// File is the YAML or TOML file read with --config or CONFIG_FILE.
+	File string
+	// PrintConfig asks to print the configuration instead of running.
+	PrintConfig bool
+}
+
+// Read builds the configuration from its layers, each overriding the one
+// before: the env-default tags, the config file, env vars and the flags in
+// args. Empty env vars count as unset, like the empty lines of .env.example.
+//
+// The file and the flags use the env names of the fields: JWT_SECRET is
+// jwt_secret in the file and --jwt-secret on the command line. Read does
+// not validate the result, see Validate. With -h it prints the flags and
+// returns flag.ErrHelp.
+func Read(args []string) (*Config, *Options, error) {
+	fields := configFields()
+
+	opts := &Options{File: os.Getenv("CONFIG_FILE")}
+	flags := flag.NewFlagSet("marketplace", flag.ContinueOnError)
+	flags.StringVar(&opts.File, "config", opts.File, "YAML or TOML configuration file")
+	flags.BoolVar(&opts.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	flagValues := map[string]*string{}
+	for _, field := range fields {
+		flagValues[field.env] = flags.String(flagName(field.env), "", field.env)
+	}
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			flags.SetOutput(os.Stderr)
+			flags.PrintDefaults()
+		}
+		return nil, nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	setFlags := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	var fileValues map[string]string
+	if opts.File != "" {
+		var err error
+		if fileValues, err = readFile(opts.File, fields); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cfg := &Config{}
+	value := reflect.ValueOf(cfg).Elem()
+	var errs []error
+	for _, field := range fields {
+		text, ok := field.tag.Lookup("env-default")
+		if fileText, found := fileValues[field.env]; found {
+			text, ok = fileText, true
+		}
+		if envText := os.Getenv(field.env); envText != "" {
+			text, ok = envText, true
+		}
+		if setFlags[flagName(field.env)] {
+			text, ok = *flagValues[field.env], true
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(field.index), text); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.env, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+	return cfg, opts, nil
+}
+
+type configField struct {
+	index int
+	env   string
+	tag   reflect.StructTag
+}
+
+func configFields() []configField {
+	t := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, t.NumField())
+	for i := range t.NumField() {
+		if env := t.Field(i).Tag.Get("env"); env != "" {
+			fields = append(fields, configField{index: i, env: env, tag: t.Field(i).Tag})
+		}
+	}
+	return fields
+}
+
+func flagName(env string) string {
+	return strings.ReplaceAll(strings.ToLower(env), "_", "-")
+}
+
+// readFile returns the values of the file as they would be written in env
+// vars, keyed by env name. Lists are joined with commas, maps become
+// key=value pairs and anything holding objects, such as the OIDC
+// providers, becomes JSON.
+func readFile(path string, fields []configField) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	raw := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unknown config file format %q (allowed: .yaml, .yml, .toml)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	known := map[string]bool{}
+	for _, field := range fields {
+		known[field.env] = true
+	}
+	values := map[string]string{}
+	var errs []error
+	for key, v := range raw {
+		env := strings.ToUpper(key)
+		if !known[env] {
+			errs = append(errs, fmt.Errorf("%s: unknown config key %q", path, key))
+			continue
+		}
+		text, err := fileValueText(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, key, err))
+			continue
+		}
+		values[env] = text
+	}
+	return values, errors.Join(errs...)
+}
+
+func fileValueText(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if !isScalar(item) {
+				return marshalJSON(v)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		entries := make([]string, 0, len(v))
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if !isScalar(v[key]) {
+				return marshalJSON(v)
+			}
+			entries = append(entries, key+"="+fmt.Sprint(v[key]))
+		}
+		return strings.Join(entries, ","), nil
+	default:
+		if !isScalar(v) {
+			return "", fmt.Errorf("unsupported value %v", v)
+		}
+		return fmt.Sprint(v), nil
+	}
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func marshalJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// setField parses text the way it is written in env vars: types with
+// UnmarshalText parse themselves and slices are comma-separated.
+func setField(field reflect.Value, text string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	text = strings.TrimSpace(text)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		if text == "" {
+			field.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", text)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if text == "" {
+			field.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", text)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		if text == "" {
+			field.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", text)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		field.SetZero()
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setField(elem, item); err != nil {
+				return err
+			}
+			field.Set(reflect.Append(field, elem))
+		}
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustRead(t *testing.T, args ...string) *Config {
+	t.Helper()
+	cfg, _, err := Read(args)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	return cfg
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadLayers(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+app_port: 8081
+db_host: file-host
+db_name: file-db
+metrics_enabled: true
+outbox_sinks: [bus, log]
+log_level_overrides:
+  services.auth: debug
+oidc_providers:
+  - name: mock
+    issuer_url: http://localhost:8090/default
+    client_id: marketplace
+    redirect_url: http://localhost:8080/callback
+`)
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_NAME", "")
+
+	cfg := mustRead(t, "--config", path, "--app-port", "9090")
+
+	if cfg.AppPort != 9090 {
+		t.Errorf("AppPort = %d, want 9090 from the flag", cfg.AppPort)
+	}
+	if cfg.DBHost != "env-host" {
+		t.Errorf("DBHost = %q, want env-host from the env", cfg.DBHost)
+	}
+	if cfg.DBName != "file-db" {
+		t.Errorf("DBName = %q, want file-db from the file, an empty env var is unset", cfg.DBName)
+	}
+	if !cfg.MetricsEnabled {
+		t.Error("MetricsEnabled = false, want true from the file over the default")
+	}
+	if cfg.DBPort != 5432 {
+		t.Errorf("DBPort = %d, want the default 5432", cfg.DBPort)
+	}
+	if want := []OutboxSink{BusOutboxSink, LogOutboxSink}; !slices.Equal(cfg.OutboxSinks, want) {
+		t.Errorf("OutboxSinks = %v, want %v", cfg.OutboxSinks, want)
+	}
+	if cfg.LogLevelOverrides["services.auth"] != slog.LevelDebug {
+		t.Errorf("LogLevelOverrides = %v", cfg.LogLevelOverrides)
+	}
+	if len(cfg.OIDCProviders) != 1 || cfg.OIDCProviders[0].Name != "mock" {
+		t.Errorf("OIDCProviders = %+v", cfg.OIDCProviders)
+	}
+}
+
+func TestReadTOMLFile(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+JWT_SECRET = "file-secret"
+TRACING_SAMPLE_RATIO = 0.25
+`)
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg := mustRead(t)
+	if cfg.JWTSecret != "file-secret" || cfg.TracingSampleRatio != 0.25 {
+		t.Errorf("JWTSecret = %q, TracingSampleRatio = %v", cfg.JWTSecret, cfg.TracingSampleRatio)
+	}
+}
+
+func TestReadRejectsInvalidSources(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unknown file key", []string{"--config", writeConfigFile(t, "config.yaml", "db_hots: localhost\n")}, `unknown config key "db_hots"`},
+		{"unknown file format", []string{"--config", writeConfigFile(t, "config.json", "{}")}, "unknown config file format"},
+		{"invalid flag value", []string{"--app-port", "eighty"}, "APP_PORT: invalid integer"},
+		{"unknown flag", []string{"--app-prot", "80"}, "app-prot"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Read(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPrintConfig(t *testing.T) {
+	_, opts, err := Read([]string{"--print-config"})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !opts.PrintConfig {
+		t.Error("PrintConfig = false, want true")
+	}
+}
+
+func TestLoadRateLimitPolicyFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_DEFAULT", "5/30s@ip")
+
+	cfg := mustRead(t)
+	want := RateLimitPolicy{Limit: 5, Window: 30 * time.Second, Key: IPRateLimitKey}
+	if cfg.RateLimitDefault != want {
+		t.Errorf("RateLimitDefault = %+v, want %+v", cfg.RateLimitDefault, want)
+	}
+	if !cfg.RateLimitDefault.Enabled() {
+		t.Error("RateLimitDefault is not enabled")
+	}
+}
+
+func TestLoadRateLimitPolicyDefaults(t *testing.T) {
+	cfg := mustRead(t)
+	tests := []struct {
+		name   string
+		policy RateLimitPolicy
+		want   RateLimitPolicy
+	}{
+		{"RATE_LIMIT_DEFAULT", cfg.RateLimitDefault, RateLimitPolicy{Limit: 300, Window: time.Minute, Key: IPRateLimitKey}},
+		{"RATE_LIMIT_AUTH", cfg.RateLimitAuth, RateLimitPolicy{Limit: 20, Window: time.Minute, Key: IPRateLimitKey}},
+		{"RATE_LIMIT_ADVERTISEMENTS_WRITE", cfg.RateLimitAdvertisementsWrite, RateLimitPolicy{Limit: 30, Window: time.Hour, Key: UserRateLimitKey}},
+	}
+	for _, tt := range tests {
+		if tt.policy != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.name, tt.policy, tt.want)
+		}
+	}
+}
+
+func TestReadRateLimitPolicyInvalid(t *testing.T) {
+	t.Setenv("RATE_LIMIT_DEFAULT", "5/30s@nobody")
+
+	if _, _, err := Read(nil); err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_DEFAULT") {
+		t.Errorf("Read() error = %v, want an invalid key error of RATE_LIMIT_DEFAULT", err)
+	}
+}
+
+func TestLoadLogLevelOverridesFromEnv(t *testing.T) {
+	t.Setenv("LOG_LEVEL_OVERRIDES", "services.auth=debug, handlers.v1=WARN")
+
+	cfg := mustRead(t)
+	want := LogLevelOverrides{"services.auth": slog.LevelDebug, "handlers.v1": slog.LevelWarn}
+	if !maps.Equal(cfg.LogLevelOverrides, want) {
+		t.Errorf("LogLevelOverrides = %v, want %v", cfg.LogLevelOverrides, want)
+	}
+	if got := cfg.LogLevelOverrides.String(); got != "handlers.v1=warn,services.auth=debug" {
+		t.Errorf("String() = %q", got)
+	}
+
+	var overrides LogLevelOverrides
+	if err := overrides.UnmarshalText([]byte("services.auth")); err == nil {
+		t.Error("UnmarshalText() without a level succeeded")
+	}
+}
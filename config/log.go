@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// LogLevelOverrides sets the level of the logs of an op prefix, written as
+// "services.auth=debug,handlers.v1=warn". A prefix matches the op itself
+// and every op below it, the longest matching prefix wins.
+type LogLevelOverrides map[string]slog.Level
+
+func (o *LogLevelOverrides) UnmarshalText(text []byte) error {
+	overrides := LogLevelOverrides{}
+	for _, entry := range strings.Split(string(text), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, levelName, found := strings.Cut(entry, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !found || prefix == "" {
+			return fmt.Errorf("invalid log level override %q (expected <op prefix>=<level>)", entry)
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(levelName))); err != nil {
+			return fmt.Errorf("invalid log level override %q: %v", entry, err)
+		}
+		overrides[prefix] = level
+	}
+	*o = overrides
+	return nil
+}
+
+func (o LogLevelOverrides) String() string {
+	entries := make([]string, 0, len(o))
+	for _, prefix := range slices.Sorted(maps.Keys(o)) {
+		entries = append(entries, prefix+"="+strings.ToLower(o[prefix].String()))
+	}
+	return strings.Join(entries, ",")
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type OIDCProvider struct {
+	Name         string   `json:"name" yaml:"name"`
+	IssuerURL    string   `json:"issuer_url" yaml:"issuer_url"`
+	ClientID     string   `json:"client_id" yaml:"client_id"`
+	ClientSecret string   `json:"client_secret" yaml:"client_secret" secret:"true"`
+	RedirectURL  string   `json:"redirect_url" yaml:"redirect_url"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+}
+
+// OIDCProviders is read from the environment as a JSON array, for example
+// [{"name":"google","issuer_url":"https://accounts.google.com",...}].
+type OIDCProviders []OIDCProvider
+
+func (p *OIDCProviders) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = nil
+		return nil
+	}
+	var providers []OIDCProvider
+	if err := json.Unmarshal(text, &providers); err != nil {
+		return fmt.Errorf("invalid OIDC providers: %v", err)
+	}
+	for _, provider := range providers {
+		if provider.Name == "" || provider.IssuerURL == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return fmt.Errorf("invalid OIDC provider %q: name, issuer_url, client_id and redirect_url are required", provider.Name)
+		}
+	}
+	*p = providers
+	return nil
+}
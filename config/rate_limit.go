@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RateLimitStore string
+
+const (
+	MemoryRateLimitStore   RateLimitStore = "memory"
+	PostgresRateLimitStore RateLimitStore = "postgres"
+)
+
+type RateLimitKey string
+
+const (
+	IPRateLimitKey     RateLimitKey = "ip"
+	UserRateLimitKey   RateLimitKey = "user"
+	APIKeyRateLimitKey RateLimitKey = "api_key"
+)
+
+// RateLimitPolicy is written as "<limit>/<window>@<key>", for example
+// "10/1m@ip". The key defaults to ip. An empty value disables the limit.
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+	Key    RateLimitKey
+}
+
+func (p *RateLimitPolicy) Enabled() bool {
+	return p.Limit > 0 && p.Window > 0
+}
+
+func (p *RateLimitPolicy) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if value == "" {
+		*p = RateLimitPolicy{}
+		return nil
+	}
+
+	key := IPRateLimitKey
+	if rate, k, found := strings.Cut(value, "@"); found {
+		value = rate
+		key = RateLimitKey(k)
+	}
+	switch key {
+	case IPRateLimitKey, UserRateLimitKey, APIKeyRateLimitKey:
+	default:
+		return fmt.Errorf("invalid rate limit key %q (allowed: ip, user, api_key)", key)
+	}
+
+	limitValue, windowValue, found := strings.Cut(value, "/")
+	if !found {
+		return fmt.Errorf("invalid rate limit policy %q (expected <limit>/<window>@<key>)", value)
+	}
+	limit, err := strconv.Atoi(limitValue)
+	if err != nil || limit <= 0 {
+		return fmt.Errorf("invalid rate limit %q", limitValue)
+	}
+	window, err := time.ParseDuration(windowValue)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid rate limit window %q", windowValue)
+	}
+
+	*p = RateLimitPolicy{Limit: limit, Window: window, Key: key}
+	return nil
+}
+
+func (p RateLimitPolicy) String() string {
+	if !p.Enabled() {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s@%s", p.Limit, p.Window, p.Key)
+}
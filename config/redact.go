@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redactedSecret replaces the values of fields tagged secret:"true".
+const redactedSecret = "[REDACTED]"
+
+// Redacted returns the effective configuration keyed by environment
+// variable, safe to print or serve: secrets are replaced with [REDACTED]
+// unless they are empty.
+func (cfg *Config) Redacted() map[string]any {
+	return redactStruct(reflect.ValueOf(cfg).Elem())
+}
+
+func redactStruct(value reflect.Value) map[string]any {
+	out := make(map[string]any, value.NumField())
+	for i := range value.NumField() {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Tag.Get("secret") == "true" {
+			if value.Field(i).IsZero() {
+				out[redactedName(field)] = ""
+			} else {
+				out[redactedName(field)] = redactedSecret
+			}
+			continue
+		}
+		out[redactedName(field)] = redactValue(value.Field(i))
+	}
+	return out
+}
+
+func redactValue(value reflect.Value) any {
+	if stringer, ok := value.Interface().(fmt.Stringer); ok && (value.Kind() == reflect.Struct || value.Kind() == reflect.Map) {
+		return stringer.String()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return redactStruct(value)
+	case reflect.Slice:
+		if value.IsNil() {
+			return []any{}
+		}
+		out := make([]any, value.Len())
+		for i := range value.Len() {
+			out[i] = redactValue(value.Index(i))
+		}
+		return out
+	default:
+		return value.Interface()
+	}
+}
+
+// redactedName names top level fields by their environment variable and
+// nested ones, such as OIDC providers, by their JSON key.
+func redactedName(field reflect.StructField) string {
+	for _, tag := range []string{"env", "json"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
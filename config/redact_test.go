@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	cfg := &Config{
+		JWTSecret:  "jwt-secret-value",
+		DBUsername: "marketplace",
+		DBPassword: "db-password-value",
+		OIDCProviders: OIDCProviders{
+			{Name: "google", ClientID: "client-id", ClientSecret: "client-secret-value"},
+		},
+		RateLimitAuth: RateLimitPolicy{Limit: 20, Window: time.Minute, Key: IPRateLimitKey},
+	}
+
+	redacted := cfg.Redacted()
+	body, err := json.Marshal(redacted)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, secret := range []string{"jwt-secret-value", "db-password-value", "client-secret-value"} {
+		if strings.Contains(string(body), secret) {
+			t.Errorf("redacted config leaks %q: %s", secret, body)
+		}
+	}
+
+	if got := redacted["JWT_SECRET"]; got != redactedSecret {
+		t.Errorf("JWT_SECRET = %v, want %s", got, redactedSecret)
+	}
+	if got := redacted["SMTP_PASSWORD"]; got != "" {
+		t.Errorf("SMTP_PASSWORD = %v, want empty for an unset secret", got)
+	}
+	if got := redacted["DB_USERNAME"]; got != "marketplace" {
+		t.Errorf("DB_USERNAME = %v, want marketplace", got)
+	}
+	if got := redacted["RATE_LIMIT_AUTH"]; got != "20/1m0s@ip" {
+		t.Errorf("RATE_LIMIT_AUTH = %v, want 20/1m0s@ip", got)
+	}
+	providers := redacted["OIDC_PROVIDERS"].([]any)
+	if provider := providers[0].(map[string]any); provider["client_id"] != "client-id" || provider["client_secret"] != redactedSecret {
+		t.Errorf("OIDC provider = %v, want client_id kept and client_secret redacted", provider)
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("env")
+	})
+	return v
+}
+
+// Validate checks the required fields and the ranges of cfg and reports
+// every invalid field, named by its env var.
+func (cfg *Config) Validate() error {
+	var errs []error
+	var validationErrors validator.ValidationErrors
+	if err := validate.Struct(cfg); errors.As(err, &validationErrors) {
+		for _, fieldErr := range validationErrors {
+			errs = append(errs, errors.New(fieldErr.Field()+" "+validationMessage(fieldErr)))
+		}
+	} else if err != nil {
+		return err
+	}
+	// The log and file drivers keep mail, and with it reset and
+	// verification tokens, on the server instead of delivering it.
+	if cfg.AppEnv == Prod && cfg.MailDriver != SMTPMailDriver {
+		errs = append(errs, errors.New("MAIL_DRIVER must be smtp when APP_ENV is prod"))
+	}
+	return errors.Join(errs...)
+}
+
+func validationMessage(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "required_if":
+		condition := strings.Fields(err.Param())
+		if field, ok := reflect.TypeOf(Config{}).FieldByName(condition[0]); ok && len(condition) == 2 {
+			return fmt.Sprintf("is required when %s is %s", field.Tag.Get("env"), condition[1])
+		}
+		return "is required"
+	case "min":
+		if err.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", err.Param())
+		}
+		return "must be at least " + err.Param()
+	case "gte":
+		return "must be at least " + err.Param()
+	case "max", "lte":
+		return "must be at most " + err.Param()
+	case "ltefield":
+		if field, ok := reflect.TypeOf(Config{}).FieldByName(err.Param()); ok {
+			return "must not be greater than " + field.Tag.Get("env")
+		}
+		return "must not be greater than " + err.Param()
+	case "gtfield":
+		if field, ok := reflect.TypeOf(Config{}).FieldByName(err.Param()); ok {
+			return "must be greater than " + field.Tag.Get("env")
+		}
+		return "must be greater than " + err.Param()
+	case "ltfield":
+		if field, ok := reflect.TypeOf(Config{}).FieldByName(err.Param()); ok {
+			return "must be less than " + field.Tag.Get("env")
+		}
+		return "must be less than " + err.Param()
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(err.Param()), ", ")
+	case "url":
+		return "must be a valid URL"
+	default:
+		return fmt.Sprintf("is invalid (%s)", err.Tag())
+	}
+}
@@ -0,0 +1,16 @@
+// Package backoff computes retry delays shared by the relays, the job queue
+// and the database connection code.
+package backoff
+
+import "time"
+
+// Exponential returns the delay before the next attempt after attempts
+// failed ones: base doubled for every failure after the first, capped at
+// maxDelay.
+func Exponential(attempts int, base, maxDelay time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
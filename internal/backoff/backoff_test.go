@@ -0,0 +1,30 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := Exponential(i+1, time.Second, 10*time.Second); got != w {
+			t.Errorf("Exponential(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestExponentialWithUnevenCap(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1: 5 * time.Second,
+		2: 10 * time.Second,
+		3: 20 * time.Second,
+		4: 40 * time.Second,
+		5: time.Minute,
+		9: time.Minute,
+	} {
+		if got := Exponential(attempts, 5*time.Second, time.Minute); got != want {
+			t.Errorf("Exponential(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
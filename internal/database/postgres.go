@@ -2,18 +2,63 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"marketplace/config"
+	"marketplace/internal/backoff"
+	"marketplace/internal/tracing"
 )
 
 type PostgresDatabase struct {
 	Pool *pgxpool.Pool
+
+	txMaxAttempts int
 }
 
-func New(DBURL string) *PostgresDatabase {
-	pool, err := pgxpool.New(context.Background(), DBURL)
+// New opens the pool and pings the database until it answers, waiting
+// between attempts with exponential backoff, so the app can start before
+// the database is ready. It gives up after DB_CONNECT_MAX_ATTEMPTS.
+func New(ctx context.Context, cfg *config.Config) (*PostgresDatabase, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.GetDBURL())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		panic("Failed to connect database")
+		return nil, fmt.Errorf("cannot create database pool: %w", err)
+	}
+
+	retryBase := time.Duration(cfg.DBConnectRetryBaseSeconds) * time.Second
+	retryMax := time.Duration(cfg.DBConnectRetryMaxSeconds) * time.Second
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.DBConnectTimeoutSeconds)*time.Second)
+		err = pool.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.DBConnectMaxAttempts {
+			pool.Close()
+			return nil, fmt.Errorf("database is not reachable after %d attempts: %w", attempt, err)
+		}
+		delay := backoff.Exponential(attempt, retryBase, retryMax)
+		slog.Warn("Database is not ready, retrying",
+			slog.String("op", "database.New"),
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_in", delay),
+			slog.Any("error", err),
+		)
+		select {
+		case <-ctx.Done():
+			pool.Close()
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
 	}
-	return &PostgresDatabase{Pool: pool}
+	return &PostgresDatabase{Pool: pool, txMaxAttempts: cfg.DBTxMaxAttempts}, nil
 }
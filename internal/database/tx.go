@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"marketplace/internal/backoff"
+	"marketplace/internal/logger"
+)
+
+const (
+	txRetryBase = 20 * time.Millisecond
+	txRetryMax  = 500 * time.Millisecond
+)
+
+// WithTx runs fn in a transaction and commits it. When the transaction
+// fails with a transient error, such as a serialization failure, a deadlock
+// or a reset connection, it is rolled back and fn runs again in a new one,
+// up to DB_TX_MAX_ATTEMPTS times. fn must therefore not have effects outside
+// the transaction, and must return the errors of tx unwrapped or wrapped
+// with %w so that they can be told apart.
+//
+// A commit that fails on a broken connection is not retried, as the
+// transaction may have been committed.
+func (db *PostgresDatabase) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return withTx(ctx, db.Pool.Begin, db.txMaxAttempts, fn)
+}
+
+func withTx(
+	ctx context.Context,
+	begin func(ctx context.Context) (pgx.Tx, error),
+	maxAttempts int,
+	fn func(tx pgx.Tx) error,
+) error {
+	for attempt := 1; ; attempt++ {
+		retryable, err := runTx(ctx, begin, fn)
+		if err == nil || !retryable || attempt >= max(maxAttempts, 1) || ctx.Err() != nil {
+			return err
+		}
+		delay := backoff.Exponential(attempt, txRetryBase, txRetryMax)
+		delay = delay/2 + rand.N(delay/2+1)
+		slogger.GetLoggerFromContext(ctx).Debug("Transaction failed with a transient error, retrying",
+			slog.String("op", "database.PostgresDatabase.WithTx"),
+			slog.Int("attempt", attempt),
+			slog.Duration("retry_in", delay),
+			slog.Any("error", err),
+		)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func runTx(
+	ctx context.Context,
+	begin func(ctx context.Context) (pgx.Tx, error),
+	fn func(tx pgx.Tx) error,
+) (retryable bool, err error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return IsTransient(err), err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = fn(tx); err != nil {
+		return IsTransient(err), err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return isRolledBack(err), err
+	}
+	return false, nil
+}
+
+// IsTransient reports whether running the transaction that failed with err
+// again may succeed.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+		// Class 08 is connection exception.
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// isRolledBack reports whether the server rejected the commit, in which case
+// the transaction was rolled back and can safely run again.
+func isRolledBack(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
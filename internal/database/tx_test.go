@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeTx counts the transactions begun and committed. Commit fails with
+// the next error of commitErrs, if any.
+type fakeTx struct {
+	pgx.Tx
+
+	begun      int
+	committed  int
+	commitErrs []error
+}
+
+func (tx *fakeTx) begin(context.Context) (pgx.Tx, error) {
+	tx.begun++
+	return tx, nil
+}
+
+func (tx *fakeTx) Commit(context.Context) error {
+	if len(tx.commitErrs) > 0 {
+		err := tx.commitErrs[0]
+		tx.commitErrs = tx.commitErrs[1:]
+		return err
+	}
+	tx.committed++
+	return nil
+}
+
+func (tx *fakeTx) Rollback(context.Context) error {
+	return nil
+}
+
+func TestWithTxRetriesTransientErrors(t *testing.T) {
+	tx := &fakeTx{}
+	calls := 0
+	err := withTx(context.Background(), tx.begin, 3, func(pgx.Tx) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("update: %w", &pgconn.PgError{Code: "40001"})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withTx() error = %v", err)
+	}
+	if calls != 2 || tx.begun != 2 || tx.committed != 1 {
+		t.Errorf("fn ran %d times in %d transactions with %d commits, want 2, 2 and 1", calls, tx.begun, tx.committed)
+	}
+}
+
+func TestWithTxStopsAfterMaxAttempts(t *testing.T) {
+	tx := &fakeTx{}
+	calls := 0
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	err := withTx(context.Background(), tx.begin, 3, func(pgx.Tx) error {
+		calls++
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) {
+		t.Errorf("withTx() error = %v, want %v", err, deadlock)
+	}
+	if calls != 3 || tx.committed != 0 {
+		t.Errorf("fn ran %d times with %d commits, want 3 and 0", calls, tx.committed)
+	}
+}
+
+func TestWithTxDoesNotRetryOtherErrors(t *testing.T) {
+	tx := &fakeTx{}
+	calls := 0
+	violation := &pgconn.PgError{Code: "23505"}
+	err := withTx(context.Background(), tx.begin, 3, func(pgx.Tx) error {
+		calls++
+		return violation
+	})
+	if !errors.Is(err, violation) || calls != 1 {
+		t.Errorf("withTx() error = %v after %d calls, want %v after 1", err, calls, violation)
+	}
+}
+
+func TestWithTxRetriesRejectedCommit(t *testing.T) {
+	tx := &fakeTx{commitErrs: []error{&pgconn.PgError{Code: "40001"}}}
+	calls := 0
+	err := withTx(context.Background(), tx.begin, 3, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 2 || tx.committed != 1 {
+		t.Errorf("withTx() error = %v after %d calls and %d commits, want nil after 2 and 1", err, calls, tx.committed)
+	}
+}
+
+func TestWithTxDoesNotRetryCommitOnBrokenConnection(t *testing.T) {
+	reset := fmt.Errorf("commit: %w", syscall.ECONNRESET)
+	tx := &fakeTx{commitErrs: []error{reset}}
+	calls := 0
+	err := withTx(context.Background(), tx.begin, 3, func(pgx.Tx) error {
+		calls++
+		return nil
+	})
+	// The commit may have reached the server, running fn again could
+	// apply it twice.
+	if !errors.Is(err, syscall.ECONNRESET) || calls != 1 {
+		t.Errorf("withTx() error = %v after %d calls, want %v after 1", err, calls, reset)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"statement timeout", &pgconn.PgError{Code: "57014"}, false},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("boom"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRolledBack(t *testing.T) {
+	if !isRolledBack(&pgconn.PgError{Code: "40001"}) {
+		t.Error("a serialization failure on commit is not retried")
+	}
+	if isRolledBack(fmt.Errorf("commit: %w", syscall.ECONNRESET)) {
+		t.Error("a commit on a reset connection is retried, it may have been committed")
+	}
+}
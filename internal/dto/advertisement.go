@@ -3,6 +3,7 @@ package dto
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
@@ -11,15 +12,30 @@ type AdvertisementCreateRequest struct {
 	Content  string          `json:"content" binding:"required,min=1,max=5000"`
 	ImageURL string          `json:"image_url" binding:"required,url"`
 	Price    decimal.Decimal `json:"price" binding:"required"`
+	// PublishAt schedules the advertisement for later. It is published
+	// right away when empty or in the past.
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type AdvertisementUpdateRequest struct {
+	Title    *string          `json:"title" binding:"omitempty,min=1,max=100"`
+	Content  *string          `json:"content" binding:"omitempty,min=1,max=5000"`
+	ImageURL *string          `json:"image_url" binding:"omitempty,url"`
+	Price    *decimal.Decimal `json:"price"`
+	// PublishAt reschedules an advertisement that is not published yet.
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type AdvertisementResponse struct {
+	ID          uuid.UUID       `json:"id"`
 	Title       string          `json:"title"`
 	Content     string          `json:"content"`
 	ImageURL    string          `json:"image_url"`
 	Price       decimal.Decimal `json:"price"`
 	AuthorLogin string          `json:"author_login"`
 	CreatedAt   time.Time       `json:"created_at"`
+	PublishAt   time.Time       `json:"publish_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
 }
 
 type AdvertisementResponseWithOwnership struct {
@@ -28,10 +44,26 @@ type AdvertisementResponseWithOwnership struct {
 }
 
 type AdvertisementFilters struct {
-	PageNumber int              `form:"page_number" binding:"required,gte=1"`
-	PageSize   int              `form:"page_size" binding:"required,gte=1,lte=100"`
-	MinPrice   *decimal.Decimal `form:"min_price"`
-	MaxPrice   *decimal.Decimal `form:"max_price"`
-	SortType   *string          `form:"sort_type" binding:"omitempty,oneof=price created_at"`
-	SortOrder  *string          `form:"sort_order" binding:"omitempty,oneof=asc desc"`
+	MinPrice  *decimal.Decimal `form:"min_price"`
+	MaxPrice  *decimal.Decimal `form:"max_price"`
+	SortType  *string          `form:"sort_type" binding:"omitempty,oneof=price created_at"`
+	SortOrder *string          `form:"sort_order" binding:"omitempty,oneof=asc desc"`
+}
+
+type AdvertisementPageFilters struct {
+	PageNumber int `form:"page_number" binding:"required,gte=1"`
+	PageSize   int `form:"page_size" binding:"required,gte=1,lte=100"`
+	AdvertisementFilters
+}
+
+type AdvertisementExportRow struct {
+	ID          uuid.UUID       `json:"id" xml:"id"`
+	ExternalID  *string         `json:"external_id" xml:"external_id,omitempty"`
+	Title       string          `json:"title" xml:"title"`
+	Content     string          `json:"content" xml:"description"`
+	ImageURL    string          `json:"image_url" xml:"image_link"`
+	Price       decimal.Decimal `json:"price" xml:"price"`
+	AuthorLogin string          `json:"author_login" xml:"seller"`
+	CreatedAt   time.Time       `json:"created_at" xml:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at" xml:"updated_at"`
 }
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdvertisementImportRow is a single CSV or NDJSON row of an import. Rows
+// are validated with the same rules as AdvertisementCreateRequest.
+type AdvertisementImportRow struct {
+	AdvertisementCreateRequest
+	ExternalID string `json:"external_id" binding:"omitempty,max=128"`
+	Line       int    `json:"-"`
+}
+
+// ImportRowReader reads the rows of an import file one at a time, so the
+// file does not have to be held in memory. Read returns either a valid row
+// or the error of a row that cannot be imported, and io.EOF after the last
+// row. Any other error means the rest of the file is unreadable.
+type ImportRowReader interface {
+	Read() (*AdvertisementImportRow, *ImportRowError, error)
+}
+
+type ImportRowError struct {
+	Line       int    `json:"line"`
+	ExternalID string `json:"external_id,omitempty"`
+	Error      string `json:"error"`
+}
+
+type ImportJobResponse struct {
+	ID           uuid.UUID        `json:"id"`
+	Format       string           `json:"format"`
+	Status       string           `json:"status"`
+	TotalRows    int              `json:"total_rows"`
+	ImportedRows int              `json:"imported_rows"`
+	SkippedRows  int              `json:"skipped_rows"`
+	FailedRows   int              `json:"failed_rows"`
+	Errors       []ImportRowError `json:"errors"`
+	CreatedAt    time.Time        `json:"created_at"`
+	StartedAt    *time.Time       `json:"started_at,omitempty"`
+	FinishedAt   *time.Time       `json:"finished_at,omitempty"`
+}
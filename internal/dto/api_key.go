@@ -0,0 +1,28 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type APIKeyCreateRequest struct {
+	Name      string     `json:"name" binding:"required,min=1,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=ads:read ads:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type APIKeyCreatedResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
@@ -0,0 +1,19 @@
+package dto
+
+type LivenessResponse struct {
+	Status string `json:"status"`
+}
+
+type ReadinessResponse struct {
+	// Status is ok when every component is, failing when one is not, and
+	// draining while the server shuts down.
+	Status     string                    `json:"status"`
+	Components []ComponentHealthResponse `json:"components"`
+}
+
+// ComponentHealthResponse leaves out why a component fails, as readiness is
+// public; the handler logs it instead.
+type ComponentHealthResponse struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
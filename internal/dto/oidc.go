@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+type OIDCCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+	// Binding comes from the cookie set when the login was started.
+	Binding string `form:"-"`
+}
+
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	// Binding ties the login to the browser that started it and is sent as a
+	// cookie rather than in the body.
+	Binding string `json:"-"`
+}
+
+type OIDCProviderResponse struct {
+	Name string `json:"name"`
+}
+
+type UserIdentityResponse struct {
+	Provider  string    `json:"provider"`
+	Email     *string   `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
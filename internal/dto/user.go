@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type LoginUserRequest struct {
@@ -12,16 +13,93 @@ type LoginUserRequest struct {
 }
 
 type UserCreateRequest struct {
-	Login    string `json:"login" binding:"required,min=3,max=32,alphanum"`
-	Password string `json:"password" binding:"required,min=8,max=64"`
+	Login    string  `json:"login" binding:"required,min=3,max=32,alphanum"`
+	Password string  `json:"password" binding:"required,min=8,max=64"`
+	Email    *string `json:"email" binding:"omitempty,email,max=254"`
 }
 
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Login     string    `json:"login"`
-	CreatedAt time.Time `json:"created_at"`
+	ID               uuid.UUID `json:"id"`
+	Login            string    `json:"login"`
+	Email            *string   `json:"email,omitempty"`
+	EmailVerified    bool      `json:"email_verified"`
+	Role             string    `json:"role"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+type UserProfileResponse struct {
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+	// Rating is null until the seller has been rated.
+	Rating                    *decimal.Decimal `json:"rating" extensions:"x-nullable"`
+	ActiveAdvertisementsCount int              `json:"active_advertisements_count"`
+	CreatedAt                 time.Time        `json:"created_at"`
+}
+
+type UserProfileUpdateRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=64"`
+	Bio         *string `json:"bio" binding:"omitempty,max=1000"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,url"`
+}
+
+type PasswordChangeRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8,max=64"`
+}
+
+type PasswordForgotRequest struct {
+	Login string `json:"login" binding:"required"`
+}
+
+type PasswordResetRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8,max=64"`
+}
+
+// AuthenticatedUser is set by the auth middlewares. Users authenticated
+// with an API key have APIKeyID set and are limited to Scopes.
+type AuthenticatedUser struct {
+	UserID            uuid.UUID
+	Login             string
+	Role              string
+	SessionID         uuid.UUID
+	TwoFactorVerified bool
+	APIKeyID          *uuid.UUID
+	Scopes            []string
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorConfirmRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type EmailVerifyRequest struct {
+	Token string `json:"token" binding:"required"`
 }
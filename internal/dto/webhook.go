@@ -0,0 +1,62 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookCreateRequest struct {
+	URL         string   `json:"url" binding:"required,url,max=2048"`
+	EventTypes  []string `json:"event_types" binding:"required,min=1,dive,oneof=advertisement.created advertisement.updated order.paid user.registered"`
+	Description string   `json:"description" binding:"max=255"`
+}
+
+type WebhookUpdateRequest struct {
+	URL         *string  `json:"url" binding:"omitempty,url,max=2048"`
+	EventTypes  []string `json:"event_types" binding:"omitempty,min=1,dive,oneof=advertisement.created advertisement.updated order.paid user.registered"`
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	// Enabled re-enables an endpoint disabled after repeated failures, or
+	// pauses deliveries when false.
+	Enabled *bool `json:"enabled"`
+}
+
+type WebhookResponse struct {
+	ID                  uuid.UUID  `json:"id"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Description         string     `json:"description"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type WebhookCreatedResponse struct {
+	WebhookResponse
+	// Secret signs deliveries, see the X-Webhook-Signature header. It is
+	// shown only once.
+	Secret string `json:"secret"`
+}
+
+type WebhookDeliveryFilters struct {
+	PageNumber int `form:"page_number" binding:"required,gte=1"`
+	PageSize   int `form:"page_size" binding:"required,gte=1,lte=100"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	ResponseBody   *string         `json:"response_body"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
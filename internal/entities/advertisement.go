@@ -14,7 +14,21 @@ type Advertisement struct {
 	ImageURL    string          `db:"image_url"`
 	Price       decimal.Decimal `db:"price"`
 	UserID      uuid.UUID       `db:"user_id"`
+	ExternalID  *string         `db:"external_id"`
 	AuthorLogin string          `db:"author_login"`
 	CreatedAt   time.Time       `db:"created_at"`
 	UpdatedAt   time.Time       `db:"updated_at"`
+	ExpiresAt   time.Time       `db:"expires_at"`
+	ArchivedAt  *time.Time      `db:"archived_at"`
+	// PublishAt is when the advertisement becomes visible in listings.
+	// PublishedAt stays nil while it is scheduled for later.
+	PublishAt   time.Time  `db:"publish_at"`
+	PublishedAt *time.Time `db:"published_at"`
+}
+
+// ExpiringAdvertisement is an advertisement whose owner is due an expiry
+// reminder, together with the verified address to send it to.
+type ExpiringAdvertisement struct {
+	Advertisement
+	Email string `db:"email"`
 }
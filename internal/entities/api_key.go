@@ -0,0 +1,25 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type APIKey struct {
+	ID         uuid.UUID  `db:"id"`
+	UserID     uuid.UUID  `db:"user_id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash"`
+	Scopes     []string   `db:"scopes"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+const (
+	AdvertisementsReadScope  = "ads:read"
+	AdvertisementsWriteScope = "ads:write"
+)
@@ -0,0 +1,44 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ImportJobStatus string
+
+const (
+	ImportJobPending   ImportJobStatus = "pending"
+	ImportJobRunning   ImportJobStatus = "running"
+	ImportJobCompleted ImportJobStatus = "completed"
+	ImportJobFailed    ImportJobStatus = "failed"
+)
+
+type ImportFormat string
+
+const (
+	CSVImportFormat    ImportFormat = "csv"
+	NDJSONImportFormat ImportFormat = "ndjson"
+)
+
+type ImportRowError struct {
+	Line       int    `json:"line"`
+	ExternalID string `json:"external_id,omitempty"`
+	Error      string `json:"error"`
+}
+
+type ImportJob struct {
+	ID           uuid.UUID        `db:"id"`
+	UserID       uuid.UUID        `db:"user_id"`
+	Format       ImportFormat     `db:"format"`
+	Status       ImportJobStatus  `db:"status"`
+	TotalRows    int              `db:"total_rows"`
+	ImportedRows int              `db:"imported_rows"`
+	SkippedRows  int              `db:"skipped_rows"`
+	FailedRows   int              `db:"failed_rows"`
+	Errors       []ImportRowError `db:"errors"`
+	CreatedAt    time.Time        `db:"created_at"`
+	StartedAt    *time.Time       `db:"started_at"`
+	FinishedAt   *time.Time       `db:"finished_at"`
+}
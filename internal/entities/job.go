@@ -0,0 +1,34 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a unit of background work stored in the jobs table and executed by
+// the handler registered for its kind.
+type Job struct {
+	ID          uuid.UUID       `db:"id"`
+	Kind        string          `db:"kind"`
+	Payload     json.RawMessage `db:"payload"`
+	Status      JobStatus       `db:"status"`
+	UniqueKey   *string         `db:"unique_key"`
+	Attempts    int             `db:"attempts"`
+	MaxAttempts int             `db:"max_attempts"`
+	RunAt       time.Time       `db:"run_at"`
+	LockedUntil *time.Time      `db:"locked_until"`
+	LastError   *string         `db:"last_error"`
+	CreatedAt   time.Time       `db:"created_at"`
+	FinishedAt  *time.Time      `db:"finished_at"`
+}
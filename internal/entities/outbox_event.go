@@ -0,0 +1,64 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	UserAggregate          = "user"
+	AdvertisementAggregate = "advertisement"
+)
+
+const (
+	UserRegisteredEvent = "user.registered"
+	// AdvertisementCreatedEvent is recorded when an advertisement is
+	// published, which is later than its creation for scheduled ones.
+	AdvertisementCreatedEvent = "advertisement.created"
+	AdvertisementUpdatedEvent = "advertisement.updated"
+	// OrderPaidEvent can already be subscribed to by webhooks, nothing
+	// produces it until orders exist.
+	OrderPaidEvent = "order.paid"
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the change
+// it describes and delivered to sinks by the outbox relay.
+type OutboxEvent struct {
+	ID             int64           `db:"id"`
+	EventID        uuid.UUID       `db:"event_id"`
+	AggregateType  string          `db:"aggregate_type"`
+	AggregateID    uuid.UUID       `db:"aggregate_id"`
+	EventType      string          `db:"event_type"`
+	Payload        json.RawMessage `db:"payload"`
+	CreatedAt      time.Time       `db:"created_at"`
+	Attempts       int             `db:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at"`
+	LastError      *string         `db:"last_error"`
+	DeliveredAt    *time.Time      `db:"delivered_at"`
+	DeadLetteredAt *time.Time      `db:"dead_lettered_at"`
+}
+
+type UserRegisteredPayload struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Login     string    `json:"login"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AdvertisementCreatedPayload struct {
+	AdvertisementID uuid.UUID       `json:"advertisement_id"`
+	UserID          uuid.UUID       `json:"user_id"`
+	Title           string          `json:"title"`
+	Price           decimal.Decimal `json:"price"`
+	CreatedAt       time.Time       `json:"created_at"`
+}
+
+type AdvertisementUpdatedPayload struct {
+	AdvertisementID uuid.UUID       `json:"advertisement_id"`
+	UserID          uuid.UUID       `json:"user_id"`
+	Title           string          `json:"title"`
+	Price           decimal.Decimal `json:"price"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
@@ -4,11 +4,30 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
 )
 
 type User struct {
-	ID        uuid.UUID `db:"id"`
-	Login     string    `db:"login"`
-	Password  string    `db:"password"`
-	CreatedAt time.Time `db:"created_at"`
+	ID              uuid.UUID        `db:"id"`
+	Login           string           `db:"login"`
+	Password        string           `db:"password"`
+	Email           *string          `db:"email"`
+	EmailVerifiedAt *time.Time       `db:"email_verified_at"`
+	Role            Role             `db:"role"`
+	TOTPSecret      *string          `db:"totp_secret"`
+	TOTPEnabledAt   *time.Time       `db:"totp_enabled_at"`
+	TOTPLastStep    int64            `db:"totp_last_step"`
+	DisplayName     string           `db:"display_name"`
+	Bio             string           `db:"bio"`
+	AvatarURL       string           `db:"avatar_url"`
+	Rating          *decimal.Decimal `db:"rating"`
+	CreatedAt       time.Time        `db:"created_at"`
+	UpdatedAt       time.Time        `db:"updated_at"`
 }
+
+type Role string
+
+const (
+	UserRole  Role = "user"
+	AdminRole Role = "admin"
+)
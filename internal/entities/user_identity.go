@@ -0,0 +1,27 @@
+package entities
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserIdentity struct {
+	ID        uuid.UUID `db:"id"`
+	UserID    uuid.UUID `db:"user_id"`
+	Provider  string    `db:"provider"`
+	Subject   string    `db:"subject"`
+	Email     *string   `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type OIDCState struct {
+	StateHash    string     `db:"state_hash"`
+	BindingHash  string     `db:"binding_hash"`
+	Provider     string     `db:"provider"`
+	CodeVerifier string     `db:"code_verifier"`
+	Nonce        string     `db:"nonce"`
+	LinkUserID   *uuid.UUID `db:"link_user_id"`
+	CreatedAt    time.Time  `db:"created_at"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+}
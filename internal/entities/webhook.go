@@ -0,0 +1,56 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookEventTypes lists event types webhooks can subscribe to. Types
+// mapped to true are visible to admins only.
+var WebhookEventTypes = map[string]bool{
+	AdvertisementCreatedEvent: false,
+	AdvertisementUpdatedEvent: false,
+	OrderPaidEvent:            false,
+	UserRegisteredEvent:       true,
+}
+
+type WebhookEndpoint struct {
+	ID                  uuid.UUID  `db:"id"`
+	UserID              uuid.UUID  `db:"user_id"`
+	URL                 string     `db:"url"`
+	Secret              string     `db:"secret"`
+	EventTypes          []string   `db:"event_types"`
+	Description         string     `db:"description"`
+	ConsecutiveFailures int        `db:"consecutive_failures"`
+	DisabledAt          *time.Time `db:"disabled_at"`
+	CreatedAt           time.Time  `db:"created_at"`
+	UpdatedAt           time.Time  `db:"updated_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	ID             uuid.UUID             `db:"id"`
+	EndpointID     uuid.UUID             `db:"endpoint_id"`
+	EventID        uuid.UUID             `db:"event_id"`
+	EventType      string                `db:"event_type"`
+	Payload        json.RawMessage       `db:"payload"`
+	Status         WebhookDeliveryStatus `db:"status"`
+	Attempts       int                   `db:"attempts"`
+	NextAttemptAt  time.Time             `db:"next_attempt_at"`
+	ResponseStatus *int                  `db:"response_status"`
+	ResponseBody   *string               `db:"response_body"`
+	LastError      *string               `db:"last_error"`
+	CreatedAt      time.Time             `db:"created_at"`
+	DeliveredAt    *time.Time            `db:"delivered_at"`
+	// Endpoint is set on deliveries claimed for sending.
+	Endpoint *WebhookEndpoint `db:"-"`
+}
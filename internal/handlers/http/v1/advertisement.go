@@ -20,31 +20,33 @@ func NewAdvertisementHTTPHandlers(advertisementService services.AdvertisementSer
 
 // CreateAdvertisement godoc
 // @Summary Create a new advertisement
-// @Description Create an advertisement with title, content, image URL and price
+// @Description Create an advertisement with title, content, image URL and price.
+// @Description With a future publish_at it stays hidden from listings until then
 // @Tags advertisements
 // @Accept json
 // @Produce json
 // @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param advertisement body dto.AdvertisementCreateRequest true "Advertisement data"
 // @Success 200 {object} dto.AdvertisementResponse
-// @Failure 400 {object} ErrorResponse "Invalid request body or negative price"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} Problem "Invalid request body or negative price"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/v1/advertisements [post]
 func (h *AdvertisementHTTPHandlers) CreateAdvertisement(c *gin.Context) {
 	var advertisement dto.AdvertisementCreateRequest
 	if err := c.ShouldBindJSON(&advertisement); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		abortWithError(c, invalidRequest(err))
 		return
 	}
 	if advertisement.Price.IsNegative() {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: "Price cannot be negative"})
+		abortWithError(c, errNegativePrice)
 		return
 	}
 
 	id := c.MustGet("UserID").(uuid.UUID)
 	createdAdvertisement, err := h.advertisementService.CreateAdvertisement(c, &advertisement, id)
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		abortWithError(c, err)
 		return
 	}
 	c.IndentedJSON(http.StatusOK, createdAdvertisement)
@@ -55,33 +57,131 @@ func (h *AdvertisementHTTPHandlers) CreateAdvertisement(c *gin.Context) {
 // @Description Get list of advertisements with optional filters by price and category
 // @Tags advertisements
 // @Produce json
-// @Param filters query dto.AdvertisementFilters true "Filters for advertisements"
+// @Param filters query dto.AdvertisementPageFilters true "Filters for advertisements"
 // @Param Authorization header string false "Bearer token"
 // @Success 200 {array} dto.AdvertisementResponseWithOwnership
-// @Failure 400 {object} ErrorResponse "Invalid query parameters or negative price"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} Problem "Invalid query parameters or negative price"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/v1/advertisements [get]
 func (h *AdvertisementHTTPHandlers) GetAdvertisements(c *gin.Context) {
-	var filters dto.AdvertisementFilters
-	if err := c.ShouldBindQuery(&filters); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	filters, ok := bindAdvertisementFilters(c)
+	if !ok {
 		return
 	}
-	if filters.MaxPrice != nil && filters.MaxPrice.IsNegative() {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: "Max price cannot be negative"})
+
+	advertisements, err := h.advertisementService.GetAdvertisements(c, filters)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
-	if filters.MinPrice != nil && filters.MinPrice.IsNegative() {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: "Min price cannot be negative"})
+	respondWithAdvertisements(c, advertisements)
+}
+
+// UpdateAdvertisement godoc
+// @Summary Update an advertisement
+// @Description Change the given fields of an advertisement of the currently authenticated user.
+// @Description publish_at can only be changed while the advertisement is scheduled
+// @Tags advertisements
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Advertisement ID"
+// @Param advertisement body dto.AdvertisementUpdateRequest true "Advertisement changes"
+// @Success 200 {object} dto.AdvertisementResponse
+// @Failure 400 {object} Problem "Invalid advertisement ID, request body or negative price"
+// @Failure 404 {object} Problem "Advertisement not found"
+// @Failure 409 {object} Problem "Advertisement is already published and cannot be rescheduled"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/advertisements/{id} [patch]
+func (h *AdvertisementHTTPHandlers) UpdateAdvertisement(c *gin.Context) {
+	advertisementID, ok := parseAdvertisementID(c)
+	if !ok {
+		return
+	}
+	var advertisementData dto.AdvertisementUpdateRequest
+	if err := c.ShouldBindJSON(&advertisementData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	if advertisementData.Price != nil && advertisementData.Price.IsNegative() {
+		abortWithError(c, errNegativePrice)
 		return
 	}
 
-	advertisements, err := h.advertisementService.GetAdvertisements(c, &filters)
+	id := c.MustGet("UserID").(uuid.UUID)
+	advertisement, err := h.advertisementService.UpdateAdvertisement(c, id, advertisementID, &advertisementData)
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		abortWithError(c, err)
 		return
 	}
+	c.IndentedJSON(http.StatusOK, advertisement)
+}
+
+// RenewAdvertisement godoc
+// @Summary Renew an advertisement
+// @Description Start a new lifetime for an advertisement of the currently authenticated user.
+// @Description Expired and archived advertisements are listed again after renewal
+// @Tags advertisements
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Advertisement ID"
+// @Success 200 {object} dto.AdvertisementResponse
+// @Failure 400 {object} Problem "Invalid advertisement ID"
+// @Failure 404 {object} Problem "Advertisement not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/advertisements/{id}/renew [post]
+func (h *AdvertisementHTTPHandlers) RenewAdvertisement(c *gin.Context) {
+	advertisementID, ok := parseAdvertisementID(c)
+	if !ok {
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	advertisement, err := h.advertisementService.RenewAdvertisement(c, id, advertisementID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, advertisement)
+}
+
+var errNegativePrice = invalidField("price", "gte", "must not be negative")
+
+func parseAdvertisementID(c *gin.Context) (uuid.UUID, bool) {
+	advertisementID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abortWithError(c, invalidField("id", "uuid", "must be a valid UUID"))
+		return uuid.Nil, false
+	}
+	return advertisementID, true
+}
+
+func bindAdvertisementFilters(c *gin.Context) (*dto.AdvertisementPageFilters, bool) {
+	var filters dto.AdvertisementPageFilters
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return nil, false
+	}
+	if err := validateAdvertisementFilters(&filters.AdvertisementFilters); err != nil {
+		abortWithError(c, err)
+		return nil, false
+	}
+	return &filters, true
+}
+
+func validateAdvertisementFilters(filters *dto.AdvertisementFilters) error {
+	if filters.MaxPrice != nil && filters.MaxPrice.IsNegative() {
+		return invalidField("max_price", "gte", "must not be negative")
+	}
+	if filters.MinPrice != nil && filters.MinPrice.IsNegative() {
+		return invalidField("min_price", "gte", "must not be negative")
+	}
+	return nil
+}
 
+func respondWithAdvertisements(c *gin.Context, advertisements []*dto.AdvertisementResponse) {
 	login, exists := c.Get("Login")
 	if exists {
 		authorLogin := login.(string)
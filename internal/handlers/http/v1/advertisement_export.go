@@ -0,0 +1,261 @@
+package v1
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+)
+
+// exportFlushInterval is the number of rows after which the export is
+// flushed to the client, so partners start receiving data right away.
+const exportFlushInterval = 500
+
+var exportFormats = []string{"csv", "ndjson", "xml"}
+
+// ExportAdvertisements godoc
+// @Summary Export own advertisements
+// @Description Stream advertisements of the currently authenticated user as CSV, NDJSON or an XML product feed
+// @Tags advertisements
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/xml
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param format query string true "Export format" Enums(csv, ndjson, xml)
+// @Param filters query dto.AdvertisementFilters false "Filters for advertisements"
+// @Success 200 {file} file
+// @Failure 400 {object} Problem "Invalid query parameters or negative price"
+// @Failure 429 {object} Problem "Too many exports are running"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/advertisements/export [get]
+func (h *AdvertisementHTTPHandlers) ExportAdvertisements(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	h.exportAdvertisements(c, &id)
+}
+
+// ExportAllAdvertisements godoc
+// @Summary Export all advertisements
+// @Description Stream all public advertisements as CSV, NDJSON or an XML product feed. Admins only
+// @Tags admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/xml
+// @Security BearerAuth
+// @Param format query string true "Export format" Enums(csv, ndjson, xml)
+// @Param filters query dto.AdvertisementFilters false "Filters for advertisements"
+// @Success 200 {file} file
+// @Failure 400 {object} Problem "Invalid query parameters or negative price"
+// @Failure 403 {object} Problem "Not an admin"
+// @Failure 429 {object} Problem "Too many exports are running"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/admin/advertisements/export [get]
+func (h *AdvertisementHTTPHandlers) ExportAllAdvertisements(c *gin.Context) {
+	h.exportAdvertisements(c, nil)
+}
+
+func (h *AdvertisementHTTPHandlers) exportAdvertisements(c *gin.Context, userID *uuid.UUID) {
+	format := c.Query("format")
+	switch {
+	case format == "":
+		abortWithError(c, invalidField("format", "required", "is required"))
+		return
+	case !slices.Contains(exportFormats, format):
+		abortWithError(c, invalidField("format", "oneof", "must be one of: "+strings.Join(exportFormats, ", ")))
+		return
+	}
+	var filters dto.AdvertisementFilters
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	if err := validateAdvertisementFilters(&filters); err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	encoder := newAdvertisementEncoder(format, c.Writer)
+	started, count := false, 0
+	start := func() error {
+		started = true
+		c.Header("Content-Type", encoder.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="advertisements.%s"`, format))
+		c.Status(http.StatusOK)
+		return encoder.Begin()
+	}
+
+	err := h.advertisementService.ExportAdvertisements(c, userID, &filters, func(row *dto.AdvertisementExportRow) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+		if count++; count%exportFlushInterval == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Once the first row is written the status can no longer change,
+		// so the client sees a truncated file.
+		if !started {
+			abortWithError(c, err)
+		}
+		return
+	}
+	if !started {
+		if err = start(); err != nil {
+			return
+		}
+	}
+	if err = encoder.End(); err != nil {
+		return
+	}
+	c.Writer.Flush()
+}
+
+// advertisementEncoder writes an export. Encode may buffer rows until
+// Flush or End is called.
+type advertisementEncoder interface {
+	ContentType() string
+	Begin() error
+	Encode(row *dto.AdvertisementExportRow) error
+	Flush() error
+	End() error
+}
+
+func newAdvertisementEncoder(format string, w io.Writer) advertisementEncoder {
+	switch format {
+	case "ndjson":
+		return &ndjsonAdvertisementEncoder{encoder: json.NewEncoder(w)}
+	case "xml":
+		return &xmlAdvertisementEncoder{w: w, encoder: xml.NewEncoder(w)}
+	default:
+		return &csvAdvertisementEncoder{writer: csv.NewWriter(w)}
+	}
+}
+
+type csvAdvertisementEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvAdvertisementEncoder) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// Begin writes the columns the import reads, plus some it ignores, so an
+// export can be imported again. Only rows with an external id are matched
+// to existing advertisements; the others are imported as duplicates.
+func (e *csvAdvertisementEncoder) Begin() error {
+	return e.writer.Write([]string{
+		"id", "external_id", "title", "content", "image_url", "price", "author_login", "created_at", "updated_at",
+	})
+}
+
+func (e *csvAdvertisementEncoder) Encode(row *dto.AdvertisementExportRow) error {
+	externalID := ""
+	if row.ExternalID != nil {
+		externalID = *row.ExternalID
+	}
+	return e.writer.Write([]string{
+		row.ID.String(),
+		externalID,
+		row.Title,
+		row.Content,
+		row.ImageURL,
+		row.Price.StringFixed(2),
+		row.AuthorLogin,
+		row.CreatedAt.Format(time.RFC3339),
+		row.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+func (e *csvAdvertisementEncoder) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvAdvertisementEncoder) End() error {
+	return e.Flush()
+}
+
+type ndjsonAdvertisementEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonAdvertisementEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (e *ndjsonAdvertisementEncoder) Begin() error {
+	return nil
+}
+
+func (e *ndjsonAdvertisementEncoder) Encode(row *dto.AdvertisementExportRow) error {
+	return e.encoder.Encode(row)
+}
+
+func (e *ndjsonAdvertisementEncoder) Flush() error {
+	return nil
+}
+
+func (e *ndjsonAdvertisementEncoder) End() error {
+	return nil
+}
+
+type xmlAdvertisementEncoder struct {
+	w       io.Writer
+	encoder *xml.Encoder
+}
+
+var xmlFeedElement = xml.Name{Local: "feed"}
+
+func (e *xmlAdvertisementEncoder) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+func (e *xmlAdvertisementEncoder) Begin() error {
+	if _, err := io.WriteString(e.w, xml.Header); err != nil {
+		return err
+	}
+	e.encoder.Indent("", "  ")
+	return e.encoder.EncodeToken(xml.StartElement{
+		Name: xmlFeedElement,
+		Attr: []xml.Attr{{Name: xml.Name{Local: "generated_at"}, Value: time.Now().UTC().Format(time.RFC3339)}},
+	})
+}
+
+func (e *xmlAdvertisementEncoder) Encode(row *dto.AdvertisementExportRow) error {
+	return e.encoder.EncodeElement(row, xml.StartElement{Name: xml.Name{Local: "item"}})
+}
+
+func (e *xmlAdvertisementEncoder) Flush() error {
+	return e.encoder.Flush()
+}
+
+func (e *xmlAdvertisementEncoder) End() error {
+	if err := e.encoder.EncodeToken(xml.EndElement{Name: xmlFeedElement}); err != nil {
+		return err
+	}
+	if err := e.encoder.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
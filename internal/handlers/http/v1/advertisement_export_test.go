@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/services"
+)
+
+// fakeExportService hands rows to the export and then returns err. Methods
+// the tests do not need panic through the embedded nil interface.
+type fakeExportService struct {
+	services.AdvertisementService
+
+	rows    []*dto.AdvertisementExportRow
+	err     error
+	userID  *uuid.UUID
+	filters *dto.AdvertisementFilters
+}
+
+func (s *fakeExportService) ExportAdvertisements(
+	_ context.Context,
+	userID *uuid.UUID,
+	filters *dto.AdvertisementFilters,
+	fn func(row *dto.AdvertisementExportRow) error,
+) error {
+	s.userID, s.filters = userID, filters
+	for _, row := range s.rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return s.err
+}
+
+func testExportRows() []*dto.AdvertisementExportRow {
+	created := time.Date(2025, time.March, 1, 9, 30, 0, 0, time.UTC)
+	externalID := "bike-1"
+	return []*dto.AdvertisementExportRow{
+		{
+			ID:          uuid.New(),
+			ExternalID:  &externalID,
+			Title:       "Bike",
+			Content:     "Red bike, \"as new\"",
+			ImageURL:    "https://example.com/bike.jpg",
+			Price:       decimal.RequireFromString("120.5"),
+			AuthorLogin: "alice",
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		},
+		{
+			ID:          uuid.New(),
+			Title:       "Lamp & shade",
+			Content:     "Desk lamp",
+			ImageURL:    "https://example.com/lamp.jpg",
+			Price:       decimal.NewFromInt(15),
+			AuthorLogin: "alice",
+			CreatedAt:   created,
+			UpdatedAt:   created,
+		},
+	}
+}
+
+func export(t *testing.T, service *fakeExportService, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	handlers := NewAdvertisementHTTPHandlers(service).(*AdvertisementHTTPHandlers)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorMiddleware())
+	router.GET("/export", handlers.ExportAllAdvertisements)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export?"+query, nil))
+	return rec
+}
+
+func TestExportAdvertisementsCSV(t *testing.T) {
+	service := &fakeExportService{rows: testExportRows()}
+	rec := export(t, service, "format=csv&min_price=10&sort_type=price")
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("status %d with content type %q, want a CSV file", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); disposition != `attachment; filename="advertisements.csv"` {
+		t.Errorf("content disposition = %q", disposition)
+	}
+	if service.userID != nil || service.filters.MinPrice == nil || !service.filters.MinPrice.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("exported for %v with filters %+v, want all users from 10", service.userID, service.filters)
+	}
+
+	// The import reads the export back.
+	rows, err := decodeCSVImport(rec.Body)
+	if err != nil {
+		t.Fatalf("decodeCSVImport() error = %v", err)
+	}
+	valid, rowErrors := readImportRows(t, rows)
+	if len(valid) != 2 || len(rowErrors) != 0 {
+		t.Fatalf("read %d rows and errors %+v, want 2 rows", len(valid), rowErrors)
+	}
+	if valid[0].ExternalID != "bike-1" || valid[0].Content != "Red bike, \"as new\"" || !valid[0].Price.Equal(decimal.RequireFromString("120.50")) {
+		t.Errorf("row = %+v, want the bike", valid[0])
+	}
+	if valid[1].ExternalID != "" || valid[1].Title != "Lamp & shade" {
+		t.Errorf("row = %+v, want the lamp without external id", valid[1])
+	}
+}
+
+func TestExportAdvertisementsNDJSON(t *testing.T) {
+	rows := testExportRows()
+	rec := export(t, &fakeExportService{rows: rows}, "format=ndjson")
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status %d with content type %q, want NDJSON", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var row dto.AdvertisementExportRow
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil || row.ID != rows[1].ID || row.ExternalID != nil {
+		t.Errorf("line = %s, %v, want the lamp", lines[1], err)
+	}
+}
+
+func TestExportAdvertisementsXMLFeed(t *testing.T) {
+	rows := testExportRows()
+	rec := export(t, &fakeExportService{rows: rows}, "format=xml")
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/xml; charset=utf-8" {
+		t.Fatalf("status %d with content type %q, want XML", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var feed struct {
+		XMLName     xml.Name `xml:"feed"`
+		GeneratedAt string   `xml:"generated_at,attr"`
+		Items       []struct {
+			ID         string `xml:"id"`
+			ExternalID string `xml:"external_id"`
+			Title      string `xml:"title"`
+			ImageLink  string `xml:"image_link"`
+			Seller     string `xml:"seller"`
+		} `xml:"item"`
+	}
+	if err := xml.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not valid XML: %v\n%s", err, rec.Body)
+	}
+	if feed.GeneratedAt == "" || len(feed.Items) != 2 {
+		t.Fatalf("feed = %+v, want 2 items and the generation time", feed)
+	}
+	if item := feed.Items[1]; item.ID != rows[1].ID.String() || item.Title != "Lamp & shade" ||
+		item.ImageLink != "https://example.com/lamp.jpg" || item.Seller != "alice" || item.ExternalID != "" {
+		t.Errorf("item = %+v, want the lamp", item)
+	}
+}
+
+func TestExportAdvertisementsWithoutRows(t *testing.T) {
+	rec := export(t, &fakeExportService{}, "format=csv")
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "id,external_id,title") ||
+		strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("status %d with body %q, want only the header", rec.Code, rec.Body)
+	}
+}
+
+func TestExportAdvertisementsRejectsInvalidQuery(t *testing.T) {
+	for _, query := range []string{"", "format=xlsx", "format=csv&sort_order=up"} {
+		service := &fakeExportService{rows: testExportRows()}
+		if rec := export(t, service, query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+		if service.filters != nil {
+			t.Errorf("%q: the export ran", query)
+		}
+	}
+}
+
+func TestExportAdvertisementsReportsErrorBeforeFirstRow(t *testing.T) {
+	rec := export(t, &fakeExportService{err: services.ErrCannotExportAdvertisements}, "format=ndjson")
+
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Disposition") != "" {
+		t.Errorf("status %d with content disposition %q, want a problem response",
+			rec.Code, rec.Header().Get("Content-Disposition"))
+	}
+}
@@ -0,0 +1,331 @@
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/services"
+)
+
+const maxImportLineBytes = 1 << 20
+
+// maxImportPrice is the largest value that fits into numeric(11, 2).
+var maxImportPrice = decimal.RequireFromString("999999999.99")
+
+var errUnknownImportFormat = badRequest("unknown_import_format", "Unknown import format, use csv or ndjson")
+
+type AdvertisementImportHTTPHandlers struct {
+	advertisementImportService services.AdvertisementImportService
+	maxBytes                   int64
+}
+
+func NewAdvertisementImportHTTPHandlers(
+	advertisementImportService services.AdvertisementImportService,
+	maxBytes int64,
+) AdvertisementImportHandlers {
+	return &AdvertisementImportHTTPHandlers{
+		advertisementImportService: advertisementImportService,
+		maxBytes:                   maxBytes,
+	}
+}
+
+// ImportAdvertisements godoc
+// @Summary Import advertisements
+// @Description Import advertisements from CSV (with a header row) or NDJSON, sent as the request body or as a multipart "file" field.
+// @Description Columns are external_id, title, content, image_url and price. Rows with an external_id that was already imported are skipped.
+// @Description Small imports are processed right away, larger ones return 202 and continue in the background
+// @Tags advertisements
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param format query string false "Import format, detected from the content type or file name if omitted" Enums(csv, ndjson)
+// @Param file formData file false "CSV or NDJSON file"
+// @Success 200 {object} dto.ImportJobResponse "Finished import with per-row errors"
+// @Success 202 {object} dto.ImportJobResponse "Import continues in background"
+// @Failure 400 {object} Problem "Unknown format or unreadable file"
+// @Failure 413 {object} Problem "File too large, or too many rows while background jobs are disabled"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/advertisements/import [post]
+func (h *AdvertisementImportHTTPHandlers) ImportAdvertisements(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes)
+
+	body, fileName := io.Reader(c.Request.Body), ""
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType == "multipart/form-data" {
+		file, err := importFilePart(c.Request)
+		if err != nil {
+			respondWithImportReadError(c, err)
+			return
+		}
+		defer file.Close()
+		body, fileName = file, file.FileName()
+	}
+
+	format, err := detectImportFormat(c.Query("format"), c.ContentType(), fileName)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+
+	var rows dto.ImportRowReader
+	switch format {
+	case entities.CSVImportFormat:
+		rows, err = decodeCSVImport(body)
+	case entities.NDJSONImportFormat:
+		rows = decodeNDJSONImport(body)
+	}
+	if err != nil {
+		respondWithImportReadError(c, err)
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	job, err := h.advertisementImportService.ImportAdvertisements(c, id, format, rows)
+	if errors.Is(err, services.ErrUnreadableImportFile) {
+		respondWithImportReadError(c, err)
+		return
+	}
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	if job.FinishedAt == nil {
+		c.Header("Location", "/api/v1/advertisements/import/"+job.ID.String())
+		c.IndentedJSON(http.StatusAccepted, job)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, job)
+}
+
+// GetImportJob godoc
+// @Summary Get import status
+// @Description Get progress and per-row errors of an advertisement import
+// @Tags advertisements
+// @Produce json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path string true "Import job ID"
+// @Success 200 {object} dto.ImportJobResponse
+// @Failure 400 {object} Problem "Invalid import job ID"
+// @Failure 404 {object} Problem "Import job not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/advertisements/import/{id} [get]
+func (h *AdvertisementImportHTTPHandlers) GetImportJob(c *gin.Context) {
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abortWithError(c, invalidField("id", "uuid", "must be a valid UUID"))
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	job, err := h.advertisementImportService.GetImportJob(c, id, jobID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, job)
+}
+
+func respondWithImportReadError(c *gin.Context, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		abortWithError(c, &apiError{
+			status: http.StatusRequestEntityTooLarge,
+			code:   "import_file_too_large",
+			detail: fmt.Sprintf("Import file is larger than %d bytes", maxBytesErr.Limit),
+			err:    err,
+		})
+		return
+	}
+	abortWithError(c, badRequest("unreadable_import_file", err.Error()))
+}
+
+// importFilePart returns the "file" part of a multipart request to be read
+// as a stream. Unlike Request.FormFile, it does not store the form first.
+func importFilePart(r *http.Request) (*multipart.Part, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+func detectImportFormat(format, contentType, fileName string) (entities.ImportFormat, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(fileName)) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		}
+	}
+	if format == "" {
+		switch contentType {
+		case "text/csv":
+			format = "csv"
+		case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+			format = "ndjson"
+		}
+	}
+	switch entities.ImportFormat(format) {
+	case entities.CSVImportFormat, entities.NDJSONImportFormat:
+		return entities.ImportFormat(format), nil
+	default:
+		return "", errUnknownImportFormat
+	}
+}
+
+// csvImportReader reads the rows of a CSV import with a header row naming
+// its columns.
+type csvImportReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// decodeCSVImport reads the header of a CSV import and returns a reader for
+// its rows.
+func decodeCSVImport(r io.Reader) (dto.ImportRowReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("CSV file is empty")
+		}
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"title", "content", "image_url", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header has no %q column", name)
+		}
+	}
+	return &csvImportReader{reader: reader, columns: columns}, nil
+}
+
+func (d *csvImportReader) Read() (*dto.AdvertisementImportRow, *dto.ImportRowError, error) {
+	record, err := d.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, &dto.ImportRowError{Line: parseErr.Line, Error: parseErr.Err.Error()}, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	line, _ := d.reader.FieldPos(0)
+
+	row := &dto.AdvertisementImportRow{
+		AdvertisementCreateRequest: dto.AdvertisementCreateRequest{
+			Title:    d.field(record, "title"),
+			Content:  d.field(record, "content"),
+			ImageURL: d.field(record, "image_url"),
+		},
+		ExternalID: strings.TrimSpace(d.field(record, "external_id")),
+		Line:       line,
+	}
+	price, err := decimal.NewFromString(strings.TrimSpace(d.field(record, "price")))
+	if err != nil {
+		return nil, &dto.ImportRowError{Line: line, ExternalID: row.ExternalID, Error: "Invalid price"}, nil
+	}
+	row.Price = price
+
+	if rowError := validateImportRow(row); rowError != nil {
+		return nil, rowError, nil
+	}
+	return row, nil, nil
+}
+
+func (d *csvImportReader) field(record []string, name string) string {
+	if i, ok := d.columns[name]; ok && i < len(record) {
+		return record[i]
+	}
+	return ""
+}
+
+// ndjsonImportReader reads the rows of an NDJSON import, skipping blank
+// lines.
+type ndjsonImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func decodeNDJSONImport(r io.Reader) dto.ImportRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineBytes)
+	return &ndjsonImportReader{scanner: scanner}
+}
+
+func (d *ndjsonImportReader) Read() (*dto.AdvertisementImportRow, *dto.ImportRowError, error) {
+	for d.scanner.Scan() {
+		d.line++
+		text := bytes.TrimSpace(d.scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := &dto.AdvertisementImportRow{Line: d.line}
+		if err := json.Unmarshal(text, row); err != nil {
+			return nil, &dto.ImportRowError{Line: d.line, Error: err.Error()}, nil
+		}
+		if rowError := validateImportRow(row); rowError != nil {
+			return nil, rowError, nil
+		}
+		return row, nil, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, io.EOF
+}
+
+func validateImportRow(row *dto.AdvertisementImportRow) *dto.ImportRowError {
+	rowError := &dto.ImportRowError{Line: row.Line, ExternalID: row.ExternalID}
+	if err := binding.Validator.ValidateStruct(row); err != nil {
+		rowError.Error = describeValidationError(err)
+		return rowError
+	}
+	if row.Price.IsNegative() {
+		rowError.Error = "Price cannot be negative"
+		return rowError
+	}
+	if row.Price.GreaterThan(maxImportPrice) {
+		rowError.Error = "Price is too large"
+		return rowError
+	}
+	return nil
+}
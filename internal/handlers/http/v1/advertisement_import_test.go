@@ -0,0 +1,161 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"marketplace/internal/dto"
+)
+
+// readImportRows drains rows and returns the valid rows and the row errors.
+func readImportRows(t *testing.T, rows dto.ImportRowReader) ([]*dto.AdvertisementImportRow, []*dto.ImportRowError) {
+	t.Helper()
+	var valid []*dto.AdvertisementImportRow
+	var rowErrors []*dto.ImportRowError
+	for {
+		row, rowError, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			return valid, rowErrors
+		}
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if rowError != nil {
+			rowErrors = append(rowErrors, rowError)
+			continue
+		}
+		valid = append(valid, row)
+	}
+}
+
+func TestDecodeCSVImport(t *testing.T) {
+	file := "\ufeffExternal_ID, title,content,image_url,price\n" +
+		"bike-1,Bike,Red bike,https://example.com/bike.jpg, 120.50\n" +
+		"lamp-1,Lamp,Desk lamp,https://example.com/lamp.jpg,abc\n" +
+		",Chair,,https://example.com/chair.jpg,10\n" +
+		"\"broken,Table,Oak table,https://example.com/table.jpg,99\n"
+
+	rows, err := decodeCSVImport(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("decodeCSVImport() error = %v", err)
+	}
+	valid, rowErrors := readImportRows(t, rows)
+
+	if len(valid) != 1 {
+		t.Fatalf("got %d valid rows, want 1", len(valid))
+	}
+	bike := valid[0]
+	if bike.Line != 2 || bike.ExternalID != "bike-1" || bike.Title != "Bike" || bike.Content != "Red bike" ||
+		bike.ImageURL != "https://example.com/bike.jpg" || !bike.Price.Equal(decimal.RequireFromString("120.50")) {
+		t.Errorf("row = %+v, want the bike on line 2", bike)
+	}
+
+	if len(rowErrors) != 3 {
+		t.Fatalf("got row errors %+v, want 3", rowErrors)
+	}
+	if rowErrors[0].Line != 3 || rowErrors[0].ExternalID != "lamp-1" || rowErrors[0].Error != "Invalid price" {
+		t.Errorf("row error = %+v, want an invalid price on line 3", rowErrors[0])
+	}
+	if rowErrors[1].Line != 4 || rowErrors[1].Error == "" {
+		t.Errorf("row error = %+v, want the missing content on line 4", rowErrors[1])
+	}
+	if rowErrors[2].Line != 5 || rowErrors[2].Error == "" {
+		t.Errorf("row error = %+v, want the parse error on line 5", rowErrors[2])
+	}
+}
+
+func TestDecodeCSVImportRejectsBadHeader(t *testing.T) {
+	for name, file := range map[string]string{
+		"empty":          "",
+		"missing column": "title,content,image_url\nBike,Red bike,https://example.com/bike.jpg\n",
+	} {
+		if _, err := decodeCSVImport(strings.NewReader(file)); err == nil {
+			t.Errorf("%s: decodeCSVImport() error = nil, want an error", name)
+		}
+	}
+}
+
+func TestDecodeNDJSONImport(t *testing.T) {
+	file := `{"external_id":"bike-1","title":"Bike","content":"Red bike","image_url":"https://example.com/bike.jpg","price":"120.50"}
+
+{"title":"Lamp",
+{"title":"Chair","content":"Oak chair","image_url":"not a url","price":"10"}
+{"title":"Table","content":"Oak table","image_url":"https://example.com/table.jpg","price":99}
+`
+	valid, rowErrors := readImportRows(t, decodeNDJSONImport(strings.NewReader(file)))
+
+	if len(valid) != 2 {
+		t.Fatalf("got %d valid rows, want 2", len(valid))
+	}
+	if valid[0].Line != 1 || valid[0].ExternalID != "bike-1" || !valid[0].Price.Equal(decimal.RequireFromString("120.50")) {
+		t.Errorf("row = %+v, want the bike on line 1", valid[0])
+	}
+	// Blank lines are skipped but still counted.
+	if valid[1].Line != 5 || valid[1].Title != "Table" {
+		t.Errorf("row = %+v, want the table on line 5", valid[1])
+	}
+	if len(rowErrors) != 2 || rowErrors[0].Line != 3 || rowErrors[1].Line != 4 {
+		t.Errorf("row errors = %+v, want lines 3 and 4", rowErrors)
+	}
+}
+
+func TestDecodeNDJSONImportStopsAtTooLongLine(t *testing.T) {
+	file := `{"title":"` + strings.Repeat("x", maxImportLineBytes) + `"}` + "\n"
+	_, _, err := decodeNDJSONImport(strings.NewReader(file)).Read()
+	if err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("Read() error = %v, want the line to be rejected", err)
+	}
+}
+
+func TestValidateImportRow(t *testing.T) {
+	validRow := func() *dto.AdvertisementImportRow {
+		return &dto.AdvertisementImportRow{
+			AdvertisementCreateRequest: dto.AdvertisementCreateRequest{
+				Title:    "Bike",
+				Content:  "Red bike",
+				ImageURL: "https://example.com/bike.jpg",
+				Price:    decimal.RequireFromString("120.50"),
+			},
+			ExternalID: "bike-1",
+			Line:       7,
+		}
+	}
+	if rowError := validateImportRow(validRow()); rowError != nil {
+		t.Fatalf("validateImportRow() = %+v, want nil", rowError)
+	}
+
+	for name, tc := range map[string]struct {
+		change func(row *dto.AdvertisementImportRow)
+		want   string
+	}{
+		"missing title":    {change: func(row *dto.AdvertisementImportRow) { row.Title = "" }},
+		"invalid url":      {change: func(row *dto.AdvertisementImportRow) { row.ImageURL = "bike.jpg" }},
+		"long external id": {change: func(row *dto.AdvertisementImportRow) { row.ExternalID = strings.Repeat("x", 129) }},
+		"negative price": {
+			change: func(row *dto.AdvertisementImportRow) { row.Price = decimal.RequireFromString("-1") },
+			want:   "Price cannot be negative",
+		},
+		"price too large": {
+			change: func(row *dto.AdvertisementImportRow) { row.Price = decimal.RequireFromString("1000000000") },
+			want:   "Price is too large",
+		},
+	} {
+		row := validRow()
+		tc.change(row)
+		rowError := validateImportRow(row)
+		if rowError == nil {
+			t.Errorf("%s: validateImportRow() = nil, want an error", name)
+			continue
+		}
+		if rowError.Line != row.Line || rowError.ExternalID != row.ExternalID {
+			t.Errorf("%s: row error = %+v, want line %d and external id %q", name, rowError, row.Line, row.ExternalID)
+		}
+		if tc.want != "" && rowError.Error != tc.want {
+			t.Errorf("%s: error = %q, want %q", name, rowError.Error, tc.want)
+		}
+	}
+}
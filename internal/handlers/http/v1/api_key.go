@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/services"
+)
+
+type APIKeyHTTPHandlers struct {
+	apiKeyService services.APIKeyService
+}
+
+func NewAPIKeyHTTPHandlers(apiKeyService services.APIKeyService) APIKeyHandlers {
+	return &APIKeyHTTPHandlers{apiKeyService: apiKeyService}
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a named API key with scopes and an optional expiry. The key is shown only once
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param apiKey body dto.APIKeyCreateRequest true "API key data"
+// @Success 200 {object} dto.APIKeyCreatedResponse
+// @Failure 400 {object} Problem "Invalid request body or expiry in the past"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/api-keys [post]
+func (h *APIKeyHTTPHandlers) CreateAPIKey(c *gin.Context) {
+	var apiKeyData dto.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&apiKeyData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	apiKey, err := h.apiKeyService.CreateAPIKey(c, id, &apiKeyData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, apiKey)
+}
+
+// GetAPIKeys godoc
+// @Summary Get API keys
+// @Description Get active API keys of the currently authenticated user
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} dto.APIKeyResponse
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/api-keys [get]
+func (h *APIKeyHTTPHandlers) GetAPIKeys(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	apiKeys, err := h.apiKeyService.GetAPIKeys(c, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, apiKeys)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key of the currently authenticated user
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 204
+// @Failure 400 {object} Problem "Invalid API key ID"
+// @Failure 404 {object} Problem "API key not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/api-keys/{id} [delete]
+func (h *APIKeyHTTPHandlers) RevokeAPIKey(c *gin.Context) {
+	apiKeyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abortWithError(c, invalidField("id", "uuid", "must be a valid UUID"))
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	err = h.apiKeyService.RevokeAPIKey(c, id, apiKeyID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
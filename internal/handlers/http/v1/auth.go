@@ -13,6 +13,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const weakPasswordMessage = "must contain at least one uppercase letter, lowercase letter, digit, and special character"
+
+var (
+	uppercaseRe   = regexp.MustCompile(`[A-Z]`)
+	lowercaseRe   = regexp.MustCompile(`[a-z]`)
+	digitRe       = regexp.MustCompile(`[0-9]`)
+	specialCharRe = regexp.MustCompile(`[!@#\$%\^&\*\(\)_\+\-=\[\]{};':"\\|,.<>\/?]`)
+)
+
 type AuthHTTPHandlers struct {
 	authService services.AuthService
 }
@@ -29,26 +38,53 @@ func NewAuthHTTPHandlers(authService services.AuthService) AuthHandlers {
 // @Produce json
 // @Param user body dto.LoginUserRequest true "User credentials"
 // @Success 200 {object} dto.TokenResponse "Access token"
-// @Failure 400 {object} ErrorResponse "Invalid request body"
-// @Failure 401 {object} ErrorResponse "Invalid credentials or user not found"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} Problem "Invalid request body"
+// @Failure 401 {object} Problem "Invalid credentials"
+// @Failure 429 {object} Problem "Too many failed login attempts"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/v1/auth/login [post]
 func (h *AuthHTTPHandlers) Login(c *gin.Context) {
 	var userData dto.LoginUserRequest
 	if err := c.ShouldBindJSON(&userData); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	tokenResponse, err := h.authService.LoginUser(c, &userData, c.ClientIP())
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, tokenResponse)
+}
+
+// LoginWithTwoFactor godoc
+// @Summary Complete two-factor login
+// @Description Exchange a challenge token from login and a TOTP or recovery code for an access token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param login body dto.TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} dto.TokenResponse "Access token"
+// @Failure 400 {object} Problem "Invalid request body"
+// @Failure 401 {object} Problem "Invalid challenge token or code"
+// @Failure 429 {object} Problem "Too many failed login attempts"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/login/2fa [post]
+func (h *AuthHTTPHandlers) LoginWithTwoFactor(c *gin.Context) {
+	var loginData dto.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&loginData); err != nil {
+		abortWithError(c, invalidRequest(err))
 		return
 	}
-	accessToken, err := h.authService.LoginUser(c, &userData)
+	tokenResponse, err := h.authService.LoginUserWithTwoFactor(c, &loginData, c.ClientIP())
 	if err != nil {
-		if errors.Is(err, services.ErrInvalidCredentials) || errors.Is(err, services.ErrCannotFindUser) {
-			c.IndentedJSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
-			return
+		if errors.Is(err, services.ErrTwoFactorNotEnabled) {
+			err = withStatus(err, http.StatusUnauthorized)
 		}
-		c.IndentedJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		abortWithError(c, err)
 		return
 	}
-	c.IndentedJSON(http.StatusOK, dto.TokenResponse{Token: accessToken})
+	c.IndentedJSON(http.StatusOK, tokenResponse)
 }
 
 // Register godoc
@@ -59,39 +95,25 @@ func (h *AuthHTTPHandlers) Login(c *gin.Context) {
 // @Produce json
 // @Param user body dto.UserCreateRequest true "User registration data"
 // @Success 200 {object} dto.UserResponse
-// @Failure 400 {object} ErrorResponse "Invalid request body or password too weak or user already exists"
-// @Failure 404 {object} ErrorResponse "User not found"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} Problem "Invalid request body or password too weak or user already exists"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/v1/auth/register [post]
 func (h *AuthHTTPHandlers) Register(c *gin.Context) {
 	var userData dto.UserCreateRequest
 	if err := c.ShouldBindJSON(&userData); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		abortWithError(c, invalidRequest(err))
 		return
 	}
 
-	var (
-		uppercaseRe   = regexp.MustCompile(`[A-Z]`)
-		lowercaseRe   = regexp.MustCompile(`[a-z]`)
-		digitRe       = regexp.MustCompile(`[0-9]`)
-		specialCharRe = regexp.MustCompile(`[!@#\$%\^&\*\(\)_\+\-=\[\]{};':"\\|,.<>\/?]`)
-	)
-	if !uppercaseRe.MatchString(userData.Password) || !lowercaseRe.MatchString(userData.Password) ||
-		!digitRe.MatchString(userData.Password) || !specialCharRe.MatchString(userData.Password) {
-		c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: "Password must contain at least one uppercase letter, lowercase letter, digit, and special character"})
+	if !isStrongPassword(userData.Password) {
+		abortWithError(c, invalidField("password", "weak_password", weakPasswordMessage))
 		return
 	}
 
 	createdUser, err := h.authService.CreateUser(c, &userData)
 	if err != nil {
-		if errors.Is(err, services.ErrUserNotFound) {
-			c.IndentedJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
-			return
-		} else if errors.Is(err, services.ErrUserAlreadyExists) {
-			c.IndentedJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-			return
-		}
-		c.IndentedJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		abortWithError(c, err)
 		return
 	}
 	c.IndentedJSON(http.StatusOK, createdUser)
@@ -104,19 +126,189 @@ func (h *AuthHTTPHandlers) Register(c *gin.Context) {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} dto.UserResponse
-// @Failure 404 {object} ErrorResponse "User not found"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
 // @Router /api/v1/auth/me [get]
 func (h *AuthHTTPHandlers) GetMe(c *gin.Context) {
 	id := c.MustGet("UserID").(uuid.UUID)
 	user, err := h.authService.GetUserByID(c, id)
 	if err != nil {
-		if errors.Is(err, services.ErrUserNotFound) {
-			c.IndentedJSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
-			return
-		}
-		c.IndentedJSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		abortWithError(c, err)
 		return
 	}
 	c.IndentedJSON(http.StatusOK, user)
 }
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change password of the currently authenticated user and revoke all other sessions
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param passwords body dto.PasswordChangeRequest true "Old and new password"
+// @Success 204
+// @Failure 400 {object} Problem "Invalid request body or password too weak"
+// @Failure 401 {object} Problem "Invalid old password"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/password/change [post]
+func (h *AuthHTTPHandlers) ChangePassword(c *gin.Context) {
+	var passwordData dto.PasswordChangeRequest
+	if err := c.ShouldBindJSON(&passwordData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	if !isStrongPassword(passwordData.NewPassword) {
+		abortWithError(c, invalidField("new_password", "weak_password", weakPasswordMessage))
+		return
+	}
+
+	authUser := c.MustGet("AuthUser").(*dto.AuthenticatedUser)
+	err := h.authService.ChangePassword(c, authUser, &passwordData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Send a single-use password reset token to the email of the user. The response does not reveal whether the user exists
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param user body dto.PasswordForgotRequest true "User login"
+// @Success 202
+// @Failure 400 {object} Problem "Invalid request body"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/password/forgot [post]
+func (h *AuthHTTPHandlers) ForgotPassword(c *gin.Context) {
+	var forgotData dto.PasswordForgotRequest
+	if err := c.ShouldBindJSON(&forgotData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	if err := h.authService.RequestPasswordReset(c, &forgotData); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a password reset token and revoke all sessions
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body dto.PasswordResetRequest true "Reset token and new password"
+// @Success 204
+// @Failure 400 {object} Problem "Invalid request body, password too weak or invalid token"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/password/reset [post]
+func (h *AuthHTTPHandlers) ResetPassword(c *gin.Context) {
+	var resetData dto.PasswordResetRequest
+	if err := c.ShouldBindJSON(&resetData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	if !isStrongPassword(resetData.NewPassword) {
+		abortWithError(c, invalidField("new_password", "weak_password", weakPasswordMessage))
+		return
+	}
+	err := h.authService.ResetPassword(c, &resetData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func isStrongPassword(password string) bool {
+	return uppercaseRe.MatchString(password) && lowercaseRe.MatchString(password) &&
+		digitRe.MatchString(password) && specialCharRe.MatchString(password)
+}
+
+// EnrollTwoFactor godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret and a provisioning URI to be shown as a QR code. Enrollment must be confirmed with a code
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} dto.TwoFactorEnrollResponse
+// @Failure 400 {object} Problem "Two-factor authentication already enabled"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/2fa/enroll [post]
+func (h *AuthHTTPHandlers) EnrollTwoFactor(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	enrollment, err := h.authService.EnrollTwoFactor(c, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactor godoc
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with a TOTP code and return one-time recovery codes. The codes are shown only once
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code body dto.TwoFactorConfirmRequest true "TOTP code"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {object} Problem "Invalid request body, invalid code or enrollment not started"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/2fa/confirm [post]
+func (h *AuthHTTPHandlers) ConfirmTwoFactor(c *gin.Context) {
+	var confirmData dto.TwoFactorConfirmRequest
+	if err := c.ShouldBindJSON(&confirmData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	id := c.MustGet("UserID").(uuid.UUID)
+	recoveryCodes, err := h.authService.ConfirmTwoFactor(c, id, &confirmData)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			err = withStatus(err, http.StatusBadRequest)
+		}
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, recoveryCodes)
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication with the password and a TOTP or recovery code. Admins cannot disable it
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param credentials body dto.TwoFactorDisableRequest true "Password and code"
+// @Success 204
+// @Failure 400 {object} Problem "Invalid request body or two-factor authentication not enabled"
+// @Failure 401 {object} Problem "Invalid password or code"
+// @Failure 403 {object} Problem "Two-factor authentication is required for the role"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/2fa/disable [post]
+func (h *AuthHTTPHandlers) DisableTwoFactor(c *gin.Context) {
+	var disableData dto.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&disableData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	id := c.MustGet("UserID").(uuid.UUID)
+	err := h.authService.DisableTwoFactor(c, id, &disableData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
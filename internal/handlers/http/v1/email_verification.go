@@ -0,0 +1,66 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/services"
+)
+
+type EmailVerificationHTTPHandlers struct {
+	emailVerificationService services.EmailVerificationService
+}
+
+func NewEmailVerificationHTTPHandlers(emailVerificationService services.EmailVerificationService) EmailVerificationHandlers {
+	return &EmailVerificationHTTPHandlers{emailVerificationService: emailVerificationService}
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the email address of a user with a verification token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param verification body dto.EmailVerifyRequest true "Verification token"
+// @Success 204
+// @Failure 400 {object} Problem "Invalid request body or invalid token"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/email/verify [post]
+func (h *EmailVerificationHTTPHandlers) VerifyEmail(c *gin.Context) {
+	var verifyData dto.EmailVerifyRequest
+	if err := c.ShouldBindJSON(&verifyData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	err := h.emailVerificationService.VerifyEmail(c, &verifyData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ResendVerificationEmail godoc
+// @Summary Resend verification email
+// @Description Send a new verification token to the email of the currently authenticated user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 202
+// @Failure 400 {object} Problem "User has no email or email already verified"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 429 {object} Problem "Verification email was sent recently"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/email/resend [post]
+func (h *EmailVerificationHTTPHandlers) ResendVerificationEmail(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	err := h.emailVerificationService.SendVerificationEmail(c, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -6,15 +6,67 @@ import (
 
 type AuthHandlers interface {
 	Login(c *gin.Context)
+	LoginWithTwoFactor(c *gin.Context)
 	Register(c *gin.Context)
 	GetMe(c *gin.Context)
+	ChangePassword(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	EnrollTwoFactor(c *gin.Context)
+	ConfirmTwoFactor(c *gin.Context)
+	DisableTwoFactor(c *gin.Context)
+}
+
+type OIDCHandlers interface {
+	GetProviders(c *gin.Context)
+	Login(c *gin.Context)
+	Link(c *gin.Context)
+	Callback(c *gin.Context)
+	GetIdentities(c *gin.Context)
+}
+
+type EmailVerificationHandlers interface {
+	VerifyEmail(c *gin.Context)
+	ResendVerificationEmail(c *gin.Context)
+}
+
+type APIKeyHandlers interface {
+	CreateAPIKey(c *gin.Context)
+	GetAPIKeys(c *gin.Context)
+	RevokeAPIKey(c *gin.Context)
+}
+
+type WebhookHandlers interface {
+	CreateWebhook(c *gin.Context)
+	GetWebhooks(c *gin.Context)
+	GetWebhook(c *gin.Context)
+	UpdateWebhook(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	GetWebhookDeliveries(c *gin.Context)
+	ReplayWebhookDelivery(c *gin.Context)
 }
 
 type AdvertisementHandlers interface {
 	CreateAdvertisement(c *gin.Context)
 	GetAdvertisements(c *gin.Context)
+	UpdateAdvertisement(c *gin.Context)
+	RenewAdvertisement(c *gin.Context)
+	ExportAdvertisements(c *gin.Context)
+	ExportAllAdvertisements(c *gin.Context)
+}
+
+type AdvertisementImportHandlers interface {
+	ImportAdvertisements(c *gin.Context)
+	GetImportJob(c *gin.Context)
+}
+
+type UserHandlers interface {
+	GetUserProfile(c *gin.Context)
+	GetUserAdvertisements(c *gin.Context)
+	UpdateMe(c *gin.Context)
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+type HealthHandlers interface {
+	Liveness(c *gin.Context)
+	Readiness(c *gin.Context)
 }
@@ -0,0 +1,66 @@
+package v1
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/health"
+	"marketplace/internal/logger"
+)
+
+type HealthHTTPHandlers struct {
+	checker *health.Checker
+}
+
+func NewHealthHTTPHandlers(checker *health.Checker) HealthHandlers {
+	return &HealthHTTPHandlers{checker: checker}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Report that the process is up. Dependencies are not checked, a failing database must not get the instance restarted
+// @Tags health
+// @Produce json
+// @Success 200 {object} dto.LivenessResponse
+// @Router /healthz [get]
+func (h *HealthHTTPHandlers) Liveness(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, dto.LivenessResponse{Status: health.StatusOK})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Check the dependencies of the instance and report the status of each, the details of failures are logged.
+// @Description The instance is not ready while a dependency fails or while it shuts down
+// @Tags health
+// @Produce json
+// @Success 200 {object} dto.ReadinessResponse
+// @Failure 503 {object} dto.ReadinessResponse "A dependency fails or the server is draining"
+// @Router /readyz [get]
+func (h *HealthHTTPHandlers) Readiness(c *gin.Context) {
+	report := h.checker.Readiness(c)
+
+	response := dto.ReadinessResponse{
+		Status:     report.Status,
+		Components: make([]dto.ComponentHealthResponse, len(report.Components)),
+	}
+	for i, component := range report.Components {
+		response.Components[i] = dto.ComponentHealthResponse{Name: component.Name, Status: component.Status}
+		if component.Status != health.StatusOK {
+			slogger.GetLoggerFromContext(c).Warn("Readiness check failed",
+				slog.String("op", "handlers.v1.Readiness"),
+				slog.String("component", component.Name),
+				slog.Float64("latency_ms", float64(component.Latency.Microseconds())/1000),
+				slog.String("error", component.Error),
+			)
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.IndentedJSON(status, response)
+}
@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"marketplace/internal/health"
+)
+
+func TestReadinessHidesFailureDetails(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Register("database", func(context.Context) error {
+		return errors.New("dial tcp 10.0.3.7:5432: connection refused")
+	})
+	handlers := NewHealthHTTPHandlers(checker)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/readyz", handlers.Readiness)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"name": "database"`) || !strings.Contains(body, `"status": "failing"`) {
+		t.Errorf("body = %s, want the failing database component", body)
+	}
+	if strings.Contains(body, "10.0.3.7") || strings.Contains(body, "latency") {
+		t.Errorf("body = %s, want no error or latency details", body)
+	}
+}
@@ -1,69 +1,253 @@
 package v1
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"marketplace/config"
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
+	"marketplace/internal/ratelimit"
+	"marketplace/internal/services"
+	"marketplace/internal/tracing"
 )
 
+const requestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware keeps the X-Request-ID of the caller, so a request can
+// be followed through proxies, or assigns a new one. The id is echoed in the
+// response either way.
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		requestID := uuid.New().String()
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
 		c.Set("RequestID", requestID)
+		c.Header(requestIDHeader, requestID)
 		c.Next()
 	}
 }
 
+// validRequestID bounds what a client can inject into logs and headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLoggerMiddleware must be placed after RequestIDMiddleware and
+// TracingMiddleware so the logs of a request carry its request, trace and
+// span ids. The logger is stored in the request context, where
+// slogger.GetLoggerFromContext finds it.
 func SetLoggerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		logger := slog.Default().With("request_id", c.GetString("RequestID"))
-		c.Set("Logger", logger)
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			logger = logger.With(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+		c.Request = c.Request.WithContext(slogger.WithLogger(c.Request.Context(), logger))
+		c.Next()
+	}
+}
+
+// AccessLogMiddleware logs every request once it is served, through the
+// request logger, so it must be placed after SetLoggerMiddleware. Values of
+// sensitive query parameters, such as OAuth codes, are redacted.
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
 		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if c.Request.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", redactQuery(c.Request.URL.Query())))
+		}
+		if userID, exists := c.Get("UserID"); exists {
+			attrs = append(attrs, slog.String("user_id", userID.(uuid.UUID).String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		slogger.GetLoggerFromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "HTTP request", attrs...)
+	}
+}
+
+func redactQuery(query url.Values) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(query)) {
+		for _, value := range query[name] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(name))
+			b.WriteByte('=')
+			if slogger.IsSensitive(name) {
+				b.WriteString(slogger.Redacted)
+			} else {
+				b.WriteString(url.QueryEscape(value))
+			}
+		}
 	}
+	return b.String()
 }
 
-func AuthMiddleware(JWTSecret string) gin.HandlerFunc {
+// TracingMiddleware continues the trace of an incoming traceparent header
+// or starts a new one, and runs the request within a server span named
+// after the route template.
+func TracingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		route := c.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.ClientAddress(c.ClientIP()),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// MetricsMiddleware records the duration of every request. Requests are
+// labelled with the route template, so paths with IDs share a series.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+		metrics.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// AuthMiddleware accepts Bearer access tokens. When scopes are given it
+// also accepts API keys from the X-API-Key header that hold all of them;
+// without scopes the route is available to interactive sessions only.
+func AuthMiddleware(authService services.AuthService, scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			if len(scopes) == 0 {
+				abortWithError(c, errAPIKeyNotAllowed)
+				return
+			}
+			authUser, err := authService.AuthenticateAPIKey(c, apiKey)
+			if err != nil {
+				if errors.Is(err, services.ErrInvalidToken) {
+					err = errInvalidAPIKey
+				}
+				abortWithError(c, err)
+				return
+			}
+			if !hasScopes(authUser, scopes) {
+				abortWithError(c, errInsufficientScope)
+				return
+			}
+			setAuthenticatedUser(c, authUser)
+			c.Next()
+			return
+		}
+
 		accessToken := c.GetHeader("Authorization")
 		if accessToken == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Authorization header is required")
+			abortWithError(c, errAuthorizationRequired)
 			return
 		}
 		prefix := "Bearer "
 		if len(accessToken) < len(prefix) || accessToken[:len(prefix)] != prefix {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Authorization header must start with 'Bearer '")
+			abortWithError(c, errInvalidAuthorization)
 			return
 		}
 		accessToken = accessToken[len(prefix):]
 
-		token, err := jwt.ParseWithClaims(accessToken, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWTSecret), nil
-		})
+		authUser, err := authService.Authenticate(c, accessToken)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token")
+			abortWithError(c, err)
 			return
 		}
-		var userID uuid.UUID
-		var login string
-		if claims, ok := token.Claims.(*jwt.MapClaims); ok && token.Valid {
-			userID, err = uuid.Parse((*claims)["sub"].(string))
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, "Invalid token")
-				return
-			}
-			login = (*claims)["login"].(string)
-		}
-		c.Set("UserID", userID)
-		c.Set("Login", login)
+		setAuthenticatedUser(c, authUser)
 		c.Next()
 	}
 }
 
-func SetUserInfoMiddleware(JWTSecret string) gin.HandlerFunc {
+// SetUserInfoMiddleware identifies the caller when credentials are present
+// and valid, but never rejects a request.
+func SetUserInfoMiddleware(authService services.AuthService, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && len(scopes) > 0 {
+			authUser, err := authService.AuthenticateAPIKey(c, apiKey)
+			if err == nil && hasScopes(authUser, scopes) {
+				setAuthenticatedUser(c, authUser)
+			}
+			c.Next()
+			return
+		}
+
 		accessToken := c.GetHeader("Authorization")
 		prefix := "Bearer "
 		if len(accessToken) < len(prefix) || accessToken[:len(prefix)] != prefix {
@@ -72,25 +256,158 @@ func SetUserInfoMiddleware(JWTSecret string) gin.HandlerFunc {
 		}
 		accessToken = accessToken[len(prefix):]
 
-		token, err := jwt.ParseWithClaims(accessToken, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWTSecret), nil
-		})
+		authUser, err := authService.Authenticate(c, accessToken)
 		if err != nil {
 			c.Next()
 			return
 		}
-		var userID uuid.UUID
-		var login string
-		if claims, ok := token.Claims.(*jwt.MapClaims); ok && token.Valid {
-			userID, err = uuid.Parse((*claims)["sub"].(string))
-			if err != nil {
-				c.Next()
-				return
-			}
-			login = (*claims)["login"].(string)
+		setAuthenticatedUser(c, authUser)
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmailMiddleware must be placed after AuthMiddleware.
+// When required is false it lets every request through.
+func RequireVerifiedEmailMiddleware(emailVerificationService services.EmailVerificationService, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !required {
+			c.Next()
+			return
+		}
+		verified, err := emailVerificationService.IsEmailVerified(c, c.MustGet("UserID").(uuid.UUID))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		if !verified {
+			abortWithError(c, services.ErrEmailNotVerified)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRoleMiddleware must be placed after AuthMiddleware. Admins must
+// have passed two-factor authentication in the current session.
+func RequireRoleMiddleware(role entities.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUser := c.MustGet("AuthUser").(*dto.AuthenticatedUser)
+		if entities.Role(authUser.Role) != role {
+			abortWithError(c, services.ErrForbidden)
+			return
+		}
+		if role == entities.AdminRole && !authUser.TwoFactorVerified {
+			abortWithError(c, services.ErrTwoFactorRequired)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitMiddleware limits requests per policy key. Policies keyed by
+// user or api_key must be placed after AuthMiddleware; requests without
+// such a caller fall back to the client IP. Store errors let the request
+// through.
+func RateLimitMiddleware(store ratelimit.Store, name string, policy config.RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !policy.Enabled() {
+			c.Next()
+			return
+		}
+
+		key := name + ":" + rateLimitIdentity(c, policy.Key)
+		result, err := store.Allow(c, key, policy.Limit, policy.Window)
+		if err != nil {
+			slogger.GetLoggerFromContext(c).Error("Rate limit check failed",
+				slog.String("op", "handlers.v1.RateLimitMiddleware"),
+				slog.Any("error", err),
+			)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			abortWithError(c, errRateLimited)
+			return
 		}
-		c.Set("UserID", userID)
-		c.Set("Login", login)
 		c.Next()
 	}
 }
+
+// ExportLimitMiddleware lets at most maxConcurrent exports run at a time
+// and ends each one after timeout. An export holds a pooled connection and
+// a transaction while it streams, so slow clients or many exports could
+// otherwise take the whole pool. One middleware is shared by all export
+// routes.
+func ExportLimitMiddleware(maxConcurrent int, timeout time.Duration) gin.HandlerFunc {
+	running := make(chan struct{}, maxConcurrent)
+	return func(c *gin.Context) {
+		select {
+		case running <- struct{}{}:
+			defer func() { <-running }()
+		default:
+			abortWithError(c, errTooManyExports)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		// The context does not interrupt a write blocked on a slow client,
+		// the write deadline does. It is cleared for the next request on
+		// the connection.
+		controller := http.NewResponseController(c.Writer)
+		deadline, _ := ctx.Deadline()
+		if err := controller.SetWriteDeadline(deadline); err == nil {
+			defer func() { _ = controller.SetWriteDeadline(time.Time{}) }()
+		}
+		c.Next()
+	}
+}
+
+func rateLimitIdentity(c *gin.Context, key config.RateLimitKey) string {
+	switch key {
+	case config.UserRateLimitKey:
+		if userID, exists := c.Get("UserID"); exists {
+			return "user:" + userID.(uuid.UUID).String()
+		}
+	case config.APIKeyRateLimitKey:
+		// Only an authenticated key counts, otherwise a client could dodge
+		// the limit by sending a new random key with every request.
+		if authUser, exists := c.Get("AuthUser"); exists && authUser.(*dto.AuthenticatedUser).APIKeyID != nil {
+			return "api_key:" + authUser.(*dto.AuthenticatedUser).APIKeyID.String()
+		}
+	}
+	// ClientIP reads X-Forwarded-For only from TRUSTED_PROXIES, so clients
+	// cannot pick a fresh bucket by forging the header.
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// hasScopes reports whether authUser holds all scopes. Interactive
+// sessions are not limited by scopes.
+func hasScopes(authUser *dto.AuthenticatedUser, scopes []string) bool {
+	if authUser.APIKeyID == nil {
+		return true
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(authUser.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+func setAuthenticatedUser(c *gin.Context, authUser *dto.AuthenticatedUser) {
+	c.Set("AuthUser", authUser)
+	c.Set("UserID", authUser.UserID)
+	c.Set("Login", authUser.Login)
+}
@@ -0,0 +1,252 @@
+package v1
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"marketplace/config"
+	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
+	"marketplace/internal/ratelimit"
+)
+
+func newRateLimitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatalf("SetTrustedProxies() error = %v", err)
+	}
+	policy := config.RateLimitPolicy{Limit: 1, Window: time.Minute, Key: config.IPRateLimitKey}
+	router.Use(ErrorMiddleware(), RateLimitMiddleware(ratelimit.NewMemoryStore(), "test", policy))
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func rateLimitedRequest(router *gin.Engine, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	router := newRateLimitedRouter(t, nil)
+
+	if code := rateLimitedRequest(router, "203.0.113.7:40000", "198.51.100.1"); code != http.StatusNoContent {
+		t.Fatalf("first request status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := rateLimitedRequest(router, "203.0.113.7:40001", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("request with a forged X-Forwarded-For status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimitKeysOnClientBehindTrustedProxy(t *testing.T) {
+	router := newRateLimitedRouter(t, []string{"10.0.0.0/8"})
+
+	if code := rateLimitedRequest(router, "10.0.0.2:40000", "198.51.100.1"); code != http.StatusNoContent {
+		t.Fatalf("first client status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := rateLimitedRequest(router, "10.0.0.2:40001", "198.51.100.2"); code != http.StatusNoContent {
+		t.Errorf("second client status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := rateLimitedRequest(router, "10.0.0.3:40000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("first client again status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestMetricsMiddlewareLabelsRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MetricsMiddleware())
+	router.GET("/metrics-test/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/metrics-test-missing/3"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	counts := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() != "marketplace_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["route"]+" "+labels["status"]] += metric.GetHistogram().GetSampleCount()
+		}
+	}
+	if got := counts["/metrics-test/:id 204"]; got != 2 {
+		t.Errorf("requests of /metrics-test/:id = %d, want 2", got)
+	}
+	if got := counts[metrics.UnmatchedRoute+" 404"]; got != 1 {
+		t.Errorf("unmatched requests = %d, want 1", got)
+	}
+	for key := range counts {
+		if strings.Contains(key, "/metrics-test/1") || strings.Contains(key, "/metrics-test-missing") {
+			t.Errorf("request path %q used as a route label", key)
+		}
+	}
+}
+
+func TestTracingMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	var logs strings.Builder
+	previousLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previousLogger) })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TracingMiddleware(), SetLoggerMiddleware())
+	router.GET("/items/:id", func(c *gin.Context) {
+		slogger.GetLoggerFromContext(c.Request.Context()).Info("handled")
+		c.Status(http.StatusNoContent)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logs.String(), "trace_id="+traceID) {
+		t.Errorf("logs %q do not carry the incoming trace id", logs.String())
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended spans = %d, want 1", len(spans))
+	}
+	if spans[0].Name() != "GET /items/:id" {
+		t.Errorf("span name = %q, want %q", spans[0].Name(), "GET /items/:id")
+	}
+	if !spans[0].Parent().IsRemote() || spans[0].Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span parent = %v, want the incoming remote span", spans[0].Parent())
+	}
+}
+
+func TestRequestIDIsKeptAndEchoed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "edge-7f3a.1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got != "edge-7f3a.1" {
+		t.Errorf("X-Request-ID = %q, want the incoming id", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "bad id\ninjected")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got == "" || strings.ContainsAny(got, " \n") {
+		t.Errorf("X-Request-ID = %q, want a generated id replacing the invalid one", got)
+	}
+}
+
+func TestAccessLogRedactsSensitiveValues(t *testing.T) {
+	var logs strings.Builder
+	previousLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{ReplaceAttr: slogger.RedactAttr})))
+	t.Cleanup(func() { slog.SetDefault(previousLogger) })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), SetLoggerMiddleware(), AccessLogMiddleware())
+	router.GET("/callback/:provider", func(c *gin.Context) {
+		slogger.GetLoggerFromContext(c.Request.Context()).Info("exchanging code", slog.String("password", "hunter2"))
+		c.String(http.StatusOK, "done")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/callback/mock?code=secret-code&state=abc&page=2", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := logs.String()
+	for _, leaked := range []string{"secret-code", "hunter2"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("logs leak %q: %s", leaked, out)
+		}
+	}
+	for _, want := range []string{`"route":"/callback/:provider"`, `"status":200`, `"bytes":4`, `"request_id":"req-1"`, `code=[REDACTED]`, `page=2`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("access log does not contain %s: %s", want, out)
+		}
+	}
+}
+
+func TestExportLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.ContextWithFallback = true
+	router.Use(ErrorMiddleware(), ExportLimitMiddleware(1, time.Minute))
+	started, release := make(chan struct{}), make(chan struct{})
+	router.GET("/export", func(c *gin.Context) {
+		deadline, ok := c.Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("export deadline = %v, want within the timeout", deadline)
+		}
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+	export := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export", nil))
+		return rec
+	}
+
+	first := make(chan int)
+	go func() { first <- export().Code }()
+	<-started
+	if rec := export(); rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "too_many_exports") {
+		t.Errorf("second export: status %d with body %s, want too_many_exports", rec.Code, rec.Body)
+	}
+	close(release)
+	if code := <-first; code != http.StatusOK {
+		t.Errorf("first export: status = %d, want %d", code, http.StatusOK)
+	}
+
+	// The finished export frees its slot.
+	started, release = make(chan struct{}), make(chan struct{})
+	close(release)
+	if rec := export(); rec.Code != http.StatusOK {
+		t.Errorf("export after the first one finished: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
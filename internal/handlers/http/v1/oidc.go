@@ -0,0 +1,143 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/services"
+)
+
+// oidcBindingCookie holds the binding of the login started by the browser.
+// SameSite=Lax still sends it on the top-level redirect back from the
+// provider.
+const (
+	oidcBindingCookie     = "oidc_binding"
+	oidcBindingCookiePath = "/api/v1/auth/oidc"
+)
+
+type OIDCHTTPHandlers struct {
+	oidcService   services.OIDCService
+	secureCookies bool
+}
+
+func NewOIDCHTTPHandlers(oidcService services.OIDCService, secureCookies bool) OIDCHandlers {
+	return &OIDCHTTPHandlers{oidcService: oidcService, secureCookies: secureCookies}
+}
+
+func (h *OIDCHTTPHandlers) setBindingCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    value,
+		Path:     oidcBindingCookiePath,
+		MaxAge:   maxAge,
+		Secure:   h.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GetProviders godoc
+// @Summary Get identity providers
+// @Description Get the external identity providers users can sign in with
+// @Tags auth
+// @Produce json
+// @Success 200 {array} dto.OIDCProviderResponse
+// @Router /api/v1/auth/oidc/providers [get]
+func (h *OIDCHTTPHandlers) GetProviders(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, h.oidcService.GetProviders(c))
+}
+
+// Login godoc
+// @Summary Sign in with an identity provider
+// @Description Redirect to the provider login page. The provider redirects back to the callback endpoint, which requires the oidc_binding cookie set here
+// @Tags auth
+// @Param provider path string true "Provider name"
+// @Success 302
+// @Failure 404 {object} Problem "Provider not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/oidc/{provider}/login [get]
+func (h *OIDCHTTPHandlers) Login(c *gin.Context) {
+	authorization, err := h.oidcService.GetAuthorizationURL(c, c.Param("provider"), nil)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	h.setBindingCookie(c, authorization.Binding, 0)
+	c.Redirect(http.StatusFound, authorization.AuthorizationURL)
+}
+
+// Link godoc
+// @Summary Link an identity provider
+// @Description Start linking an external identity to the currently authenticated user. Open the returned URL in the browser that made this request, as the callback requires the oidc_binding cookie set here
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.OIDCAuthorizationResponse
+// @Failure 404 {object} Problem "Provider not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/oidc/{provider}/link [post]
+func (h *OIDCHTTPHandlers) Link(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	authorization, err := h.oidcService.GetAuthorizationURL(c, c.Param("provider"), &id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	h.setBindingCookie(c, authorization.Binding, 0)
+	c.IndentedJSON(http.StatusOK, authorization)
+}
+
+// Callback godoc
+// @Summary Identity provider callback
+// @Description Complete a login or link started with the provider. New users are provisioned automatically
+// @Tags auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string false "Authorization code"
+// @Param state query string true "Login state"
+// @Success 200 {object} dto.TokenResponse "Access token, or a challenge token if two-factor authentication is enabled"
+// @Failure 400 {object} Problem "Invalid state, login started by another browser, or identity linked to another user"
+// @Failure 401 {object} Problem "External authentication failed"
+// @Failure 404 {object} Problem "Provider not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/oidc/{provider}/callback [get]
+func (h *OIDCHTTPHandlers) Callback(c *gin.Context) {
+	var callbackData dto.OIDCCallbackRequest
+	if err := c.ShouldBindQuery(&callbackData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+	callbackData.Binding, _ = c.Cookie(oidcBindingCookie)
+	// The state is single use, so the binding is not needed any more.
+	h.setBindingCookie(c, "", -1)
+
+	token, err := h.oidcService.HandleCallback(c, c.Param("provider"), &callbackData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, token)
+}
+
+// GetIdentities godoc
+// @Summary Get linked identities
+// @Description Get external identities linked to the currently authenticated user
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} dto.UserIdentityResponse
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/oidc/identities [get]
+func (h *OIDCHTTPHandlers) GetIdentities(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	identities, err := h.oidcService.GetUserIdentities(c, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, identities)
+}
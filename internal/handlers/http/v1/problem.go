@@ -0,0 +1,338 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"marketplace/internal/logger"
+	"marketplace/internal/repositories"
+	"marketplace/internal/services"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details object, the body of every error
+// response. Code is stable and meant for clients to branch on, Detail is
+// meant for humans and may change.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// Errors lists the invalid fields of a validation_failed problem.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	// Field is the JSON or query name of the field, with an index for
+	// elements of lists, such as event_types[1].
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiError is an error with the status and code it is reported with.
+type apiError struct {
+	status int
+	code   string
+	detail string
+	fields []FieldError
+	err    error
+}
+
+func (e *apiError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return e.detail
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings assigns statuses and codes to the errors that are safe to
+// show to clients. Any other error is reported as internal_error without
+// its message.
+var errorMappings = []errorMapping{
+	{services.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{services.ErrUserAlreadyExists, http.StatusBadRequest, "user_already_exists"},
+	{services.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{services.ErrTooManyLoginAttempts, http.StatusTooManyRequests, "too_many_login_attempts"},
+	{services.ErrInvalidToken, http.StatusUnauthorized, "invalid_token"},
+	{services.ErrInvalidResetToken, http.StatusBadRequest, "invalid_reset_token"},
+	{services.ErrTwoFactorRequired, http.StatusForbidden, "two_factor_required"},
+	{services.ErrTwoFactorAlreadyEnabled, http.StatusBadRequest, "two_factor_already_enabled"},
+	{services.ErrTwoFactorNotEnabled, http.StatusBadRequest, "two_factor_not_enabled"},
+	{services.ErrInvalidTwoFactorCode, http.StatusUnauthorized, "invalid_two_factor_code"},
+	{services.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{services.ErrOIDCProviderNotFound, http.StatusNotFound, "identity_provider_not_found"},
+	{services.ErrInvalidOIDCState, http.StatusBadRequest, "invalid_login_state"},
+	{services.ErrOIDCAuthenticationFailed, http.StatusUnauthorized, "external_authentication_failed"},
+	{services.ErrIdentityAlreadyLinked, http.StatusBadRequest, "identity_already_linked"},
+	{services.ErrAPIKeyNotFound, http.StatusNotFound, "api_key_not_found"},
+	{services.ErrInvalidAPIKeyExpiry, http.StatusBadRequest, "invalid_api_key_expiry"},
+	{services.ErrUserHasNoEmail, http.StatusBadRequest, "user_has_no_email"},
+	{services.ErrEmailAlreadyVerified, http.StatusBadRequest, "email_already_verified"},
+	{services.ErrEmailNotVerified, http.StatusForbidden, "email_not_verified"},
+	{services.ErrVerificationEmailThrottled, http.StatusTooManyRequests, "verification_email_throttled"},
+	{services.ErrInvalidVerificationToken, http.StatusBadRequest, "invalid_verification_token"},
+	{services.ErrAdvertisementNotFound, http.StatusNotFound, "advertisement_not_found"},
+	{services.ErrAdvertisementAlreadyPublished, http.StatusConflict, "advertisement_already_published"},
+	{services.ErrImportJobNotFound, http.StatusNotFound, "import_job_not_found"},
+	{services.ErrImportTooLarge, http.StatusRequestEntityTooLarge, "import_too_large"},
+	{services.ErrWebhookNotFound, http.StatusNotFound, "webhook_not_found"},
+	{services.ErrWebhookDeliveryNotFound, http.StatusNotFound, "webhook_delivery_not_found"},
+	{services.ErrInvalidWebhookURL, http.StatusBadRequest, "invalid_webhook_url"},
+	{services.ErrInvalidWebhookEventType, http.StatusBadRequest, "invalid_webhook_event_type"},
+	{repositories.ErrNotFound, http.StatusNotFound, "not_found"},
+	{repositories.ErrAlreadyExists, http.StatusConflict, "already_exists"},
+}
+
+// Errors raised by the HTTP layer itself.
+var (
+	errAuthorizationRequired = &apiError{status: http.StatusUnauthorized, code: "authorization_required", detail: "Authorization header is required"}
+	errInvalidAuthorization  = &apiError{status: http.StatusUnauthorized, code: "invalid_authorization_header", detail: "Authorization header must start with 'Bearer '"}
+	errInvalidAPIKey         = &apiError{status: http.StatusUnauthorized, code: "invalid_api_key", detail: "Invalid API key"}
+	errAPIKeyNotAllowed      = &apiError{status: http.StatusForbidden, code: "api_key_not_allowed", detail: "API keys are not allowed for this endpoint"}
+	errInsufficientScope     = &apiError{status: http.StatusForbidden, code: "insufficient_scope", detail: "API key does not have the required scope"}
+	errRateLimited           = &apiError{status: http.StatusTooManyRequests, code: "rate_limited", detail: "Too many requests"}
+	errTooManyExports        = &apiError{status: http.StatusTooManyRequests, code: "too_many_exports", detail: "Too many exports are running, try again later"}
+	errRouteNotFound         = &apiError{status: http.StatusNotFound, code: "route_not_found", detail: "No endpoint matches the request path"}
+)
+
+func init() {
+	// Validation errors name fields as clients send them, not as the Go
+	// struct fields they are bound to.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "uri"} {
+				name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// abortWithError stops the handler chain. ErrorMiddleware writes the
+// response for err.
+func abortWithError(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// invalidRequest reports a request that failed to bind, with the invalid
+// fields of validation errors.
+func invalidRequest(err error) error {
+	var validationErrors validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var numErr *strconv.NumError
+	switch {
+	case errors.As(err, &validationErrors):
+		fields := make([]FieldError, len(validationErrors))
+		for i, fieldErr := range validationErrors {
+			fields[i] = FieldError{
+				Field:   fieldPath(fieldErr.Namespace()),
+				Code:    fieldErr.Tag(),
+				Message: validationMessage(fieldErr),
+			}
+		}
+		return &apiError{status: http.StatusBadRequest, code: "validation_failed", detail: "The request has invalid fields", fields: fields, err: err}
+	case errors.As(err, &typeErr):
+		return invalidField(typeErr.Field, "type", "must be of type "+typeErr.Type.String())
+	case errors.Is(err, io.EOF):
+		return &apiError{status: http.StatusBadRequest, code: "invalid_body", detail: "Request body is empty", err: err}
+	case errors.As(err, &numErr):
+		return &apiError{status: http.StatusBadRequest, code: "invalid_request", detail: fmt.Sprintf("%q is not a valid number", numErr.Num), err: err}
+	default:
+		return &apiError{status: http.StatusBadRequest, code: "invalid_request", detail: err.Error(), err: err}
+	}
+}
+
+// invalidField reports a single invalid field found by a check of the
+// handler rather than by binding.
+func invalidField(field, code, message string) error {
+	return &apiError{
+		status: http.StatusBadRequest,
+		code:   "validation_failed",
+		detail: "The request has invalid fields",
+		fields: []FieldError{{Field: field, Code: code, Message: message}},
+	}
+}
+
+func badRequest(code, detail string) error {
+	return &apiError{status: http.StatusBadRequest, code: code, detail: detail}
+}
+
+// withStatus reports a mapped error with another status, for the few
+// endpoints where the usual one would mislead.
+func withStatus(err error, status int) error {
+	problem := problemFor(err)
+	return &apiError{status: status, code: problem.Code, detail: problem.Detail, err: err}
+}
+
+// ErrorMiddleware writes the last error added by the handlers as an
+// application/problem+json response. It must run before every middleware
+// and handler that adds errors.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil {
+			return
+		}
+		problem := problemFor(last.Err)
+		if problem.Status >= http.StatusInternalServerError {
+			slogger.GetLoggerFromContext(c.Request.Context()).Error("Request failed",
+				slog.String("op", "handlers.v1.ErrorMiddleware"),
+				slog.Any("error", last.Err),
+			)
+		}
+		if c.Writer.Written() {
+			// A streamed response has already started, the client sees it
+			// truncated.
+			return
+		}
+
+		var lockedErr *services.LoginLockedError
+		if errors.As(last.Err, &lockedErr) {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(lockedErr.RetryAfter)))
+			problem.Detail = lockedErr.Error()
+		}
+		problem.Instance = c.Request.URL.Path
+		problem.RequestID = c.GetString("RequestID")
+		writeProblem(c, problem)
+	}
+}
+
+// RouteNotFound answers requests that match no route.
+func RouteNotFound(c *gin.Context) {
+	abortWithError(c, errRouteNotFound)
+}
+
+func problemFor(err error) *Problem {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return newProblem(apiErr.status, apiErr.code, apiErr.detail, apiErr.fields)
+	}
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return newProblem(mapping.status, mapping.code, mapping.err.Error(), nil)
+		}
+	}
+	return newProblem(http.StatusInternalServerError, "internal_error", "The server could not process the request", nil)
+}
+
+func newProblem(status int, code, detail string, fields []FieldError) *Problem {
+	return &Problem{
+		Type:   "urn:problem:marketplace:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: fields,
+	}
+}
+
+func writeProblem(c *gin.Context, problem *Problem) {
+	body, err := json.MarshalIndent(problem, "", "    ")
+	if err != nil {
+		c.Status(problem.Status)
+		return
+	}
+	c.Data(problem.Status, problemContentType, body)
+}
+
+// fieldPath drops the name of the top level struct from a validator
+// namespace, such as UserCreateRequest.login.
+func fieldPath(namespace string) string {
+	if _, path, found := strings.Cut(namespace, "."); found {
+		return path
+	}
+	return namespace
+}
+
+// describeValidationError sums up validation errors in one line, such as
+// "title is required; price must be at least 0".
+func describeValidationError(err error) string {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err.Error()
+	}
+	messages := make([]string, len(validationErrors))
+	for i, fieldErr := range validationErrors {
+		messages[i] = fieldPath(fieldErr.Namespace()) + " " + validationMessage(fieldErr)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func validationMessage(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "uuid":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(param, " ", ", ")
+	case "min":
+		if fieldErr.Kind() == reflect.String {
+			return "must be at least " + param + " characters long"
+		}
+		if fieldErr.Kind() == reflect.Slice {
+			return "must have at least " + param + " items"
+		}
+		return "must be at least " + param
+	case "max":
+		if fieldErr.Kind() == reflect.String {
+			return "must be at most " + param + " characters long"
+		}
+		if fieldErr.Kind() == reflect.Slice {
+			return "must have at most " + param + " items"
+		}
+		return "must be at most " + param
+	case "len":
+		return "must be exactly " + param + " characters long"
+	case "gt":
+		return "must be greater than " + param
+	case "gte":
+		return "must be greater than or equal to " + param
+	case "lt":
+		return "must be less than " + param
+	case "lte":
+		return "must be less than or equal to " + param
+	default:
+		return "is invalid"
+	}
+}
@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"marketplace/internal/services"
+)
+
+func serveProblem(t *testing.T, handler gin.HandlerFunc, body string) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), ErrorMiddleware())
+	router.POST("/things", handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "req-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Type"); got != problemContentType {
+		t.Errorf("Content-Type = %q, want %q", got, problemContentType)
+	}
+	var problem Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode problem: %v, body %s", err, rec.Body.String())
+	}
+	return rec, problem
+}
+
+func TestErrorMiddlewareMapsServiceErrors(t *testing.T) {
+	rec, problem := serveProblem(t, func(c *gin.Context) {
+		abortWithError(c, services.ErrAdvertisementAlreadyPublished)
+	}, "")
+
+	if rec.Code != http.StatusConflict || problem.Status != http.StatusConflict {
+		t.Errorf("status = %d, problem status = %d, want %d", rec.Code, problem.Status, http.StatusConflict)
+	}
+	if problem.Code != "advertisement_already_published" || problem.Type != "urn:problem:marketplace:advertisement_already_published" {
+		t.Errorf("code = %q, type = %q", problem.Code, problem.Type)
+	}
+	if problem.Instance != "/things" || problem.RequestID != "req-1" {
+		t.Errorf("instance = %q, request_id = %q, want /things and req-1", problem.Instance, problem.RequestID)
+	}
+}
+
+func TestErrorMiddlewareHidesInternalErrors(t *testing.T) {
+	rec, problem := serveProblem(t, func(c *gin.Context) {
+		abortWithError(c, errors.New("pq: relation \"users\" does not exist"))
+	}, "")
+
+	if rec.Code != http.StatusInternalServerError || problem.Code != "internal_error" {
+		t.Errorf("status = %d, code = %q, want 500 internal_error", rec.Code, problem.Code)
+	}
+	if strings.Contains(rec.Body.String(), "relation") {
+		t.Errorf("body leaks the internal error: %s", rec.Body.String())
+	}
+}
+
+func TestErrorMiddlewareSetsRetryAfterForLockedLogin(t *testing.T) {
+	rec, problem := serveProblem(t, func(c *gin.Context) {
+		abortWithError(c, &services.LoginLockedError{RetryAfter: 90 * time.Second})
+	}, "")
+
+	if rec.Code != http.StatusTooManyRequests || problem.Code != "too_many_login_attempts" {
+		t.Errorf("status = %d, code = %q, want 429 too_many_login_attempts", rec.Code, problem.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Retry-After = %q, want 90", got)
+	}
+}
+
+func TestInvalidRequestReportsFieldsByTheirJSONNames(t *testing.T) {
+	type request struct {
+		EmailAddress string   `json:"email_address" binding:"required,email"`
+		Tags         []string `json:"tags" binding:"dive,max=3"`
+	}
+	rec, problem := serveProblem(t, func(c *gin.Context) {
+		var body request
+		if err := c.ShouldBindJSON(&body); err != nil {
+			abortWithError(c, invalidRequest(err))
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}, `{"email_address": "nope", "tags": ["ok", "too long"]}`)
+
+	if rec.Code != http.StatusBadRequest || problem.Code != "validation_failed" {
+		t.Fatalf("status = %d, code = %q, want 400 validation_failed", rec.Code, problem.Code)
+	}
+	want := []FieldError{
+		{Field: "email_address", Code: "email", Message: "must be a valid email address"},
+		{Field: "tags[1]", Code: "max", Message: "must be at most 3 characters long"},
+	}
+	if len(problem.Errors) != len(want) {
+		t.Fatalf("errors = %+v, want %+v", problem.Errors, want)
+	}
+	for i := range want {
+		if problem.Errors[i] != want[i] {
+			t.Errorf("errors[%d] = %+v, want %+v", i, problem.Errors[i], want[i])
+		}
+	}
+	if strings.Contains(rec.Body.String(), "EmailAddress") {
+		t.Errorf("body leaks Go field names: %s", rec.Body.String())
+	}
+}
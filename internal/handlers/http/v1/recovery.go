@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
+)
+
+// CrashReport describes a panic recovered while serving a request.
+type CrashReport struct {
+	Value     any
+	Stack     []byte
+	Time      time.Time
+	RequestID string
+	Method    string
+	Route     string
+	Path      string
+	// UserID is empty when the panic happened before authentication or on
+	// a public route.
+	UserID string
+}
+
+// CrashReporter forwards crash reports to an external service, such as an
+// error tracker. It is called synchronously, so it should hand the report
+// off instead of sending it inline.
+type CrashReporter func(ctx context.Context, report *CrashReport)
+
+var errPanic = errors.New("panic while serving the request")
+
+// RecoveryMiddleware turns a panic into a problem+json 500, logs it with
+// the stack and passes it to the reporters. It must be placed after the
+// request ID, logger, access log and metrics middlewares, so the request
+// is still logged and counted with its final status.
+func RecoveryMiddleware(reporters ...CrashReporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value == http.ErrAbortHandler {
+				// Aborting the response on purpose, net/http handles it.
+				panic(value)
+			}
+
+			route := c.FullPath()
+			if route == "" {
+				route = metrics.UnmatchedRoute
+			}
+			report := &CrashReport{
+				Value:     value,
+				Stack:     debug.Stack(),
+				Time:      time.Now(),
+				RequestID: c.GetString("RequestID"),
+				Method:    c.Request.Method,
+				Route:     route,
+				Path:      c.Request.URL.Path,
+			}
+			if userID, exists := c.Get("UserID"); exists {
+				if id, ok := userID.(uuid.UUID); ok {
+					report.UserID = id.String()
+				}
+			}
+
+			ctx := c.Request.Context()
+			logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", "handlers.v1.RecoveryMiddleware"))
+			if brokenConnection(value) {
+				logger.Warn("Client connection broken", slog.Any("error", value))
+				c.Abort()
+				return
+			}
+			metrics.RecordPanic(route)
+			logger.Error("Panic recovered",
+				slog.Any("panic", value),
+				slog.String("route", report.Route),
+				slog.String("user_id", report.UserID),
+				slog.String("stack", string(report.Stack)),
+			)
+			for _, reporter := range reporters {
+				reportCrash(ctx, logger, reporter, report)
+			}
+
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			problem := problemFor(errPanic)
+			problem.Instance = c.Request.URL.Path
+			problem.RequestID = report.RequestID
+			c.Abort()
+			writeProblem(c, problem)
+		}()
+		c.Next()
+	}
+}
+
+// reportCrash keeps a failing reporter from taking the server down with
+// it.
+func reportCrash(ctx context.Context, logger *slog.Logger, reporter CrashReporter, report *CrashReport) {
+	defer func() {
+		if value := recover(); value != nil {
+			logger.Error("Crash reporter panicked", slog.Any("panic", value))
+		}
+	}()
+	reporter(ctx, report)
+}
+
+// brokenConnection reports panics caused by writing to a client that went
+// away, which are not bugs of the server.
+func brokenConnection(value any) bool {
+	err, ok := value.(error)
+	if !ok {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if !errors.As(opErr, &syscallErr) {
+		return false
+	}
+	message := strings.ToLower(syscallErr.Error())
+	return strings.Contains(message, "broken pipe") || strings.Contains(message, "connection reset by peer")
+}
@@ -0,0 +1,90 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/metrics"
+)
+
+func TestRecoveryMiddlewareReportsPanic(t *testing.T) {
+	var logs strings.Builder
+	previousLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previousLogger) })
+
+	userID := uuid.New()
+	var reports []*CrashReport
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), SetLoggerMiddleware(), ErrorMiddleware(), RecoveryMiddleware(
+		func(_ context.Context, report *CrashReport) { reports = append(reports, report) },
+		func(context.Context, *CrashReport) { panic("reporter is broken") },
+	))
+	router.GET("/panic-test/:id", func(c *gin.Context) {
+		c.Set("UserID", userID)
+		var claims map[string]any
+		_ = claims["login"].(string)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/panic-test/1", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	var problem Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode problem: %v, body %s", err, rec.Body.String())
+	}
+	if problem.Code != "internal_error" || problem.RequestID != "req-1" {
+		t.Errorf("problem = %+v, want internal_error for req-1", problem)
+	}
+	if strings.Contains(rec.Body.String(), "interface conversion") {
+		t.Errorf("body leaks the panic: %s", rec.Body.String())
+	}
+
+	if len(reports) != 1 {
+		t.Fatalf("reports = %d, want 1", len(reports))
+	}
+	if r := reports[0]; r.RequestID != "req-1" || r.Route != "/panic-test/:id" || r.UserID != userID.String() || len(r.Stack) == 0 {
+		t.Errorf("report = %+v, want request id, route, user and stack", r)
+	}
+	out := logs.String()
+	for _, want := range []string{`"msg":"Panic recovered"`, `"request_id":"req-1"`, `"route":"/panic-test/:id"`, `"user_id":"` + userID.String() + `"`, `"msg":"Crash reporter panicked"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("logs do not contain %s: %s", want, out)
+		}
+	}
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	var panics float64
+	for _, family := range families {
+		if family.GetName() != "marketplace_http_panics_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "route" && label.GetValue() == "/panic-test/:id" {
+					panics += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if panics != 1 {
+		t.Errorf("panics of /panic-test/:id = %v, want 1", panics)
+	}
+}
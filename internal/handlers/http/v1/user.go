@@ -0,0 +1,100 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/services"
+)
+
+type UserHTTPHandlers struct {
+	userService services.UserService
+}
+
+func NewUserHTTPHandlers(userService services.UserService) UserHandlers {
+	return &UserHTTPHandlers{userService: userService}
+}
+
+// GetUserProfile godoc
+// @Summary Get user profile
+// @Description Get public profile of a user by login
+// @Tags users
+// @Produce json
+// @Param login path string true "User login"
+// @Success 200 {object} dto.UserProfileResponse
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/users/{login} [get]
+func (h *UserHTTPHandlers) GetUserProfile(c *gin.Context) {
+	profile, err := h.userService.GetUserProfile(c, c.Param("login"))
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, profile)
+}
+
+// GetUserAdvertisements godoc
+// @Summary Get user advertisements
+// @Description Get advertisements of a user (seller storefront) with optional filters by price.
+// @Description Users viewing their own storefront also see scheduled, expired and archived advertisements
+// @Tags users
+// @Produce json
+// @Param login path string true "User login"
+// @Param filters query dto.AdvertisementPageFilters true "Filters for advertisements"
+// @Param Authorization header string false "Bearer token"
+// @Success 200 {array} dto.AdvertisementResponseWithOwnership
+// @Failure 400 {object} Problem "Invalid query parameters or negative price"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/users/{login}/advertisements [get]
+func (h *UserHTTPHandlers) GetUserAdvertisements(c *gin.Context) {
+	filters, ok := bindAdvertisementFilters(c)
+	if !ok {
+		return
+	}
+
+	var viewerID *uuid.UUID
+	if id, exists := c.Get("UserID"); exists {
+		userID := id.(uuid.UUID)
+		viewerID = &userID
+	}
+	advertisements, err := h.userService.GetUserAdvertisements(c, c.Param("login"), filters, viewerID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	respondWithAdvertisements(c, advertisements)
+}
+
+// UpdateMe godoc
+// @Summary Update current user profile
+// @Description Update display name, bio and avatar of the currently authenticated user
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param profile body dto.UserProfileUpdateRequest true "Profile fields to update"
+// @Success 200 {object} dto.UserProfileResponse
+// @Failure 400 {object} Problem "Invalid request body"
+// @Failure 404 {object} Problem "User not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/auth/me [patch]
+func (h *UserHTTPHandlers) UpdateMe(c *gin.Context) {
+	var profileData dto.UserProfileUpdateRequest
+	if err := c.ShouldBindJSON(&profileData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	profile, err := h.userService.UpdateUserProfile(c, id, &profileData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, profile)
+}
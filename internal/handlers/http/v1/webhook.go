@@ -0,0 +1,233 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/services"
+)
+
+type WebhookHTTPHandlers struct {
+	webhookService services.WebhookService
+}
+
+func NewWebhookHTTPHandlers(webhookService services.WebhookService) WebhookHandlers {
+	return &WebhookHTTPHandlers{webhookService: webhookService}
+}
+
+// CreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribe an endpoint to events. Deliveries are signed with the returned secret, which is shown only once.
+// @Description The X-Webhook-Signature header is "t=<unix>,v1=<hex HMAC-SHA256 of "<unix>.<body>">"
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param webhook body dto.WebhookCreateRequest true "Webhook data"
+// @Success 200 {object} dto.WebhookCreatedResponse
+// @Failure 400 {object} Problem "Invalid request body or URL"
+// @Failure 403 {object} Problem "Event type is available to admins only"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks [post]
+func (h *WebhookHTTPHandlers) CreateWebhook(c *gin.Context) {
+	var webhookData dto.WebhookCreateRequest
+	if err := c.ShouldBindJSON(&webhookData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+
+	authUser := c.MustGet("AuthUser").(*dto.AuthenticatedUser)
+	webhook, err := h.webhookService.CreateWebhook(c, authUser, &webhookData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, webhook)
+}
+
+// GetWebhooks godoc
+// @Summary Get webhooks
+// @Description Get webhooks of the currently authenticated user
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} dto.WebhookResponse
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks [get]
+func (h *WebhookHTTPHandlers) GetWebhooks(c *gin.Context) {
+	id := c.MustGet("UserID").(uuid.UUID)
+	webhooks, err := h.webhookService.GetWebhooks(c, id)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, webhooks)
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook
+// @Description Get a webhook of the currently authenticated user
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} dto.WebhookResponse
+// @Failure 400 {object} Problem "Invalid webhook ID"
+// @Failure 404 {object} Problem "Webhook not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks/{id} [get]
+func (h *WebhookHTTPHandlers) GetWebhook(c *gin.Context) {
+	webhookID, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	webhook, err := h.webhookService.GetWebhook(c, id, webhookID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook godoc
+// @Summary Update a webhook
+// @Description Change the URL, event types or description of a webhook. Setting enabled to true re-enables
+// @Description a webhook disabled after repeated failures, false pauses deliveries
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Param webhook body dto.WebhookUpdateRequest true "Webhook changes"
+// @Success 200 {object} dto.WebhookResponse
+// @Failure 400 {object} Problem "Invalid webhook ID, request body or URL"
+// @Failure 403 {object} Problem "Event type is available to admins only"
+// @Failure 404 {object} Problem "Webhook not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks/{id} [patch]
+func (h *WebhookHTTPHandlers) UpdateWebhook(c *gin.Context) {
+	webhookID, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	var webhookData dto.WebhookUpdateRequest
+	if err := c.ShouldBindJSON(&webhookData); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+
+	authUser := c.MustGet("AuthUser").(*dto.AuthenticatedUser)
+	webhook, err := h.webhookService.UpdateWebhook(c, authUser, webhookID, &webhookData)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Delete a webhook of the currently authenticated user together with its delivery log
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Success 204
+// @Failure 400 {object} Problem "Invalid webhook ID"
+// @Failure 404 {object} Problem "Webhook not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks/{id} [delete]
+func (h *WebhookHTTPHandlers) DeleteWebhook(c *gin.Context) {
+	webhookID, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	if err := h.webhookService.DeleteWebhook(c, id, webhookID); err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary Get webhook deliveries
+// @Description Get the delivery log of a webhook, newest first
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Param page_number query int true "Page number" minimum(1)
+// @Param page_size query int true "Page size" minimum(1) maximum(100)
+// @Success 200 {array} dto.WebhookDeliveryResponse
+// @Failure 400 {object} Problem "Invalid webhook ID or query parameters"
+// @Failure 404 {object} Problem "Webhook not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (h *WebhookHTTPHandlers) GetWebhookDeliveries(c *gin.Context) {
+	webhookID, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	var filters dto.WebhookDeliveryFilters
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		abortWithError(c, invalidRequest(err))
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	deliveries, err := h.webhookService.GetWebhookDeliveries(c, id, webhookID, &filters)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusOK, deliveries)
+}
+
+// ReplayWebhookDelivery godoc
+// @Summary Replay a webhook delivery
+// @Description Send a delivery again as soon as possible, whatever its previous outcome
+// @Tags webhooks
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Webhook ID"
+// @Param deliveryID path string true "Delivery ID"
+// @Success 202 {object} dto.WebhookDeliveryResponse
+// @Failure 400 {object} Problem "Invalid webhook or delivery ID"
+// @Failure 404 {object} Problem "Webhook or delivery not found"
+// @Failure 500 {object} Problem "Internal server error"
+// @Router /api/v1/webhooks/{id}/deliveries/{deliveryID}/replay [post]
+func (h *WebhookHTTPHandlers) ReplayWebhookDelivery(c *gin.Context) {
+	webhookID, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := uuid.Parse(c.Param("deliveryID"))
+	if err != nil {
+		abortWithError(c, invalidField("deliveryID", "uuid", "must be a valid UUID"))
+		return
+	}
+
+	id := c.MustGet("UserID").(uuid.UUID)
+	delivery, err := h.webhookService.ReplayWebhookDelivery(c, id, webhookID, deliveryID)
+	if err != nil {
+		abortWithError(c, err)
+		return
+	}
+	c.IndentedJSON(http.StatusAccepted, delivery)
+}
+
+func parseWebhookID(c *gin.Context) (uuid.UUID, bool) {
+	webhookID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abortWithError(c, invalidField("id", "uuid", "must be a valid UUID"))
+		return uuid.Nil, false
+	}
+	return webhookID, true
+}
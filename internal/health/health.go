@@ -0,0 +1,106 @@
+// Package health runs the readiness checks of the dependencies of the
+// service. Liveness needs no checks: a process that can answer is alive.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDraining = "draining"
+)
+
+// Check reports a dependency as unavailable by returning an error. It must
+// give up once ctx is done.
+type Check func(ctx context.Context) error
+
+type ComponentReport struct {
+	Name    string
+	Status  string
+	Latency time.Duration
+	Error   string
+}
+
+type Report struct {
+	Status     string
+	Components []ComponentReport
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs the registered checks concurrently, each bounded by the
+// timeout, and reports not ready while the server is draining.
+type Checker struct {
+	timeout  time.Duration
+	mu       sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a check to readiness. Components are reported in the order
+// they were registered.
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// SetDraining makes readiness fail from now on, so load balancers stop
+// sending requests before the server stops accepting them.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Readiness(ctx context.Context) *Report {
+	if c.draining.Load() {
+		return &Report{Status: StatusDraining, Components: []ComponentReport{}}
+	}
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	report := &Report{Status: StatusOK, Components: make([]ComponentReport, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Components[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		if component.Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check namedCheck) ComponentReport {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.check(ctx)
+	component := ComponentReport{Name: check.name, Status: StatusOK, Latency: time.Since(start)}
+	if err != nil {
+		component.Status = StatusFailing
+		component.Error = err.Error()
+	}
+	return component
+}
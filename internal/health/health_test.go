@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadinessReportsEachComponent(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Register("database", func(context.Context) error { return nil })
+	checker.Register("cache", func(context.Context) error { return errors.New("connection refused") })
+
+	report := checker.Readiness(context.Background())
+	if report.Status != StatusFailing {
+		t.Errorf("Status = %q, want %q", report.Status, StatusFailing)
+	}
+	if len(report.Components) != 2 {
+		t.Fatalf("components = %+v, want 2", report.Components)
+	}
+	if c := report.Components[0]; c.Name != "database" || c.Status != StatusOK || c.Error != "" {
+		t.Errorf("database component = %+v, want ok", c)
+	}
+	if c := report.Components[1]; c.Name != "cache" || c.Status != StatusFailing || c.Error != "connection refused" {
+		t.Errorf("cache component = %+v, want failing with its error", c)
+	}
+}
+
+func TestReadinessTimesOutHangingCheck(t *testing.T) {
+	checker := NewChecker(20 * time.Millisecond)
+	checker.Register("database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := checker.Readiness(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Readiness() took %v, want it bounded by the timeout", elapsed)
+	}
+	if report.Status != StatusFailing {
+		t.Errorf("Status = %q, want %q", report.Status, StatusFailing)
+	}
+}
+
+func TestReadinessWhileDraining(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Register("database", func(context.Context) error { return nil })
+
+	if report := checker.Readiness(context.Background()); report.Status != StatusOK {
+		t.Fatalf("Status before draining = %q, want %q", report.Status, StatusOK)
+	}
+	checker.SetDraining()
+	if report := checker.Readiness(context.Background()); report.Status != StatusDraining {
+		t.Errorf("Status while draining = %q, want %q", report.Status, StatusDraining)
+	}
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresCheck pings the database through the pool.
+func PostgresCheck(pool *pgxpool.Pool) Check {
+	return func(ctx context.Context) error {
+		return pool.Ping(ctx)
+	}
+}
+
+// MigrationCheck verifies that the database schema is at least at the
+// version of the migrations shipped with the binary and that no migration
+// failed halfway. A newer schema passes, so instances of the previous
+// release stay ready while a rolling deploy migrates the database.
+func MigrationCheck(pool *pgxpool.Pool, expected uint) Check {
+	return func(ctx context.Context) error {
+		var version uint
+		var dirty bool
+		err := pool.QueryRow(ctx, "select version, dirty from schema_migrations").Scan(&version, &dirty)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("no migrations applied")
+		}
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if version < expected {
+			return fmt.Errorf("schema version %d, want at least %d", version, expected)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,359 @@
+// Package jobs runs background work stored in Postgres. Jobs are claimed
+// with SELECT ... FOR UPDATE SKIP LOCKED, so any number of app instances
+// can share the queue. Execution is at-least-once: a job whose worker dies
+// is picked up again after its visibility timeout, so handlers must be
+// idempotent.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/backoff"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+var ErrDuplicateJob = errors.New("job with the same unique key is already queued")
+
+// Args is the payload of a job. Its kind selects the handler, so it must
+// be unique and must not change once jobs of that kind have been queued.
+type Args interface {
+	Kind() string
+}
+
+// Job is a claimed job passed to its handler.
+type Job[T Args] struct {
+	ID          uuid.UUID
+	Args        T
+	Attempt     int
+	MaxAttempts int
+}
+
+type EnqueueOptions struct {
+	// RunAt defers the job; the zero value runs it as soon as possible.
+	RunAt time.Time
+	// MaxAttempts overrides the configured default.
+	MaxAttempts int
+	// UniqueKey prevents queuing a job of the same kind and key while one
+	// is still pending or running; Enqueue returns ErrDuplicateJob then.
+	UniqueKey string
+}
+
+type Config struct {
+	Concurrency        int
+	PollInterval       time.Duration
+	VisibilityTimeout  time.Duration
+	ShutdownTimeout    time.Duration
+	DefaultMaxAttempts int
+	RetryBase          time.Duration
+	RetryMax           time.Duration
+	Retention          time.Duration
+}
+
+type handler func(ctx context.Context, job *entities.Job) error
+
+type schedule struct {
+	name     string
+	spec     string
+	schedule Schedule
+	args     Args
+	// due is when the schedule has to be checked again; zero until the
+	// schedule has been stored.
+	due time.Time
+}
+
+type Client struct {
+	jobRepository repositories.JobRepository
+	cfg           Config
+	handlers      map[string]handler
+	schedules     []*schedule
+	wake          chan struct{}
+}
+
+func NewClient(jobRepository repositories.JobRepository, cfg Config) *Client {
+	c := &Client{
+		jobRepository: jobRepository,
+		cfg:           cfg,
+		handlers:      make(map[string]handler),
+		wake:          make(chan struct{}, 1),
+	}
+	Register(c, c.deleteFinishedJobs)
+	c.Schedule("jobs.cleanup", "@hourly", cleanupArgs{})
+	return c
+}
+
+// Register sets the handler for jobs with args of type T. It must be called
+// before Run.
+func Register[T Args](c *Client, handle func(ctx context.Context, job *Job[T]) error) {
+	var zero T
+	c.handlers[zero.Kind()] = func(ctx context.Context, job *entities.Job) error {
+		typed := Job[T]{ID: job.ID, Attempt: job.Attempts, MaxAttempts: job.MaxAttempts}
+		if err := json.Unmarshal(job.Payload, &typed.Args); err != nil {
+			return Permanent(fmt.Errorf("cannot decode job arguments: %w", err))
+		}
+		return handle(ctx, &typed)
+	}
+}
+
+// Schedule enqueues a job with args whenever spec, see ParseSchedule, comes
+// due. With several instances running, each occurrence is enqueued once.
+// Invalid specs are logged and the schedule is skipped.
+func (c *Client) Schedule(name, spec string, args Args) {
+	parsed, err := ParseSchedule(spec)
+	if err == nil && parsed.Next(time.Now()).IsZero() {
+		err = fmt.Errorf("schedule %q never runs", spec)
+	}
+	if err != nil {
+		slog.Error("Job schedule is ignored", slog.String("schedule", name), slog.Any("error", err))
+		return
+	}
+	c.schedules = append(c.schedules, &schedule{name: name, spec: spec, schedule: parsed, args: args})
+}
+
+func (c *Client) Enqueue(ctx context.Context, args Args, opts *EnqueueOptions) error {
+	job, err := c.newJob(args, opts)
+	if err != nil {
+		return err
+	}
+	if err = c.jobRepository.EnqueueJob(ctx, job); err != nil {
+		if errors.Is(err, repositories.ErrAlreadyExists) {
+			return ErrDuplicateJob
+		}
+		return err
+	}
+	if !job.RunAt.After(time.Now()) {
+		c.notify()
+	}
+	return nil
+}
+
+func (c *Client) newJob(args Args, opts *EnqueueOptions) (*entities.Job, error) {
+	if opts == nil {
+		opts = &EnqueueOptions{}
+	}
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode job arguments: %w", err)
+	}
+	// The job times are timestamps without time zone and pgx keeps only
+	// the wall clock of a time, so every time is stored in UTC.
+	job := &entities.Job{
+		Kind:        args.Kind(),
+		Payload:     payload,
+		MaxAttempts: c.cfg.DefaultMaxAttempts,
+		RunAt:       time.Now().UTC(),
+	}
+	if opts.MaxAttempts > 0 {
+		job.MaxAttempts = opts.MaxAttempts
+	}
+	if !opts.RunAt.IsZero() {
+		job.RunAt = opts.RunAt.UTC()
+	}
+	if opts.UniqueKey != "" {
+		job.UniqueKey = &opts.UniqueKey
+	}
+	return job, nil
+}
+
+func (c *Client) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run executes jobs until ctx is cancelled. Running jobs are then given
+// ShutdownTimeout to finish before their contexts are cancelled too.
+func (c *Client) Run(ctx context.Context) {
+	logger := slog.Default().With(slog.String("op", "jobs.Client.Run"))
+
+	kinds := make([]string, 0, len(c.handlers))
+	for kind := range c.handlers {
+		kinds = append(kinds, kind)
+	}
+	logger.Info("Job worker started", slog.Int("concurrency", c.cfg.Concurrency), slog.Any("kinds", kinds))
+
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+	var running sync.WaitGroup
+	slots := make(chan struct{}, c.cfg.Concurrency)
+
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		c.enqueueScheduled(ctx, logger)
+
+		if free := cap(slots) - len(slots); free > 0 && ctx.Err() == nil {
+			jobs, err := c.jobRepository.ClaimJobs(ctx, kinds, free, c.cfg.VisibilityTimeout)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Claiming jobs failed", slog.Any("error", err))
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				running.Add(1)
+				go func() {
+					defer running.Done()
+					c.execute(handlerCtx, job)
+					<-slots
+					c.notify()
+				}()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Job worker stopping", slog.Int("running", len(slots)))
+			c.waitForJobs(&running, cancelHandlers, logger)
+			logger.Info("Job worker stopped")
+			return
+		case <-ticker.C:
+		case <-c.wake:
+		}
+	}
+}
+
+func (c *Client) waitForJobs(running *sync.WaitGroup, cancelHandlers context.CancelFunc, logger *slog.Logger) {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(c.cfg.ShutdownTimeout):
+		logger.Warn("Running jobs did not finish in time and are cancelled")
+		cancelHandlers()
+		<-done
+	}
+}
+
+func (c *Client) enqueueScheduled(ctx context.Context, logger *slog.Logger) {
+	now := time.Now()
+	for _, s := range c.schedules {
+		if now.Before(s.due) {
+			continue
+		}
+		next := s.schedule.Next(now)
+		job, err := c.newJob(s.args, nil)
+		if err == nil {
+			_, err = c.jobRepository.EnqueueScheduledJob(ctx, s.name, s.spec, next.UTC(), job)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Enqueuing scheduled job failed", slog.String("schedule", s.name), slog.Any("error", err))
+			}
+			continue
+		}
+		s.due = next
+	}
+}
+
+func (c *Client) execute(ctx context.Context, job *entities.Job) {
+	logger := slog.Default().With(
+		slog.String("op", "jobs.Client.execute"),
+		slog.String("jobID", job.ID.String()),
+		slog.String("kind", job.Kind),
+		slog.Int("attempt", job.Attempts),
+	)
+
+	// The job must finish before another worker may claim it again.
+	jobCtx, cancel := context.WithTimeout(ctx, c.cfg.VisibilityTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.handle(jobCtx, job, logger)
+	duration := time.Since(start)
+	now := time.Now().UTC()
+	job.LastError = nil
+	switch {
+	case err == nil:
+		job.Status = entities.JobSucceeded
+		job.FinishedAt = &now
+		logger.Debug("Job succeeded", slog.Duration("duration", duration))
+	case ctx.Err() != nil:
+		// Interrupted by shutdown: run again as soon as a worker is up.
+		job.Status = entities.JobPending
+		job.RunAt = now
+		lastError := "interrupted by shutdown: " + err.Error()
+		job.LastError = &lastError
+		logger.Warn("Job interrupted by shutdown", slog.Any("error", err))
+	case job.Attempts >= job.MaxAttempts || isPermanent(err):
+		job.Status = entities.JobFailed
+		job.FinishedAt = &now
+		lastError := err.Error()
+		job.LastError = &lastError
+		logger.Error("Job failed", slog.Any("error", err))
+	default:
+		job.Status = entities.JobPending
+		job.RunAt = now.Add(backoff.Exponential(job.Attempts, c.cfg.RetryBase, c.cfg.RetryMax))
+		lastError := err.Error()
+		job.LastError = &lastError
+		logger.Warn("Job failed and will be retried", slog.Time("runAt", job.RunAt), slog.Any("error", err))
+	}
+
+	saveCtx, cancelSave := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancelSave()
+	if err = c.jobRepository.FinishJob(saveCtx, job); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			logger.Warn("Job was claimed by another worker after its visibility timeout")
+			return
+		}
+		logger.Error("Saving job result failed", slog.Any("error", err))
+	}
+}
+
+func (c *Client) handle(ctx context.Context, job *entities.Job, logger *slog.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Job handler panicked", slog.Any("panic", r), slog.String("stack", string(debug.Stack())))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	handle, ok := c.handlers[job.Kind]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job kind %q", job.Kind))
+	}
+	return handle(ctx, job)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+type cleanupArgs struct{}
+
+func (cleanupArgs) Kind() string { return "jobs.cleanup" }
+
+func (c *Client) deleteFinishedJobs(ctx context.Context, _ *Job[cleanupArgs]) error {
+	deleted, err := c.jobRepository.DeleteFinishedJobs(ctx, time.Now().UTC().Add(-c.cfg.Retention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Info("Finished jobs deleted", slog.String("op", "jobs.Client.deleteFinishedJobs"), slog.Int("count", deleted))
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+// fakeJobRepository keeps jobs in memory and follows the claiming and
+// finishing rules of the Postgres repository.
+type fakeJobRepository struct {
+	repositories.JobRepository
+
+	mu   sync.Mutex
+	jobs []*entities.Job
+}
+
+func (r *fakeJobRepository) EnqueueJob(_ context.Context, job *entities.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job.UniqueKey != nil && slices.ContainsFunc(r.jobs, func(j *entities.Job) bool {
+		return j.Kind == job.Kind && j.UniqueKey != nil && *j.UniqueKey == *job.UniqueKey &&
+			(j.Status == entities.JobPending || j.Status == entities.JobRunning)
+	}) {
+		return repositories.ErrAlreadyExists
+	}
+	job.ID = uuid.New()
+	job.Status = entities.JobPending
+	job.CreatedAt = time.Now().UTC()
+	stored := *job
+	r.jobs = append(r.jobs, &stored)
+	return nil
+}
+
+func (r *fakeJobRepository) ClaimJobs(_ context.Context, kinds []string, limit int, visibilityTimeout time.Duration) ([]*entities.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var claimed []*entities.Job
+	for _, job := range r.jobs {
+		due := job.Status == entities.JobPending && !job.RunAt.After(now) ||
+			job.Status == entities.JobRunning && !job.LockedUntil.After(now)
+		if len(claimed) == limit || !due || !slices.Contains(kinds, job.Kind) {
+			continue
+		}
+		lockedUntil := now.Add(visibilityTimeout)
+		job.Status = entities.JobRunning
+		job.Attempts++
+		job.LockedUntil = &lockedUntil
+		copied := *job
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (r *fakeJobRepository) FinishJob(_ context.Context, job *entities.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := slices.IndexFunc(r.jobs, func(j *entities.Job) bool {
+		return j.ID == job.ID && j.Attempts == job.Attempts && j.Status == entities.JobRunning
+	})
+	if idx < 0 {
+		return repositories.ErrNotFound
+	}
+	stored := r.jobs[idx]
+	stored.Status = job.Status
+	stored.RunAt = job.RunAt
+	stored.LastError = job.LastError
+	stored.FinishedAt = job.FinishedAt
+	stored.LockedUntil = nil
+	return nil
+}
+
+func (r *fakeJobRepository) EnqueueScheduledJob(context.Context, string, string, time.Time, *entities.Job) (bool, error) {
+	return false, nil
+}
+
+// makeDue lets the backoff and the visibility timeout of every job pass.
+func (r *fakeJobRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	past := time.Now().Add(-time.Second)
+	for _, job := range r.jobs {
+		job.RunAt = past
+		if job.LockedUntil != nil {
+			job.LockedUntil = &past
+		}
+	}
+}
+
+func (r *fakeJobRepository) job(t *testing.T) entities.Job {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.jobs) != 1 {
+		t.Fatalf("%d jobs queued, want 1", len(r.jobs))
+	}
+	return *r.jobs[0]
+}
+
+type testArgs struct {
+	Name string `json:"name"`
+}
+
+func (testArgs) Kind() string { return "test.run" }
+
+type jobsTest struct {
+	repository *fakeJobRepository
+	client     *Client
+	// run handles every test job; it succeeds when unset.
+	run func(ctx context.Context, job *Job[testArgs]) error
+}
+
+var testJobsConfig = Config{
+	Concurrency:        2,
+	PollInterval:       time.Hour,
+	VisibilityTimeout:  time.Minute,
+	ShutdownTimeout:    time.Second,
+	DefaultMaxAttempts: 3,
+	RetryBase:          time.Minute,
+	RetryMax:           90 * time.Second,
+}
+
+func newJobsTest(cfg Config) *jobsTest {
+	tt := &jobsTest{repository: &fakeJobRepository{}}
+	tt.client = NewClient(tt.repository, cfg)
+	Register(tt.client, func(ctx context.Context, job *Job[testArgs]) error {
+		if tt.run == nil {
+			return nil
+		}
+		return tt.run(ctx, job)
+	})
+	return tt
+}
+
+func (tt *jobsTest) enqueue(t *testing.T, opts *EnqueueOptions) {
+	t.Helper()
+	if err := tt.client.Enqueue(context.Background(), testArgs{Name: "bike"}, opts); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+}
+
+// work claims due jobs like a worker and executes them one by one.
+func (tt *jobsTest) work(t *testing.T, want int) {
+	t.Helper()
+	jobs, err := tt.repository.ClaimJobs(context.Background(), []string{testArgs{}.Kind()}, 10, tt.client.cfg.VisibilityTimeout)
+	if err != nil {
+		t.Fatalf("ClaimJobs() error = %v", err)
+	}
+	if len(jobs) != want {
+		t.Fatalf("claimed %d jobs, want %d", len(jobs), want)
+	}
+	for _, job := range jobs {
+		tt.client.execute(context.Background(), job)
+	}
+}
+
+func TestClientRunsEnqueuedJob(t *testing.T) {
+	tt := newJobsTest(testJobsConfig)
+	handled := make(chan *Job[testArgs], 1)
+	tt.run = func(_ context.Context, job *Job[testArgs]) error {
+		handled <- job
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		tt.client.Run(ctx)
+		close(stopped)
+	}()
+
+	tt.enqueue(t, nil)
+	select {
+	case job := <-handled:
+		if job.Args.Name != "bike" || job.Attempt != 1 || job.MaxAttempts != 3 {
+			t.Errorf("handled %+v, want the first attempt of the bike job", job)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job was not handled")
+	}
+	cancel()
+	<-stopped
+
+	job := tt.repository.job(t)
+	if job.Status != entities.JobSucceeded || job.FinishedAt == nil || job.LockedUntil != nil {
+		t.Errorf("job = %+v, want succeeded", job)
+	}
+}
+
+func TestEnqueueStoresTimesInUTC(t *testing.T) {
+	tt := newJobsTest(testJobsConfig)
+	runAt := time.Now().Add(time.Hour).In(time.FixedZone("MSK", 3*60*60))
+	tt.enqueue(t, &EnqueueOptions{RunAt: runAt})
+
+	job := tt.repository.job(t)
+	if job.RunAt.Location() != time.UTC || !job.RunAt.Equal(runAt) {
+		t.Errorf("stored RunAt = %v, want %v in UTC", job.RunAt, runAt.UTC())
+	}
+	// Not due before its time.
+	tt.work(t, 0)
+}
+
+func TestEnqueueRejectsDuplicateUniqueKey(t *testing.T) {
+	tt := newJobsTest(testJobsConfig)
+	tt.enqueue(t, &EnqueueOptions{UniqueKey: "bike"})
+
+	err := tt.client.Enqueue(context.Background(), testArgs{Name: "bike"}, &EnqueueOptions{UniqueKey: "bike"})
+	if !errors.Is(err, ErrDuplicateJob) {
+		t.Fatalf("Enqueue() error = %v, want %v", err, ErrDuplicateJob)
+	}
+	// A finished job no longer blocks its key.
+	tt.work(t, 1)
+	tt.enqueue(t, &EnqueueOptions{UniqueKey: "bike"})
+}
+
+func TestClientRetriesWithBackoff(t *testing.T) {
+	tt := newJobsTest(testJobsConfig)
+	tt.run = func(context.Context, *Job[testArgs]) error {
+		return errors.New("connection reset")
+	}
+	tt.enqueue(t, nil)
+
+	for attempt, backoff := range []time.Duration{time.Minute, 90 * time.Second} {
+		start := time.Now()
+		tt.work(t, 1)
+		job := tt.repository.job(t)
+		if job.Status != entities.JobPending || job.Attempts != attempt+1 || job.LastError == nil {
+			t.Fatalf("attempt %d: job = %+v, want pending with the error", attempt+1, job)
+		}
+		if job.RunAt.Location() != time.UTC {
+			t.Errorf("attempt %d: RunAt = %v, want UTC", attempt+1, job.RunAt)
+		}
+		if job.RunAt.Before(start.Add(backoff)) || job.RunAt.After(time.Now().Add(backoff)) {
+			t.Errorf("attempt %d: next run in %v, want %v", attempt+1, time.Until(job.RunAt), backoff)
+		}
+		// Not due before the backoff has passed.
+		tt.work(t, 0)
+		tt.repository.makeDue()
+	}
+
+	tt.work(t, 1)
+	job := tt.repository.job(t)
+	if job.Status != entities.JobFailed || job.Attempts != 3 || job.FinishedAt == nil {
+		t.Fatalf("job = %+v, want failed after 3 attempts", job)
+	}
+	tt.repository.makeDue()
+	tt.work(t, 0)
+}
+
+func TestClientDoesNotRetryPermanentError(t *testing.T) {
+	tt := newJobsTest(testJobsConfig)
+	tt.run = func(context.Context, *Job[testArgs]) error {
+		return Permanent(errors.New("advertisement is gone"))
+	}
+	tt.enqueue(t, nil)
+
+	tt.work(t, 1)
+	if job := tt.repository.job(t); job.Status != entities.JobFailed || job.Attempts != 1 {
+		t.Errorf("job = %+v, want failed after 1 attempt", job)
+	}
+}
+
+func TestClientReclaimsJobAfterVisibilityTimeout(t *testing.T) {
+	tt := newJobsTest(testJobsConfig)
+	tt.enqueue(t, nil)
+
+	// A worker claims the job and dies before finishing it.
+	stale, err := tt.repository.ClaimJobs(context.Background(), []string{testArgs{}.Kind()}, 10, time.Minute)
+	if err != nil || len(stale) != 1 {
+		t.Fatalf("ClaimJobs() = %d jobs, %v, want 1", len(stale), err)
+	}
+	tt.work(t, 0)
+
+	tt.repository.makeDue()
+	tt.run = func(ctx context.Context, job *Job[testArgs]) error {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("handler deadline = %v, want within the visibility timeout", deadline)
+		}
+		if job.Attempt != 2 {
+			t.Errorf("attempt = %d, want 2", job.Attempt)
+		}
+		return nil
+	}
+	tt.work(t, 1)
+
+	// The result of the lost claim is dropped.
+	tt.run = func(context.Context, *Job[testArgs]) error {
+		return errors.New("connection reset")
+	}
+	tt.client.execute(context.Background(), stale[0])
+	job := tt.repository.job(t)
+	if job.Status != entities.JobSucceeded || job.Attempts != 2 {
+		t.Errorf("job = %+v, want succeeded on the second claim", job)
+	}
+}
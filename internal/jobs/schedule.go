@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a periodic job runs next.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(after time.Time) time.Time {
+	return after.Truncate(time.Duration(s)).Add(time.Duration(s))
+}
+
+// cronSchedule is a standard five-field cron expression evaluated in UTC.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+}
+
+var scheduleAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseSchedule accepts "@every <duration>", the usual @hourly-style
+// aliases and five-field cron expressions ("*/15 * * * *") with lists,
+// ranges and steps. Cron expressions are evaluated in UTC.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil || interval < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval must be a duration of at least 1s", spec)
+		}
+		return everySchedule(interval), nil
+	}
+	if alias, ok := scheduleAliases[spec]; ok {
+		spec = alias
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields", spec)
+	}
+	var schedule cronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: minute: %w", spec, err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: hour: %w", spec, err)
+	}
+	if schedule.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: day of month: %w", spec, err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: month: %w", spec, err)
+	}
+	if schedule.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: day of week: %w", spec, err)
+	}
+	// Both 0 and 7 mean Sunday.
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.anyDay = fields[2] == "*"
+	schedule.anyWeekday = fields[4] == "*"
+	return &schedule, nil
+}
+
+func parseCronField(field string, low, high int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		start, end := low, high
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid value %q", first)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid value %q", last)
+				}
+			} else if hasStep {
+				end = high
+			}
+		}
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, low, high)
+		}
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every combination repeats within a few years, so the loop always ends
+	// for valid expressions; the limit guards against impossible dates such
+	// as February 30.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchesDay follows cron: when both day fields are restricted, a day
+// matching either of them is enough.
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday.
+	after := time.Date(2025, time.January, 15, 10, 7, 30, 0, time.UTC)
+	date := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec  string
+		after time.Time
+		want  time.Time
+	}{
+		{"* * * * *", after, date(time.January, 15, 10, 8)},
+		{"*/15 * * * *", after, date(time.January, 15, 10, 15)},
+		{"*/15 * * * *", date(time.January, 15, 10, 15), date(time.January, 15, 10, 30)},
+		{"5/20 * * * *", after, date(time.January, 15, 10, 25)},
+		{"0,30 22 * * *", after, date(time.January, 15, 22, 0)},
+		{"0 * * * *", after, date(time.January, 15, 11, 0)},
+		{"0 9-17/4 * * *", after, date(time.January, 15, 13, 0)},
+		{"10-20 10 * * *", after, date(time.January, 15, 10, 10)},
+		{"30 9 * * *", after, date(time.January, 16, 9, 30)},
+		{"59 23 * * *", date(time.January, 31, 23, 59), date(time.February, 1, 23, 59)},
+		{"0 0 1 * *", after, date(time.February, 1, 0, 0)},
+		{"0 0 31 * *", date(time.January, 31, 0, 0), date(time.March, 31, 0, 0)},
+		{"0 0 * 3 *", after, date(time.March, 1, 0, 0)},
+		{"59 23 31 12 *", after, date(time.December, 31, 23, 59)},
+		{"0 0 1 1 *", after, time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", after, time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1", after, date(time.January, 20, 0, 0)},
+		{"0 0 * * 0", after, date(time.January, 19, 0, 0)},
+		{"0 0 * * 7", after, date(time.January, 19, 0, 0)},
+		{"0 0 * * 1-5", after, date(time.January, 16, 0, 0)},
+		{"0 0 * * 6,0", after, date(time.January, 18, 0, 0)},
+		// Either day field matches when both are restricted.
+		{"0 12 1 * 1", after, date(time.January, 20, 12, 0)},
+		{"0 12 16 * 1", after, date(time.January, 16, 12, 0)},
+		{"@hourly", after, date(time.January, 15, 11, 0)},
+		{"@daily", after, date(time.January, 16, 0, 0)},
+		{"@weekly", after, date(time.January, 19, 0, 0)},
+		{"@monthly", after, date(time.February, 1, 0, 0)},
+		{"@yearly", after, time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 1h", after, date(time.January, 15, 11, 0)},
+		{"@every 90s", after, date(time.January, 15, 10, 9)},
+		{" @every 10m ", after, date(time.January, 15, 10, 10)},
+		// Cron expressions are evaluated in UTC whatever the location.
+		{"0 11 * * *", after.In(time.FixedZone("UTC+3", 3*60*60)), date(time.January, 15, 11, 0)},
+		// February 30 never comes.
+		{"0 0 30 2 *", after, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule() error = %v", err)
+			}
+			if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"@sometimes",
+		"@every",
+		"@every soon",
+		"@every 500ms",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"-1 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"5-1 * * * *",
+		"1-a * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"0-70/10 * * * *",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParseSchedule(spec); err == nil {
+				t.Errorf("ParseSchedule(%q) error = nil", spec)
+			}
+		})
+	}
+}
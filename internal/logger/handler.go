@@ -0,0 +1,109 @@
+package slogger
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// allLevels lets every record through the wrapped handler, which leaves
+// filtering to filterHandler.
+const allLevels = slog.Level(math.MinInt)
+
+// filterHandler drops records below the level of their op and samples
+// info and debug records, then passes the rest to the wrapped handler.
+// The op comes from the logger attributes or from the record itself.
+type filterHandler struct {
+	handler  slog.Handler
+	settings *settings
+	op       string
+}
+
+func newFilterHandler(handler slog.Handler, settings *settings) *filterHandler {
+	return &filterHandler{handler: handler, settings: settings}
+}
+
+func (h *filterHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.op != "" {
+		return level >= h.settings.levelFor(h.op)
+	}
+	return level >= h.settings.minLevel()
+}
+
+func (h *filterHandler) Handle(ctx context.Context, record slog.Record) error {
+	op := h.op
+	if op == "" {
+		record.Attrs(func(attr slog.Attr) bool {
+			if attr.Key == "op" {
+				op = attr.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if record.Level < h.settings.levelFor(op) {
+		return nil
+	}
+	if record.Level <= slog.LevelInfo {
+		if s := h.settings.sampler.Load(); s != nil && !s.allow(record.Message) {
+			return nil
+		}
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+func (h *filterHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handler := *h
+	handler.handler = h.handler.WithAttrs(attrs)
+	for _, attr := range attrs {
+		if attr.Key == "op" {
+			handler.op = attr.Value.String()
+		}
+	}
+	return &handler
+}
+
+func (h *filterHandler) WithGroup(name string) slog.Handler {
+	handler := *h
+	handler.handler = h.handler.WithGroup(name)
+	return &handler
+}
+
+// sampler lets through the first initial records with the same message in
+// each interval and every thereafter-th record after that.
+type sampler struct {
+	initial    int
+	thereafter int
+	interval   time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// newSampler returns nil, which disables sampling, when initial is not
+// positive.
+func newSampler(initial, thereafter int, interval time.Duration) *sampler {
+	if initial <= 0 || interval <= 0 {
+		return nil
+	}
+	return &sampler{initial: initial, thereafter: thereafter, interval: interval, counts: map[string]int{}}
+}
+
+func (s *sampler) allow(message string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); now.Sub(s.windowStart) >= s.interval {
+		s.windowStart = now
+		clear(s.counts)
+	}
+	s.counts[message]++
+	n := s.counts[message]
+	if n <= s.initial {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.initial)%s.thereafter == 0
+}
@@ -0,0 +1,69 @@
+package slogger
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"marketplace/config"
+)
+
+func newTestLogger(t *testing.T, cfg *config.Config) (*slog.Logger, *strings.Builder) {
+	t.Helper()
+	var out strings.Builder
+	var s settings
+	s.level.Set(slog.LevelInfo)
+	if cfg.LogLevelOverrides != nil {
+		overrides := cfg.LogLevelOverrides
+		s.overrides.Store(&overrides)
+	}
+	s.sampler.Store(newSampler(cfg.LogSamplingInitial, cfg.LogSamplingThereafter, time.Hour))
+	handler := slog.NewTextHandler(&out, &slog.HandlerOptions{Level: allLevels})
+	return slog.New(newFilterHandler(handler, &s)), &out
+}
+
+func TestFilterHandlerAppliesOverridesByOpPrefix(t *testing.T) {
+	logger, out := newTestLogger(t, &config.Config{
+		LogLevelOverrides: config.LogLevelOverrides{
+			"services.auth":           slog.LevelDebug,
+			"services.auth.LoginUser": slog.LevelError,
+		},
+	})
+
+	logger.Debug("auth debug", slog.String("op", "services.auth.Authenticate"))
+	logger.With(slog.String("op", "services.auth.CreateUser")).Debug("auth debug from logger attrs")
+	logger.Warn("login warning", slog.String("op", "services.auth.LoginUser"))
+	logger.Debug("authorization debug", slog.String("op", "services.authorization.Check"))
+	logger.Debug("request debug")
+	logger.Info("request info")
+
+	got := out.String()
+	for _, want := range []string{"auth debug", "auth debug from logger attrs", "request info"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+	for _, dropped := range []string{"login warning", "authorization debug", "request debug"} {
+		if strings.Contains(got, dropped) {
+			t.Errorf("output contains %q:\n%s", dropped, got)
+		}
+	}
+}
+
+func TestFilterHandlerSamplesInfoLogs(t *testing.T) {
+	logger, out := newTestLogger(t, &config.Config{LogSamplingInitial: 2, LogSamplingThereafter: 3})
+
+	for range 8 {
+		logger.Info("HTTP request")
+		logger.Warn("slow query")
+	}
+
+	// 2 initial records, then the 3rd and 6th of the remaining 6.
+	if got := strings.Count(out.String(), "HTTP request"); got != 4 {
+		t.Errorf("info records written = %d, want 4", got)
+	}
+	if got := strings.Count(out.String(), "slow query"); got != 8 {
+		t.Errorf("warn records written = %d, want all 8", got)
+	}
+}
@@ -0,0 +1,101 @@
+package slogger
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"marketplace/config"
+)
+
+// settings are read by every record of the default logger and changed at
+// runtime by the admin server and on SIGHUP.
+type settings struct {
+	level     slog.LevelVar
+	overrides atomic.Pointer[config.LogLevelOverrides]
+	sampler   atomic.Pointer[sampler]
+}
+
+var current settings
+
+// Configure applies the log settings of cfg: LOG_LEVEL, falling back to
+// the default of AppEnv, LOG_LEVEL_OVERRIDES and sampling. The previous
+// settings are kept when LOG_LEVEL is invalid.
+func Configure(cfg *config.Config) error {
+	level := defaultLevel(cfg.AppEnv)
+	if cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL: %v", err)
+		}
+	}
+	current.level.Set(level)
+	SetOverrides(cfg.LogLevelOverrides)
+	current.sampler.Store(newSampler(
+		cfg.LogSamplingInitial,
+		cfg.LogSamplingThereafter,
+		time.Duration(cfg.LogSamplingIntervalSeconds)*time.Second,
+	))
+	return nil
+}
+
+func defaultLevel(env config.AppEnv) slog.Level {
+	switch env {
+	case config.Local, config.Dev:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Level returns the minimum level of the logs of ops without an override.
+func Level() slog.Level {
+	return current.level.Level()
+}
+
+func SetLevel(l slog.Level) {
+	current.level.Set(l)
+}
+
+func Overrides() config.LogLevelOverrides {
+	if overrides := current.overrides.Load(); overrides != nil {
+		return maps.Clone(*overrides)
+	}
+	return config.LogLevelOverrides{}
+}
+
+// SetOverrides replaces all overrides, an empty map removes them.
+func SetOverrides(overrides config.LogLevelOverrides) {
+	overrides = maps.Clone(overrides)
+	current.overrides.Store(&overrides)
+}
+
+// levelFor returns the minimum level of the logs of op.
+func (s *settings) levelFor(op string) slog.Level {
+	level := s.level.Level()
+	overrides := s.overrides.Load()
+	if op == "" || overrides == nil {
+		return level
+	}
+	matched := ""
+	for prefix, override := range *overrides {
+		if (op == prefix || strings.HasPrefix(op, prefix+".")) && len(prefix) > len(matched) {
+			matched, level = prefix, override
+		}
+	}
+	return level
+}
+
+// minLevel is the lowest level any op may log at, used before the op of a
+// record is known.
+func (s *settings) minLevel() slog.Level {
+	level := s.level.Level()
+	if overrides := s.overrides.Load(); overrides != nil {
+		for _, override := range *overrides {
+			level = min(level, override)
+		}
+	}
+	return level
+}
@@ -10,32 +10,41 @@ import (
 	"marketplace/config"
 )
 
-func SetLogger(env config.AppEnv) {
-	var defaultLogger *slog.Logger
-	switch env {
+type loggerKey struct{}
+
+// SetLogger installs the default logger. Its level, per op overrides and
+// sampling come from cfg and can be changed at runtime with Configure,
+// SetLevel and SetOverrides.
+func SetLogger(cfg *config.Config) {
+	options := &slog.HandlerOptions{
+		Level:       allLevels,
+		ReplaceAttr: RedactAttr,
+	}
+	var handler slog.Handler
+	switch cfg.AppEnv {
 	case config.Local:
-		prettyHandler := prettylog.NewHandler(&slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		})
-		defaultLogger = slog.New(prettyHandler)
-	case config.Dev:
-		defaultLogger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		}))
-	case config.Prod:
-		defaultLogger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelInfo,
-		}))
+		handler = prettylog.NewHandler(options)
 	default:
-		defaultLogger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelInfo,
-		}))
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+	configErr := Configure(cfg)
+	if configErr != nil {
+		current.level.Set(defaultLevel(cfg.AppEnv))
 	}
-	slog.SetDefault(defaultLogger)
+	slog.SetDefault(slog.New(newFilterHandler(handler, &current)))
+	if configErr != nil {
+		slog.Error("Invalid log settings, using the default level", slog.Any("error", configErr))
+	}
+}
+
+// WithLogger returns a copy of ctx carrying logger, which is what
+// GetLoggerFromContext returns for it and the contexts derived from it.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
 }
 
 func GetLoggerFromContext(ctx context.Context) *slog.Logger {
-	if logger, ok := ctx.Value("Logger").(*slog.Logger); ok {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
 		return logger
 	}
 	return slog.Default()
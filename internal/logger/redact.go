@@ -0,0 +1,36 @@
+package slogger
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive attributes and query parameters.
+const Redacted = "[REDACTED]"
+
+var sensitiveNames = []string{"password", "token", "secret", "authorization", "api_key", "cookie"}
+
+// IsSensitive reports whether an attribute or parameter name suggests a
+// credential, such as new_password, access_token or client_secret. OAuth
+// authorization codes are sensitive as well.
+func IsSensitive(name string) bool {
+	name = strings.ToLower(name)
+	if name == "code" {
+		return true
+	}
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactAttr is a slog.HandlerOptions.ReplaceAttr function hiding the
+// values of sensitive attributes, so a careless log call cannot leak them.
+func RedactAttr(_ []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() != slog.KindGroup && IsSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// CaptureMailer keeps sent messages in memory. It is meant for tests.
+type CaptureMailer struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewCaptureMailer() *CaptureMailer {
+	return &CaptureMailer{}
+}
+
+func (m *CaptureMailer) Send(_ context.Context, message *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, *message)
+	return nil
+}
+
+func (m *CaptureMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
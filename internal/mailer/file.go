@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"marketplace/internal/logger"
+)
+
+// FileMailer appends messages to a file so mail flows can be used locally
+// without a mail server. Without a path it only logs the recipient and
+// subject: bodies carry reset and verification tokens and never go to the
+// logs.
+type FileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path string) Mailer {
+	return &FileMailer{path: path}
+}
+
+func (m *FileMailer) Send(ctx context.Context, message *Message) error {
+	if m.path == "" {
+		slogger.GetLoggerFromContext(ctx).Info("Mail message",
+			slog.String("op", "mailer.file.Send"),
+			slog.String("to", message.To),
+			slog.String("subject", message.Subject),
+		)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("mailer.file.Send error: %v", err)
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC1123Z),
+		message.To,
+		message.Subject,
+		message.Body,
+	)
+	if err != nil {
+		return fmt.Errorf("mailer.file.Send error: %v", err)
+	}
+	return nil
+}
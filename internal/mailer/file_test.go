@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"marketplace/internal/logger"
+)
+
+func TestFileMailerWithoutPathDoesNotLogBody(t *testing.T) {
+	var out bytes.Buffer
+	ctx := slogger.WithLogger(context.Background(), slog.New(slog.NewTextHandler(&out, nil)))
+
+	err := NewFileMailer("").Send(ctx, &Message{
+		To:      "alice@example.com",
+		Subject: "Password reset",
+		Body:    "Use the following token to reset your password: secret-token",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	logged := out.String()
+	if !strings.Contains(logged, "alice@example.com") || !strings.Contains(logged, "Password reset") {
+		t.Errorf("log does not name the recipient and subject:\n%s", logged)
+	}
+	if strings.Contains(logged, "secret-token") {
+		t.Errorf("log contains the message body:\n%s", logged)
+	}
+}
+
+func TestFileMailerAppendsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	mailer := NewFileMailer(path)
+	for _, subject := range []string{"First", "Second"} {
+		if err := mailer.Send(context.Background(), &Message{To: "alice@example.com", Subject: subject, Body: "token"}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Subject: First") || !strings.Contains(string(data), "Subject: Second\n\ntoken") {
+		t.Errorf("file = %q, want both messages", data)
+	}
+}
@@ -0,0 +1,28 @@
+package mailer
+
+import (
+	"context"
+
+	"marketplace/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+func New(cfg *config.Config) Mailer {
+	switch cfg.MailDriver {
+	case config.SMTPMailDriver:
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case config.FileMailDriver:
+		return NewFileMailer(cfg.MailFilePath)
+	default:
+		return NewFileMailer("")
+	}
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message *Message) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", message.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", message.Subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(message.Body)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, []byte(msg.String()))
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("mailer.smtp.Send error: %v", ctx.Err())
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("mailer.smtp.Send error: %v", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+// Package metrics holds the Prometheus collectors of the application. They
+// are registered on Registry rather than on the global default registry, so
+// only what Handler exposes is what the application defines.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "marketplace"
+
+// Label values of the business counters.
+const (
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+
+	PasswordRegistration = "password"
+	OIDCRegistration     = "oidc"
+
+	APIAdvertisementSource    = "api"
+	ImportAdvertisementSource = "import"
+)
+
+// UnmatchedRoute labels requests that matched no route, so scans for
+// random paths do not create a series each.
+const UnmatchedRoute = "unmatched"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by method, route template and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "panics_total",
+		Help:      "Requests that panicked by route template.",
+	}, []string{"route"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts by result. A password login of a user with two-factor authentication counts once its second step is done.",
+	}, []string{"result"})
+
+	registrations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Registered users by method.",
+	}, []string{"method"})
+
+	advertisementsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "advertisements_created_total",
+		Help:      "Created advertisements by source.",
+	}, []string{"source"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		httpPanics,
+		logins,
+		registrations,
+		advertisementsCreated,
+	)
+	// Known label values start at zero instead of appearing with the
+	// first event, which keeps rate() and absent() queries simple.
+	for _, result := range []string{LoginSucceeded, LoginFailed} {
+		logins.WithLabelValues(result)
+	}
+	for _, method := range []string{PasswordRegistration, OIDCRegistration} {
+		registrations.WithLabelValues(method)
+	}
+	for _, source := range []string{APIAdvertisementSource, ImportAdvertisementSource} {
+		advertisementsCreated.WithLabelValues(source)
+	}
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveHTTPRequest records a served request. route must be a route
+// template, never the request path, to keep the number of series bounded.
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// RecordPanic counts a recovered panic. Like ObserveHTTPRequest it takes a
+// route template.
+func RecordPanic(route string) {
+	httpPanics.WithLabelValues(route).Inc()
+}
+
+func RecordLogin(result string) {
+	logins.WithLabelValues(result).Inc()
+}
+
+func RecordRegistration(method string) {
+	registrations.WithLabelValues(method).Inc()
+}
+
+func RecordAdvertisementsCreated(source string, count int) {
+	advertisementsCreated.WithLabelValues(source).Add(float64(count))
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector reads the statistics of a pgx pool on every scrape.
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquires             *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	canceledAcquires     *prometheus.Desc
+	emptyAcquires        *prometheus.Desc
+	newConns             *prometheus.Desc
+	maxLifetimeDestroyed *prometheus.Desc
+	maxIdleDestroyed     *prometheus.Desc
+}
+
+// RegisterPool exposes the statistics of the database connection pool.
+func RegisterPool(pool *pgxpool.Pool) error {
+	return Registry.Register(newPoolCollector(pool))
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:                 pool,
+		acquiredConns:        desc("acquired_connections", "Connections currently in use."),
+		idleConns:            desc("idle_connections", "Connections currently idle."),
+		constructingConns:    desc("constructing_connections", "Connections currently being established."),
+		totalConns:           desc("connections", "Connections currently open."),
+		maxConns:             desc("max_connections", "Maximum size of the pool."),
+		acquires:             desc("acquires_total", "Successful connection acquires."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		canceledAcquires:     desc("canceled_acquires_total", "Acquires cancelled by their context."),
+		emptyAcquires:        desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		newConns:             desc("new_connections_total", "Connections opened."),
+		maxLifetimeDestroyed: desc("max_lifetime_destroyed_total", "Connections closed for reaching their maximum lifetime."),
+		maxIdleDestroyed:     desc("max_idle_destroyed_total", "Connections closed for being idle too long."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	gauge := func(desc *prometheus.Desc, value int32) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value))
+	}
+	counter := func(desc *prometheus.Desc, value int64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value))
+	}
+	gauge(c.acquiredConns, stat.AcquiredConns())
+	gauge(c.idleConns, stat.IdleConns())
+	gauge(c.constructingConns, stat.ConstructingConns())
+	gauge(c.totalConns, stat.TotalConns())
+	gauge(c.maxConns, stat.MaxConns())
+	counter(c.acquires, stat.AcquireCount())
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	counter(c.canceledAcquires, stat.CanceledAcquireCount())
+	counter(c.emptyAcquires, stat.EmptyAcquireCount())
+	counter(c.newConns, stat.NewConnsCount())
+	counter(c.maxLifetimeDestroyed, stat.MaxLifetimeDestroyCount())
+	counter(c.maxIdleDestroyed, stat.MaxIdleDestroyCount())
+}
@@ -0,0 +1,347 @@
+// Package oidc is a minimal OpenID Connect relying party: provider
+// discovery, the authorization code flow with PKCE and ID token
+// verification against the provider JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"marketplace/config"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrUnknownKey     = errors.New("unknown signing key")
+)
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// minKeyRefreshInterval throttles JWKS refetches for unknown key ids, so
+// that tokens with made-up ids cannot make the client hammer the provider.
+const minKeyRefreshInterval = time.Minute
+
+type Client struct {
+	provider   config.OIDCProvider
+	httpClient *http.Client
+
+	// fetchMu serializes requests to the provider, mu guards the cached
+	// results and is never held during a request.
+	fetchMu       sync.Mutex
+	mu            sync.Mutex
+	discovery     *discovery
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewClient(provider config.OIDCProvider, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{provider: provider, httpClient: httpClient}
+}
+
+func (c *Client) Name() string {
+	return c.provider.Name
+}
+
+// AuthCodeURL returns the URL of the provider login page. codeVerifier is
+// the PKCE verifier that must be passed to Exchange.
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	d, err := c.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	scopes := c.provider.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", c.provider.ClientID)
+	query.Set("redirect_uri", c.provider.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the
+// verified ID token claims.
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	d, err := c.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.provider.RedirectURL)
+	form.Set("client_id", c.provider.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if c.provider.ClientSecret != "" {
+		form.Set("client_secret", c.provider.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oidc.Exchange error: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = c.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("oidc.Exchange error: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("oidc.Exchange error: %w: token response has no id_token", ErrInvalidIDToken)
+	}
+	return c.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	d, err := c.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return c.getKey(ctx, kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidIDToken
+	}
+	if !claims.VerifyIssuer(d.Issuer, true) {
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidIDToken)
+	}
+	if !claims.VerifyAudience(c.provider.ClientID, true) {
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	result := &Claims{}
+	result.Subject, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	result.Name, _ = claims["name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+	if result.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	return result, nil
+}
+
+func (c *Client) getDiscovery(ctx context.Context) (*discovery, error) {
+	if d := c.cachedDiscovery(); d != nil {
+		return d, nil
+	}
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	if d := c.cachedDiscovery(); d != nil {
+		return d, nil
+	}
+
+	wellKnown := strings.TrimSuffix(c.provider.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc.discovery error: %v", err)
+	}
+	var d discovery
+	if err = c.doJSON(req, &d); err != nil {
+		return nil, fmt.Errorf("oidc.discovery error: %v", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != strings.TrimSuffix(c.provider.IssuerURL, "/") {
+		return nil, fmt.Errorf("oidc.discovery error: issuer %q does not match %q", d.Issuer, c.provider.IssuerURL)
+	}
+
+	c.mu.Lock()
+	c.discovery = &d
+	c.mu.Unlock()
+	return &d, nil
+}
+
+func (c *Client) cachedDiscovery() *discovery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.discovery
+}
+
+// getKey returns the verification key with the given id. The key set is
+// refetched when the id is unknown, which handles provider key rotation,
+// but at most once per minKeyRefreshInterval.
+func (c *Client) getKey(ctx context.Context, kid string) (any, error) {
+	if key, ok, _ := c.cachedKey(kid); ok {
+		return key, nil
+	}
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// Another caller may have refetched the set while this one waited.
+	key, ok, fetchedAt := c.cachedKey(kid)
+	if ok {
+		return key, nil
+	}
+	if time.Since(fetchedAt) < minKeyRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+	d := c.cachedDiscovery()
+	if d == nil {
+		return nil, fmt.Errorf("oidc.jwks error: provider is not discovered")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("oidc.jwks error: %v", err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = c.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("oidc.jwks error: %v", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = publicKey
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.keysFetchedAt = time.Now()
+	c.mu.Unlock()
+
+	if key, ok = keys[kid]; !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (c *Client) cachedKey(kid string) (any, bool, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key, ok := c.keys[kid]
+	return key, ok, c.keysFetchedAt
+}
+
+func (c *Client) doJSON(req *http.Request, v any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, req.URL.Redacted())
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
@@ -0,0 +1,206 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"marketplace/internal/oidc/oidctest"
+)
+
+func newTestClient(t *testing.T) (*oidctest.Issuer, *Client) {
+	t.Helper()
+	issuer := oidctest.NewIssuer()
+	t.Cleanup(issuer.Close)
+	return issuer, NewClient(issuer.Provider("test"), nil)
+}
+
+func TestExchange(t *testing.T) {
+	issuer, client := newTestClient(t)
+	authorizationURL, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, _ := url.Parse(authorizationURL)
+	if got := parsed.Query().Get("redirect_uri"); got != oidctest.RedirectURL {
+		t.Errorf("redirect_uri = %q, want %q", got, oidctest.RedirectURL)
+	}
+	claims := issuer.Claims("subject-1")
+	claims["email"] = "alice@example.com"
+	claims["email_verified"] = true
+	claims["preferred_username"] = "alice"
+	claims["name"] = "Alice"
+	code, state, err := issuer.Authorize(authorizationURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if state != "state" {
+		t.Errorf("state = %q, want state", state)
+	}
+
+	got, err := client.Exchange(context.Background(), code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	want := Claims{
+		Subject:           "subject-1",
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "alice",
+		Name:              "Alice",
+	}
+	if *got != want {
+		t.Errorf("Exchange() = %+v, want %+v", *got, want)
+	}
+}
+
+func TestExchangeRejectsWrongCodeVerifier(t *testing.T) {
+	issuer, client := newTestClient(t)
+	authorizationURL, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	code, _, err := issuer.Authorize(authorizationURL, issuer.Claims("subject-1"))
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+
+	if _, err = client.Exchange(context.Background(), code, "other verifier", "nonce"); err == nil {
+		t.Error("Exchange() error = nil, want the token endpoint to refuse the code")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer, client := newTestClient(t)
+	valid := func() jwt.MapClaims {
+		claims := issuer.Claims("subject-1")
+		claims["nonce"] = "nonce"
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		token  func() string
+		nonce  string
+		wantOK bool
+	}{
+		{"valid", func() string { return issuer.Sign(valid()) }, "nonce", true},
+		{"nonce mismatch", func() string { return issuer.Sign(valid()) }, "other", false},
+		{"missing nonce", func() string {
+			claims := valid()
+			delete(claims, "nonce")
+			return issuer.Sign(claims)
+		}, "nonce", false},
+		{"wrong issuer", func() string {
+			claims := valid()
+			claims["iss"] = "https://evil.example.com"
+			return issuer.Sign(claims)
+		}, "nonce", false},
+		{"wrong audience", func() string {
+			claims := valid()
+			claims["aud"] = "someone-else"
+			return issuer.Sign(claims)
+		}, "nonce", false},
+		{"expired", func() string {
+			claims := valid()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			return issuer.Sign(claims)
+		}, "nonce", false},
+		{"missing subject", func() string {
+			claims := valid()
+			delete(claims, "sub")
+			return issuer.Sign(claims)
+		}, "nonce", false},
+		{"hmac signed", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, valid())
+			signed, _ := token.SignedString([]byte(oidctest.ClientSecret))
+			return signed
+		}, "nonce", false},
+		{"unsigned", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, valid())
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}, "nonce", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.VerifyIDToken(context.Background(), tt.token(), tt.nonce)
+			if tt.wantOK && err != nil {
+				t.Errorf("VerifyIDToken() error = %v", err)
+			}
+			if !tt.wantOK && !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("VerifyIDToken() error = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenAfterKeyRotation(t *testing.T) {
+	issuer, client := newTestClient(t)
+	claims := issuer.Claims("subject-1")
+	claims["nonce"] = "nonce"
+	if _, err := client.VerifyIDToken(context.Background(), issuer.Sign(claims), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+
+	// The throttle would otherwise hide the new key for a minute.
+	client.keysFetchedAt = time.Now().Add(-minKeyRefreshInterval)
+	issuer.RotateKey()
+	if _, err := client.VerifyIDToken(context.Background(), issuer.Sign(claims), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken() after rotation error = %v", err)
+	}
+	if got := issuer.JWKSRequests(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", got)
+	}
+}
+
+func TestUnknownKeyRefetchIsThrottled(t *testing.T) {
+	issuer, client := newTestClient(t)
+	claims := issuer.Claims("subject-1")
+	claims["nonce"] = "nonce"
+	if _, err := client.VerifyIDToken(context.Background(), issuer.Sign(claims), "nonce"); err != nil {
+		t.Fatalf("VerifyIDToken() error = %v", err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+			token.Header["kid"] = "made-up"
+			signed, _ := token.SignedString(otherKey)
+			if _, err := client.VerifyIDToken(context.Background(), signed, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("VerifyIDToken() error = %v, want %v", err, ErrInvalidIDToken)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	issuer, _ := newTestClient(t)
+	provider := issuer.Provider("test")
+	// The same server under another name announces a different issuer.
+	provider.IssuerURL = strings.Replace(issuer.URL(), "127.0.0.1", "localhost", 1)
+	client := NewClient(provider, nil)
+
+	if _, err := client.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Error("AuthCodeURL() error = nil, want an issuer mismatch")
+	}
+}
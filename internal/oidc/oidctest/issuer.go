@@ -0,0 +1,203 @@
+// Package oidctest provides an in-process OpenID Connect issuer for tests
+// of the relying party.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"marketplace/config"
+)
+
+const (
+	ClientID     = "marketplace"
+	ClientSecret = "secret"
+	RedirectURL  = "http://localhost/callback"
+)
+
+type authorization struct {
+	nonce         string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+// Issuer serves discovery, JWKS and token endpoints. Codes are created
+// with Authorize instead of a login page.
+type Issuer struct {
+	server *httptest.Server
+
+	mu             sync.Mutex
+	key            *rsa.PrivateKey
+	kid            string
+	keyCount       int
+	authorizations map[string]authorization
+
+	jwksRequests atomic.Int64
+}
+
+func NewIssuer() *Issuer {
+	issuer := &Issuer{authorizations: make(map[string]authorization)}
+	issuer.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("POST /token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	return issuer
+}
+
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+func (i *Issuer) URL() string {
+	return i.server.URL
+}
+
+// Provider returns the relying party configuration for the issuer.
+func (i *Issuer) Provider(name string) config.OIDCProvider {
+	return config.OIDCProvider{
+		Name:         name,
+		IssuerURL:    i.server.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  RedirectURL,
+	}
+}
+
+// RotateKey replaces the signing key with one under a new key id.
+func (i *Issuer) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keyCount++
+	i.key = key
+	i.kid = fmt.Sprintf("key-%d", i.keyCount)
+}
+
+// JWKSRequests reports how often the key set was fetched.
+func (i *Issuer) JWKSRequests() int {
+	return int(i.jwksRequests.Load())
+}
+
+// Claims returns valid ID token claims for subject, to be adjusted by
+// tests before they are passed to Authorize or Sign.
+func (i *Issuer) Claims(subject string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": i.server.URL,
+		"aud": ClientID,
+		"sub": subject,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// Authorize plays the login page: it accepts the authorization URL built by
+// the relying party and returns the code and state it would redirect with.
+// The ID token issued for the code carries claims and the request nonce.
+func (i *Issuer) Authorize(authorizationURL string, claims jwt.MapClaims) (code, state string, err error) {
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != ClientID || query.Get("code_challenge_method") != "S256" {
+		return "", "", fmt.Errorf("unexpected authorization request %s", parsed.RawQuery)
+	}
+	code = rand.Text()
+	i.mu.Lock()
+	i.authorizations[code] = authorization{
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		claims:        claims,
+	}
+	i.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+// Sign returns claims signed with the current key.
+func (i *Issuer) Sign(claims jwt.MapClaims) string {
+	i.mu.Lock()
+	key, kid := i.key, i.kid
+	i.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 i.server.URL,
+		"authorization_endpoint": i.server.URL + "/authorize",
+		"token_endpoint":         i.server.URL + "/token",
+		"jwks_uri":               i.server.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	i.jwksRequests.Add(1)
+	i.mu.Lock()
+	key, kid := i.key.PublicKey, i.kid
+	i.mu.Unlock()
+	writeJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("client_id") != ClientID || r.PostForm.Get("client_secret") != ClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+	i.mu.Lock()
+	auth, ok := i.authorizations[r.PostForm.Get("code")]
+	delete(i.authorizations, r.PostForm.Get("code"))
+	i.mu.Unlock()
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.codeChallenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{"nonce": auth.nonce}
+	for name, value := range auth.claims {
+		claims[name] = value
+	}
+	writeJSON(w, map[string]string{"id_token": i.Sign(claims), "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,54 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"marketplace/internal/entities"
+)
+
+// AllEvents subscribes a handler to every event type.
+const AllEvents = "*"
+
+type Handler func(ctx context.Context, event *entities.OutboxEvent) error
+
+// Bus is an in-process sink dispatching events to subscribed handlers.
+// A handler error makes the relay retry the event, which is delivered again
+// to every handler.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+func (b *Bus) Name() string {
+	return "bus"
+}
+
+func (b *Bus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *Bus) Publish(ctx context.Context, event *entities.OutboxEvent) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler(nil), b.handlers[event.EventType]...), b.handlers[AllEvents]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := handler(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("bus handlers failed: %w", errors.Join(errs...))
+	}
+	return nil
+}
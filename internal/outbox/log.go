@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+
+	"marketplace/internal/entities"
+)
+
+// LogSink writes events to the application log. It is useful in development
+// and as an audit trail.
+type LogSink struct{}
+
+func NewLogSink() *LogSink {
+	return &LogSink{}
+}
+
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+func (s *LogSink) Publish(ctx context.Context, event *entities.OutboxEvent) error {
+	slog.InfoContext(ctx, "Domain event",
+		slog.String("op", "outbox.LogSink.Publish"),
+		slog.String("eventID", event.EventID.String()),
+		slog.String("eventType", event.EventType),
+		slog.String("aggregateType", event.AggregateType),
+		slog.String("aggregateID", event.AggregateID.String()),
+		slog.String("payload", string(event.Payload)),
+	)
+	return nil
+}
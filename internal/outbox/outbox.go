@@ -0,0 +1,69 @@
+// Package outbox delivers domain events recorded in the outbox table to
+// sinks. Delivery is at-least-once, so sinks must tolerate duplicates and
+// can use the event id to drop them.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/config"
+	"marketplace/internal/entities"
+)
+
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event *entities.OutboxEvent) error
+}
+
+// Envelope is the wire format of an event sent outside the process.
+type Envelope struct {
+	ID            uuid.UUID       `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   uuid.UUID       `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+func NewEnvelope(event *entities.OutboxEvent) *Envelope {
+	return &Envelope{
+		ID:            event.EventID,
+		Type:          event.EventType,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		OccurredAt:    event.CreatedAt,
+		Data:          event.Payload,
+	}
+}
+
+// NewSinks builds the sinks enabled in the config. The bus is always
+// returned so in-process subscribers can register even if it is not
+// enabled as a sink.
+func NewSinks(cfg *config.Config) ([]Sink, *Bus) {
+	bus := NewBus()
+	var sinks []Sink
+	for _, name := range cfg.OutboxSinks {
+		switch name {
+		case config.BusOutboxSink:
+			sinks = append(sinks, bus)
+		case config.WebhookOutboxSink:
+			if cfg.OutboxWebhookURL == "" {
+				slog.Warn("Outbox webhook sink has no URL and is disabled")
+				continue
+			}
+			client := &http.Client{Timeout: time.Duration(cfg.OutboxWebhookTimeoutSeconds) * time.Second}
+			sinks = append(sinks, NewWebhookSink(cfg.OutboxWebhookURL, client))
+		case config.LogOutboxSink:
+			sinks = append(sinks, NewLogSink())
+		default:
+			slog.Warn("Unknown outbox sink is ignored", slog.String("sink", string(name)))
+		}
+	}
+	return sinks, bus
+}
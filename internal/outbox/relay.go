@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"marketplace/internal/backoff"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+const cleanupInterval = time.Hour
+
+type RelayConfig struct {
+	BatchSize    int
+	PollInterval time.Duration
+	Lease        time.Duration
+	MaxAttempts  int
+	RetryBase    time.Duration
+	RetryMax     time.Duration
+	Retention    time.Duration
+}
+
+// Relay polls the outbox and hands due events to every sink. An event that
+// fails in any sink is retried with exponential backoff and dead-lettered
+// after MaxAttempts, which also unblocks later events of its aggregate.
+// Events are claimed with a lease and published outside of any
+// transaction, so publishing is never undone by a later database error.
+type Relay struct {
+	outboxRepository repositories.OutboxRepository
+	sinks            []Sink
+	cfg              RelayConfig
+}
+
+func NewRelay(outboxRepository repositories.OutboxRepository, sinks []Sink, cfg RelayConfig) *Relay {
+	return &Relay{outboxRepository: outboxRepository, sinks: sinks, cfg: cfg}
+}
+
+// Run relays events until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	logger := slog.Default().With(slog.String("op", "outbox.Relay.Run"))
+	logger.Info("Outbox relay started", slog.Int("sinks", len(r.sinks)))
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+
+	for {
+		processed, err := r.relayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Outbox batch failed", slog.Any("error", err))
+		}
+
+		if r.cfg.Retention > 0 && time.Since(lastCleanup) > cleanupInterval && ctx.Err() == nil {
+			lastCleanup = time.Now()
+			deleted, err := r.outboxRepository.DeleteDeliveredOutboxEvents(ctx, time.Now().UTC().Add(-r.cfg.Retention))
+			if err != nil {
+				logger.Error("Outbox cleanup failed", slog.Any("error", err))
+			} else if deleted > 0 {
+				logger.Info("Delivered outbox events deleted", slog.Int("count", deleted))
+			}
+		}
+
+		// A full batch means more events are probably waiting.
+		if err == nil && processed == r.cfg.BatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch claims a batch of events, publishes them and records each
+// outcome. Publishing stops when the lease runs out, since another relay
+// may claim the remaining events from then on.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	logger := slog.Default().With(slog.String("op", "outbox.Relay.relayBatch"))
+
+	events, err := r.outboxRepository.ClaimOutboxEvents(ctx, r.cfg.BatchSize, r.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+	leaseCtx, cancel := context.WithTimeout(ctx, r.cfg.Lease)
+	defer cancel()
+
+	for _, event := range events {
+		if leaseCtx.Err() != nil {
+			break
+		}
+		leasedUntil := event.NextAttemptAt
+		r.deliver(leaseCtx, event)
+		if event.DeliveredAt == nil && leaseCtx.Err() != nil {
+			// Cut short by shutdown or the end of the lease, which does not
+			// count as an attempt.
+			break
+		}
+
+		saveCtx, cancelSave := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		err = r.outboxRepository.UpdateOutboxEvent(saveCtx, event, leasedUntil)
+		cancelSave()
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			logger.Warn("Outbox event was claimed again after its lease", slog.String("eventID", event.EventID.String()))
+		case err != nil:
+			return 0, err
+		}
+	}
+	return len(events), nil
+}
+
+func (r *Relay) deliver(ctx context.Context, event *entities.OutboxEvent) {
+	logger := slog.Default().With(
+		slog.String("op", "outbox.Relay.deliver"),
+		slog.String("eventID", event.EventID.String()),
+		slog.String("eventType", event.EventType),
+	)
+
+	var errs []error
+	for _, sink := range r.sinks {
+		if err := sink.Publish(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+
+	// The event times are timestamps without time zone compared with now()
+	// in SQL, and pgx keeps only the wall clock of a time, so every time is
+	// stored in UTC.
+	now := time.Now().UTC()
+	event.Attempts++
+	if len(errs) == 0 {
+		event.DeliveredAt = &now
+		event.LastError = nil
+		return
+	}
+
+	lastError := errors.Join(errs...).Error()
+	event.LastError = &lastError
+	if event.Attempts >= r.cfg.MaxAttempts {
+		event.DeadLetteredAt = &now
+		logger.Error("Outbox event dead-lettered", slog.Int("attempts", event.Attempts), slog.String("error", lastError))
+		return
+	}
+	event.NextAttemptAt = now.Add(backoff.Exponential(event.Attempts, r.cfg.RetryBase, r.cfg.RetryMax))
+	logger.Warn("Outbox event delivery failed",
+		slog.Int("attempts", event.Attempts),
+		slog.Time("nextAttemptAt", event.NextAttemptAt),
+		slog.String("error", lastError),
+	)
+}
@@ -0,0 +1,300 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+// fakeOutboxRepository keeps events in memory and follows the claiming and
+// lease rules of the Postgres repository.
+type fakeOutboxRepository struct {
+	repositories.OutboxRepository
+
+	mu     sync.Mutex
+	events []*entities.OutboxEvent
+}
+
+func (r *fakeOutboxRepository) add(aggregateID uuid.UUID) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event := &entities.OutboxEvent{
+		ID:            int64(len(r.events) + 1),
+		EventID:       uuid.New(),
+		AggregateType: entities.AdvertisementAggregate,
+		AggregateID:   aggregateID,
+		EventType:     entities.AdvertisementUpdatedEvent,
+		Payload:       []byte(`{}`),
+		CreatedAt:     time.Now(),
+		NextAttemptAt: time.Now(),
+	}
+	r.events = append(r.events, event)
+	return event.ID
+}
+
+func (r *fakeOutboxRepository) ClaimOutboxEvents(_ context.Context, limit int, lease time.Duration) ([]*entities.OutboxEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var claimed []*entities.OutboxEvent
+	for _, event := range r.events {
+		if len(claimed) == limit || !pending(event) || event.NextAttemptAt.After(now) {
+			continue
+		}
+		if slices.ContainsFunc(r.events, func(p *entities.OutboxEvent) bool {
+			return p.AggregateID == event.AggregateID && p.ID < event.ID && pending(p)
+		}) {
+			continue
+		}
+		event.NextAttemptAt = now.Add(lease)
+		copied := *event
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (r *fakeOutboxRepository) UpdateOutboxEvent(_ context.Context, event *entities.OutboxEvent, leasedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.events[event.ID-1]
+	if !stored.NextAttemptAt.Equal(leasedUntil) {
+		return repositories.ErrNotFound
+	}
+	*stored = *event
+	return nil
+}
+
+func pending(event *entities.OutboxEvent) bool {
+	return event.DeliveredAt == nil && event.DeadLetteredAt == nil
+}
+
+// makeDue lets the backoff and the lease of every pending event pass.
+func (r *fakeOutboxRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range r.events {
+		event.NextAttemptAt = time.Now()
+	}
+}
+
+func (r *fakeOutboxRepository) event(id int64) entities.OutboxEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.events[id-1]
+}
+
+// fakeSink records the events it is handed and fails them while fail
+// returns an error.
+type fakeSink struct {
+	mu     sync.Mutex
+	events []int64
+	fail   func(ctx context.Context, event *entities.OutboxEvent) error
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Publish(ctx context.Context, event *entities.OutboxEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, event.ID)
+	s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail(ctx, event)
+	}
+	return nil
+}
+
+func (s *fakeSink) published() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.events)
+}
+
+type relayTest struct {
+	repository *fakeOutboxRepository
+	sink       *fakeSink
+	relay      *Relay
+}
+
+var testRelayConfig = RelayConfig{
+	BatchSize:   10,
+	Lease:       time.Minute,
+	MaxAttempts: 3,
+	RetryBase:   time.Minute,
+	RetryMax:    90 * time.Second,
+}
+
+func newRelayTest(cfg RelayConfig) *relayTest {
+	repository := &fakeOutboxRepository{}
+	sink := &fakeSink{}
+	return &relayTest{
+		repository: repository,
+		sink:       sink,
+		relay:      NewRelay(repository, []Sink{sink}, cfg),
+	}
+}
+
+func (tt *relayTest) relayBatch(t *testing.T, want int) {
+	t.Helper()
+	claimed, err := tt.relay.relayBatch(context.Background())
+	if err != nil {
+		t.Fatalf("relayBatch() error = %v", err)
+	}
+	if claimed != want {
+		t.Fatalf("relayBatch() claimed %d events, want %d", claimed, want)
+	}
+}
+
+func TestRelayDeliversEventsOfAggregateInOrder(t *testing.T) {
+	tt := newRelayTest(testRelayConfig)
+	bike, lamp := uuid.New(), uuid.New()
+	bikeCreated := tt.repository.add(bike)
+	lampCreated := tt.repository.add(lamp)
+	bikeUpdated := tt.repository.add(bike)
+	tt.sink.fail = func(_ context.Context, event *entities.OutboxEvent) error {
+		if event.ID == bikeCreated && event.Attempts == 0 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}
+
+	// The failed event holds back the later event of its aggregate but not
+	// the events of other aggregates.
+	tt.relayBatch(t, 2)
+	tt.repository.makeDue()
+	tt.relayBatch(t, 1)
+	tt.relayBatch(t, 1)
+	tt.relayBatch(t, 0)
+
+	want := []int64{bikeCreated, lampCreated, bikeCreated, bikeUpdated}
+	if published := tt.sink.published(); !slices.Equal(published, want) {
+		t.Errorf("published %v, want %v", published, want)
+	}
+	for _, id := range want {
+		if event := tt.repository.event(id); event.DeliveredAt == nil {
+			t.Errorf("event %d = %+v, want delivered", id, event)
+		}
+	}
+}
+
+func TestRelayRetriesWithBackoff(t *testing.T) {
+	tt := newRelayTest(testRelayConfig)
+	id := tt.repository.add(uuid.New())
+	tt.sink.fail = func(context.Context, *entities.OutboxEvent) error {
+		return errors.New("broker unavailable")
+	}
+
+	for attempt, backoff := range []time.Duration{time.Minute, 90 * time.Second} {
+		start := time.Now()
+		tt.relayBatch(t, 1)
+		event := tt.repository.event(id)
+		if event.Attempts != attempt+1 || !pending(&event) {
+			t.Fatalf("attempt %d: event = %+v, want pending", attempt+1, event)
+		}
+		if event.LastError == nil || !strings.Contains(*event.LastError, "fake: broker unavailable") {
+			t.Errorf("attempt %d: last error = %v, want the sink error", attempt+1, event.LastError)
+		}
+		if event.NextAttemptAt.Location() != time.UTC {
+			t.Errorf("attempt %d: NextAttemptAt = %v, want UTC", attempt+1, event.NextAttemptAt)
+		}
+		if event.NextAttemptAt.Before(start.Add(backoff)) || event.NextAttemptAt.After(time.Now().Add(backoff)) {
+			t.Errorf("attempt %d: next attempt in %v, want %v", attempt+1, time.Until(event.NextAttemptAt), backoff)
+		}
+		// Not due before the backoff has passed.
+		tt.relayBatch(t, 0)
+		tt.repository.makeDue()
+	}
+}
+
+func TestRelayDeadLettersAfterMaxAttempts(t *testing.T) {
+	cfg := testRelayConfig
+	cfg.MaxAttempts = 2
+	tt := newRelayTest(cfg)
+	aggregateID := uuid.New()
+	failing := tt.repository.add(aggregateID)
+	next := tt.repository.add(aggregateID)
+	tt.sink.fail = func(_ context.Context, event *entities.OutboxEvent) error {
+		if event.ID == failing {
+			return errors.New("payload rejected")
+		}
+		return nil
+	}
+
+	tt.relayBatch(t, 1)
+	tt.repository.makeDue()
+	tt.relayBatch(t, 1)
+	event := tt.repository.event(failing)
+	if event.DeadLetteredAt == nil || event.DeliveredAt != nil || event.Attempts != 2 {
+		t.Fatalf("event = %+v, want dead-lettered after 2 attempts", event)
+	}
+
+	// Dead-lettering unblocks the rest of the aggregate.
+	tt.relayBatch(t, 1)
+	if event = tt.repository.event(next); event.DeliveredAt == nil {
+		t.Errorf("event = %+v, want delivered", event)
+	}
+	tt.repository.makeDue()
+	tt.relayBatch(t, 0)
+}
+
+func TestRelayStopsAtEndOfLease(t *testing.T) {
+	cfg := testRelayConfig
+	cfg.Lease = 50 * time.Millisecond
+	tt := newRelayTest(cfg)
+	slow := tt.repository.add(uuid.New())
+	tt.repository.add(uuid.New())
+	tt.sink.fail = func(ctx context.Context, _ *entities.OutboxEvent) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tt.relayBatch(t, 2)
+
+	if published := tt.sink.published(); !slices.Equal(published, []int64{slow}) {
+		t.Errorf("published %v, want only event %d", published, slow)
+	}
+	// The cut short attempt is not recorded, so the event is retried with
+	// its attempts intact once the lease expires.
+	event := tt.repository.event(slow)
+	if event.Attempts != 0 || event.LastError != nil || !pending(&event) {
+		t.Errorf("event = %+v, want it untouched", event)
+	}
+	tt.sink.fail = nil
+	tt.repository.makeDue()
+	tt.relayBatch(t, 2)
+}
+
+func TestRelayDropsResultOfExpiredLease(t *testing.T) {
+	tt := newRelayTest(testRelayConfig)
+	reclaimed := tt.repository.add(uuid.New())
+	next := tt.repository.add(uuid.New())
+	tt.sink.fail = func(_ context.Context, event *entities.OutboxEvent) error {
+		if event.ID == reclaimed {
+			// Another relay claims the event after the lease expired.
+			tt.repository.mu.Lock()
+			tt.repository.events[event.ID-1].NextAttemptAt = time.Now().Add(time.Minute)
+			tt.repository.mu.Unlock()
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}
+
+	tt.relayBatch(t, 2)
+
+	if event := tt.repository.event(reclaimed); event.Attempts != 0 || event.LastError != nil {
+		t.Errorf("event = %+v, want the result of the expired lease dropped", event)
+	}
+	if event := tt.repository.event(next); event.DeliveredAt == nil {
+		t.Errorf("event = %+v, want the rest of the batch delivered", event)
+	}
+}
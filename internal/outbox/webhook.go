@@ -0,0 +1,52 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"marketplace/internal/entities"
+)
+
+// WebhookSink posts every event as a JSON envelope to a fixed URL. Any
+// response other than 2xx is treated as a failed delivery.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string, client *http.Client) *WebhookSink {
+	return &WebhookSink{url: url, client: client}
+}
+
+func (s *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, event *entities.OutboxEvent) error {
+	body, err := json.Marshal(NewEnvelope(event))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.EventID.String())
+	req.Header.Set("X-Event-Type", event.EventType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
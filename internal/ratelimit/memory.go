@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryCleanupInterval = time.Minute
+
+// MemoryStore keeps buckets in process memory. Limits are not shared
+// between instances.
+type MemoryStore struct {
+	mu          sync.Mutex
+	tats        map[string]time.Time
+	lastCleanup time.Time
+}
+
+func NewMemoryStore() Store {
+	return &MemoryStore{
+		tats:        make(map[string]time.Time),
+		lastCleanup: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastCleanup) > memoryCleanupInterval {
+		for k, tat := range s.tats {
+			if tat.Before(now) {
+				delete(s.tats, k)
+			}
+		}
+		s.lastCleanup = now
+	}
+
+	tat, result := gcra(now, s.tats[key], limit, window)
+	s.tats[key] = tat
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+)
+
+const postgresCleanupEvery = 1000
+
+// PostgresStore keeps buckets in the rate_limits table so that limits are
+// shared between instances.
+type PostgresStore struct {
+	db    *database.PostgresDatabase
+	calls atomic.Uint64
+}
+
+func NewPostgresStore(db *database.PostgresDatabase) Store {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	if s.calls.Add(1)%postgresCleanupEvery == 0 {
+		if _, err := s.db.Pool.Exec(ctx, `delete from rate_limits where tat < now()`); err != nil {
+			return nil, fmt.Errorf("ratelimit.postgres.Allow cleanup error: %v", err)
+		}
+	}
+
+	var result *Result
+	err := s.db.WithTx(ctx, func(tx pgx.Tx) error {
+		var now, tat time.Time
+		err := tx.QueryRow(ctx, `
+			insert into rate_limits (key, tat)
+			values ($1, now())
+			on conflict (key) do update set key = excluded.key
+			returning now(), tat`, key).Scan(&now, &tat)
+		if err != nil {
+			return err
+		}
+		var newTAT time.Time
+		newTAT, result = gcra(now, tat, limit, window)
+		if result.Allowed {
+			_, err = tx.Exec(ctx, `update rate_limits set tat = $2 where key = $1`, key, newTAT)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit.postgres.Allow error: %v", err)
+	}
+	return result, nil
+}
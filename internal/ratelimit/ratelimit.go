@@ -0,0 +1,61 @@
+// Package ratelimit implements token bucket rate limiting using the
+// generic cell rate algorithm (GCRA), which needs only one timestamp per
+// key and therefore fits both in memory and in a database row.
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"marketplace/config"
+	"marketplace/internal/database"
+)
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	// Allow takes one token from the bucket of key. The bucket holds limit
+	// tokens and is refilled completely over window.
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error)
+}
+
+func New(cfg *config.Config, db *database.PostgresDatabase) Store {
+	switch cfg.RateLimitStore {
+	case config.PostgresRateLimitStore:
+		return NewPostgresStore(db)
+	default:
+		return NewMemoryStore()
+	}
+}
+
+// gcra computes the new theoretical arrival time of the bucket for a
+// request made at now. tat is the previous theoretical arrival time.
+func gcra(now, tat time.Time, limit int, window time.Duration) (time.Time, *Result) {
+	emission := window / time.Duration(limit)
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(emission)
+	allowAt := newTAT.Add(-window)
+	if now.Before(allowAt) {
+		return tat, &Result{
+			Allowed:    false,
+			Limit:      limit,
+			Remaining:  0,
+			ResetAfter: tat.Sub(now),
+			RetryAfter: allowAt.Sub(now),
+		}
+	}
+	return newTAT, &Result{
+		Allowed:    true,
+		Limit:      limit,
+		Remaining:  int((window - newTAT.Sub(now)) / emission),
+		ResetAfter: newTAT.Sub(now),
+	}
+}
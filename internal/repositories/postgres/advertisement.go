@@ -4,16 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/shopspring/decimal"
 
 	"marketplace/internal/database"
 	"marketplace/internal/entities"
 	"marketplace/internal/repositories"
 )
 
+const advertisementColumns = `
+	id, title, content, image_url, price, user_id, external_id, created_at, updated_at, expires_at, archived_at,
+	publish_at, published_at`
+
 type AdvertisementPostgresRepository struct {
 	db *database.PostgresDatabase
 }
@@ -22,47 +26,68 @@ func NewAdvertisementPostgresRepository(db *database.PostgresDatabase) repositor
 	return &AdvertisementPostgresRepository{db: db}
 }
 
+func scanAdvertisement(row pgx.Row, advertisement *entities.Advertisement) error {
+	return row.Scan(
+		&advertisement.ID,
+		&advertisement.Title,
+		&advertisement.Content,
+		&advertisement.ImageURL,
+		&advertisement.Price,
+		&advertisement.UserID,
+		&advertisement.ExternalID,
+		&advertisement.CreatedAt,
+		&advertisement.UpdatedAt,
+		&advertisement.ExpiresAt,
+		&advertisement.ArchivedAt,
+		&advertisement.PublishAt,
+		&advertisement.PublishedAt,
+	)
+}
+
+// CreateAdvertisement records an advertisement.created event unless the
+// advertisement is scheduled, PublishScheduledAdvertisements records it then.
 func (r *AdvertisementPostgresRepository) CreateAdvertisement(ctx context.Context, advertisement *entities.Advertisement) error {
-	query := `
-		insert into advertisements (title, content, image_url, price, user_id) 
-		values ($1, $2, $3, $4, $5)
-		returning *`
-	err := r.db.Pool.
-		QueryRow(ctx, query, advertisement.Title, advertisement.Content, advertisement.ImageURL, advertisement.Price, advertisement.UserID).
-		Scan(
-			&advertisement.ID,
-			&advertisement.Title,
-			&advertisement.Content,
-			&advertisement.ImageURL,
-			&advertisement.Price,
-			&advertisement.UserID,
-			&advertisement.CreatedAt,
-			&advertisement.UpdatedAt,
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			insert into advertisements (title, content, image_url, price, user_id, expires_at, publish_at, published_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8)
+			returning ` + advertisementColumns
+		row := tx.QueryRow(
+			ctx,
+			query,
+			advertisement.Title,
+			advertisement.Content,
+			advertisement.ImageURL,
+			advertisement.Price,
+			advertisement.UserID,
+			advertisement.ExpiresAt,
+			advertisement.PublishAt,
+			advertisement.PublishedAt,
 		)
-	if err != nil {
-		return fmt.Errorf("repositories.advertisement.CreateAdvertisement error: %v", err)
-	}
-	return nil
+		if err := scanAdvertisement(row, advertisement); err != nil {
+			return err
+		}
+		if advertisement.PublishedAt != nil {
+			event, err := newAdvertisementCreatedEvent(advertisement)
+			if err != nil {
+				return err
+			}
+			if err = insertOutboxEvents(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return txError("repositories.advertisement.CreateAdvertisement", err)
 }
 
 func (r *AdvertisementPostgresRepository) GetAdvertisementByID(ctx context.Context, id uuid.UUID) (*entities.Advertisement, error) {
 	query := `
-		select *
+		select ` + advertisementColumns + `
 		from advertisements
 		where id = $1`
 	var advertisement entities.Advertisement
-	err := r.db.Pool.
-		QueryRow(ctx, query, id).
-		Scan(
-			&advertisement.ID,
-			&advertisement.Title,
-			&advertisement.Content,
-			&advertisement.ImageURL,
-			&advertisement.Price,
-			&advertisement.UserID,
-			&advertisement.CreatedAt,
-			&advertisement.UpdatedAt,
-		)
+	err := scanAdvertisement(r.db.Pool.QueryRow(ctx, query, id), &advertisement)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, repositories.ErrNotFound
@@ -72,12 +97,52 @@ func (r *AdvertisementPostgresRepository) GetAdvertisementByID(ctx context.Conte
 	return &advertisement, nil
 }
 
-func (r *AdvertisementPostgresRepository) GetAdvertisements(
+func (r *AdvertisementPostgresRepository) GetAdvertisements(ctx context.Context, filter *repositories.AdvertisementFilter) ([]*entities.Advertisement, error) {
+	var advertisements []*entities.Advertisement
+	err := queryAdvertisements(ctx, r.db.Pool, filter, func(advertisement *entities.Advertisement) error {
+		advertisements = append(advertisements, advertisement)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("repositories.advertisement.GetAdvertisements error: %v", err)
+	}
+	return advertisements, nil
+}
+
+// StreamAdvertisements calls fn for every advertisement matching the filter
+// as rows arrive from the database. A zero Limit streams all of them.
+//
+// A full export can take longer than DB_STATEMENT_TIMEOUT_SECONDS, so it
+// runs in a read-only transaction without a statement timeout and ends with
+// ctx, which the export routes bound by EXPORT_TIMEOUT_SECONDS. It is not
+// retried, as fn may already have sent rows on.
+func (r *AdvertisementPostgresRepository) StreamAdvertisements(
+	ctx context.Context,
+	filter *repositories.AdvertisementFilter,
+	fn func(advertisement *entities.Advertisement) error,
+) error {
+	err := pgx.BeginTxFunc(ctx, r.db.Pool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `set local statement_timeout = 0`); err != nil {
+			return err
+		}
+		return queryAdvertisements(ctx, tx, filter, fn)
+	})
+	if err != nil {
+		return fmt.Errorf("repositories.advertisement.StreamAdvertisements error: %v", err)
+	}
+	return nil
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func queryAdvertisements(
 	ctx context.Context,
-	offset, limit int,
-	minPrice, maxPrice *decimal.Decimal,
-	sortType, sortOrder *string,
-) ([]*entities.Advertisement, error) {
+	db querier,
+	filter *repositories.AdvertisementFilter,
+	fn func(advertisement *entities.Advertisement) error,
+) error {
 	selection := `
 		select
 			a.id,
@@ -86,55 +151,73 @@ func (r *AdvertisementPostgresRepository) GetAdvertisements(
 			a.image_url,
 			a.price,
 			a.user_id,
+			a.external_id,
 			u.login as author_login,
 			a.created_at,
-			a.updated_at
+			a.updated_at,
+			a.expires_at,
+			a.archived_at,
+			a.publish_at,
+			a.published_at
 		from advertisements a
 		join users u on a.user_id = u.id
 	`
 	placeholderNumber := 1
 
-	priceFilter := "where true"
+	conditions := "where true"
+	if !filter.IncludeExpired {
+		conditions += " and a.archived_at is null and a.expires_at > now()"
+	}
+	if !filter.IncludeScheduled {
+		conditions += " and a.publish_at <= now()"
+	}
 	var args []any
-	if minPrice != nil {
-		priceFilter += fmt.Sprintf(" and a.price >= $%d", placeholderNumber)
-		args = append(args, minPrice)
+	if filter.UserID != nil {
+		conditions += fmt.Sprintf(" and a.user_id = $%d", placeholderNumber)
+		args = append(args, *filter.UserID)
+		placeholderNumber++
+	}
+	if filter.MinPrice != nil {
+		conditions += fmt.Sprintf(" and a.price >= $%d", placeholderNumber)
+		args = append(args, filter.MinPrice)
 		placeholderNumber++
 	}
-	if maxPrice != nil {
-		priceFilter += fmt.Sprintf(" and a.price <= $%d", placeholderNumber)
-		args = append(args, maxPrice)
+	if filter.MaxPrice != nil {
+		conditions += fmt.Sprintf(" and a.price <= $%d", placeholderNumber)
+		args = append(args, filter.MaxPrice)
 		placeholderNumber++
 	}
 
 	var sortTypeValue, sortOrderValue string
-	if sortType == nil {
+	if filter.SortType == nil {
 		sortTypeValue = "created_at"
-	} else if *sortType == "created_at" || *sortType == "price" {
-		sortTypeValue = *sortType
+	} else if *filter.SortType == "created_at" || *filter.SortType == "price" {
+		sortTypeValue = *filter.SortType
 	} else {
-		return nil, fmt.Errorf("repositories.advertisement.GetAdvertisements invalid sortType: %s (allowed: created_at, price)", *sortType)
+		return fmt.Errorf("invalid sortType: %s (allowed: created_at, price)", *filter.SortType)
 	}
-	if sortOrder == nil {
+	if filter.SortOrder == nil {
 		sortOrderValue = "desc"
-	} else if *sortOrder == "asc" || *sortOrder == "desc" {
-		sortOrderValue = *sortOrder
+	} else if *filter.SortOrder == "asc" || *filter.SortOrder == "desc" {
+		sortOrderValue = *filter.SortOrder
 	} else {
-		return nil, fmt.Errorf("repositories.advertisement.GetAdvertisements invalid sortOrder: %s (allowed: asc, desc)", *sortOrder)
+		return fmt.Errorf("invalid sortOrder: %s (allowed: asc, desc)", *filter.SortOrder)
 	}
-	sorting := fmt.Sprintf("order by a.%s %s", sortTypeValue, sortOrderValue)
+	sorting := fmt.Sprintf("order by a.%s %s, a.id", sortTypeValue, sortOrderValue)
 
-	pagination := fmt.Sprintf("limit $%d offset $%d", placeholderNumber, placeholderNumber+1)
-	args = append(args, limit, offset)
+	pagination := ""
+	if filter.Limit > 0 {
+		pagination = fmt.Sprintf("limit $%d offset $%d", placeholderNumber, placeholderNumber+1)
+		args = append(args, filter.Limit, filter.Offset)
+	}
 
-	query := fmt.Sprintf(`%s %s %s %s`, selection, priceFilter, sorting, pagination)
-	rows, err := r.db.Pool.Query(ctx, query, args...)
+	query := fmt.Sprintf(`%s %s %s %s`, selection, conditions, sorting, pagination)
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("repositories.advertisement.GetAdvertisements error: %v", err)
+		return err
 	}
 	defer rows.Close()
 
-	var advertisements []*entities.Advertisement
 	for rows.Next() {
 		var advertisement entities.Advertisement
 		if err = rows.Scan(
@@ -144,16 +227,368 @@ func (r *AdvertisementPostgresRepository) GetAdvertisements(
 			&advertisement.ImageURL,
 			&advertisement.Price,
 			&advertisement.UserID,
+			&advertisement.ExternalID,
 			&advertisement.AuthorLogin,
 			&advertisement.CreatedAt,
 			&advertisement.UpdatedAt,
+			&advertisement.ExpiresAt,
+			&advertisement.ArchivedAt,
+			&advertisement.PublishAt,
+			&advertisement.PublishedAt,
+		); err != nil {
+			return fmt.Errorf("scan error: %v", err)
+		}
+		if err = fn(&advertisement); err != nil {
+			return err
+		}
+	}
+	if rows.Err() != nil {
+		return fmt.Errorf("rows error: %v", rows.Err())
+	}
+	return nil
+}
+
+// ImportAdvertisements copies advertisements into a staging table and moves
+// them over in one statement. Rows whose external id the seller already
+// imported are skipped, so the number of inserted rows is returned.
+// An advertisement.created event is recorded for every inserted row.
+func (r *AdvertisementPostgresRepository) ImportAdvertisements(ctx context.Context, advertisements []*entities.Advertisement) (int, error) {
+	var inserted int
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := createImportTable(ctx, tx); err != nil {
+			return err
+		}
+		_, err := tx.CopyFrom(
+			ctx,
+			pgx.Identifier{"advertisements_import"},
+			[]string{"title", "content", "image_url", "price", "user_id", "external_id", "expires_at"},
+			pgx.CopyFromSlice(len(advertisements), func(i int) ([]any, error) {
+				a := advertisements[i]
+				return []any{a.Title, a.Content, a.ImageURL, a.Price, a.UserID, a.ExternalID, a.ExpiresAt}, nil
+			}),
+		)
+		if err != nil {
+			return err
+		}
+		inserted, err = insertImportedAdvertisements(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return 0, txError("repositories.advertisement.ImportAdvertisements", err)
+	}
+	return inserted, nil
+}
+
+// ImportStagedAdvertisements imports up to limit rows staged for the import
+// job like ImportAdvertisements and adds them to the job's counters. The
+// rows are removed in the same transaction, so an interrupted job can
+// continue where it stopped. The imported advertisements expire at
+// expiresAt. It returns the number of rows taken, zero once none are left.
+func (r *AdvertisementPostgresRepository) ImportStagedAdvertisements(
+	ctx context.Context,
+	importJobID uuid.UUID,
+	limit int,
+	expiresAt time.Time,
+) (int, error) {
+	var staged int
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		if err := createImportTable(ctx, tx); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `
+			with batch as (
+				delete from import_job_rows
+				where import_job_id = $1 and row_index in (
+					select row_index
+					from import_job_rows
+					where import_job_id = $1
+					order by row_index
+					limit $2
+				)
+				returning *
+			)
+			insert into advertisements_import (title, content, image_url, price, user_id, external_id, expires_at)
+			select b.title, b.content, b.image_url, b.price, j.user_id, b.external_id, $3
+			from batch b
+			join import_jobs j on j.id = b.import_job_id`,
+			importJobID, limit, expiresAt,
+		)
+		if err != nil {
+			return err
+		}
+		staged = int(tag.RowsAffected())
+		if staged == 0 {
+			return nil
+		}
+		inserted, err := insertImportedAdvertisements(ctx, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			update import_jobs
+			set imported_rows = imported_rows + $2, skipped_rows = skipped_rows + $3
+			where id = $1`,
+			importJobID, inserted, staged-inserted,
+		)
+		return err
+	})
+	if err != nil {
+		return 0, txError("repositories.advertisement.ImportStagedAdvertisements", err)
+	}
+	return staged, nil
+}
+
+func createImportTable(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `
+		create temporary table advertisements_import (
+			title text not null,
+			content text not null,
+			image_url text not null,
+			price numeric(11, 2) not null,
+			user_id uuid not null,
+			external_id varchar(128),
+			expires_at timestamp not null
+		) on commit drop`)
+	return err
+}
+
+// insertImportedAdvertisements moves the rows of the import table into
+// advertisements and returns how many were inserted.
+func insertImportedAdvertisements(ctx context.Context, tx pgx.Tx) (int, error) {
+	rows, err := tx.Query(ctx, `
+		insert into advertisements (title, content, image_url, price, user_id, external_id, expires_at, published_at)
+		select title, content, image_url, price, user_id, external_id, expires_at, now()
+		from advertisements_import
+		on conflict (user_id, external_id) where external_id is not null do nothing
+		returning `+advertisementColumns)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var events []*entities.OutboxEvent
+	for rows.Next() {
+		var advertisement entities.Advertisement
+		if err = scanAdvertisement(rows, &advertisement); err != nil {
+			return 0, fmt.Errorf("scan error: %w", err)
+		}
+		event, err := newAdvertisementCreatedEvent(&advertisement)
+		if err != nil {
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return 0, fmt.Errorf("rows error: %w", rows.Err())
+	}
+	return len(events), insertOutboxEvents(ctx, tx, events...)
+}
+
+// CountAdvertisementsByUserID counts the advertisements of the user that
+// are listed, that is published and neither expired nor archived.
+func (r *AdvertisementPostgresRepository) CountAdvertisementsByUserID(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `
+		select count(*)
+		from advertisements
+		where user_id = $1 and archived_at is null and expires_at > now() and publish_at <= now()`
+	var count int
+	err := r.db.Pool.QueryRow(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("repositories.advertisement.CountAdvertisementsByUserID error: %v", err)
+	}
+	return count, nil
+}
+
+// RenewAdvertisement moves the expiry of an advertisement of the user to
+// expiresAt and brings it back from the archive. A reminder is sent again
+// before the new expiry.
+func (r *AdvertisementPostgresRepository) RenewAdvertisement(
+	ctx context.Context,
+	id, userID uuid.UUID,
+	expiresAt time.Time,
+) (*entities.Advertisement, error) {
+	query := `
+		update advertisements
+		set expires_at = $3, expiry_reminded_at = null, archived_at = null, updated_at = now()
+		where id = $1 and user_id = $2
+		returning ` + advertisementColumns
+	var advertisement entities.Advertisement
+	err := scanAdvertisement(r.db.Pool.QueryRow(ctx, query, id, userID, expiresAt), &advertisement)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.advertisement.RenewAdvertisement error: %v", err)
+	}
+	return &advertisement, nil
+}
+
+// GetExpiringAdvertisements returns up to limit advertisements expiring
+// before the given time whose owners have not been reminded yet. Only
+// owners with a verified email address can be reminded, so advertisements
+// of other users are left out.
+func (r *AdvertisementPostgresRepository) GetExpiringAdvertisements(
+	ctx context.Context,
+	before time.Time,
+	limit int,
+) ([]*entities.ExpiringAdvertisement, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		select a.id, a.title, a.user_id, u.login, u.email, a.expires_at
+		from advertisements a
+		join users u on a.user_id = u.id
+		where a.archived_at is null and a.expiry_reminded_at is null
+			and a.expires_at > now() and a.expires_at <= $1
+			and u.email is not null and u.email_verified_at is not null
+		order by a.expires_at, a.id
+		limit $2`,
+		before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.advertisement.GetExpiringAdvertisements error: %v", err)
+	}
+	defer rows.Close()
+
+	var advertisements []*entities.ExpiringAdvertisement
+	for rows.Next() {
+		var advertisement entities.ExpiringAdvertisement
+		if err = rows.Scan(
+			&advertisement.ID,
+			&advertisement.Title,
+			&advertisement.UserID,
+			&advertisement.AuthorLogin,
+			&advertisement.Email,
+			&advertisement.ExpiresAt,
 		); err != nil {
-			return nil, fmt.Errorf("repositories.advertisement.GetAdvertisements scan error: %v", err)
+			return nil, fmt.Errorf("repositories.advertisement.GetExpiringAdvertisements scan error: %v", err)
 		}
 		advertisements = append(advertisements, &advertisement)
 	}
 	if rows.Err() != nil {
-		return nil, fmt.Errorf("repositories.advertisement.GetAdvertisements rows error: %v", rows.Err())
+		return nil, fmt.Errorf("repositories.advertisement.GetExpiringAdvertisements rows error: %v", rows.Err())
 	}
 	return advertisements, nil
 }
+
+// MarkAdvertisementExpiryReminded records that the owner was reminded of
+// the expiry at expiresAt. Nothing is recorded if the advertisement has
+// been renewed since, so the new expiry gets its own reminder.
+func (r *AdvertisementPostgresRepository) MarkAdvertisementExpiryReminded(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	_, err := r.db.Pool.Exec(ctx, `
+		update advertisements
+		set expiry_reminded_at = now()
+		where id = $1 and expires_at = $2`,
+		id, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("repositories.advertisement.MarkAdvertisementExpiryReminded error: %v", err)
+	}
+	return nil
+}
+
+// ArchiveExpiredAdvertisements archives the advertisements that have
+// expired and returns how many there were.
+func (r *AdvertisementPostgresRepository) ArchiveExpiredAdvertisements(ctx context.Context) (int, error) {
+	tag, err := r.db.Pool.Exec(ctx, `
+		update advertisements
+		set archived_at = now()
+		where archived_at is null and expires_at <= now()`)
+	if err != nil {
+		return 0, fmt.Errorf("repositories.advertisement.ArchiveExpiredAdvertisements error: %v", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// UpdateAdvertisement saves the changes to an advertisement of the user and
+// records an advertisement.updated event if it is published. The publish
+// time can only be changed while the advertisement is scheduled;
+// repositories.ErrNotFound is returned otherwise, as for an advertisement
+// of another user.
+func (r *AdvertisementPostgresRepository) UpdateAdvertisement(ctx context.Context, advertisement *entities.Advertisement) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			update advertisements
+			set title = $3, content = $4, image_url = $5, price = $6, publish_at = $7, expires_at = $8, updated_at = now()
+			where id = $1 and user_id = $2 and (published_at is null or publish_at = $7)
+			returning ` + advertisementColumns
+		row := tx.QueryRow(
+			ctx,
+			query,
+			advertisement.ID,
+			advertisement.UserID,
+			advertisement.Title,
+			advertisement.Content,
+			advertisement.ImageURL,
+			advertisement.Price,
+			advertisement.PublishAt,
+			advertisement.ExpiresAt,
+		)
+		if err := scanAdvertisement(row, advertisement); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repositories.ErrNotFound
+			}
+			return err
+		}
+		if advertisement.PublishedAt != nil {
+			event, err := newAdvertisementUpdatedEvent(advertisement)
+			if err != nil {
+				return err
+			}
+			if err = insertOutboxEvents(ctx, tx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return txError("repositories.advertisement.UpdateAdvertisement", err)
+}
+
+// PublishScheduledAdvertisements publishes up to limit scheduled
+// advertisements whose publish time has come, records their
+// advertisement.created events and returns how many were published.
+func (r *AdvertisementPostgresRepository) PublishScheduledAdvertisements(ctx context.Context, limit int) (int, error) {
+	var published int
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			update advertisements
+			set published_at = now()
+			where id in (
+				select id
+				from advertisements
+				where published_at is null and publish_at <= now()
+				order by publish_at
+				limit $1
+				for update skip locked
+			)
+			returning `+advertisementColumns,
+			limit,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var events []*entities.OutboxEvent
+		for rows.Next() {
+			var advertisement entities.Advertisement
+			if err = scanAdvertisement(rows, &advertisement); err != nil {
+				return err
+			}
+			event, err := newAdvertisementCreatedEvent(&advertisement)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+		rows.Close()
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+		published = len(events)
+		return insertOutboxEvents(ctx, tx, events...)
+	})
+	if err != nil {
+		return 0, txError("repositories.advertisement.PublishScheduledAdvertisements", err)
+	}
+	return published, nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at`
+
+type APIKeyPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewAPIKeyPostgresRepository(db *database.PostgresDatabase) repositories.APIKeyRepository {
+	return &APIKeyPostgresRepository{db: db}
+}
+
+func scanAPIKey(row pgx.Row, apiKey *entities.APIKey) error {
+	return row.Scan(
+		&apiKey.ID,
+		&apiKey.UserID,
+		&apiKey.Name,
+		&apiKey.Prefix,
+		&apiKey.KeyHash,
+		&apiKey.Scopes,
+		&apiKey.ExpiresAt,
+		&apiKey.LastUsedAt,
+		&apiKey.CreatedAt,
+		&apiKey.RevokedAt,
+	)
+}
+
+func (r *APIKeyPostgresRepository) CreateAPIKey(ctx context.Context, apiKey *entities.APIKey) error {
+	query := `
+		insert into api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		values ($1, $2, $3, $4, $5, $6)
+		returning ` + apiKeyColumns
+	err := scanAPIKey(r.db.Pool.QueryRow(ctx, query,
+		apiKey.UserID, apiKey.Name, apiKey.Prefix, apiKey.KeyHash, apiKey.Scopes, apiKey.ExpiresAt,
+	), apiKey)
+	if err != nil {
+		return fmt.Errorf("repositories.api_key.CreateAPIKey error: %v", err)
+	}
+	return nil
+}
+
+func (r *APIKeyPostgresRepository) GetAPIKeysByUserID(ctx context.Context, userID uuid.UUID) ([]*entities.APIKey, error) {
+	query := `
+		select ` + apiKeyColumns + `
+		from api_keys
+		where user_id = $1 and revoked_at is null
+		order by created_at desc`
+	rows, err := r.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.api_key.GetAPIKeysByUserID error: %v", err)
+	}
+	defer rows.Close()
+
+	var apiKeys []*entities.APIKey
+	for rows.Next() {
+		var apiKey entities.APIKey
+		if err = scanAPIKey(rows, &apiKey); err != nil {
+			return nil, fmt.Errorf("repositories.api_key.GetAPIKeysByUserID scan error: %v", err)
+		}
+		apiKeys = append(apiKeys, &apiKey)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("repositories.api_key.GetAPIKeysByUserID rows error: %v", rows.Err())
+	}
+	return apiKeys, nil
+}
+
+func (r *APIKeyPostgresRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*entities.APIKey, error) {
+	query := `
+		select ` + apiKeyColumns + `
+		from api_keys
+		where key_hash = $1`
+	var apiKey entities.APIKey
+	err := scanAPIKey(r.db.Pool.QueryRow(ctx, query, keyHash), &apiKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.api_key.GetAPIKeyByHash error: %v", err)
+	}
+	return &apiKey, nil
+}
+
+// TouchAPIKey updates last_used_at at most once a minute to avoid a write
+// on every request.
+func (r *APIKeyPostgresRepository) TouchAPIKey(ctx context.Context, id uuid.UUID) error {
+	query := `
+		update api_keys
+		set last_used_at = now()
+		where id = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute')`
+	_, err := r.db.Pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("repositories.api_key.TouchAPIKey error: %v", err)
+	}
+	return nil
+}
+
+func (r *APIKeyPostgresRepository) RevokeAPIKey(ctx context.Context, id, userID uuid.UUID) error {
+	query := `
+		update api_keys
+		set revoked_at = now()
+		where id = $1 and user_id = $2 and revoked_at is null`
+	tag, err := r.db.Pool.Exec(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("repositories.api_key.RevokeAPIKey error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+type EmailVerificationPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewEmailVerificationPostgresRepository(db *database.PostgresDatabase) repositories.EmailVerificationRepository {
+	return &EmailVerificationPostgresRepository{db: db}
+}
+
+func (r *EmailVerificationPostgresRepository) CreateEmailVerificationToken(ctx context.Context, token *entities.EmailVerificationToken) error {
+	query := `
+		insert into email_verification_tokens (user_id, email, token_hash, expires_at)
+		values ($1, $2, $3, $4)
+		returning id, created_at`
+	err := r.db.Pool.
+		QueryRow(ctx, query, token.UserID, token.Email, token.TokenHash, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repositories.email_verification.CreateEmailVerificationToken error: %v", err)
+	}
+	return nil
+}
+
+func (r *EmailVerificationPostgresRepository) GetLastEmailVerificationTokenTime(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	query := `
+		select max(created_at)
+		from email_verification_tokens
+		where user_id = $1`
+	var createdAt *time.Time
+	err := r.db.Pool.QueryRow(ctx, query, userID).Scan(&createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.email_verification.GetLastEmailVerificationTokenTime error: %v", err)
+	}
+	return createdAt, nil
+}
+
+// UseEmailVerificationToken consumes the token and marks the email of its
+// user as verified. A token issued for an address the user no longer has is
+// left untouched and reported as not found.
+func (r *EmailVerificationPostgresRepository) UseEmailVerificationToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	query := `
+		with token as (
+			update email_verification_tokens t
+			set used_at = now()
+			from users u
+			where t.token_hash = $1 and t.used_at is null and t.expires_at > now()
+				and u.id = t.user_id and u.email = t.email
+			returning t.user_id
+		)
+		update users u
+		set email_verified_at = now(), updated_at = now()
+		from token
+		where u.id = token.user_id
+		returning u.id`
+	var userID uuid.UUID
+	err := r.db.Pool.QueryRow(ctx, query, tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, repositories.ErrNotFound
+		}
+		return uuid.Nil, fmt.Errorf("repositories.email_verification.UseEmailVerificationToken error: %v", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+const importJobColumns = `
+	id, user_id, format, status, total_rows, imported_rows, skipped_rows, failed_rows, errors,
+	created_at, started_at, finished_at`
+
+type ImportJobPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewImportJobPostgresRepository(db *database.PostgresDatabase) repositories.ImportJobRepository {
+	return &ImportJobPostgresRepository{db: db}
+}
+
+func scanImportJob(row pgx.Row, job *entities.ImportJob) error {
+	return row.Scan(
+		&job.ID,
+		&job.UserID,
+		&job.Format,
+		&job.Status,
+		&job.TotalRows,
+		&job.ImportedRows,
+		&job.SkippedRows,
+		&job.FailedRows,
+		&job.Errors,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+	)
+}
+
+// CreateImportJob records the job together with the advertisements staged
+// for ImportStagedAdvertisements, read from staged until it returns nil, if
+// staged is set. The counters and errors of job are stored once staged is
+// drained, so staged may still add to them. As staged can be read only
+// once, the transaction is not retried.
+func (r *ImportJobPostgresRepository) CreateImportJob(
+	ctx context.Context,
+	job *entities.ImportJob,
+	staged func() (*entities.Advertisement, error),
+) error {
+	if job.Errors == nil {
+		job.Errors = []entities.ImportRowError{}
+	}
+	err := pgx.BeginFunc(ctx, r.db.Pool, func(tx pgx.Tx) error {
+		query := `
+			insert into import_jobs (user_id, format, status, total_rows, failed_rows, errors)
+			values ($1, $2, $3, $4, $5, $6)
+			returning ` + importJobColumns
+		err := scanImportJob(
+			tx.QueryRow(ctx, query, job.UserID, job.Format, job.Status, job.TotalRows, job.FailedRows, job.Errors),
+			job,
+		)
+		if err != nil || staged == nil {
+			return err
+		}
+
+		rowIndex := 0
+		_, err = tx.CopyFrom(
+			ctx,
+			pgx.Identifier{"import_job_rows"},
+			[]string{"import_job_id", "row_index", "title", "content", "image_url", "price", "external_id"},
+			pgx.CopyFromFunc(func() ([]any, error) {
+				a, err := staged()
+				if a == nil || err != nil {
+					return nil, err
+				}
+				row := []any{job.ID, rowIndex, a.Title, a.Content, a.ImageURL, a.Price, a.ExternalID}
+				rowIndex++
+				return row, nil
+			}),
+		)
+		if err != nil {
+			return err
+		}
+		query = `
+			update import_jobs
+			set total_rows = $2, failed_rows = $3, errors = $4
+			where id = $1
+			returning ` + importJobColumns
+		return scanImportJob(tx.QueryRow(ctx, query, job.ID, job.TotalRows, job.FailedRows, job.Errors), job)
+	})
+	if err != nil {
+		return fmt.Errorf("repositories.import_job.CreateImportJob error: %v", err)
+	}
+	return nil
+}
+
+func (r *ImportJobPostgresRepository) GetImportJob(ctx context.Context, id, userID uuid.UUID) (*entities.ImportJob, error) {
+	query := `
+		select ` + importJobColumns + `
+		from import_jobs
+		where id = $1 and user_id = $2`
+	var job entities.ImportJob
+	err := scanImportJob(r.db.Pool.QueryRow(ctx, query, id, userID), &job)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.import_job.GetImportJob error: %v", err)
+	}
+	return &job, nil
+}
+
+func (r *ImportJobPostgresRepository) UpdateImportJob(ctx context.Context, job *entities.ImportJob) error {
+	query := `
+		update import_jobs
+		set status = $2, imported_rows = $3, skipped_rows = $4, failed_rows = $5, errors = $6,
+			started_at = $7, finished_at = $8
+		where id = $1`
+	_, err := r.db.Pool.Exec(ctx, query,
+		job.ID, job.Status, job.ImportedRows, job.SkippedRows, job.FailedRows, job.Errors,
+		job.StartedAt, job.FinishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("repositories.import_job.UpdateImportJob error: %v", err)
+	}
+	return nil
+}
+
+// StartImportJob marks a pending or running job as running and returns it.
+// Finished jobs are reported as not found.
+func (r *ImportJobPostgresRepository) StartImportJob(ctx context.Context, id uuid.UUID) (*entities.ImportJob, error) {
+	query := `
+		update import_jobs
+		set status = $2, started_at = coalesce(started_at, now())
+		where id = $1 and status in ($3, $2)
+		returning ` + importJobColumns
+	var job entities.ImportJob
+	err := scanImportJob(
+		r.db.Pool.QueryRow(ctx, query, id, entities.ImportJobRunning, entities.ImportJobPending),
+		&job,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.import_job.StartImportJob error: %v", err)
+	}
+	return &job, nil
+}
+
+// FinishImportJob completes the job, or fails it with rowError. The rows
+// still staged for a failed job are dropped and counted as failed.
+func (r *ImportJobPostgresRepository) FinishImportJob(
+	ctx context.Context,
+	id uuid.UUID,
+	rowError *entities.ImportRowError,
+) (*entities.ImportJob, error) {
+	var job entities.ImportJob
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		status, rowErrors := entities.ImportJobCompleted, []entities.ImportRowError{}
+		if rowError != nil {
+			status, rowErrors = entities.ImportJobFailed, append(rowErrors, *rowError)
+		}
+		tag, err := tx.Exec(ctx, `delete from import_job_rows where import_job_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		query := `
+			update import_jobs
+			set status = $2, failed_rows = failed_rows + $3, errors = errors || $4::jsonb, finished_at = now()
+			where id = $1
+			returning ` + importJobColumns
+		err = scanImportJob(tx.QueryRow(ctx, query, id, status, tag.RowsAffected(), rowErrors), &job)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repositories.ErrNotFound
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, txError("repositories.import_job.FinishImportJob", err)
+	}
+	return &job, nil
+}
@@ -0,0 +1,188 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+const jobColumns = `
+	id, kind, payload, status, unique_key, attempts, max_attempts, run_at, locked_until, last_error,
+	created_at, finished_at`
+
+type JobPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewJobPostgresRepository(db *database.PostgresDatabase) repositories.JobRepository {
+	return &JobPostgresRepository{db: db}
+}
+
+func scanJob(row pgx.Row, job *entities.Job) error {
+	return row.Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.UniqueKey,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LockedUntil,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.FinishedAt,
+	)
+}
+
+// EnqueueJob returns repositories.ErrAlreadyExists when a job of the same
+// kind and unique key is still pending or running.
+func (r *JobPostgresRepository) EnqueueJob(ctx context.Context, job *entities.Job) error {
+	err := enqueueJob(ctx, r.db.Pool, job)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAlreadyExists) {
+			return err
+		}
+		return fmt.Errorf("repositories.job.EnqueueJob error: %v", err)
+	}
+	return nil
+}
+
+func enqueueJob(ctx context.Context, db queryRower, job *entities.Job) error {
+	query := `
+		insert into jobs (kind, payload, unique_key, max_attempts, run_at)
+		values ($1, $2, $3, $4, $5)
+		on conflict (kind, unique_key) where unique_key is not null and status in ('pending', 'running')
+		do nothing
+		returning ` + jobColumns
+	err := scanJob(db.QueryRow(ctx, query, job.Kind, job.Payload, job.UniqueKey, job.MaxAttempts, job.RunAt), job)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repositories.ErrAlreadyExists
+	}
+	return err
+}
+
+// ClaimJobs marks up to limit due jobs of the given kinds as running and
+// hides them from other workers for visibilityTimeout. Running jobs whose
+// timeout has passed are claimed again, so jobs of a crashed worker are
+// not lost.
+func (r *JobPostgresRepository) ClaimJobs(
+	ctx context.Context,
+	kinds []string,
+	limit int,
+	visibilityTimeout time.Duration,
+) ([]*entities.Job, error) {
+	query := `
+		update jobs
+		set status = 'running', attempts = attempts + 1, locked_until = now() + $3::interval
+		where id in (
+			select id
+			from jobs
+			where kind = any($1)
+				and ((status = 'pending' and run_at <= now()) or (status = 'running' and locked_until <= now()))
+			order by run_at
+			limit $2
+			for update skip locked
+		)
+		returning ` + jobColumns
+	rows, err := r.db.Pool.Query(ctx, query, kinds, limit, visibilityTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.job.ClaimJobs error: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []*entities.Job
+	for rows.Next() {
+		var job entities.Job
+		if err = scanJob(rows, &job); err != nil {
+			return nil, fmt.Errorf("repositories.job.ClaimJobs scan error: %v", err)
+		}
+		jobs = append(jobs, &job)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("repositories.job.ClaimJobs rows error: %v", rows.Err())
+	}
+	return jobs, nil
+}
+
+// FinishJob stores the outcome of a claimed job. It returns
+// repositories.ErrNotFound when the claim was lost because the visibility
+// timeout passed and another worker picked the job up.
+func (r *JobPostgresRepository) FinishJob(ctx context.Context, job *entities.Job) error {
+	query := `
+		update jobs
+		set status = $3, run_at = $4, last_error = $5, finished_at = $6, locked_until = null
+		where id = $1 and attempts = $2 and status = 'running'`
+	tag, err := r.db.Pool.Exec(ctx, query, job.ID, job.Attempts, job.Status, job.RunAt, job.LastError, job.FinishedAt)
+	if err != nil {
+		return fmt.Errorf("repositories.job.FinishJob error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+// EnqueueScheduledJob enqueues job if the schedule called name is due and
+// moves the schedule to nextRunAt; the result reports whether it was due.
+// Only one of several concurrent callers enqueues the job. A schedule seen
+// for the first time, or whose spec has changed, is set to nextRunAt
+// without enqueuing anything.
+func (r *JobPostgresRepository) EnqueueScheduledJob(
+	ctx context.Context,
+	name, spec string,
+	nextRunAt time.Time,
+	job *entities.Job,
+) (bool, error) {
+	due := false
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			insert into job_schedules (name, spec, next_run_at)
+			values ($1, $2, $3)
+			on conflict (name) do update
+			set spec = excluded.spec, next_run_at = excluded.next_run_at
+			where job_schedules.spec <> excluded.spec`, name, spec, nextRunAt)
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `
+			update job_schedules
+			set next_run_at = $2, last_run_at = now()
+			where name = $1 and next_run_at <= now()`, name, nextRunAt)
+		if err != nil {
+			return err
+		}
+		due = tag.RowsAffected() > 0
+		if !due {
+			return nil
+		}
+		// A previous run still in progress is not a reason to skip moving the
+		// schedule, the duplicate is simply not enqueued.
+		if err = enqueueJob(ctx, tx, job); err != nil && !errors.Is(err, repositories.ErrAlreadyExists) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return false, txError("repositories.job.EnqueueScheduledJob", err)
+	}
+	return due, nil
+}
+
+func (r *JobPostgresRepository) DeleteFinishedJobs(ctx context.Context, before time.Time) (int, error) {
+	query := `
+		delete from jobs
+		where finished_at < $1`
+	tag, err := r.db.Pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("repositories.job.DeleteFinishedJobs error: %v", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
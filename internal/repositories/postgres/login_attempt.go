@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+type LoginAttemptPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewLoginAttemptPostgresRepository(db *database.PostgresDatabase) repositories.LoginAttemptRepository {
+	return &LoginAttemptPostgresRepository{db: db}
+}
+
+func (r *LoginAttemptPostgresRepository) GetLoginAttempt(ctx context.Context, key string) (*entities.LoginAttempt, error) {
+	query := `
+		select key, failures, last_failure_at, locked_until
+		from login_attempts
+		where key = $1`
+	var attempt entities.LoginAttempt
+	err := r.db.Pool.
+		QueryRow(ctx, query, key).
+		Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.login_attempt.GetLoginAttempt error: %v", err)
+	}
+	return &attempt, nil
+}
+
+func (r *LoginAttemptPostgresRepository) RegisterFailedLoginAttempt(ctx context.Context, key string, window time.Duration) (*entities.LoginAttempt, error) {
+	query := `
+		insert into login_attempts (key, failures, last_failure_at)
+		values ($1, 1, now())
+		on conflict (key) do update
+		set failures = case
+				when login_attempts.last_failure_at < now() - $2::interval then 1
+				else login_attempts.failures + 1
+			end,
+			last_failure_at = now()
+		returning key, failures, last_failure_at, locked_until`
+	var attempt entities.LoginAttempt
+	err := r.db.Pool.
+		QueryRow(ctx, query, key, window).
+		Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.login_attempt.RegisterFailedLoginAttempt error: %v", err)
+	}
+	return &attempt, nil
+}
+
+func (r *LoginAttemptPostgresRepository) LockLoginAttempts(ctx context.Context, key string, lockedUntil time.Time) error {
+	query := `
+		update login_attempts
+		set locked_until = $2
+		where key = $1`
+	_, err := r.db.Pool.Exec(ctx, query, key, lockedUntil)
+	if err != nil {
+		return fmt.Errorf("repositories.login_attempt.LockLoginAttempts error: %v", err)
+	}
+	return nil
+}
+
+func (r *LoginAttemptPostgresRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	query := `
+		delete from login_attempts
+		where key = $1`
+	_, err := r.db.Pool.Exec(ctx, query, key)
+	if err != nil {
+		return fmt.Errorf("repositories.login_attempt.ResetLoginAttempts error: %v", err)
+	}
+	return nil
+}
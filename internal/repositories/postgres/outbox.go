@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+type OutboxPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewOutboxPostgresRepository(db *database.PostgresDatabase) repositories.OutboxRepository {
+	return &OutboxPostgresRepository{db: db}
+}
+
+// ClaimOutboxEvents leases up to limit due events by moving their next
+// attempt to the end of the lease, so no other relay picks them up until it
+// expires. Only the oldest pending event of each aggregate is claimed, so
+// events of one aggregate are delivered in order even with several relays
+// running.
+func (r *OutboxPostgresRepository) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*entities.OutboxEvent, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		update outbox_events
+		set next_attempt_at = now() + $2::interval
+		where id in (
+			select e.id
+			from outbox_events e
+			where e.delivered_at is null and e.dead_lettered_at is null and e.next_attempt_at <= now()
+				and not exists (
+					select 1
+					from outbox_events p
+					where p.aggregate_type = e.aggregate_type and p.aggregate_id = e.aggregate_id and p.id < e.id
+						and p.delivered_at is null and p.dead_lettered_at is null
+				)
+			order by e.id
+			limit $1
+			for update skip locked
+		)
+		returning id, event_id, aggregate_type, aggregate_id, event_type, payload,
+			created_at, attempts, next_attempt_at, last_error, delivered_at, dead_lettered_at`,
+		limit, lease,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.outbox.ClaimOutboxEvents error: %v", err)
+	}
+	defer rows.Close()
+
+	var events []*entities.OutboxEvent
+	for rows.Next() {
+		var event entities.OutboxEvent
+		if err = rows.Scan(
+			&event.ID,
+			&event.EventID,
+			&event.AggregateType,
+			&event.AggregateID,
+			&event.EventType,
+			&event.Payload,
+			&event.CreatedAt,
+			&event.Attempts,
+			&event.NextAttemptAt,
+			&event.LastError,
+			&event.DeliveredAt,
+			&event.DeadLetteredAt,
+		); err != nil {
+			return nil, fmt.Errorf("repositories.outbox.ClaimOutboxEvents scan error: %v", err)
+		}
+		events = append(events, &event)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("repositories.outbox.ClaimOutboxEvents rows error: %v", rows.Err())
+	}
+	slices.SortFunc(events, func(a, b *entities.OutboxEvent) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return events, nil
+}
+
+// UpdateOutboxEvent records the outcome of a delivery attempt. It returns
+// repositories.ErrNotFound when the lease that ended at leasedUntil is no
+// longer held, because the event was claimed again in the meantime.
+func (r *OutboxPostgresRepository) UpdateOutboxEvent(ctx context.Context, event *entities.OutboxEvent, leasedUntil time.Time) error {
+	tag, err := r.db.Pool.Exec(ctx, `
+		update outbox_events
+		set attempts = $3, next_attempt_at = $4, last_error = $5, delivered_at = $6, dead_lettered_at = $7
+		where id = $1 and next_attempt_at = $2`,
+		event.ID, leasedUntil, event.Attempts, event.NextAttemptAt, event.LastError, event.DeliveredAt, event.DeadLetteredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("repositories.outbox.UpdateOutboxEvent error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+func (r *OutboxPostgresRepository) DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int, error) {
+	query := `
+		delete from outbox_events
+		where delivered_at < $1`
+	tag, err := r.db.Pool.Exec(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("repositories.outbox.DeleteDeliveredOutboxEvents error: %v", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// insertOutboxEvents writes events within the caller's transaction.
+func insertOutboxEvents(ctx context.Context, tx pgx.Tx, events ...*entities.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	_, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"outbox_events"},
+		[]string{"aggregate_type", "aggregate_id", "event_type", "payload"},
+		pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+			e := events[i]
+			return []any{e.AggregateType, e.AggregateID, e.EventType, e.Payload}, nil
+		}),
+	)
+	return err
+}
+
+func newOutboxEvent(aggregateType string, aggregateID uuid.UUID, eventType string, payload any) (*entities.OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.OutboxEvent{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       data,
+	}, nil
+}
+
+func newUserRegisteredEvent(user *entities.User) (*entities.OutboxEvent, error) {
+	return newOutboxEvent(entities.UserAggregate, user.ID, entities.UserRegisteredEvent, entities.UserRegisteredPayload{
+		UserID:    user.ID,
+		Login:     user.Login,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+func newAdvertisementCreatedEvent(advertisement *entities.Advertisement) (*entities.OutboxEvent, error) {
+	return newOutboxEvent(entities.AdvertisementAggregate, advertisement.ID, entities.AdvertisementCreatedEvent, entities.AdvertisementCreatedPayload{
+		AdvertisementID: advertisement.ID,
+		UserID:          advertisement.UserID,
+		Title:           advertisement.Title,
+		Price:           advertisement.Price,
+		CreatedAt:       advertisement.CreatedAt,
+	})
+}
+
+func newAdvertisementUpdatedEvent(advertisement *entities.Advertisement) (*entities.OutboxEvent, error) {
+	return newOutboxEvent(entities.AdvertisementAggregate, advertisement.ID, entities.AdvertisementUpdatedEvent, entities.AdvertisementUpdatedPayload{
+		AdvertisementID: advertisement.ID,
+		UserID:          advertisement.UserID,
+		Title:           advertisement.Title,
+		Price:           advertisement.Price,
+		UpdatedAt:       advertisement.UpdatedAt,
+	})
+}
@@ -0,0 +1,130 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+type SessionPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewSessionPostgresRepository(db *database.PostgresDatabase) repositories.SessionRepository {
+	return &SessionPostgresRepository{db: db}
+}
+
+func (r *SessionPostgresRepository) CreateSession(ctx context.Context, session *entities.Session) error {
+	query := `
+		insert into sessions (user_id, expires_at)
+		values ($1, $2)
+		returning id, user_id, created_at, expires_at, revoked_at`
+	err := r.db.Pool.
+		QueryRow(ctx, query, session.UserID, session.ExpiresAt).
+		Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		return fmt.Errorf("repositories.session.CreateSession error: %v", err)
+	}
+	return nil
+}
+
+func (r *SessionPostgresRepository) GetSessionByID(ctx context.Context, id uuid.UUID) (*entities.Session, error) {
+	query := `
+		select id, user_id, created_at, expires_at, revoked_at
+		from sessions
+		where id = $1`
+	var session entities.Session
+	err := r.db.Pool.
+		QueryRow(ctx, query, id).
+		Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.session.GetSessionByID error: %v", err)
+	}
+	return &session, nil
+}
+
+func (r *SessionPostgresRepository) CreatePasswordResetToken(ctx context.Context, token *entities.PasswordResetToken) error {
+	query := `
+		insert into password_reset_tokens (user_id, token_hash, expires_at)
+		values ($1, $2, $3)
+		returning id, created_at`
+	err := r.db.Pool.
+		QueryRow(ctx, query, token.UserID, token.TokenHash, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repositories.session.CreatePasswordResetToken error: %v", err)
+	}
+	return nil
+}
+
+// ResetPasswordWithToken consumes the reset token, stores the new password
+// hash and revokes every session of the user in one transaction, so a
+// failure leaves the token usable.
+func (r *SessionPostgresRepository) ResetPasswordWithToken(ctx context.Context, tokenHash, password string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			update password_reset_tokens
+			set used_at = now()
+			where token_hash = $1 and used_at is null and expires_at > now()
+			returning user_id`, tokenHash).Scan(&userID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repositories.ErrNotFound
+			}
+			return err
+		}
+		tag, err := tx.Exec(ctx, `
+			update users
+			set password = $2, updated_at = now()
+			where id = $1`, userID, password)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repositories.ErrNotFound
+		}
+		_, err = tx.Exec(ctx, `
+			update sessions
+			set revoked_at = now()
+			where user_id = $1 and revoked_at is null`, userID)
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, txError("repositories.session.ResetPasswordWithToken", err)
+	}
+	return userID, nil
+}
+
+// ChangePasswordAndRevokeSessions stores the new password hash and revokes
+// every session of the user except keepSessionID in one transaction.
+func (r *SessionPostgresRepository) ChangePasswordAndRevokeSessions(ctx context.Context, userID uuid.UUID, password string, keepSessionID uuid.UUID) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			update users
+			set password = $2, updated_at = now()
+			where id = $1`, userID, password)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repositories.ErrNotFound
+		}
+		_, err = tx.Exec(ctx, `
+			update sessions
+			set revoked_at = now()
+			where user_id = $1 and revoked_at is null and id <> $2`, userID, keepSessionID)
+		return err
+	})
+	return txError("repositories.session.ChangePasswordAndRevokeSessions", err)
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/repositories"
+)
+
+type TwoFactorPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewTwoFactorPostgresRepository(db *database.PostgresDatabase) repositories.TwoFactorRepository {
+	return &TwoFactorPostgresRepository{db: db}
+}
+
+func (r *TwoFactorPostgresRepository) SetPendingTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+		update users
+		set totp_secret = $2, totp_last_step = 0, updated_at = now()
+		where id = $1 and totp_enabled_at is null`
+	tag, err := r.db.Pool.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("repositories.two_factor.SetPendingTOTPSecret error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *TwoFactorPostgresRepository) EnableTOTP(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			update users
+			set totp_enabled_at = now(), updated_at = now()
+			where id = $1 and totp_secret is not null and totp_enabled_at is null`, userID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repositories.ErrNotFound
+		}
+		if _, err = tx.Exec(ctx, `delete from recovery_codes where user_id = $1`, userID); err != nil {
+			return err
+		}
+		rows := make([][]any, len(recoveryCodeHashes))
+		for i, codeHash := range recoveryCodeHashes {
+			rows[i] = []any{userID, codeHash}
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"recovery_codes"}, []string{"user_id", "code_hash"}, pgx.CopyFromRows(rows))
+		return err
+	})
+	return txError("repositories.two_factor.EnableTOTP", err)
+}
+
+func (r *TwoFactorPostgresRepository) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			update users
+			set totp_secret = null, totp_enabled_at = null, totp_last_step = 0, updated_at = now()
+			where id = $1`, userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `delete from recovery_codes where user_id = $1`, userID)
+		return err
+	})
+	return txError("repositories.two_factor.DisableTOTP", err)
+}
+
+func (r *TwoFactorPostgresRepository) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `
+		update users
+		set totp_last_step = $2
+		where id = $1 and totp_last_step < $2`
+	tag, err := r.db.Pool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("repositories.two_factor.UseTOTPStep error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+func (r *TwoFactorPostgresRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	query := `
+		update recovery_codes
+		set used_at = now()
+		where user_id = $1 and code_hash = $2 and used_at is null`
+	tag, err := r.db.Pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("repositories.two_factor.UseRecoveryCode error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+
+	"marketplace/internal/repositories"
+)
+
+// txError wraps an error of database.WithTx like the other errors of op,
+// keeping the repository errors the transaction returned.
+func txError(op string, err error) error {
+	if err == nil || errors.Is(err, repositories.ErrNotFound) || errors.Is(err, repositories.ErrAlreadyExists) {
+		return err
+	}
+	return fmt.Errorf("%s error: %v", op, err)
+}
@@ -15,6 +15,10 @@ import (
 	"marketplace/internal/repositories"
 )
 
+const userColumns = `
+	id, login, password, email, email_verified_at, role, totp_secret, totp_enabled_at, totp_last_step,
+	display_name, bio, avatar_url, rating, created_at, updated_at`
+
 type UserPostgresRepository struct {
 	db *database.PostgresDatabase
 }
@@ -23,35 +27,65 @@ func NewUserPostgresRepository(db *database.PostgresDatabase) repositories.UserR
 	return &UserPostgresRepository{db: db}
 }
 
+func scanUser(row pgx.Row, user *entities.User) error {
+	return row.Scan(
+		&user.ID,
+		&user.Login,
+		&user.Password,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.TOTPLastStep,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Rating,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+}
+
 func (r *UserPostgresRepository) CreateUser(ctx context.Context, user *entities.User) error {
-	query := `
-		insert into users (login, password) 
-		values ($1, $2)
-		returning *`
-	err := r.db.Pool.
-		QueryRow(ctx, query, user.Login, user.Password).
-		Scan(&user.ID, &user.Login, &user.Password, &user.CreatedAt)
-	if err != nil {
-		var pgErr *pgconn.PgError
-		if ok := errors.As(err, &pgErr); ok {
-			if pgErr.Code == "23505" {
-				return repositories.ErrAlreadyExists
-			}
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			insert into users (login, password, email) 
+			values ($1, $2, $3)
+			returning ` + userColumns
+		err := scanUser(tx.QueryRow(ctx, query, user.Login, user.Password, user.Email), user)
+		if err != nil {
+			return userUniqueViolation(err)
+		}
+		event, err := newUserRegisteredEvent(user)
+		if err != nil {
+			return err
+		}
+		return insertOutboxEvents(ctx, tx, event)
+	})
+	return txError("repositories.user.CreateUser", err)
+}
+
+// userUniqueViolation tells a taken email from a taken login, so that
+// registration does not have to reveal which addresses are in use.
+func userUniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if pgErr.ConstraintName == "users_email_key" {
+			return repositories.ErrEmailAlreadyExists
 		}
-		return fmt.Errorf("repositories.user.CreateUser error: %v", err)
+		return repositories.ErrAlreadyExists
 	}
-	return nil
+	return err
 }
 
 func (r *UserPostgresRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*entities.User, error) {
 	query := `
-		select *
+		select ` + userColumns + `
 		from users
 		where id = $1`
 	var user entities.User
-	err := r.db.Pool.
-		QueryRow(ctx, query, id).
-		Scan(&user.ID, &user.Login, &user.Password, &user.CreatedAt)
+	err := scanUser(r.db.Pool.QueryRow(ctx, query, id), &user)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, repositories.ErrNotFound
@@ -63,13 +97,11 @@ func (r *UserPostgresRepository) GetUserByID(ctx context.Context, id uuid.UUID)
 
 func (r *UserPostgresRepository) GetUserByLogin(ctx context.Context, login string) (*entities.User, error) {
 	query := `
-		select *
+		select ` + userColumns + `
 		from users
 		where login = $1`
 	var user entities.User
-	err := r.db.Pool.
-		QueryRow(ctx, query, login).
-		Scan(&user.ID, &user.Login, &user.Password, &user.CreatedAt)
+	err := scanUser(r.db.Pool.QueryRow(ctx, query, login), &user)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, repositories.ErrNotFound
@@ -78,3 +110,19 @@ func (r *UserPostgresRepository) GetUserByLogin(ctx context.Context, login strin
 	}
 	return &user, nil
 }
+
+func (r *UserPostgresRepository) UpdateUserProfile(ctx context.Context, user *entities.User) error {
+	query := `
+		update users
+		set display_name = $2, bio = $3, avatar_url = $4, updated_at = now()
+		where id = $1
+		returning ` + userColumns
+	err := scanUser(r.db.Pool.QueryRow(ctx, query, user.ID, user.DisplayName, user.Bio, user.AvatarURL), user)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repositories.ErrNotFound
+		}
+		return fmt.Errorf("repositories.user.UpdateUserProfile error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+type UserIdentityPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewUserIdentityPostgresRepository(db *database.PostgresDatabase) repositories.UserIdentityRepository {
+	return &UserIdentityPostgresRepository{db: db}
+}
+
+func (r *UserIdentityPostgresRepository) CreateOIDCState(ctx context.Context, state *entities.OIDCState) error {
+	query := `
+		insert into oidc_states (state_hash, binding_hash, provider, code_verifier, nonce, link_user_id, expires_at)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		returning created_at`
+	err := r.db.Pool.
+		QueryRow(ctx, query, state.StateHash, state.BindingHash, state.Provider, state.CodeVerifier, state.Nonce, state.LinkUserID, state.ExpiresAt).
+		Scan(&state.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repositories.user_identity.CreateOIDCState error: %v", err)
+	}
+	return nil
+}
+
+// UseOIDCState consumes the state only when the callback comes from the
+// browser that holds its binding.
+func (r *UserIdentityPostgresRepository) UseOIDCState(ctx context.Context, stateHash, bindingHash, provider string) (*entities.OIDCState, error) {
+	query := `
+		delete from oidc_states
+		where state_hash = $1 and binding_hash = $2 and provider = $3 and expires_at > now()
+		returning state_hash, binding_hash, provider, code_verifier, nonce, link_user_id, created_at, expires_at`
+	var state entities.OIDCState
+	err := r.db.Pool.
+		QueryRow(ctx, query, stateHash, bindingHash, provider).
+		Scan(&state.StateHash, &state.BindingHash, &state.Provider, &state.CodeVerifier, &state.Nonce, &state.LinkUserID, &state.CreatedAt, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.user_identity.UseOIDCState error: %v", err)
+	}
+	if _, err = r.db.Pool.Exec(ctx, `delete from oidc_states where expires_at <= now()`); err != nil {
+		return nil, fmt.Errorf("repositories.user_identity.UseOIDCState error: %v", err)
+	}
+	return &state, nil
+}
+
+func (r *UserIdentityPostgresRepository) GetUserIdentity(ctx context.Context, provider, subject string) (*entities.UserIdentity, error) {
+	query := `
+		select id, user_id, provider, subject, email, created_at
+		from user_identities
+		where provider = $1 and subject = $2`
+	var identity entities.UserIdentity
+	err := r.db.Pool.
+		QueryRow(ctx, query, provider, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.user_identity.GetUserIdentity error: %v", err)
+	}
+	return &identity, nil
+}
+
+func (r *UserIdentityPostgresRepository) GetUserIdentitiesByUserID(ctx context.Context, userID uuid.UUID) ([]*entities.UserIdentity, error) {
+	query := `
+		select id, user_id, provider, subject, email, created_at
+		from user_identities
+		where user_id = $1
+		order by created_at`
+	rows, err := r.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.user_identity.GetUserIdentitiesByUserID error: %v", err)
+	}
+	defer rows.Close()
+
+	var identities []*entities.UserIdentity
+	for rows.Next() {
+		var identity entities.UserIdentity
+		err = rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("repositories.user_identity.GetUserIdentitiesByUserID error: %v", err)
+		}
+		identities = append(identities, &identity)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repositories.user_identity.GetUserIdentitiesByUserID error: %v", err)
+	}
+	return identities, nil
+}
+
+func (r *UserIdentityPostgresRepository) CreateUserIdentity(ctx context.Context, identity *entities.UserIdentity) error {
+	err := createUserIdentity(ctx, r.db.Pool, identity)
+	if err != nil && !errors.Is(err, repositories.ErrAlreadyExists) {
+		return fmt.Errorf("repositories.user_identity.CreateUserIdentity error: %v", err)
+	}
+	return err
+}
+
+// CreateUserWithIdentity provisions a new user for an external identity.
+// Both rows are written in one transaction so a failed link never leaves
+// an orphaned account behind.
+func (r *UserIdentityPostgresRepository) CreateUserWithIdentity(ctx context.Context, user *entities.User, identity *entities.UserIdentity) error {
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		query := `
+			insert into users (login, password, email, email_verified_at, display_name)
+			values ($1, $2, $3, $4, $5)
+			returning ` + userColumns
+		err := scanUser(tx.QueryRow(ctx, query, user.Login, user.Password, user.Email, user.EmailVerifiedAt, user.DisplayName), user)
+		if err != nil {
+			return userUniqueViolation(err)
+		}
+		identity.UserID = user.ID
+		if err = createUserIdentity(ctx, tx, identity); err != nil {
+			return err
+		}
+		event, err := newUserRegisteredEvent(user)
+		if err != nil {
+			return err
+		}
+		return insertOutboxEvents(ctx, tx, event)
+	})
+	return txError("repositories.user_identity.CreateUserWithIdentity", err)
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// createUserIdentity returns the errors of the query unwrapped, so that a
+// transaction can tell the transient ones apart.
+func createUserIdentity(ctx context.Context, db queryRower, identity *entities.UserIdentity) error {
+	query := `
+		insert into user_identities (user_id, provider, subject, email)
+		values ($1, $2, $3, $4)
+		returning id, created_at`
+	err := db.
+		QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return repositories.ErrAlreadyExists
+		}
+		return err
+	}
+	return nil
+}
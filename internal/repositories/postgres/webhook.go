@@ -0,0 +1,322 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"marketplace/internal/database"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+const webhookEndpointColumns = `
+	id, user_id, url, secret, event_types, description, consecutive_failures, disabled_at, created_at, updated_at`
+
+const webhookDeliveryColumns = `
+	id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	response_status, response_body, last_error, created_at, delivered_at`
+
+type WebhookPostgresRepository struct {
+	db *database.PostgresDatabase
+}
+
+func NewWebhookPostgresRepository(db *database.PostgresDatabase) repositories.WebhookRepository {
+	return &WebhookPostgresRepository{db: db}
+}
+
+func scanWebhookEndpoint(row pgx.Row, endpoint *entities.WebhookEndpoint) error {
+	return row.Scan(
+		&endpoint.ID,
+		&endpoint.UserID,
+		&endpoint.URL,
+		&endpoint.Secret,
+		&endpoint.EventTypes,
+		&endpoint.Description,
+		&endpoint.ConsecutiveFailures,
+		&endpoint.DisabledAt,
+		&endpoint.CreatedAt,
+		&endpoint.UpdatedAt,
+	)
+}
+
+func scanWebhookDelivery(row pgx.Row, delivery *entities.WebhookDelivery, extra ...any) error {
+	return row.Scan(append([]any{
+		&delivery.ID,
+		&delivery.EndpointID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.ResponseBody,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	}, extra...)...)
+}
+
+func (r *WebhookPostgresRepository) CreateWebhookEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) error {
+	query := `
+		insert into webhook_endpoints (user_id, url, secret, event_types, description)
+		values ($1, $2, $3, $4, $5)
+		returning ` + webhookEndpointColumns
+	err := scanWebhookEndpoint(
+		r.db.Pool.QueryRow(ctx, query, endpoint.UserID, endpoint.URL, endpoint.Secret, endpoint.EventTypes, endpoint.Description),
+		endpoint,
+	)
+	if err != nil {
+		return fmt.Errorf("repositories.webhook.CreateWebhookEndpoint error: %v", err)
+	}
+	return nil
+}
+
+func (r *WebhookPostgresRepository) GetWebhookEndpointsByUserID(ctx context.Context, userID uuid.UUID) ([]*entities.WebhookEndpoint, error) {
+	query := `
+		select ` + webhookEndpointColumns + `
+		from webhook_endpoints
+		where user_id = $1
+		order by created_at desc`
+	rows, err := r.db.Pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.webhook.GetWebhookEndpointsByUserID error: %v", err)
+	}
+	defer rows.Close()
+
+	var endpoints []*entities.WebhookEndpoint
+	for rows.Next() {
+		var endpoint entities.WebhookEndpoint
+		if err = scanWebhookEndpoint(rows, &endpoint); err != nil {
+			return nil, fmt.Errorf("repositories.webhook.GetWebhookEndpointsByUserID scan error: %v", err)
+		}
+		endpoints = append(endpoints, &endpoint)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("repositories.webhook.GetWebhookEndpointsByUserID rows error: %v", rows.Err())
+	}
+	return endpoints, nil
+}
+
+func (r *WebhookPostgresRepository) GetWebhookEndpoint(ctx context.Context, id, userID uuid.UUID) (*entities.WebhookEndpoint, error) {
+	query := `
+		select ` + webhookEndpointColumns + `
+		from webhook_endpoints
+		where id = $1 and user_id = $2`
+	var endpoint entities.WebhookEndpoint
+	err := scanWebhookEndpoint(r.db.Pool.QueryRow(ctx, query, id, userID), &endpoint)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.webhook.GetWebhookEndpoint error: %v", err)
+	}
+	return &endpoint, nil
+}
+
+func (r *WebhookPostgresRepository) UpdateWebhookEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) error {
+	query := `
+		update webhook_endpoints
+		set url = $3, event_types = $4, description = $5, consecutive_failures = $6, disabled_at = $7,
+			updated_at = now()
+		where id = $1 and user_id = $2
+		returning ` + webhookEndpointColumns
+	err := scanWebhookEndpoint(
+		r.db.Pool.QueryRow(ctx, query,
+			endpoint.ID, endpoint.UserID, endpoint.URL, endpoint.EventTypes, endpoint.Description,
+			endpoint.ConsecutiveFailures, endpoint.DisabledAt,
+		),
+		endpoint,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repositories.ErrNotFound
+		}
+		return fmt.Errorf("repositories.webhook.UpdateWebhookEndpoint error: %v", err)
+	}
+	return nil
+}
+
+func (r *WebhookPostgresRepository) DeleteWebhookEndpoint(ctx context.Context, id, userID uuid.UUID) error {
+	query := `
+		delete from webhook_endpoints
+		where id = $1 and user_id = $2`
+	tag, err := r.db.Pool.Exec(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("repositories.webhook.DeleteWebhookEndpoint error: %v", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+// CreateWebhookDeliveries queues the event for every enabled endpoint of
+// ownerID subscribed to its type. A nil ownerID queues it for subscribers of
+// any user, which is only meant for admin-only event types. Queuing the same
+// event twice is a no-op.
+func (r *WebhookPostgresRepository) CreateWebhookDeliveries(
+	ctx context.Context,
+	eventID uuid.UUID,
+	eventType string,
+	ownerID *uuid.UUID,
+	payload []byte,
+) (int, error) {
+	query := `
+		insert into webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		select id, $1, $2, $4
+		from webhook_endpoints
+		where disabled_at is null and $2 = any(event_types) and ($3::uuid is null or user_id = $3)
+		on conflict (endpoint_id, event_id) do nothing`
+	tag, err := r.db.Pool.Exec(ctx, query, eventID, eventType, ownerID, payload)
+	if err != nil {
+		return 0, fmt.Errorf("repositories.webhook.CreateWebhookDeliveries error: %v", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *WebhookPostgresRepository) GetWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, offset, limit int) ([]*entities.WebhookDelivery, error) {
+	query := `
+		select ` + webhookDeliveryColumns + `
+		from webhook_deliveries
+		where endpoint_id = $1
+		order by created_at desc, id
+		limit $2 offset $3`
+	rows, err := r.db.Pool.Query(ctx, query, endpointID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.webhook.GetWebhookDeliveries error: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*entities.WebhookDelivery
+	for rows.Next() {
+		var delivery entities.WebhookDelivery
+		if err = scanWebhookDelivery(rows, &delivery); err != nil {
+			return nil, fmt.Errorf("repositories.webhook.GetWebhookDeliveries scan error: %v", err)
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("repositories.webhook.GetWebhookDeliveries rows error: %v", rows.Err())
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues a delivery to be sent again right away,
+// regardless of its previous outcome.
+func (r *WebhookPostgresRepository) ReplayWebhookDelivery(ctx context.Context, id, endpointID uuid.UUID) (*entities.WebhookDelivery, error) {
+	query := `
+		update webhook_deliveries
+		set status = 'pending', attempts = 0, next_attempt_at = now(), last_error = null
+		where id = $1 and endpoint_id = $2
+		returning ` + webhookDeliveryColumns
+	var delivery entities.WebhookDelivery
+	err := scanWebhookDelivery(r.db.Pool.QueryRow(ctx, query, id, endpointID), &delivery)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repositories.ErrNotFound
+		}
+		return nil, fmt.Errorf("repositories.webhook.ReplayWebhookDelivery error: %v", err)
+	}
+	return &delivery, nil
+}
+
+// ClaimWebhookDeliveries picks due deliveries of enabled endpoints and hides
+// them from other dispatchers for lease. A delivery whose dispatcher dies
+// is picked up again once the lease runs out.
+func (r *WebhookPostgresRepository) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*entities.WebhookDelivery, error) {
+	query := `
+		with claimed as (
+			update webhook_deliveries
+			set next_attempt_at = now() + $2, attempts = attempts + 1
+			where id in (
+				select d.id
+				from webhook_deliveries d
+				join webhook_endpoints e on e.id = d.endpoint_id
+				where d.status = 'pending' and d.next_attempt_at <= now() and e.disabled_at is null
+				order by d.next_attempt_at
+				limit $1
+				for update of d skip locked
+			)
+			returning ` + webhookDeliveryColumns + `
+		)
+		select c.*, e.url, e.secret
+		from claimed c
+		join webhook_endpoints e on e.id = c.endpoint_id`
+	rows, err := r.db.Pool.Query(ctx, query, limit, lease)
+	if err != nil {
+		return nil, fmt.Errorf("repositories.webhook.ClaimWebhookDeliveries error: %v", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*entities.WebhookDelivery
+	for rows.Next() {
+		delivery := entities.WebhookDelivery{Endpoint: &entities.WebhookEndpoint{}}
+		if err = scanWebhookDelivery(rows, &delivery, &delivery.Endpoint.URL, &delivery.Endpoint.Secret); err != nil {
+			return nil, fmt.Errorf("repositories.webhook.ClaimWebhookDeliveries scan error: %v", err)
+		}
+		delivery.Endpoint.ID = delivery.EndpointID
+		deliveries = append(deliveries, &delivery)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("repositories.webhook.ClaimWebhookDeliveries rows error: %v", rows.Err())
+	}
+	return deliveries, nil
+}
+
+// SaveWebhookDeliveryResult stores the outcome of a delivery attempt and
+// updates the failure streak of its endpoint. The endpoint is disabled when
+// the streak reaches disableAfterFailures; the returned flag reports that.
+// It returns repositories.ErrNotFound when the lease that ended at
+// leasedUntil is no longer held, because the delivery was claimed again or
+// replayed in the meantime, and leaves the newer attempt alone.
+func (r *WebhookPostgresRepository) SaveWebhookDeliveryResult(
+	ctx context.Context,
+	delivery *entities.WebhookDelivery,
+	leasedUntil time.Time,
+	succeeded bool,
+	disableAfterFailures int,
+) (bool, error) {
+	var disabled bool
+	err := r.db.WithTx(ctx, func(tx pgx.Tx) error {
+		disabled = false
+		tag, err := tx.Exec(ctx, `
+			update webhook_deliveries
+			set status = $4, next_attempt_at = $5, response_status = $6, response_body = $7, last_error = $8,
+				delivered_at = $9
+			where id = $1 and status = 'pending' and attempts = $2 and next_attempt_at = $3`,
+			delivery.ID, delivery.Attempts, leasedUntil, delivery.Status, delivery.NextAttemptAt,
+			delivery.ResponseStatus, delivery.ResponseBody, delivery.LastError, delivery.DeliveredAt,
+		)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repositories.ErrNotFound
+		}
+
+		if succeeded {
+			_, err = tx.Exec(ctx, `update webhook_endpoints set consecutive_failures = 0 where id = $1`, delivery.EndpointID)
+		} else {
+			err = tx.QueryRow(ctx, `
+				update webhook_endpoints
+				set consecutive_failures = consecutive_failures + 1,
+					disabled_at = case
+						when disabled_at is null and consecutive_failures + 1 >= $2 then now()
+						else disabled_at
+					end
+				where id = $1
+				returning disabled_at is not null`, delivery.EndpointID, disableAfterFailures).Scan(&disabled)
+		}
+		return err
+	})
+	if err != nil {
+		return false, txError("repositories.webhook.SaveWebhookDeliveryResult", err)
+	}
+	return disabled, nil
+}
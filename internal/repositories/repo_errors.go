@@ -1,8 +1,14 @@
 package repositories
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrNotFound      = errors.New("not found")
 	ErrAlreadyExists = errors.New("already exists")
+	// ErrEmailAlreadyExists is an ErrAlreadyExists caused by the email of a
+	// user rather than by its login.
+	ErrEmailAlreadyExists = fmt.Errorf("email %w", ErrAlreadyExists)
 )
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
@@ -13,9 +14,116 @@ type UserRepository interface {
 	CreateUser(ctx context.Context, user *entities.User) error
 	GetUserByID(ctx context.Context, id uuid.UUID) (*entities.User, error)
 	GetUserByLogin(ctx context.Context, login string) (*entities.User, error)
+	UpdateUserProfile(ctx context.Context, user *entities.User) error
+}
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *entities.Session) error
+	GetSessionByID(ctx context.Context, id uuid.UUID) (*entities.Session, error)
+	CreatePasswordResetToken(ctx context.Context, token *entities.PasswordResetToken) error
+	ResetPasswordWithToken(ctx context.Context, tokenHash, password string) (uuid.UUID, error)
+	ChangePasswordAndRevokeSessions(ctx context.Context, userID uuid.UUID, password string, keepSessionID uuid.UUID) error
+}
+
+type TwoFactorRepository interface {
+	SetPendingTOTPSecret(ctx context.Context, userID uuid.UUID, secret string) error
+	EnableTOTP(ctx context.Context, userID uuid.UUID, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID uuid.UUID) error
+	UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+}
+
+type LoginAttemptRepository interface {
+	GetLoginAttempt(ctx context.Context, key string) (*entities.LoginAttempt, error)
+	RegisterFailedLoginAttempt(ctx context.Context, key string, window time.Duration) (*entities.LoginAttempt, error)
+	LockLoginAttempts(ctx context.Context, key string, lockedUntil time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, apiKey *entities.APIKey) error
+	GetAPIKeysByUserID(ctx context.Context, userID uuid.UUID) ([]*entities.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*entities.APIKey, error)
+	TouchAPIKey(ctx context.Context, id uuid.UUID) error
+	RevokeAPIKey(ctx context.Context, id, userID uuid.UUID) error
+}
+
+type EmailVerificationRepository interface {
+	CreateEmailVerificationToken(ctx context.Context, token *entities.EmailVerificationToken) error
+	GetLastEmailVerificationTokenTime(ctx context.Context, userID uuid.UUID) (*time.Time, error)
+	UseEmailVerificationToken(ctx context.Context, tokenHash string) (uuid.UUID, error)
+}
+
+type UserIdentityRepository interface {
+	CreateOIDCState(ctx context.Context, state *entities.OIDCState) error
+	UseOIDCState(ctx context.Context, stateHash, bindingHash, provider string) (*entities.OIDCState, error)
+	GetUserIdentity(ctx context.Context, provider, subject string) (*entities.UserIdentity, error)
+	GetUserIdentitiesByUserID(ctx context.Context, userID uuid.UUID) ([]*entities.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, identity *entities.UserIdentity) error
+	CreateUserWithIdentity(ctx context.Context, user *entities.User, identity *entities.UserIdentity) error
 }
 
 type AdvertisementRepository interface {
 	CreateAdvertisement(ctx context.Context, advertisement *entities.Advertisement) error
-	GetAdvertisements(ctx context.Context, offset, limit int, minPrice, maxPrice *decimal.Decimal, sortType, sortOrder *string) ([]*entities.Advertisement, error)
+	GetAdvertisementByID(ctx context.Context, id uuid.UUID) (*entities.Advertisement, error)
+	UpdateAdvertisement(ctx context.Context, advertisement *entities.Advertisement) error
+	PublishScheduledAdvertisements(ctx context.Context, limit int) (int, error)
+	GetAdvertisements(ctx context.Context, filter *AdvertisementFilter) ([]*entities.Advertisement, error)
+	StreamAdvertisements(ctx context.Context, filter *AdvertisementFilter, fn func(advertisement *entities.Advertisement) error) error
+	CountAdvertisementsByUserID(ctx context.Context, userID uuid.UUID) (int, error)
+	ImportAdvertisements(ctx context.Context, advertisements []*entities.Advertisement) (int, error)
+	ImportStagedAdvertisements(ctx context.Context, importJobID uuid.UUID, limit int, expiresAt time.Time) (int, error)
+	RenewAdvertisement(ctx context.Context, id, userID uuid.UUID, expiresAt time.Time) (*entities.Advertisement, error)
+	GetExpiringAdvertisements(ctx context.Context, before time.Time, limit int) ([]*entities.ExpiringAdvertisement, error)
+	MarkAdvertisementExpiryReminded(ctx context.Context, id uuid.UUID, expiresAt time.Time) error
+	ArchiveExpiredAdvertisements(ctx context.Context) (int, error)
+}
+
+type ImportJobRepository interface {
+	CreateImportJob(ctx context.Context, job *entities.ImportJob, staged func() (*entities.Advertisement, error)) error
+	GetImportJob(ctx context.Context, id, userID uuid.UUID) (*entities.ImportJob, error)
+	UpdateImportJob(ctx context.Context, job *entities.ImportJob) error
+	StartImportJob(ctx context.Context, id uuid.UUID) (*entities.ImportJob, error)
+	FinishImportJob(ctx context.Context, id uuid.UUID, rowError *entities.ImportRowError) (*entities.ImportJob, error)
+}
+
+type JobRepository interface {
+	EnqueueJob(ctx context.Context, job *entities.Job) error
+	ClaimJobs(ctx context.Context, kinds []string, limit int, visibilityTimeout time.Duration) ([]*entities.Job, error)
+	FinishJob(ctx context.Context, job *entities.Job) error
+	EnqueueScheduledJob(ctx context.Context, name, spec string, nextRunAt time.Time, job *entities.Job) (bool, error)
+	DeleteFinishedJobs(ctx context.Context, before time.Time) (int, error)
+}
+
+type OutboxRepository interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*entities.OutboxEvent, error)
+	UpdateOutboxEvent(ctx context.Context, event *entities.OutboxEvent, leasedUntil time.Time) error
+	DeleteDeliveredOutboxEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+type WebhookRepository interface {
+	CreateWebhookEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) error
+	GetWebhookEndpointsByUserID(ctx context.Context, userID uuid.UUID) ([]*entities.WebhookEndpoint, error)
+	GetWebhookEndpoint(ctx context.Context, id, userID uuid.UUID) (*entities.WebhookEndpoint, error)
+	UpdateWebhookEndpoint(ctx context.Context, endpoint *entities.WebhookEndpoint) error
+	DeleteWebhookEndpoint(ctx context.Context, id, userID uuid.UUID) error
+	CreateWebhookDeliveries(ctx context.Context, eventID uuid.UUID, eventType string, ownerID *uuid.UUID, payload []byte) (int, error)
+	GetWebhookDeliveries(ctx context.Context, endpointID uuid.UUID, offset, limit int) ([]*entities.WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, id, endpointID uuid.UUID) (*entities.WebhookDelivery, error)
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*entities.WebhookDelivery, error)
+	SaveWebhookDeliveryResult(ctx context.Context, delivery *entities.WebhookDelivery, leasedUntil time.Time, succeeded bool, disableAfterFailures int) (bool, error)
+}
+
+type AdvertisementFilter struct {
+	Offset    int
+	Limit     int
+	MinPrice  *decimal.Decimal
+	MaxPrice  *decimal.Decimal
+	SortType  *string
+	SortOrder *string
+	UserID    *uuid.UUID
+	// IncludeExpired and IncludeScheduled also match expired or archived
+	// and not yet published advertisements, which are hidden from listings.
+	IncludeExpired   bool
+	IncludeScheduled bool
 }
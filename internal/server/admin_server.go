@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"marketplace/config"
+	"marketplace/internal/logger"
+)
+
+// AdminServer serves diagnostics on a listener of its own, so profiling never competes with the rate limits and
+// middlewares of the API and is not exposed with it. It has no
+// authentication.
+type AdminServer struct {
+	cfg        *config.Config
+	httpServer *http.Server
+	startedAt  time.Time
+}
+
+type runtimeStatsResponse struct {
+	GoVersion      string  `json:"go_version"`
+	UptimeSeconds  float64 `json:"uptime_seconds"`
+	Goroutines     int     `json:"goroutines"`
+	GOMAXPROCS     int     `json:"gomaxprocs"`
+	NumCPU         int     `json:"num_cpu"`
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	HeapSysBytes   uint64  `json:"heap_sys_bytes"`
+	HeapObjects    uint64  `json:"heap_objects"`
+	StackSysBytes  uint64  `json:"stack_sys_bytes"`
+	SysBytes       uint64  `json:"sys_bytes"`
+	NumGC          uint32  `json:"num_gc"`
+	GCPauseTotalMs float64 `json:"gc_pause_total_ms"`
+	LastGC         string  `json:"last_gc,omitempty"`
+}
+
+type buildInfoResponse struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	Settings  map[string]string `json:"settings"`
+}
+
+// logLevelRequest changes the level when Level is set and replaces all
+// overrides when Overrides is set, an empty object removes them.
+type logLevelRequest struct {
+	Level     string            `json:"level"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+type logLevelResponse struct {
+	Level     string            `json:"level"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+func NewAdminServer(cfg *config.Config) *AdminServer {
+	s := &AdminServer{cfg: cfg, startedAt: time.Now()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/runtime", s.runtimeStats)
+	mux.HandleFunc("GET /debug/build", s.buildInfo)
+	mux.HandleFunc("GET /debug/config", s.config)
+	mux.HandleFunc("GET /debug/log-level", s.logLevel)
+	mux.HandleFunc("PUT /debug/log-level", s.setLogLevel)
+
+	s.httpServer = &http.Server{
+		Addr:              cfg.AdminAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+func (s *AdminServer) Run() error {
+	slog.Info("Starting admin server", slog.String("addr", s.cfg.AdminAddr))
+	return s.httpServer.ListenAndServe()
+}
+
+func (s *AdminServer) Shutdown(ctx context.Context) error {
+	slog.Info("Shutting down admin server...")
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *AdminServer) runtimeStats(w http.ResponseWriter, _ *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := runtimeStatsResponse{
+		GoVersion:      runtime.Version(),
+		UptimeSeconds:  time.Since(s.startedAt).Seconds(),
+		Goroutines:     runtime.NumGoroutine(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		NumCPU:         runtime.NumCPU(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapSysBytes:   mem.HeapSys,
+		HeapObjects:    mem.HeapObjects,
+		StackSysBytes:  mem.StackSys,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		GCPauseTotalMs: float64(mem.PauseTotalNs) / float64(time.Millisecond),
+	}
+	if mem.LastGC > 0 {
+		stats.LastGC = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+	writeAdminJSON(w, http.StatusOK, stats)
+}
+
+// buildInfo reports the module version and the VCS revision stamped by
+// go build, when the binary was built from a checkout.
+func (s *AdminServer) buildInfo(w http.ResponseWriter, _ *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build information is not available", http.StatusNotFound)
+		return
+	}
+	response := buildInfoResponse{
+		GoVersion: info.GoVersion,
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		Settings:  map[string]string{},
+	}
+	for _, setting := range info.Settings {
+		response.Settings[setting.Key] = setting.Value
+	}
+	writeAdminJSON(w, http.StatusOK, response)
+}
+
+func (s *AdminServer) config(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, s.cfg.Redacted())
+}
+
+func (s *AdminServer) logLevel(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, http.StatusOK, currentLogLevel())
+}
+
+// setLogLevel accepts the names of slog, such as debug or WARN, with an
+// optional offset, such as info+2. Overrides are keyed by op prefix, such
+// as services.auth.
+func (s *AdminServer) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var request logLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	level := slogger.Level()
+	if request.Level != "" {
+		if err := level.UnmarshalText([]byte(request.Level)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var overrides config.LogLevelOverrides
+	if request.Overrides != nil {
+		overrides = config.LogLevelOverrides{}
+		for prefix, name := range request.Overrides {
+			var override slog.Level
+			if err := override.UnmarshalText([]byte(name)); err != nil {
+				http.Error(w, fmt.Sprintf("invalid level of %q: %v", prefix, err), http.StatusBadRequest)
+				return
+			}
+			overrides[prefix] = override
+		}
+	}
+
+	// Logged before the change, so raising the level does not hide it.
+	slog.Info("Log level changed",
+		slog.String("op", "server.AdminServer.setLogLevel"),
+		slog.String("from", slogger.Level().String()),
+		slog.String("to", level.String()),
+		slog.Any("overrides", request.Overrides),
+	)
+	slogger.SetLevel(level)
+	if overrides != nil {
+		slogger.SetOverrides(overrides)
+	}
+	writeAdminJSON(w, http.StatusOK, currentLogLevel())
+}
+
+func currentLogLevel() logLevelResponse {
+	response := logLevelResponse{Level: slogger.Level().String(), Overrides: map[string]string{}}
+	for prefix, level := range slogger.Overrides() {
+		response.Overrides[prefix] = level.String()
+	}
+	return response
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
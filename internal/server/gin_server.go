@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,16 +15,37 @@ import (
 
 	"marketplace/config"
 	"marketplace/internal/database"
+	"marketplace/internal/entities"
 	"marketplace/internal/handlers/http/v1"
+	"marketplace/internal/health"
+	"marketplace/internal/jobs"
+	"marketplace/internal/mailer"
+	"marketplace/internal/metrics"
+	"marketplace/internal/oidc"
+	"marketplace/internal/outbox"
+	"marketplace/internal/ratelimit"
 	"marketplace/internal/repositories/postgres"
 	"marketplace/internal/services"
+	"marketplace/internal/webhooks"
+	"marketplace/migrations"
 )
 
 type GinServer struct {
-	router     *gin.Engine
-	db         *database.PostgresDatabase
-	cfg        *config.Config
-	httpServer *http.Server
+	router      *gin.Engine
+	db          *database.PostgresDatabase
+	cfg         *config.Config
+	httpServer  *http.Server
+	health      *health.Checker
+	workers     []worker
+	workersWG   sync.WaitGroup
+	workersMu   sync.Mutex
+	workersCtx  context.Context
+	stopWorkers context.CancelFunc
+}
+
+// worker is a background process running for the lifetime of the server.
+type worker interface {
+	Run(ctx context.Context)
 }
 
 // @title           Marketplace
@@ -31,7 +54,7 @@ type GinServer struct {
 // @schemes         http
 // @host            localhost:8089
 // @BasePath        /api/v1
-func NewGinServer(cfg *config.Config, db *database.PostgresDatabase) *GinServer {
+func NewGinServer(cfg *config.Config, db *database.PostgresDatabase, crashReporters ...v1.CrashReporter) *GinServer {
 	switch cfg.AppEnv {
 	case config.Local, config.Dev:
 		gin.SetMode(gin.DebugMode)
@@ -42,28 +65,253 @@ func NewGinServer(cfg *config.Config, db *database.PostgresDatabase) *GinServer
 	}
 
 	userRepository := postgres.NewUserPostgresRepository(db)
-	authService := services.NewAuthServiceImpl(userRepository, time.Duration(cfg.TokenTTLMinutes), cfg.JWTSecret)
+	sessionRepository := postgres.NewSessionPostgresRepository(db)
+	twoFactorRepository := postgres.NewTwoFactorPostgresRepository(db)
+	loginAttemptRepository := postgres.NewLoginAttemptPostgresRepository(db)
+	apiKeyRepository := postgres.NewAPIKeyPostgresRepository(db)
+	emailVerificationRepository := postgres.NewEmailVerificationPostgresRepository(db)
+	mailSender := mailer.New(cfg)
+	emailVerificationService := services.NewEmailVerificationServiceImpl(
+		userRepository,
+		emailVerificationRepository,
+		mailSender,
+		time.Duration(cfg.EmailVerificationTTLMinutes),
+		time.Duration(cfg.EmailVerificationResendIntervalSeconds),
+	)
+	emailVerificationHandlers := v1.NewEmailVerificationHTTPHandlers(emailVerificationService)
+	authService := services.NewAuthServiceImpl(
+		userRepository,
+		sessionRepository,
+		twoFactorRepository,
+		loginAttemptRepository,
+		apiKeyRepository,
+		emailVerificationService,
+		mailSender,
+		time.Duration(cfg.TokenTTLMinutes),
+		time.Duration(cfg.PasswordResetTTLMinutes),
+		services.LoginAttemptPolicy{
+			MaxAccountFailures: cfg.LoginMaxAccountFailures,
+			MaxIPFailures:      cfg.LoginMaxIPFailures,
+			Window:             time.Duration(cfg.LoginFailureWindowMinutes) * time.Minute,
+			BaseLockout:        time.Duration(cfg.LoginLockoutBaseSeconds) * time.Second,
+			MaxLockout:         time.Duration(cfg.LoginLockoutMaxSeconds) * time.Second,
+		},
+		cfg.JWTSecret,
+		cfg.TOTPIssuer,
+	)
 	authHandlers := v1.NewAuthHTTPHandlers(authService)
 
+	oidcClients := make([]*oidc.Client, len(cfg.OIDCProviders))
+	for i, provider := range cfg.OIDCProviders {
+		oidcClients[i] = oidc.NewClient(provider, nil)
+	}
+	oidcService := services.NewOIDCServiceImpl(
+		oidcClients,
+		postgres.NewUserIdentityPostgresRepository(db),
+		authService,
+		time.Duration(cfg.OIDCStateTTLMinutes),
+	)
+	oidcHandlers := v1.NewOIDCHTTPHandlers(oidcService, cfg.AppEnv != config.Local)
+
+	apiKeyService := services.NewAPIKeyServiceImpl(apiKeyRepository)
+	apiKeyHandlers := v1.NewAPIKeyHTTPHandlers(apiKeyService)
+
+	advertisementLifetime := time.Duration(cfg.AdvertisementLifetimeDays) * 24 * time.Hour
 	advertisementRepository := postgres.NewAdvertisementPostgresRepository(db)
-	advertisementService := services.NewAdvertisementServiceImpl(advertisementRepository)
+	advertisementService := services.NewAdvertisementServiceImpl(advertisementRepository, advertisementLifetime)
 	advertisementHandlers := v1.NewAdvertisementHTTPHandlers(advertisementService)
 
-	router := gin.Default()
-	v1Routes := router.Group(
-		"/api/v1",
+	jobClient := jobs.NewClient(postgres.NewJobPostgresRepository(db), jobs.Config{
+		Concurrency:        cfg.JobsConcurrency,
+		PollInterval:       time.Duration(cfg.JobsPollIntervalSeconds) * time.Second,
+		VisibilityTimeout:  time.Duration(cfg.JobsVisibilityTimeoutSeconds) * time.Second,
+		ShutdownTimeout:    time.Duration(cfg.JobsShutdownTimeoutSeconds) * time.Second,
+		DefaultMaxAttempts: cfg.JobsMaxAttempts,
+		RetryBase:          time.Duration(cfg.JobsRetryBaseSeconds) * time.Second,
+		RetryMax:           time.Duration(cfg.JobsRetryMaxSeconds) * time.Second,
+		Retention:          time.Duration(cfg.JobsRetentionHours) * time.Hour,
+	})
+	// Without the job workers an import job would stay pending forever.
+	var importJobClient *jobs.Client
+	if cfg.JobsEnabled {
+		importJobClient = jobClient
+	}
+	advertisementImportService := services.NewAdvertisementImportServiceImpl(
+		advertisementRepository,
+		postgres.NewImportJobPostgresRepository(db),
+		importJobClient,
+		cfg.ImportSyncMaxRows,
+		advertisementLifetime,
+	)
+	advertisementImportHandlers := v1.NewAdvertisementImportHTTPHandlers(advertisementImportService, cfg.ImportMaxBytes)
+
+	userService := services.NewUserServiceImpl(userRepository, advertisementRepository)
+	userHandlers := v1.NewUserHTTPHandlers(userService)
+
+	webhookRepository := postgres.NewWebhookPostgresRepository(db)
+	webhookService := services.NewWebhookServiceImpl(webhookRepository)
+	webhookHandlers := v1.NewWebhookHTTPHandlers(webhookService)
+
+	rateLimitStore := ratelimit.New(cfg, db)
+
+	services.RegisterAdvertisementExpiryJobs(jobClient, services.NewAdvertisementExpiryServiceImpl(
+		advertisementRepository,
+		mailSender,
+		time.Duration(cfg.AdvertisementExpiryReminderHours)*time.Hour,
+	))
+	services.RegisterAdvertisementPublishingJobs(jobClient, services.NewAdvertisementPublishingServiceImpl(advertisementRepository))
+	services.RegisterAdvertisementImportJobs(jobClient, advertisementImportService)
+
+	// Webhook deliveries are queued by the outbox bus, so they are only
+	// produced while the bus sink is enabled.
+	webhookDispatcher := webhooks.NewDispatcher(
+		webhookRepository,
+		webhooks.NewHTTPClient(time.Duration(cfg.WebhookTimeoutSeconds)*time.Second, cfg.WebhookAllowPrivateNetworks),
+		webhooks.DispatcherConfig{
+			PollInterval:         time.Duration(cfg.WebhookPollIntervalSeconds) * time.Second,
+			MaxAttempts:          cfg.WebhookMaxAttempts,
+			RetryBase:            time.Duration(cfg.WebhookRetryBaseSeconds) * time.Second,
+			RetryMax:             time.Duration(cfg.WebhookRetryMaxSeconds) * time.Second,
+			DisableAfterFailures: cfg.WebhookDisableAfterFailures,
+			Timeout:              time.Duration(cfg.WebhookTimeoutSeconds) * time.Second,
+		},
+	)
+	workers := []worker{webhookDispatcher}
+	outboxSinks, outboxBus := outbox.NewSinks(cfg)
+	outboxBus.Subscribe(outbox.AllEvents, webhookDispatcher.HandleEvent)
+	if cfg.JobsEnabled {
+		workers = append(workers, jobClient)
+	}
+	if cfg.OutboxRelayEnabled {
+		workers = append(workers, outbox.NewRelay(postgres.NewOutboxPostgresRepository(db), outboxSinks, outbox.RelayConfig{
+			BatchSize:    cfg.OutboxBatchSize,
+			PollInterval: time.Duration(cfg.OutboxPollIntervalSeconds) * time.Second,
+			Lease:        time.Duration(cfg.OutboxLeaseSeconds) * time.Second,
+			MaxAttempts:  cfg.OutboxMaxAttempts,
+			RetryBase:    time.Duration(cfg.OutboxRetryBaseSeconds) * time.Second,
+			RetryMax:     time.Duration(cfg.OutboxRetryMaxSeconds) * time.Second,
+			Retention:    time.Duration(cfg.OutboxRetentionHours) * time.Hour,
+		}))
+	}
+
+	healthChecker := health.NewChecker(time.Duration(cfg.HealthCheckTimeoutSeconds) * time.Second)
+	healthChecker.Register("database", health.PostgresCheck(db.Pool))
+	if version, err := migrations.LatestVersion(); err != nil {
+		slog.Error("Cannot read migrations, schema version is not checked", slog.Any("error", err))
+	} else {
+		healthChecker.Register("migrations", health.MigrationCheck(db.Pool, version))
+	}
+	healthHandlers := v1.NewHealthHTTPHandlers(healthChecker)
+
+	router := gin.New()
+	recovery := v1.RecoveryMiddleware(crashReporters...)
+	// Without trusted proxies the client IP is the address of the peer, so a
+	// forged X-Forwarded-For cannot dodge IP lockouts and rate limits.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies, trusting none", slog.Any("error", err))
+		_ = router.SetTrustedProxies(nil)
+	}
+	// Probes are registered before the middlewares below, so they do not
+	// flood traces, access logs and request metrics.
+	router.GET("/healthz", recovery, healthHandlers.Liveness)
+	router.GET("/readyz", recovery, healthHandlers.Readiness)
+	// Handlers pass the Gin context to services, which reach the span and
+	// the logger of the request through the request context only with this
+	// fallback.
+	router.ContextWithFallback = true
+	router.Use(
 		v1.RequestIDMiddleware(),
+		v1.TracingMiddleware(),
 		v1.SetLoggerMiddleware(),
+		v1.AccessLogMiddleware(),
 	)
+	if cfg.MetricsEnabled {
+		router.Use(v1.MetricsMiddleware())
+		if err := metrics.RegisterPool(db.Pool); err != nil {
+			slog.Error("Database pool metrics are not registered", slog.Any("error", err))
+		}
+	}
+	// Errors and panics are handled last, so the middlewares above see the
+	// final status of the response.
+	router.Use(v1.ErrorMiddleware(), recovery)
+	router.NoRoute(v1.RouteNotFound)
+	v1Routes := router.Group("/api/v1", v1.RateLimitMiddleware(rateLimitStore, "default", cfg.RateLimitDefault))
 
-	authRoutes := v1Routes.Group("/auth")
+	authRoutes := v1Routes.Group("/auth", v1.RateLimitMiddleware(rateLimitStore, "auth", cfg.RateLimitAuth))
 	authRoutes.POST("/register", authHandlers.Register)
 	authRoutes.POST("/login", authHandlers.Login)
-	authRoutes.GET("/me", v1.AuthMiddleware(cfg.JWTSecret), authHandlers.GetMe)
+	authRoutes.POST("/login/2fa", authHandlers.LoginWithTwoFactor)
+	authRoutes.GET("/me", v1.AuthMiddleware(authService), authHandlers.GetMe)
+	authRoutes.PATCH("/me", v1.AuthMiddleware(authService), userHandlers.UpdateMe)
+	authRoutes.POST("/password/change", v1.AuthMiddleware(authService), authHandlers.ChangePassword)
+	authRoutes.POST("/password/forgot", authHandlers.ForgotPassword)
+	authRoutes.POST("/password/reset", authHandlers.ResetPassword)
+	authRoutes.POST("/email/verify", emailVerificationHandlers.VerifyEmail)
+	authRoutes.POST("/email/resend", v1.AuthMiddleware(authService), emailVerificationHandlers.ResendVerificationEmail)
+	authRoutes.POST("/2fa/enroll", v1.AuthMiddleware(authService), authHandlers.EnrollTwoFactor)
+	authRoutes.POST("/2fa/confirm", v1.AuthMiddleware(authService), authHandlers.ConfirmTwoFactor)
+	authRoutes.POST("/2fa/disable", v1.AuthMiddleware(authService), authHandlers.DisableTwoFactor)
+	authRoutes.GET("/oidc/providers", oidcHandlers.GetProviders)
+	authRoutes.GET("/oidc/identities", v1.AuthMiddleware(authService), oidcHandlers.GetIdentities)
+	authRoutes.GET("/oidc/:provider/login", oidcHandlers.Login)
+	authRoutes.POST("/oidc/:provider/link", v1.AuthMiddleware(authService), oidcHandlers.Link)
+	authRoutes.GET("/oidc/:provider/callback", oidcHandlers.Callback)
+
+	exportLimit := v1.ExportLimitMiddleware(cfg.ExportMaxConcurrent, time.Duration(cfg.ExportTimeoutSeconds)*time.Second)
 
 	advertisementRoutes := v1Routes.Group("/advertisements")
-	advertisementRoutes.POST("/", v1.AuthMiddleware(cfg.JWTSecret), advertisementHandlers.CreateAdvertisement)
-	advertisementRoutes.GET("/", v1.SetUserInfoMiddleware(cfg.JWTSecret), advertisementHandlers.GetAdvertisements)
+	advertisementRoutes.POST("/",
+		v1.AuthMiddleware(authService, entities.AdvertisementsWriteScope),
+		v1.RequireVerifiedEmailMiddleware(emailVerificationService, cfg.RequireVerifiedEmailForAdvertisements),
+		v1.RateLimitMiddleware(rateLimitStore, "advertisements_write", cfg.RateLimitAdvertisementsWrite),
+		advertisementHandlers.CreateAdvertisement,
+	)
+	advertisementRoutes.GET("/", v1.SetUserInfoMiddleware(authService, entities.AdvertisementsReadScope), advertisementHandlers.GetAdvertisements)
+	advertisementRoutes.PATCH("/:id",
+		v1.AuthMiddleware(authService, entities.AdvertisementsWriteScope),
+		v1.RateLimitMiddleware(rateLimitStore, "advertisements_write", cfg.RateLimitAdvertisementsWrite),
+		advertisementHandlers.UpdateAdvertisement,
+	)
+	advertisementRoutes.POST("/:id/renew",
+		v1.AuthMiddleware(authService, entities.AdvertisementsWriteScope),
+		advertisementHandlers.RenewAdvertisement,
+	)
+	advertisementRoutes.GET("/export",
+		v1.AuthMiddleware(authService, entities.AdvertisementsReadScope),
+		exportLimit,
+		advertisementHandlers.ExportAdvertisements,
+	)
+	advertisementRoutes.POST("/import",
+		v1.AuthMiddleware(authService, entities.AdvertisementsWriteScope),
+		v1.RequireVerifiedEmailMiddleware(emailVerificationService, cfg.RequireVerifiedEmailForAdvertisements),
+		v1.RateLimitMiddleware(rateLimitStore, "advertisements_write", cfg.RateLimitAdvertisementsWrite),
+		advertisementImportHandlers.ImportAdvertisements,
+	)
+	advertisementRoutes.GET("/import/:id",
+		v1.AuthMiddleware(authService, entities.AdvertisementsWriteScope),
+		advertisementImportHandlers.GetImportJob,
+	)
+
+	userRoutes := v1Routes.Group("/users")
+	userRoutes.GET("/:login", userHandlers.GetUserProfile)
+	userRoutes.GET("/:login/advertisements", v1.SetUserInfoMiddleware(authService, entities.AdvertisementsReadScope), userHandlers.GetUserAdvertisements)
+
+	adminRoutes := v1Routes.Group("/admin", v1.AuthMiddleware(authService), v1.RequireRoleMiddleware(entities.AdminRole))
+	adminRoutes.GET("/advertisements/export", exportLimit, advertisementHandlers.ExportAllAdvertisements)
+
+	apiKeyRoutes := v1Routes.Group("/api-keys", v1.AuthMiddleware(authService))
+	apiKeyRoutes.POST("/", apiKeyHandlers.CreateAPIKey)
+	apiKeyRoutes.GET("/", apiKeyHandlers.GetAPIKeys)
+	apiKeyRoutes.DELETE("/:id", apiKeyHandlers.RevokeAPIKey)
+
+	webhookRoutes := v1Routes.Group("/webhooks", v1.AuthMiddleware(authService))
+	webhookRoutes.POST("/", webhookHandlers.CreateWebhook)
+	webhookRoutes.GET("/", webhookHandlers.GetWebhooks)
+	webhookRoutes.GET("/:id", webhookHandlers.GetWebhook)
+	webhookRoutes.PATCH("/:id", webhookHandlers.UpdateWebhook)
+	webhookRoutes.DELETE("/:id", webhookHandlers.DeleteWebhook)
+	webhookRoutes.GET("/:id/deliveries", webhookHandlers.GetWebhookDeliveries)
+	webhookRoutes.POST("/:id/deliveries/:deliveryID/replay", webhookHandlers.ReplayWebhookDelivery)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -72,20 +320,66 @@ func NewGinServer(cfg *config.Config, db *database.PostgresDatabase) *GinServer
 		Handler: router,
 	}
 
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
 	return &GinServer{
-		router:     router,
-		db:         db,
-		cfg:        cfg,
-		httpServer: httpServer,
+		router:      router,
+		db:          db,
+		cfg:         cfg,
+		httpServer:  httpServer,
+		health:      healthChecker,
+		workers:     workers,
+		workersCtx:  workersCtx,
+		stopWorkers: stopWorkers,
 	}
 }
 
+// Run starts the background workers and serves requests. Shutdown may come
+// first on an early signal, in which case the workers are not started.
 func (s *GinServer) Run() error {
+	s.workersMu.Lock()
+	if s.workersCtx.Err() == nil {
+		for _, w := range s.workers {
+			s.workersWG.Add(1)
+			go func() {
+				defer s.workersWG.Done()
+				w.Run(s.workersCtx)
+			}()
+		}
+	}
+	s.workersMu.Unlock()
+
 	slog.Info("Starting Gin server")
 	return s.httpServer.ListenAndServe()
 }
 
+// Shutdown fails readiness for the drain period, then stops accepting
+// requests and waits for background workers, so events produced by
+// in-flight requests are still relayed. Once ctx is done the remaining
+// connections are closed and workers still running are left behind.
 func (s *GinServer) Shutdown(ctx context.Context) error {
 	slog.Info("Shutting down Gin server...")
-	return s.httpServer.Shutdown(ctx)
+	s.health.SetDraining()
+	select {
+	case <-time.After(time.Duration(s.cfg.ShutdownDrainSeconds) * time.Second):
+	case <-ctx.Done():
+	}
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		_ = s.httpServer.Close()
+	}
+	s.workersMu.Lock()
+	s.stopWorkers()
+	s.workersMu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.workersWG.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		err = errors.Join(err, fmt.Errorf("background workers did not stop: %w", ctx.Err()))
+	}
+	return err
 }
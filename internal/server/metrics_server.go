@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"marketplace/config"
+	"marketplace/internal/metrics"
+)
+
+// MetricsServer serves the Prometheus metrics on a listener of its own, so
+// the monitoring network can reach them without the API or the
+// diagnostics of the admin server. It has no authentication.
+type MetricsServer struct {
+	cfg        *config.Config
+	httpServer *http.Server
+}
+
+func NewMetricsServer(cfg *config.Config) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	return &MetricsServer{
+		cfg: cfg,
+		httpServer: &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (s *MetricsServer) Run() error {
+	slog.Info("Starting metrics server", slog.String("addr", s.cfg.MetricsAddr))
+	return s.httpServer.ListenAndServe()
+}
+
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	slog.Info("Shutting down metrics server...")
+	return s.httpServer.Shutdown(ctx)
+}
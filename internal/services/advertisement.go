@@ -2,41 +2,63 @@ package services
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"time"
 
 	"github.com/google/uuid"
 
 	"marketplace/internal/dto"
 	"marketplace/internal/entities"
 	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
 	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
 )
 
 type AdvertisementServiceImpl struct {
 	advertisementRepository repositories.AdvertisementRepository
+	lifetime                time.Duration
 }
 
-func NewAdvertisementServiceImpl(advertisementRepository repositories.AdvertisementRepository) AdvertisementService {
-	return &AdvertisementServiceImpl{advertisementRepository: advertisementRepository}
+func NewAdvertisementServiceImpl(advertisementRepository repositories.AdvertisementRepository, lifetime time.Duration) AdvertisementService {
+	return &AdvertisementServiceImpl{
+		advertisementRepository: advertisementRepository,
+		lifetime:                lifetime,
+	}
 }
 
-func (s *AdvertisementServiceImpl) CreateAdvertisement(ctx context.Context, advertisementData *dto.AdvertisementCreateRequest, userID uuid.UUID) (*dto.AdvertisementResponse, error) {
-	logger := slogger.GetLoggerFromContext(ctx).
-		With(slog.String("op", "services.advertisement.CreateAdvertisement"))
+func (s *AdvertisementServiceImpl) CreateAdvertisement(ctx context.Context, advertisementData *dto.AdvertisementCreateRequest, userID uuid.UUID) (_ *dto.AdvertisementResponse, err error) {
+	const op = "services.advertisement.CreateAdvertisement"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
 
 	logger.Info("Creating advertisement",
 		slog.String("title", advertisementData.Title),
 		slog.String("user_id", userID.String()),
 	)
 
+	// The columns are timestamps without time zone, which keep the wall
+	// clock of a time and drop its offset, so every time is stored in UTC.
+	now := time.Now().UTC()
 	advertisement := &entities.Advertisement{
-		Title:    advertisementData.Title,
-		Content:  advertisementData.Content,
-		ImageURL: advertisementData.ImageURL,
-		Price:    advertisementData.Price,
-		UserID:   userID,
+		Title:     advertisementData.Title,
+		Content:   advertisementData.Content,
+		ImageURL:  advertisementData.ImageURL,
+		Price:     advertisementData.Price,
+		UserID:    userID,
+		PublishAt: now,
+	}
+	if advertisementData.PublishAt != nil && advertisementData.PublishAt.After(now) {
+		advertisement.PublishAt = advertisementData.PublishAt.UTC()
+	} else {
+		advertisement.PublishedAt = &now
 	}
-	err := s.advertisementRepository.CreateAdvertisement(ctx, advertisement)
+	// The lifetime starts when the advertisement is published.
+	advertisement.ExpiresAt = advertisement.PublishAt.Add(s.lifetime)
+	err = s.advertisementRepository.CreateAdvertisement(ctx, advertisement)
 	if err != nil {
 		logger.Error("Failed to create advertisement", slog.Any("error", err))
 		return nil, ErrCannotCreateAdvertisement
@@ -45,21 +67,19 @@ func (s *AdvertisementServiceImpl) CreateAdvertisement(ctx context.Context, adve
 	logger.Info("Advertisement created successfully",
 		slog.String("title", advertisement.Title),
 		slog.String("user_id", userID.String()),
+		slog.Bool("scheduled", advertisement.PublishedAt == nil),
 	)
+	metrics.RecordAdvertisementsCreated(metrics.APIAdvertisementSource, 1)
 
-	return &dto.AdvertisementResponse{
-		Title:       advertisement.Title,
-		Content:     advertisement.Content,
-		ImageURL:    advertisement.ImageURL,
-		Price:       advertisement.Price,
-		AuthorLogin: advertisement.AuthorLogin,
-		CreatedAt:   advertisement.CreatedAt,
-	}, nil
+	return newAdvertisementResponse(advertisement), nil
 }
 
-func (s *AdvertisementServiceImpl) GetAdvertisements(ctx context.Context, filters *dto.AdvertisementFilters) ([]*dto.AdvertisementResponse, error) {
-	logger := slogger.GetLoggerFromContext(ctx).
-		With(slog.String("op", "services.advertisement.GetAdvertisements"))
+func (s *AdvertisementServiceImpl) GetAdvertisements(ctx context.Context, filters *dto.AdvertisementPageFilters) (_ []*dto.AdvertisementResponse, err error) {
+	const op = "services.advertisement.GetAdvertisements"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
 
 	logger.Info("Fetching advertisements",
 		slog.Int("page_number", filters.PageNumber),
@@ -80,13 +100,7 @@ func (s *AdvertisementServiceImpl) GetAdvertisements(ctx context.Context, filter
 		}()),
 	)
 
-	offset := (filters.PageNumber - 1) * filters.PageSize
-	advertisements, err := s.advertisementRepository.GetAdvertisements(
-		ctx,
-		offset, filters.PageSize,
-		filters.MinPrice, filters.MaxPrice,
-		filters.SortType, filters.SortOrder,
-	)
+	advertisements, err := s.advertisementRepository.GetAdvertisements(ctx, newAdvertisementPageFilter(filters))
 	if err != nil {
 		logger.Error("Failed to get advertisements", slog.Any("error", err))
 		return nil, ErrCannotGetAdvertisements
@@ -94,16 +108,193 @@ func (s *AdvertisementServiceImpl) GetAdvertisements(ctx context.Context, filter
 
 	logger.Info("Successfully fetched advertisements", slog.Int("count", len(advertisements)))
 
-	advertisementsResponse := make([]*dto.AdvertisementResponse, len(advertisements))
-	for i, advertisement := range advertisements {
-		advertisementsResponse[i] = &dto.AdvertisementResponse{
+	return newAdvertisementResponses(advertisements), nil
+}
+
+// UpdateAdvertisement changes the given fields of an advertisement of the
+// user. Only scheduled advertisements can be rescheduled.
+func (s *AdvertisementServiceImpl) UpdateAdvertisement(
+	ctx context.Context,
+	userID, id uuid.UUID,
+	advertisementData *dto.AdvertisementUpdateRequest,
+) (_ *dto.AdvertisementResponse, err error) {
+	const op = "services.advertisement.UpdateAdvertisement"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Updating advertisement",
+		slog.String("advertisementID", id.String()),
+		slog.String("userID", userID.String()),
+	)
+
+	advertisement, err := s.advertisementRepository.GetAdvertisementByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrAdvertisementNotFound
+		}
+		logger.Error("Failed to get advertisement", slog.Any("error", err))
+		return nil, ErrCannotUpdateAdvertisement
+	}
+	if advertisement.UserID != userID {
+		return nil, ErrAdvertisementNotFound
+	}
+	if advertisementData.Title != nil {
+		advertisement.Title = *advertisementData.Title
+	}
+	if advertisementData.Content != nil {
+		advertisement.Content = *advertisementData.Content
+	}
+	if advertisementData.ImageURL != nil {
+		advertisement.ImageURL = *advertisementData.ImageURL
+	}
+	if advertisementData.Price != nil {
+		advertisement.Price = *advertisementData.Price
+	}
+	if advertisementData.PublishAt != nil {
+		if advertisement.PublishedAt != nil {
+			return nil, ErrAdvertisementAlreadyPublished
+		}
+		advertisement.PublishAt = advertisementData.PublishAt.UTC()
+		if now := time.Now().UTC(); advertisement.PublishAt.Before(now) {
+			advertisement.PublishAt = now
+		}
+		advertisement.ExpiresAt = advertisement.PublishAt.Add(s.lifetime)
+	}
+
+	err = s.advertisementRepository.UpdateAdvertisement(ctx, advertisement)
+	if err != nil {
+		// The advertisement exists, so it was deleted or published in the
+		// meantime; only the latter keeps a reschedule from being saved.
+		if errors.Is(err, repositories.ErrNotFound) {
+			if advertisementData.PublishAt != nil {
+				return nil, ErrAdvertisementAlreadyPublished
+			}
+			return nil, ErrAdvertisementNotFound
+		}
+		logger.Error("Failed to update advertisement", slog.Any("error", err))
+		return nil, ErrCannotUpdateAdvertisement
+	}
+
+	logger.Info("Advertisement updated successfully", slog.String("advertisementID", id.String()))
+
+	return newAdvertisementResponse(advertisement), nil
+}
+
+// RenewAdvertisement starts a new lifetime for an advertisement of the user,
+// including one that has already expired and been archived.
+func (s *AdvertisementServiceImpl) RenewAdvertisement(ctx context.Context, userID, id uuid.UUID) (_ *dto.AdvertisementResponse, err error) {
+	const op = "services.advertisement.RenewAdvertisement"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Renewing advertisement",
+		slog.String("advertisementID", id.String()),
+		slog.String("userID", userID.String()),
+	)
+
+	advertisement, err := s.advertisementRepository.RenewAdvertisement(ctx, id, userID, time.Now().UTC().Add(s.lifetime))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrAdvertisementNotFound
+		}
+		logger.Error("Failed to renew advertisement", slog.Any("error", err))
+		return nil, ErrCannotRenewAdvertisement
+	}
+
+	logger.Info("Advertisement renewed successfully",
+		slog.String("advertisementID", id.String()),
+		slog.Time("expiresAt", advertisement.ExpiresAt),
+	)
+
+	return newAdvertisementResponse(advertisement), nil
+}
+
+// ExportAdvertisements streams advertisements matching the filters to fn.
+// Only advertisements of userID are exported unless it is nil. The export of
+// a user includes their expired, archived and scheduled advertisements. The
+// export of all advertisements feeds partners, so it keeps to the ones the
+// public listing shows.
+func (s *AdvertisementServiceImpl) ExportAdvertisements(
+	ctx context.Context,
+	userID *uuid.UUID,
+	filters *dto.AdvertisementFilters,
+	fn func(row *dto.AdvertisementExportRow) error,
+) (err error) {
+	const op = "services.advertisement.ExportAdvertisements"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Exporting advertisements", slog.Bool("all", userID == nil))
+
+	count := 0
+	filter := newAdvertisementFilter(filters)
+	filter.UserID = userID
+	filter.IncludeExpired = userID != nil
+	filter.IncludeScheduled = userID != nil
+	err = s.advertisementRepository.StreamAdvertisements(ctx, filter, func(advertisement *entities.Advertisement) error {
+		count++
+		return fn(&dto.AdvertisementExportRow{
+			ID:          advertisement.ID,
+			ExternalID:  advertisement.ExternalID,
 			Title:       advertisement.Title,
 			Content:     advertisement.Content,
 			ImageURL:    advertisement.ImageURL,
 			Price:       advertisement.Price,
 			AuthorLogin: advertisement.AuthorLogin,
 			CreatedAt:   advertisement.CreatedAt,
-		}
+			UpdatedAt:   advertisement.UpdatedAt,
+		})
+	})
+	if err != nil {
+		logger.Error("Failed to export advertisements", slog.Int("exported", count), slog.Any("error", err))
+		return ErrCannotExportAdvertisements
+	}
+
+	logger.Info("Successfully exported advertisements", slog.Int("count", count))
+
+	return nil
+}
+
+func newAdvertisementFilter(filters *dto.AdvertisementFilters) *repositories.AdvertisementFilter {
+	return &repositories.AdvertisementFilter{
+		MinPrice:  filters.MinPrice,
+		MaxPrice:  filters.MaxPrice,
+		SortType:  filters.SortType,
+		SortOrder: filters.SortOrder,
+	}
+}
+
+func newAdvertisementPageFilter(filters *dto.AdvertisementPageFilters) *repositories.AdvertisementFilter {
+	filter := newAdvertisementFilter(&filters.AdvertisementFilters)
+	filter.Offset = (filters.PageNumber - 1) * filters.PageSize
+	filter.Limit = filters.PageSize
+	return filter
+}
+
+func newAdvertisementResponse(advertisement *entities.Advertisement) *dto.AdvertisementResponse {
+	return &dto.AdvertisementResponse{
+		ID:          advertisement.ID,
+		Title:       advertisement.Title,
+		Content:     advertisement.Content,
+		ImageURL:    advertisement.ImageURL,
+		Price:       advertisement.Price,
+		AuthorLogin: advertisement.AuthorLogin,
+		CreatedAt:   advertisement.CreatedAt,
+		PublishAt:   advertisement.PublishAt,
+		ExpiresAt:   advertisement.ExpiresAt,
+	}
+}
+
+func newAdvertisementResponses(advertisements []*entities.Advertisement) []*dto.AdvertisementResponse {
+	advertisementsResponse := make([]*dto.AdvertisementResponse, len(advertisements))
+	for i, advertisement := range advertisements {
+		advertisementsResponse[i] = newAdvertisementResponse(advertisement)
 	}
-	return advertisementsResponse, nil
+	return advertisementsResponse
 }
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"marketplace/internal/jobs"
+	"marketplace/internal/mailer"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+const expiryReminderBatchSize = 100
+
+type AdvertisementExpiryServiceImpl struct {
+	advertisementRepository repositories.AdvertisementRepository
+	mailer                  mailer.Mailer
+	reminderBefore          time.Duration
+}
+
+func NewAdvertisementExpiryServiceImpl(
+	advertisementRepository repositories.AdvertisementRepository,
+	mailer mailer.Mailer,
+	reminderBefore time.Duration,
+) AdvertisementExpiryService {
+	return &AdvertisementExpiryServiceImpl{
+		advertisementRepository: advertisementRepository,
+		mailer:                  mailer,
+		reminderBefore:          reminderBefore,
+	}
+}
+
+type expiryRemindersArgs struct{}
+
+func (expiryRemindersArgs) Kind() string { return "advertisements.expiry_reminders" }
+
+type archiveExpiredArgs struct{}
+
+func (archiveExpiredArgs) Kind() string { return "advertisements.archive_expired" }
+
+// RegisterAdvertisementExpiryJobs schedules the expiry reminders and the
+// sweep archiving expired advertisements. Expired advertisements are hidden
+// from listings right away, so the sweep only has to catch up eventually.
+func RegisterAdvertisementExpiryJobs(c *jobs.Client, s AdvertisementExpiryService) {
+	jobs.Register(c, func(ctx context.Context, _ *jobs.Job[expiryRemindersArgs]) error {
+		_, err := s.SendExpiryReminders(ctx)
+		return err
+	})
+	jobs.Register(c, func(ctx context.Context, _ *jobs.Job[archiveExpiredArgs]) error {
+		_, err := s.ArchiveExpiredAdvertisements(ctx)
+		return err
+	})
+	c.Schedule("advertisements.expiry_reminders", "*/15 * * * *", expiryRemindersArgs{})
+	c.Schedule("advertisements.archive_expired", "*/5 * * * *", archiveExpiredArgs{})
+}
+
+// SendExpiryReminders mails the owners of advertisements expiring within the
+// reminder period and returns the number of reminders sent. A failed mail
+// stops the run, the advertisements left are picked up by the next one.
+func (s *AdvertisementExpiryServiceImpl) SendExpiryReminders(ctx context.Context) (_ int, err error) {
+	const op = "services.advertisement_expiry.SendExpiryReminders"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slog.Default().With(slog.String("op", op))
+
+	sent := 0
+	for {
+		advertisements, err := s.advertisementRepository.GetExpiringAdvertisements(ctx, time.Now().Add(s.reminderBefore), expiryReminderBatchSize)
+		if err != nil {
+			return sent, err
+		}
+		for _, advertisement := range advertisements {
+			err = s.mailer.Send(ctx, &mailer.Message{
+				To:      advertisement.Email,
+				Subject: "Your advertisement expires soon",
+				Body: "Your advertisement \"" + advertisement.Title + "\" expires at " +
+					advertisement.ExpiresAt.Format(time.RFC1123) + " and will be hidden from listings.\n" +
+					"Renew it with POST /api/v1/advertisements/" + advertisement.ID.String() + "/renew to keep it listed.",
+			})
+			if err != nil {
+				return sent, fmt.Errorf("cannot send expiry reminder for advertisement %s: %w", advertisement.ID, err)
+			}
+			err = s.advertisementRepository.MarkAdvertisementExpiryReminded(ctx, advertisement.ID, advertisement.ExpiresAt)
+			if err != nil {
+				return sent, err
+			}
+			sent++
+		}
+		if len(advertisements) < expiryReminderBatchSize {
+			break
+		}
+	}
+
+	if sent > 0 {
+		logger.Info("Expiry reminders sent", slog.Int("count", sent))
+	}
+	return sent, nil
+}
+
+func (s *AdvertisementExpiryServiceImpl) ArchiveExpiredAdvertisements(ctx context.Context) (_ int, err error) {
+	const op = "services.advertisement_expiry.ArchiveExpiredAdvertisements"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	archived, err := s.advertisementRepository.ArchiveExpiredAdvertisements(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if archived > 0 {
+		slog.Info("Expired advertisements archived",
+			slog.String("op", op),
+			slog.Int("count", archived),
+		)
+	}
+	return archived, nil
+}
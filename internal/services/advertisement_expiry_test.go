@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/entities"
+	"marketplace/internal/mailer"
+)
+
+type advertisementExpiryTest struct {
+	users          *fakeUserRepository
+	advertisements *fakeAdvertisementRepository
+	mailer         *mailer.CaptureMailer
+	expiry         AdvertisementExpiryService
+	service        AdvertisementService
+}
+
+func newAdvertisementExpiryTest() *advertisementExpiryTest {
+	users := newFakeUserRepository()
+	advertisements := &fakeAdvertisementRepository{users: users}
+	captureMailer := mailer.NewCaptureMailer()
+	return &advertisementExpiryTest{
+		users:          users,
+		advertisements: advertisements,
+		mailer:         captureMailer,
+		expiry:         NewAdvertisementExpiryServiceImpl(advertisements, captureMailer, 72*time.Hour),
+		service:        NewAdvertisementServiceImpl(advertisements, 30*24*time.Hour),
+	}
+}
+
+func (tt *advertisementExpiryTest) createUser(t *testing.T, login string) uuid.UUID {
+	t.Helper()
+	user := entities.User{Login: login, Password: "hash"}
+	if err := tt.users.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user.ID
+}
+
+func TestSendExpiryReminders(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	tt.users.verifyEmail(alice, "alice@example.com")
+	unverified := tt.createUser(t, "bob")
+
+	expiring := tt.advertisements.add(alice, "Bicycle", time.Now().Add(24*time.Hour))
+	tt.advertisements.add(alice, "Sofa", time.Now().Add(10*24*time.Hour))
+	tt.advertisements.add(alice, "Lamp", time.Now().Add(-time.Hour))
+	tt.advertisements.add(unverified, "Table", time.Now().Add(time.Hour))
+
+	sent, err := tt.expiry.SendExpiryReminders(context.Background())
+	if err != nil {
+		t.Fatalf("SendExpiryReminders() error = %v", err)
+	}
+	if sent != 1 {
+		t.Fatalf("SendExpiryReminders() = %d, want 1", sent)
+	}
+	messages := tt.mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "alice@example.com" {
+		t.Fatalf("messages = %+v, want one reminder to alice@example.com", messages)
+	}
+	if !strings.Contains(messages[0].Body, "Bicycle") || !strings.Contains(messages[0].Body, expiring.String()+"/renew") {
+		t.Errorf("reminder body %q does not name the advertisement and its renewal path", messages[0].Body)
+	}
+
+	sent, err = tt.expiry.SendExpiryReminders(context.Background())
+	if err != nil || sent != 0 {
+		t.Errorf("second SendExpiryReminders() = %d, %v, want 0, nil", sent, err)
+	}
+}
+
+func TestRenewedAdvertisementIsRemindedAgain(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	tt.users.verifyEmail(alice, "alice@example.com")
+	id := tt.advertisements.add(alice, "Bicycle", time.Now().Add(time.Hour))
+
+	if _, err := tt.expiry.SendExpiryReminders(context.Background()); err != nil {
+		t.Fatalf("SendExpiryReminders() error = %v", err)
+	}
+	renewed, err := tt.service.RenewAdvertisement(context.Background(), alice, id)
+	if err != nil {
+		t.Fatalf("RenewAdvertisement() error = %v", err)
+	}
+	if renewed.ExpiresAt.Before(time.Now().Add(29 * 24 * time.Hour)) {
+		t.Errorf("renewed ExpiresAt = %v, want a new 30 day lifetime", renewed.ExpiresAt)
+	}
+	if stored := tt.advertisements.get(id); stored.remindedAt != nil {
+		t.Error("renewal kept the reminder of the previous lifetime")
+	}
+}
+
+func TestRenewAdvertisementOfAnotherUser(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	mallory := tt.createUser(t, "mallory")
+	id := tt.advertisements.add(alice, "Bicycle", time.Now().Add(time.Hour))
+
+	_, err := tt.service.RenewAdvertisement(context.Background(), mallory, id)
+	if !errors.Is(err, ErrAdvertisementNotFound) {
+		t.Fatalf("RenewAdvertisement() error = %v, want %v", err, ErrAdvertisementNotFound)
+	}
+}
+
+func TestArchiveExpiredAdvertisements(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	expired := tt.advertisements.add(alice, "Lamp", time.Now().Add(-time.Minute))
+	active := tt.advertisements.add(alice, "Sofa", time.Now().Add(time.Hour))
+
+	archived, err := tt.expiry.ArchiveExpiredAdvertisements(context.Background())
+	if err != nil || archived != 1 {
+		t.Fatalf("ArchiveExpiredAdvertisements() = %d, %v, want 1, nil", archived, err)
+	}
+	if tt.advertisements.get(expired).ArchivedAt == nil {
+		t.Error("expired advertisement was not archived")
+	}
+	if tt.advertisements.get(active).ArchivedAt != nil {
+		t.Error("active advertisement was archived")
+	}
+
+	if _, err = tt.service.RenewAdvertisement(context.Background(), alice, expired); err != nil {
+		t.Fatalf("RenewAdvertisement() error = %v", err)
+	}
+	if tt.advertisements.get(expired).ArchivedAt != nil {
+		t.Error("renewed advertisement is still archived")
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+// StreamAdvertisements hands fn the advertisements the filter lets through,
+// leaving prices and sorting to the SQL it stands in for.
+func (r *fakeAdvertisementRepository) StreamAdvertisements(
+	_ context.Context,
+	filter *repositories.AdvertisementFilter,
+	fn func(advertisement *entities.Advertisement) error,
+) error {
+	r.mu.Lock()
+	var found []entities.Advertisement
+	now := time.Now()
+	for _, advertisement := range r.advertisements {
+		switch {
+		case filter.UserID != nil && advertisement.UserID != *filter.UserID:
+		case !filter.IncludeExpired && (advertisement.ArchivedAt != nil || !advertisement.ExpiresAt.After(now)):
+		case !filter.IncludeScheduled && advertisement.PublishAt.After(now):
+		default:
+			found = append(found, advertisement.Advertisement)
+		}
+	}
+	r.mu.Unlock()
+	for _, advertisement := range found {
+		if err := fn(&advertisement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportTitles(t *testing.T, service AdvertisementService, userID *uuid.UUID) []string {
+	t.Helper()
+	var titles []string
+	err := service.ExportAdvertisements(context.Background(), userID, &dto.AdvertisementFilters{},
+		func(row *dto.AdvertisementExportRow) error {
+			titles = append(titles, row.Title)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("ExportAdvertisements() error = %v", err)
+	}
+	slices.Sort(titles)
+	return titles
+}
+
+func TestExportAllAdvertisementsLeavesOutHidden(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	tt.advertisements.add(alice, "Bike", time.Now().Add(time.Hour))
+	scheduled := tt.advertisements.add(alice, "Lamp", time.Now().Add(48*time.Hour))
+	tt.advertisements.schedule(scheduled, time.Now().Add(24*time.Hour))
+	tt.advertisements.add(alice, "Sofa", time.Now().Add(-time.Hour))
+
+	if titles := exportTitles(t, tt.service, nil); !slices.Equal(titles, []string{"Bike"}) {
+		t.Errorf("exported %v, want only the public bike", titles)
+	}
+	if titles := exportTitles(t, tt.service, &alice); !slices.Equal(titles, []string{"Bike", "Lamp", "Sofa"}) {
+		t.Errorf("exported %v for the owner, want the scheduled lamp and the expired sofa too", titles)
+	}
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/jobs"
+	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+const importBatchSize = 1000
+
+type AdvertisementImportServiceImpl struct {
+	advertisementRepository repositories.AdvertisementRepository
+	importJobRepository     repositories.ImportJobRepository
+	jobClient               *jobs.Client
+	syncMaxRows             int
+	lifetime                time.Duration
+}
+
+// NewAdvertisementImportServiceImpl runs imports with more than syncMaxRows
+// rows as jobs of jobClient. Without a jobClient, as when the job workers
+// are disabled, such imports are rejected rather than left pending.
+func NewAdvertisementImportServiceImpl(
+	advertisementRepository repositories.AdvertisementRepository,
+	importJobRepository repositories.ImportJobRepository,
+	jobClient *jobs.Client,
+	syncMaxRows int,
+	lifetime time.Duration,
+) AdvertisementImportService {
+	return &AdvertisementImportServiceImpl{
+		advertisementRepository: advertisementRepository,
+		importJobRepository:     importJobRepository,
+		jobClient:               jobClient,
+		syncMaxRows:             syncMaxRows,
+		lifetime:                lifetime,
+	}
+}
+
+type importAdvertisementsArgs struct {
+	ImportJobID uuid.UUID `json:"import_job_id"`
+}
+
+func (importAdvertisementsArgs) Kind() string { return "advertisements.import" }
+
+// RegisterAdvertisementImportJobs runs the imports too large to finish
+// within their request. An import interrupted by a restart or a failed
+// batch continues with the rows still staged when its job is retried.
+func RegisterAdvertisementImportJobs(c *jobs.Client, s AdvertisementImportService) {
+	jobs.Register(c, func(ctx context.Context, job *jobs.Job[importAdvertisementsArgs]) error {
+		return s.RunImportJob(ctx, job.Args.ImportJobID, job.Attempt >= job.MaxAttempts)
+	})
+}
+
+// ImportAdvertisements records an import job for the rows read from rows.
+// Small imports finish before returning; larger ones are staged in the
+// database while they are read and imported by a background job, and their
+// progress is available through GetImportJob.
+func (s *AdvertisementImportServiceImpl) ImportAdvertisements(
+	ctx context.Context,
+	userID uuid.UUID,
+	format entities.ImportFormat,
+	rows dto.ImportRowReader,
+) (_ *dto.ImportJobResponse, err error) {
+	const op = "services.advertisement_import.ImportAdvertisements"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Importing advertisements",
+		slog.String("userID", userID.String()),
+		slog.String("format", string(format)),
+	)
+
+	job := entities.ImportJob{
+		UserID: userID,
+		Format: format,
+		Status: entities.ImportJobPending,
+	}
+	seenExternalIDs := make(map[string]int)
+	// next returns the next advertisement to import and records the invalid
+	// rows in the job. It returns nil at the end of the file. Duplicates
+	// within one file are reported instead of being silently skipped, since
+	// the seller most likely made a mistake.
+	next := func() (*entities.Advertisement, error) {
+		for {
+			row, rowError, err := rows.Read()
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			job.TotalRows++
+			if rowError == nil && row.ExternalID != "" {
+				if line, ok := seenExternalIDs[row.ExternalID]; ok {
+					rowError = &dto.ImportRowError{
+						Line:       row.Line,
+						ExternalID: row.ExternalID,
+						Error:      fmt.Sprintf("duplicate external_id, first seen on line %d", line),
+					}
+				} else {
+					seenExternalIDs[row.ExternalID] = row.Line
+				}
+			}
+			if rowError != nil {
+				job.Errors = append(job.Errors, entities.ImportRowError(*rowError))
+				job.FailedRows++
+				continue
+			}
+			return newImportedAdvertisement(userID, row), nil
+		}
+	}
+
+	var advertisements []*entities.Advertisement
+	for len(advertisements) <= s.syncMaxRows {
+		advertisement, err := next()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnreadableImportFile, err)
+		}
+		if advertisement == nil {
+			if err = s.importJobRepository.CreateImportJob(ctx, &job, nil); err != nil {
+				logger.Error("Import job creation failed", slog.Any("error", err))
+				return nil, ErrCannotImportAdvertisements
+			}
+			s.runImportJob(ctx, &job, advertisements)
+			return newImportJobResponse(&job), nil
+		}
+		advertisements = append(advertisements, advertisement)
+	}
+	if s.jobClient == nil {
+		logger.Warn("Import rejected, background jobs are disabled", slog.Int("maxRows", s.syncMaxRows))
+		return nil, ErrImportTooLarge
+	}
+
+	// The rows read so far are staged first, then the rest of the file.
+	var readErr error
+	staged := func() (*entities.Advertisement, error) {
+		if len(advertisements) > 0 {
+			advertisement := advertisements[0]
+			advertisements = advertisements[1:]
+			return advertisement, nil
+		}
+		advertisement, err := next()
+		readErr = err
+		return advertisement, err
+	}
+	if err := s.importJobRepository.CreateImportJob(ctx, &job, staged); err != nil {
+		if readErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnreadableImportFile, readErr)
+		}
+		logger.Error("Import job creation failed", slog.Any("error", err))
+		return nil, ErrCannotImportAdvertisements
+	}
+
+	args := importAdvertisementsArgs{ImportJobID: job.ID}
+	if err := s.jobClient.Enqueue(ctx, args, &jobs.EnqueueOptions{UniqueKey: job.ID.String()}); err != nil {
+		logger.Error("Import job enqueueing failed", slog.String("jobID", job.ID.String()), slog.Any("error", err))
+		rowError := &entities.ImportRowError{Error: ErrCannotImportAdvertisements.Error()}
+		if _, err = s.importJobRepository.FinishImportJob(ctx, job.ID, rowError); err != nil {
+			logger.Error("Import job update failed", slog.String("jobID", job.ID.String()), slog.Any("error", err))
+		}
+		return nil, ErrCannotImportAdvertisements
+	}
+
+	logger.Info("Import job continues in background",
+		slog.String("jobID", job.ID.String()),
+		slog.Int("rows", job.TotalRows),
+		slog.Int("invalidRows", job.FailedRows),
+	)
+	return newImportJobResponse(&job), nil
+}
+
+// RunImportJob imports the rows staged for a background import job in
+// batches. When a batch fails, the rows left stay staged for the next
+// attempt, unless lastAttempt is set: the job is failed with them then.
+func (s *AdvertisementImportServiceImpl) RunImportJob(ctx context.Context, id uuid.UUID, lastAttempt bool) (err error) {
+	const op = "services.advertisement_import.RunImportJob"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).
+		With(slog.String("op", op), slog.String("jobID", id.String()))
+
+	if _, err := s.importJobRepository.StartImportJob(ctx, id); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			// Finished by an earlier attempt.
+			return nil
+		}
+		return err
+	}
+
+	for {
+		// expires_at is a timestamp without time zone and pgx keeps only the
+		// wall clock of a time, so it is stored in UTC.
+		expiresAt := time.Now().UTC().Add(s.lifetime)
+		staged, err := s.advertisementRepository.ImportStagedAdvertisements(ctx, id, importBatchSize, expiresAt)
+		if err != nil {
+			if !lastAttempt {
+				return err
+			}
+			logger.Error("Import batch failed", slog.Any("error", err))
+			rowError := &entities.ImportRowError{Error: ErrCannotImportAdvertisements.Error()}
+			if _, finishErr := s.importJobRepository.FinishImportJob(ctx, id, rowError); finishErr != nil {
+				logger.Error("Import job update failed", slog.Any("error", finishErr))
+			}
+			return err
+		}
+		if staged == 0 {
+			break
+		}
+	}
+
+	job, err := s.importJobRepository.FinishImportJob(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+
+	metrics.RecordAdvertisementsCreated(metrics.ImportAdvertisementSource, job.ImportedRows)
+	logger.Info("Import job finished",
+		slog.String("status", string(job.Status)),
+		slog.Int("imported", job.ImportedRows),
+		slog.Int("skipped", job.SkippedRows),
+		slog.Int("failed", job.FailedRows),
+	)
+	return nil
+}
+
+func (s *AdvertisementImportServiceImpl) GetImportJob(ctx context.Context, userID, id uuid.UUID) (_ *dto.ImportJobResponse, err error) {
+	const op = "services.advertisement_import.GetImportJob"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	job, err := s.importJobRepository.GetImportJob(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrImportJobNotFound
+		}
+		logger.Error("Failed to get import job", slog.Any("error", err))
+		return nil, ErrCannotGetImportJob
+	}
+	return newImportJobResponse(job), nil
+}
+
+func (s *AdvertisementImportServiceImpl) runImportJob(ctx context.Context, job *entities.ImportJob, advertisements []*entities.Advertisement) {
+	logger := slogger.GetLoggerFromContext(ctx).
+		With(slog.String("op", "services.advertisement_import.runImportJob"), slog.String("jobID", job.ID.String()))
+
+	// The job and advertisement times are timestamps without time zone and
+	// pgx keeps only the wall clock of a time, so every time is stored in UTC.
+	startedAt := time.Now().UTC()
+	job.Status = entities.ImportJobRunning
+	job.StartedAt = &startedAt
+	if err := s.importJobRepository.UpdateImportJob(ctx, job); err != nil {
+		logger.Error("Import job update failed", slog.Any("error", err))
+	}
+
+	job.Status = entities.ImportJobCompleted
+	for start := 0; start < len(advertisements); start += importBatchSize {
+		batch := advertisements[start:min(start+importBatchSize, len(advertisements))]
+		expiresAt := time.Now().UTC().Add(s.lifetime)
+		for _, advertisement := range batch {
+			advertisement.ExpiresAt = expiresAt
+		}
+		imported, err := s.advertisementRepository.ImportAdvertisements(ctx, batch)
+		if err != nil {
+			logger.Error("Import batch failed", slog.Int("offset", start), slog.Any("error", err))
+			job.Status = entities.ImportJobFailed
+			job.FailedRows += len(advertisements) - start
+			job.Errors = append(job.Errors, entities.ImportRowError{Error: ErrCannotImportAdvertisements.Error()})
+			break
+		}
+		job.ImportedRows += imported
+		job.SkippedRows += len(batch) - imported
+		if err = s.importJobRepository.UpdateImportJob(ctx, job); err != nil {
+			logger.Error("Import job update failed", slog.Any("error", err))
+		}
+	}
+
+	finishedAt := time.Now().UTC()
+	job.FinishedAt = &finishedAt
+	if err := s.importJobRepository.UpdateImportJob(ctx, job); err != nil {
+		logger.Error("Import job update failed", slog.Any("error", err))
+	}
+
+	metrics.RecordAdvertisementsCreated(metrics.ImportAdvertisementSource, job.ImportedRows)
+	logger.Info("Import job finished",
+		slog.String("status", string(job.Status)),
+		slog.Int("imported", job.ImportedRows),
+		slog.Int("skipped", job.SkippedRows),
+		slog.Int("failed", job.FailedRows),
+	)
+}
+
+func newImportedAdvertisement(userID uuid.UUID, row *dto.AdvertisementImportRow) *entities.Advertisement {
+	advertisement := &entities.Advertisement{
+		Title:    row.Title,
+		Content:  row.Content,
+		ImageURL: row.ImageURL,
+		Price:    row.Price,
+		UserID:   userID,
+	}
+	if row.ExternalID != "" {
+		externalID := row.ExternalID
+		advertisement.ExternalID = &externalID
+	}
+	return advertisement
+}
+
+func newImportJobResponse(job *entities.ImportJob) *dto.ImportJobResponse {
+	rowErrors := make([]dto.ImportRowError, len(job.Errors))
+	for i, rowError := range job.Errors {
+		rowErrors[i] = dto.ImportRowError(rowError)
+	}
+	return &dto.ImportJobResponse{
+		ID:           job.ID,
+		Format:       string(job.Format),
+		Status:       string(job.Status),
+		TotalRows:    job.TotalRows,
+		ImportedRows: job.ImportedRows,
+		SkippedRows:  job.SkippedRows,
+		FailedRows:   job.FailedRows,
+		Errors:       rowErrors,
+		CreatedAt:    job.CreatedAt,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   job.FinishedAt,
+	}
+}
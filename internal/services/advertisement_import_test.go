@@ -0,0 +1,313 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/jobs"
+	"marketplace/internal/repositories"
+)
+
+// fakeImportRows returns its rows and row errors in order, then err.
+type fakeImportRows struct {
+	rows []fakeImportRow
+	err  error
+}
+
+type fakeImportRow struct {
+	row      *dto.AdvertisementImportRow
+	rowError *dto.ImportRowError
+}
+
+func (r *fakeImportRows) Read() (*dto.AdvertisementImportRow, *dto.ImportRowError, error) {
+	if len(r.rows) == 0 {
+		if r.err != nil {
+			return nil, nil, r.err
+		}
+		return nil, nil, io.EOF
+	}
+	next := r.rows[0]
+	r.rows = r.rows[1:]
+	return next.row, next.rowError, nil
+}
+
+func (r *fakeImportRows) add(line int, externalID string) {
+	r.rows = append(r.rows, fakeImportRow{row: &dto.AdvertisementImportRow{
+		AdvertisementCreateRequest: dto.AdvertisementCreateRequest{
+			Title:    "Bike",
+			Content:  "Red bike",
+			ImageURL: "https://example.com/bike.jpg",
+			Price:    decimal.NewFromInt(100),
+		},
+		ExternalID: externalID,
+		Line:       line,
+	}})
+}
+
+func (r *fakeImportRows) addError(line int, message string) {
+	r.rows = append(r.rows, fakeImportRow{rowError: &dto.ImportRowError{Line: line, Error: message}})
+}
+
+// fakeImportJobRepository keeps a single import job and the rows staged
+// for it.
+type fakeImportJobRepository struct {
+	repositories.ImportJobRepository
+
+	job      *entities.ImportJob
+	staged   []*entities.Advertisement
+	finished *entities.ImportRowError
+}
+
+func (r *fakeImportJobRepository) CreateImportJob(
+	_ context.Context,
+	job *entities.ImportJob,
+	staged func() (*entities.Advertisement, error),
+) error {
+	job.ID = uuid.New()
+	job.CreatedAt = time.Now()
+	for staged != nil {
+		advertisement, err := staged()
+		if err != nil {
+			r.staged = nil
+			return err
+		}
+		if advertisement == nil {
+			break
+		}
+		r.staged = append(r.staged, advertisement)
+	}
+	stored := *job
+	r.job = &stored
+	return nil
+}
+
+func (r *fakeImportJobRepository) UpdateImportJob(_ context.Context, job *entities.ImportJob) error {
+	stored := *job
+	r.job = &stored
+	return nil
+}
+
+func (r *fakeImportJobRepository) StartImportJob(_ context.Context, id uuid.UUID) (*entities.ImportJob, error) {
+	if r.job == nil || r.job.ID != id || r.job.FinishedAt != nil {
+		return nil, repositories.ErrNotFound
+	}
+	r.job.Status = entities.ImportJobRunning
+	return r.job, nil
+}
+
+func (r *fakeImportJobRepository) FinishImportJob(_ context.Context, _ uuid.UUID, rowError *entities.ImportRowError) (*entities.ImportJob, error) {
+	now := time.Now()
+	r.job.Status = entities.ImportJobCompleted
+	if rowError != nil {
+		r.job.Status = entities.ImportJobFailed
+		r.job.FailedRows += len(r.staged)
+		r.job.Errors = append(r.job.Errors, *rowError)
+		r.staged = nil
+	}
+	r.job.FinishedAt = &now
+	r.finished = rowError
+	return r.job, nil
+}
+
+// fakeImportAdvertisementRepository imports advertisements whose external
+// id is new and fails staged batches while failStaged is set.
+type fakeImportAdvertisementRepository struct {
+	repositories.AdvertisementRepository
+
+	imports    *fakeImportJobRepository
+	imported   []*entities.Advertisement
+	failStaged bool
+}
+
+func (r *fakeImportAdvertisementRepository) ImportAdvertisements(_ context.Context, advertisements []*entities.Advertisement) (int, error) {
+	r.imported = append(r.imported, advertisements...)
+	return len(advertisements), nil
+}
+
+func (r *fakeImportAdvertisementRepository) ImportStagedAdvertisements(_ context.Context, _ uuid.UUID, limit int, _ time.Time) (int, error) {
+	if r.failStaged {
+		return 0, errors.New("connection reset")
+	}
+	batch := r.imports.staged[:min(limit, len(r.imports.staged))]
+	r.imports.staged = r.imports.staged[len(batch):]
+	r.imported = append(r.imported, batch...)
+	r.imports.job.ImportedRows += len(batch)
+	return len(batch), nil
+}
+
+// fakeJobRepository records the enqueued jobs.
+type fakeJobRepository struct {
+	repositories.JobRepository
+
+	enqueued []*entities.Job
+}
+
+func (r *fakeJobRepository) EnqueueJob(_ context.Context, job *entities.Job) error {
+	r.enqueued = append(r.enqueued, job)
+	return nil
+}
+
+type importTest struct {
+	service        *AdvertisementImportServiceImpl
+	imports        *fakeImportJobRepository
+	advertisements *fakeImportAdvertisementRepository
+	jobs           *fakeJobRepository
+}
+
+func newImportTest(syncMaxRows int) *importTest {
+	imports := &fakeImportJobRepository{}
+	advertisements := &fakeImportAdvertisementRepository{imports: imports}
+	jobRepository := &fakeJobRepository{}
+	jobClient := jobs.NewClient(jobRepository, jobs.Config{DefaultMaxAttempts: 3})
+	service := NewAdvertisementImportServiceImpl(advertisements, imports, jobClient, syncMaxRows, time.Hour)
+	return &importTest{
+		service:        service.(*AdvertisementImportServiceImpl),
+		imports:        imports,
+		advertisements: advertisements,
+		jobs:           jobRepository,
+	}
+}
+
+func TestImportAdvertisementsRunsSmallImportRightAway(t *testing.T) {
+	tt := newImportTest(10)
+	rows := &fakeImportRows{}
+	rows.add(2, "bike-1")
+	rows.addError(3, "Invalid price")
+	rows.add(4, "bike-1")
+	rows.add(5, "")
+
+	job, err := tt.service.ImportAdvertisements(context.Background(), uuid.New(), entities.CSVImportFormat, rows)
+	if err != nil {
+		t.Fatalf("ImportAdvertisements() error = %v", err)
+	}
+
+	if job.Status != string(entities.ImportJobCompleted) || job.FinishedAt == nil {
+		t.Errorf("job = %+v, want completed", job)
+	}
+	if job.TotalRows != 4 || job.ImportedRows != 2 || job.FailedRows != 2 {
+		t.Errorf("total %d, imported %d, failed %d, want 4, 2 and 2", job.TotalRows, job.ImportedRows, job.FailedRows)
+	}
+	if len(job.Errors) != 2 || job.Errors[0].Line != 3 || job.Errors[1].Line != 4 || job.Errors[1].ExternalID != "bike-1" {
+		t.Errorf("errors = %+v, want the invalid row and the duplicate", job.Errors)
+	}
+	if len(tt.jobs.enqueued) != 0 {
+		t.Errorf("enqueued %d jobs, want none", len(tt.jobs.enqueued))
+	}
+	stored := tt.imports.job
+	if stored.StartedAt.Location() != time.UTC || stored.FinishedAt.Location() != time.UTC {
+		t.Errorf("started at %v and finished at %v, want UTC", stored.StartedAt, stored.FinishedAt)
+	}
+	if expiresAt := tt.advertisements.imported[0].ExpiresAt; expiresAt.Location() != time.UTC {
+		t.Errorf("ExpiresAt = %v, want UTC", expiresAt)
+	}
+}
+
+func TestImportAdvertisementsStagesLargeImportAndEnqueuesJob(t *testing.T) {
+	tt := newImportTest(2)
+	rows := &fakeImportRows{}
+	for line := 2; line <= 6; line++ {
+		rows.add(line, "")
+	}
+	rows.addError(7, "Invalid price")
+
+	job, err := tt.service.ImportAdvertisements(context.Background(), uuid.New(), entities.CSVImportFormat, rows)
+	if err != nil {
+		t.Fatalf("ImportAdvertisements() error = %v", err)
+	}
+
+	if job.Status != string(entities.ImportJobPending) || job.TotalRows != 6 || job.FailedRows != 1 {
+		t.Errorf("job = %+v, want pending with 6 rows and 1 failed", job)
+	}
+	if len(tt.imports.staged) != 5 || len(tt.advertisements.imported) != 0 {
+		t.Errorf("staged %d and imported %d rows, want 5 and 0", len(tt.imports.staged), len(tt.advertisements.imported))
+	}
+	if len(tt.jobs.enqueued) != 1 || tt.jobs.enqueued[0].Kind != "advertisements.import" {
+		t.Fatalf("enqueued %+v, want one import job", tt.jobs.enqueued)
+	}
+	var args importAdvertisementsArgs
+	if err = json.Unmarshal(tt.jobs.enqueued[0].Payload, &args); err != nil || args.ImportJobID != job.ID {
+		t.Errorf("job args = %s, want import job %s", tt.jobs.enqueued[0].Payload, job.ID)
+	}
+
+	if err = tt.service.RunImportJob(context.Background(), job.ID, false); err != nil {
+		t.Fatalf("RunImportJob() error = %v", err)
+	}
+	if tt.imports.job.Status != entities.ImportJobCompleted || tt.imports.job.ImportedRows != 5 {
+		t.Errorf("job = %+v, want completed with 5 imported", tt.imports.job)
+	}
+	// A retry of a finished job has nothing left to do.
+	if err = tt.service.RunImportJob(context.Background(), job.ID, false); err != nil {
+		t.Errorf("RunImportJob() of a finished job error = %v", err)
+	}
+}
+
+func TestImportAdvertisementsRejectsLargeImportWithoutJobs(t *testing.T) {
+	tt := newImportTest(2)
+	tt.service.jobClient = nil
+	rows := &fakeImportRows{}
+	for line := 2; line <= 4; line++ {
+		rows.add(line, "")
+	}
+
+	_, err := tt.service.ImportAdvertisements(context.Background(), uuid.New(), entities.CSVImportFormat, rows)
+	if !errors.Is(err, ErrImportTooLarge) {
+		t.Fatalf("ImportAdvertisements() error = %v, want %v", err, ErrImportTooLarge)
+	}
+	if tt.imports.job != nil || len(tt.imports.staged) != 0 {
+		t.Errorf("created job %+v with %d staged rows, want none", tt.imports.job, len(tt.imports.staged))
+	}
+}
+
+func TestImportAdvertisementsRejectsUnreadableFile(t *testing.T) {
+	for _, syncMaxRows := range []int{10, 2} {
+		tt := newImportTest(syncMaxRows)
+		rows := &fakeImportRows{err: errors.New("unexpected EOF")}
+		for line := 2; line <= 4; line++ {
+			rows.add(line, "")
+		}
+
+		_, err := tt.service.ImportAdvertisements(context.Background(), uuid.New(), entities.CSVImportFormat, rows)
+		if !errors.Is(err, ErrUnreadableImportFile) {
+			t.Errorf("sync max %d: ImportAdvertisements() error = %v, want %v", syncMaxRows, err, ErrUnreadableImportFile)
+		}
+		if len(tt.advertisements.imported) != 0 || len(tt.jobs.enqueued) != 0 {
+			t.Errorf("sync max %d: imported %d rows and enqueued %d jobs, want none",
+				syncMaxRows, len(tt.advertisements.imported), len(tt.jobs.enqueued))
+		}
+	}
+}
+
+func TestRunImportJobKeepsRowsUntilLastAttempt(t *testing.T) {
+	tt := newImportTest(1)
+	rows := &fakeImportRows{}
+	rows.add(2, "")
+	rows.add(3, "")
+	job, err := tt.service.ImportAdvertisements(context.Background(), uuid.New(), entities.CSVImportFormat, rows)
+	if err != nil {
+		t.Fatalf("ImportAdvertisements() error = %v", err)
+	}
+	tt.advertisements.failStaged = true
+
+	if err = tt.service.RunImportJob(context.Background(), job.ID, false); err == nil {
+		t.Fatal("RunImportJob() error = nil, want the batch error")
+	}
+	if tt.imports.job.FinishedAt != nil || len(tt.imports.staged) != 2 {
+		t.Fatalf("job = %+v with %d rows staged, want it running with 2", tt.imports.job, len(tt.imports.staged))
+	}
+
+	if err = tt.service.RunImportJob(context.Background(), job.ID, true); err == nil {
+		t.Fatal("RunImportJob() error = nil, want the batch error")
+	}
+	if tt.imports.job.Status != entities.ImportJobFailed || tt.imports.job.FailedRows != 2 || tt.imports.finished == nil {
+		t.Errorf("job = %+v, want failed with the 2 staged rows", tt.imports.job)
+	}
+}
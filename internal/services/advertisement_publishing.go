@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	"marketplace/internal/jobs"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+const publishBatchSize = 100
+
+type AdvertisementPublishingServiceImpl struct {
+	advertisementRepository repositories.AdvertisementRepository
+}
+
+func NewAdvertisementPublishingServiceImpl(advertisementRepository repositories.AdvertisementRepository) AdvertisementPublishingService {
+	return &AdvertisementPublishingServiceImpl{advertisementRepository: advertisementRepository}
+}
+
+type publishScheduledArgs struct{}
+
+func (publishScheduledArgs) Kind() string { return "advertisements.publish_scheduled" }
+
+// RegisterAdvertisementPublishingJobs schedules publishing of scheduled
+// advertisements every minute. They are listed from their publish time on,
+// the job only records their advertisement.created events.
+func RegisterAdvertisementPublishingJobs(c *jobs.Client, s AdvertisementPublishingService) {
+	jobs.Register(c, func(ctx context.Context, _ *jobs.Job[publishScheduledArgs]) error {
+		_, err := s.PublishScheduledAdvertisements(ctx)
+		return err
+	})
+	c.Schedule("advertisements.publish_scheduled", "* * * * *", publishScheduledArgs{})
+}
+
+func (s *AdvertisementPublishingServiceImpl) PublishScheduledAdvertisements(ctx context.Context) (_ int, err error) {
+	const op = "services.advertisement_publishing.PublishScheduledAdvertisements"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	published := 0
+	for {
+		count, err := s.advertisementRepository.PublishScheduledAdvertisements(ctx, publishBatchSize)
+		if err != nil {
+			return published, err
+		}
+		published += count
+		if count < publishBatchSize {
+			break
+		}
+	}
+	if published > 0 {
+		slog.Info("Scheduled advertisements published",
+			slog.String("op", op),
+			slog.Int("count", published),
+		)
+	}
+	return published, nil
+}
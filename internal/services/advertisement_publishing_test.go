@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"marketplace/internal/dto"
+)
+
+const testAdvertisementLifetime = 30 * 24 * time.Hour
+
+func createTestAdvertisement(t *testing.T, service AdvertisementService, userID uuid.UUID, publishAt *time.Time) *dto.AdvertisementResponse {
+	t.Helper()
+	advertisement, err := service.CreateAdvertisement(context.Background(), &dto.AdvertisementCreateRequest{
+		Title:     "Bicycle",
+		Content:   "Barely used",
+		ImageURL:  "https://example.com/bicycle.png",
+		Price:     decimal.NewFromInt(100),
+		PublishAt: publishAt,
+	}, userID)
+	if err != nil {
+		t.Fatalf("CreateAdvertisement() error = %v", err)
+	}
+	return advertisement
+}
+
+func TestCreateScheduledAdvertisement(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	publishAt := time.Now().Add(48 * time.Hour)
+
+	advertisement := createTestAdvertisement(t, tt.service, alice, &publishAt)
+
+	if !advertisement.PublishAt.Equal(publishAt) {
+		t.Errorf("PublishAt = %v, want %v", advertisement.PublishAt, publishAt)
+	}
+	if want := publishAt.Add(testAdvertisementLifetime); !advertisement.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want the lifetime to start at publishing, %v", advertisement.ExpiresAt, want)
+	}
+	if stored := tt.advertisements.get(advertisement.ID); stored.PublishedAt != nil {
+		t.Error("scheduled advertisement was published on creation")
+	}
+}
+
+// The publish_at column keeps the wall clock of a time and drops its
+// offset, so a time given with an offset must reach the repository in UTC.
+func TestScheduleAdvertisementWithOffsetStoresUTC(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	moscow := time.FixedZone("MSK", 3*60*60)
+	publishAt := time.Now().Add(48 * time.Hour).In(moscow)
+
+	advertisement := createTestAdvertisement(t, tt.service, alice, &publishAt)
+
+	stored := tt.advertisements.get(advertisement.ID)
+	if stored.PublishAt.Location() != time.UTC || !stored.PublishAt.Equal(publishAt) {
+		t.Errorf("stored PublishAt = %v, want %v in UTC", stored.PublishAt, publishAt.UTC())
+	}
+	if stored.ExpiresAt.Location() != time.UTC {
+		t.Errorf("stored ExpiresAt = %v, want UTC", stored.ExpiresAt)
+	}
+
+	rescheduled := time.Now().Add(24 * time.Hour).In(moscow)
+	_, err := tt.service.UpdateAdvertisement(context.Background(), alice, advertisement.ID, &dto.AdvertisementUpdateRequest{
+		PublishAt: &rescheduled,
+	})
+	if err != nil {
+		t.Fatalf("UpdateAdvertisement() error = %v", err)
+	}
+	stored = tt.advertisements.get(advertisement.ID)
+	if stored.PublishAt.Location() != time.UTC || !stored.PublishAt.Equal(rescheduled) {
+		t.Errorf("stored PublishAt = %v, want %v in UTC", stored.PublishAt, rescheduled.UTC())
+	}
+}
+
+func TestCreateAdvertisementPublishAtInThePast(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	publishAt := time.Now().Add(-time.Hour)
+
+	advertisement := createTestAdvertisement(t, tt.service, alice, &publishAt)
+
+	if advertisement.PublishAt.Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("PublishAt = %v, want the time of creation", advertisement.PublishAt)
+	}
+	if stored := tt.advertisements.get(advertisement.ID); stored.PublishedAt == nil {
+		t.Error("advertisement with a past publish_at was not published right away")
+	}
+}
+
+func TestRescheduleAdvertisement(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	publishAt := time.Now().Add(48 * time.Hour)
+	advertisement := createTestAdvertisement(t, tt.service, alice, &publishAt)
+
+	rescheduled := time.Now().Add(24 * time.Hour)
+	updated, err := tt.service.UpdateAdvertisement(context.Background(), alice, advertisement.ID, &dto.AdvertisementUpdateRequest{
+		PublishAt: &rescheduled,
+	})
+	if err != nil {
+		t.Fatalf("UpdateAdvertisement() error = %v", err)
+	}
+	if !updated.PublishAt.Equal(rescheduled) || !updated.ExpiresAt.Equal(rescheduled.Add(testAdvertisementLifetime)) {
+		t.Errorf("UpdateAdvertisement() = publish %v, expire %v, want %v and a lifetime later",
+			updated.PublishAt, updated.ExpiresAt, rescheduled)
+	}
+
+	tt.advertisements.publish(advertisement.ID)
+	_, err = tt.service.UpdateAdvertisement(context.Background(), alice, advertisement.ID, &dto.AdvertisementUpdateRequest{
+		PublishAt: &publishAt,
+	})
+	if !errors.Is(err, ErrAdvertisementAlreadyPublished) {
+		t.Errorf("rescheduling a published advertisement: error = %v, want %v", err, ErrAdvertisementAlreadyPublished)
+	}
+
+	title := "Red bicycle"
+	updated, err = tt.service.UpdateAdvertisement(context.Background(), alice, advertisement.ID, &dto.AdvertisementUpdateRequest{
+		Title: &title,
+	})
+	if err != nil {
+		t.Fatalf("UpdateAdvertisement() of a published advertisement error = %v", err)
+	}
+	if updated.Title != title || !updated.PublishAt.Equal(rescheduled) {
+		t.Errorf("UpdateAdvertisement() = %q published at %v, want %q published at %v", updated.Title, updated.PublishAt, title, rescheduled)
+	}
+}
+
+func TestUpdateAdvertisementOfAnotherUser(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	mallory := tt.createUser(t, "mallory")
+	advertisement := createTestAdvertisement(t, tt.service, alice, nil)
+
+	title := "Stolen"
+	_, err := tt.service.UpdateAdvertisement(context.Background(), mallory, advertisement.ID, &dto.AdvertisementUpdateRequest{
+		Title: &title,
+	})
+	if !errors.Is(err, ErrAdvertisementNotFound) {
+		t.Fatalf("UpdateAdvertisement() error = %v, want %v", err, ErrAdvertisementNotFound)
+	}
+}
+
+func TestPublishScheduledAdvertisements(t *testing.T) {
+	tt := newAdvertisementExpiryTest()
+	alice := tt.createUser(t, "alice")
+	due := tt.advertisements.add(alice, "Bicycle", time.Now().Add(testAdvertisementLifetime))
+	tt.advertisements.schedule(due, time.Now().Add(-time.Second))
+	tt.advertisements.add(alice, "Sofa", time.Now().Add(testAdvertisementLifetime))
+	later := time.Now().Add(time.Hour)
+	scheduled := createTestAdvertisement(t, tt.service, alice, &later)
+
+	published, err := NewAdvertisementPublishingServiceImpl(tt.advertisements).PublishScheduledAdvertisements(context.Background())
+	if err != nil || published != 1 {
+		t.Fatalf("PublishScheduledAdvertisements() = %d, %v, want 1, nil", published, err)
+	}
+	if tt.advertisements.get(due).PublishedAt == nil {
+		t.Error("due advertisement was not published")
+	}
+	if tt.advertisements.get(scheduled.ID).PublishedAt != nil {
+		t.Error("advertisement scheduled for later was published")
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+const (
+	apiKeyPrefix       = "mk_"
+	apiKeyPrefixLength = 10
+)
+
+type APIKeyServiceImpl struct {
+	apiKeyRepository repositories.APIKeyRepository
+}
+
+func NewAPIKeyServiceImpl(apiKeyRepository repositories.APIKeyRepository) APIKeyService {
+	return &APIKeyServiceImpl{apiKeyRepository: apiKeyRepository}
+}
+
+func (s *APIKeyServiceImpl) CreateAPIKey(ctx context.Context, userID uuid.UUID, apiKeyData *dto.APIKeyCreateRequest) (_ *dto.APIKeyCreatedResponse, err error) {
+	const op = "services.api_key.CreateAPIKey"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Creating API key",
+		slog.String("userID", userID.String()),
+		slog.String("name", apiKeyData.Name),
+		slog.Any("scopes", apiKeyData.Scopes),
+	)
+
+	if apiKeyData.ExpiresAt != nil && !apiKeyData.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidAPIKeyExpiry
+	}
+	token, err := generateToken()
+	if err != nil {
+		logger.Error("API key generation failed", slog.Any("error", err))
+		return nil, ErrCannotCreateAPIKey
+	}
+	key := apiKeyPrefix + token
+	apiKey := entities.APIKey{
+		UserID:  userID,
+		Name:    apiKeyData.Name,
+		Prefix:  key[:apiKeyPrefixLength],
+		KeyHash: hashToken(key),
+		Scopes:  apiKeyData.Scopes,
+	}
+	if apiKeyData.ExpiresAt != nil {
+		// expires_at keeps the wall clock of a time and drops its offset.
+		expiresAt := apiKeyData.ExpiresAt.UTC()
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err = s.apiKeyRepository.CreateAPIKey(ctx, &apiKey); err != nil {
+		logger.Error("API key creation failed", slog.Any("error", err))
+		return nil, ErrCannotCreateAPIKey
+	}
+
+	logger.Info("API key created successfully", slog.String("apiKeyID", apiKey.ID.String()))
+
+	return &dto.APIKeyCreatedResponse{
+		APIKeyResponse: *newAPIKeyResponse(&apiKey),
+		Key:            key,
+	}, nil
+}
+
+func (s *APIKeyServiceImpl) GetAPIKeys(ctx context.Context, userID uuid.UUID) (_ []*dto.APIKeyResponse, err error) {
+	const op = "services.api_key.GetAPIKeys"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	apiKeys, err := s.apiKeyRepository.GetAPIKeysByUserID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get API keys", slog.Any("error", err))
+		return nil, ErrCannotGetAPIKeys
+	}
+
+	apiKeysResponse := make([]*dto.APIKeyResponse, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		apiKeysResponse[i] = newAPIKeyResponse(apiKey)
+	}
+	return apiKeysResponse, nil
+}
+
+func (s *APIKeyServiceImpl) RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) (err error) {
+	const op = "services.api_key.RevokeAPIKey"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Revoking API key", slog.String("userID", userID.String()), slog.String("apiKeyID", id.String()))
+
+	err = s.apiKeyRepository.RevokeAPIKey(ctx, id, userID)
+	if err != nil {
+		logger.Error("API key revocation failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return ErrCannotRevokeAPIKey
+	}
+
+	logger.Info("API key revoked successfully", slog.String("apiKeyID", id.String()))
+
+	return nil
+}
+
+func (s *AuthServiceImpl) AuthenticateAPIKey(ctx context.Context, key string) (_ *dto.AuthenticatedUser, err error) {
+	const op = "services.auth.AuthenticateAPIKey"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	apiKey, err := s.apiKeyRepository.GetAPIKeyByHash(ctx, hashToken(key))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		logger.Error("API key lookup failed", slog.Any("error", err))
+		return nil, ErrCannotAuthenticate
+	}
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)) {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.userRepository.GetUserByID(ctx, apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		logger.Error("User fetch failed", slog.Any("error", err))
+		return nil, ErrCannotAuthenticate
+	}
+	if err = s.apiKeyRepository.TouchAPIKey(ctx, apiKey.ID); err != nil {
+		logger.Warn("API key last use update failed", slog.Any("error", err))
+	}
+
+	return &dto.AuthenticatedUser{
+		UserID:   user.ID,
+		Login:    user.Login,
+		Role:     string(user.Role),
+		APIKeyID: &apiKey.ID,
+		Scopes:   apiKey.Scopes,
+	}, nil
+}
+
+func newAPIKeyResponse(apiKey *entities.APIKey) *dto.APIKeyResponse {
+	return &dto.APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
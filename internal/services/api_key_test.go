@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+// fakeAPIKeyRepository records the created keys. Methods the tests do not
+// need panic through the embedded nil interface.
+type fakeAPIKeyRepository struct {
+	repositories.APIKeyRepository
+
+	created []entities.APIKey
+}
+
+func (r *fakeAPIKeyRepository) CreateAPIKey(_ context.Context, apiKey *entities.APIKey) error {
+	apiKey.ID = uuid.New()
+	apiKey.CreatedAt = time.Now()
+	r.created = append(r.created, *apiKey)
+	return nil
+}
+
+func TestCreateAPIKeyStoresExpiryInUTC(t *testing.T) {
+	repository := &fakeAPIKeyRepository{}
+	service := NewAPIKeyServiceImpl(repository)
+	expiresAt := time.Now().Add(24 * time.Hour).In(time.FixedZone("MSK", 3*60*60))
+
+	_, err := service.CreateAPIKey(context.Background(), uuid.New(), &dto.APIKeyCreateRequest{
+		Name:      "ci",
+		Scopes:    []string{"ads:read"},
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error = %v", err)
+	}
+
+	stored := repository.created[0].ExpiresAt
+	if stored == nil || stored.Location() != time.UTC || !stored.Equal(expiresAt) {
+		t.Errorf("stored ExpiresAt = %v, want %v in UTC", stored, expiresAt.UTC())
+	}
+}
+
+func TestCreateAPIKeyRejectsPastExpiry(t *testing.T) {
+	service := NewAPIKeyServiceImpl(&fakeAPIKeyRepository{})
+	expiresAt := time.Now().Add(-time.Minute)
+
+	_, err := service.CreateAPIKey(context.Background(), uuid.New(), &dto.APIKeyCreateRequest{
+		Name:      "ci",
+		Scopes:    []string{"ads:read"},
+		ExpiresAt: &expiresAt,
+	})
+	if !errors.Is(err, ErrInvalidAPIKeyExpiry) {
+		t.Errorf("CreateAPIKey() error = %v, want %v", err, ErrInvalidAPIKeyExpiry)
+	}
+}
@@ -9,7 +9,10 @@ import (
 	"marketplace/internal/dto"
 	"marketplace/internal/entities"
 	slogger "marketplace/internal/logger"
+	"marketplace/internal/mailer"
+	"marketplace/internal/metrics"
 	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
@@ -17,22 +20,56 @@ import (
 )
 
 type AuthServiceImpl struct {
-	userRepository  repositories.UserRepository
-	tokenTTLMinutes time.Duration
-	JWTSecret       string
+	userRepository           repositories.UserRepository
+	sessionRepository        repositories.SessionRepository
+	twoFactorRepository      repositories.TwoFactorRepository
+	loginAttemptRepository   repositories.LoginAttemptRepository
+	apiKeyRepository         repositories.APIKeyRepository
+	emailVerificationService EmailVerificationService
+	mailer                   mailer.Mailer
+	tokenTTLMinutes          time.Duration
+	passwordResetTTLMinutes  time.Duration
+	loginAttemptPolicy       LoginAttemptPolicy
+	JWTSecret                string
+	TOTPIssuer               string
 }
 
-func NewAuthServiceImpl(userRepository repositories.UserRepository, tokenTTLMinutes time.Duration, JWTSecret string) AuthService {
+func NewAuthServiceImpl(
+	userRepository repositories.UserRepository,
+	sessionRepository repositories.SessionRepository,
+	twoFactorRepository repositories.TwoFactorRepository,
+	loginAttemptRepository repositories.LoginAttemptRepository,
+	apiKeyRepository repositories.APIKeyRepository,
+	emailVerificationService EmailVerificationService,
+	mailer mailer.Mailer,
+	tokenTTLMinutes time.Duration,
+	passwordResetTTLMinutes time.Duration,
+	loginAttemptPolicy LoginAttemptPolicy,
+	JWTSecret string,
+	TOTPIssuer string,
+) AuthService {
 	return &AuthServiceImpl{
-		userRepository:  userRepository,
-		tokenTTLMinutes: tokenTTLMinutes,
-		JWTSecret:       JWTSecret,
+		userRepository:           userRepository,
+		sessionRepository:        sessionRepository,
+		twoFactorRepository:      twoFactorRepository,
+		loginAttemptRepository:   loginAttemptRepository,
+		apiKeyRepository:         apiKeyRepository,
+		emailVerificationService: emailVerificationService,
+		mailer:                   mailer,
+		tokenTTLMinutes:          tokenTTLMinutes,
+		passwordResetTTLMinutes:  passwordResetTTLMinutes,
+		loginAttemptPolicy:       loginAttemptPolicy,
+		JWTSecret:                JWTSecret,
+		TOTPIssuer:               TOTPIssuer,
 	}
 }
 
-func (s *AuthServiceImpl) CreateUser(ctx context.Context, userData *dto.UserCreateRequest) (*dto.UserResponse, error) {
-	logger := slogger.GetLoggerFromContext(ctx).
-		With(slog.String("op", "services.advertisement.CreateAdvertisement"))
+func (s *AuthServiceImpl) CreateUser(ctx context.Context, userData *dto.UserCreateRequest) (_ *dto.UserResponse, err error) {
+	const op = "services.auth.CreateUser"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
 
 	logger.Info("Creating user", slog.String("login", userData.Login))
 
@@ -45,8 +82,21 @@ func (s *AuthServiceImpl) CreateUser(ctx context.Context, userData *dto.UserCrea
 	createdUser := entities.User{
 		Login:    userData.Login,
 		Password: hashedPassword,
+		Email:    userData.Email,
 	}
 	err = s.userRepository.CreateUser(ctx, &createdUser)
+	if errors.Is(err, repositories.ErrEmailAlreadyExists) {
+		// Registration must not reveal which addresses are in use, so the
+		// account is created without the email and the response looks like
+		// the one for a fresh address. The owner of the address is told.
+		logger.Warn("Registration with an email that is already in use", slog.String("login", userData.Login))
+		createdUser.Email = nil
+		if err = s.userRepository.CreateUser(ctx, &createdUser); err == nil {
+			s.sendEmailInUseNotice(ctx, *userData.Email)
+			metrics.RecordRegistration(metrics.PasswordRegistration)
+			return newRegistrationResponse(&createdUser), nil
+		}
+	}
 	if err != nil {
 		logger.Error("User creation failed", slog.Any("error", err))
 		if errors.Is(err, repositories.ErrAlreadyExists) {
@@ -59,54 +109,157 @@ func (s *AuthServiceImpl) CreateUser(ctx context.Context, userData *dto.UserCrea
 	}
 
 	logger.Info("User created successfully", slog.String("userID", createdUser.ID.String()))
+	metrics.RecordRegistration(metrics.PasswordRegistration)
 
-	return &dto.UserResponse{
-		ID:        createdUser.ID,
-		Login:     createdUser.Login,
-		CreatedAt: createdUser.CreatedAt,
-	}, nil
+	if createdUser.Email != nil {
+		if err = s.emailVerificationService.SendVerificationEmail(ctx, createdUser.ID); err != nil {
+			logger.Warn("Verification email was not sent", slog.Any("error", err))
+		}
+	}
+
+	return newRegistrationResponse(&createdUser), nil
+}
+
+// newRegistrationResponse leaves out the email even when it was stored, so
+// a taken address cannot be told apart from a fresh one. The user sees the
+// address on their profile once signed in.
+func newRegistrationResponse(user *entities.User) *dto.UserResponse {
+	response := newUserResponse(user)
+	response.Email = nil
+	return response
 }
 
-func (s *AuthServiceImpl) LoginUser(ctx context.Context, userData *dto.LoginUserRequest) (string, error) {
-	logger := slogger.GetLoggerFromContext(ctx).
-		With(slog.String("op", "services.auth.LoginUser"))
+// sendEmailInUseNotice tells the owner of an address that someone tried to
+// register with it. Failures are only logged, like verification emails.
+func (s *AuthServiceImpl) sendEmailInUseNotice(ctx context.Context, email string) {
+	err := s.mailer.Send(ctx, &mailer.Message{
+		To:      email,
+		Subject: "Registration attempt",
+		Body: "Someone tried to register a new account with this email address.\n" +
+			"If it was you, sign in to your existing account or reset your password.\n" +
+			"Otherwise, ignore this message.",
+	})
+	if err != nil {
+		slogger.GetLoggerFromContext(ctx).Warn("Email in use notice was not sent",
+			slog.String("op", "services.auth.CreateUser"),
+			slog.Any("error", err),
+		)
+	}
+}
 
-	logger.Info("Attempting login", slog.String("login", userData.Login))
+func (s *AuthServiceImpl) LoginUser(ctx context.Context, userData *dto.LoginUserRequest, clientIP string) (_ *dto.TokenResponse, err error) {
+	const op = "services.auth.LoginUser"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
 
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Attempting login", slog.String("login", userData.Login), slog.String("ip", clientIP))
+
+	accountKey, ipKey := accountAttemptKey(userData.Login), ipAttemptKey(clientIP)
+	if err := s.checkLoginLockout(ctx, accountKey, ipKey); err != nil {
+		var lockedErr *LoginLockedError
+		if errors.As(err, &lockedErr) {
+			metrics.RecordLogin(metrics.LoginFailed)
+			logger.Warn("Login attempt while locked out",
+				slog.String("security_event", "login_locked"),
+				slog.String("login", userData.Login),
+				slog.String("ip", clientIP),
+			)
+			return nil, err
+		}
+		logger.Error("Login lockout check failed", slog.Any("error", err))
+		return nil, ErrCannotLoginUser
+	}
+
+	// Unknown logins and wrong passwords must be indistinguishable, both in
+	// the response and in the time it takes to produce it.
 	user, err := s.userRepository.GetUserByLogin(ctx, userData.Login)
 	if err != nil {
-		logger.Error("User lookup failed", slog.Any("error", err))
-		if errors.Is(err, repositories.ErrNotFound) {
-			return "", ErrCannotFindUser
-		} else {
-			return "", ErrCannotLoginUser
+		if !errors.Is(err, repositories.ErrNotFound) {
+			logger.Error("User lookup failed", slog.Any("error", err))
+			return nil, ErrCannotLoginUser
 		}
+		compareDummyPassword(userData.Password)
+	} else {
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userData.Password))
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userData.Password))
 	if err != nil {
-		logger.Warn("Invalid credentials", slog.String("login", userData.Login))
-		return "", ErrInvalidCredentials
+		logger.Warn("Invalid credentials", slog.String("login", userData.Login), slog.String("ip", clientIP))
+		s.registerLoginFailure(ctx, accountKey, ipKey)
+		metrics.RecordLogin(metrics.LoginFailed)
+		return nil, ErrInvalidCredentials
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":   user.ID,
-		"login": user.Login,
-		"iat":   time.Now().Unix(),
-		"exp":   time.Now().Add(time.Minute * s.tokenTTLMinutes).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(s.JWTSecret))
+	s.resetLoginFailures(ctx, accountKey)
+
+	if user.TOTPEnabledAt != nil {
+		challengeToken, err := s.issueChallengeToken(user)
+		if err != nil {
+			logger.Error("Challenge token signing failed", slog.Any("error", err))
+			return nil, ErrCannotSignToken
+		}
+		logger.Info("Two-factor challenge issued", slog.String("userID", user.ID.String()))
+		return &dto.TokenResponse{TwoFactorRequired: true, ChallengeToken: challengeToken}, nil
+	}
+
+	tokenString, err := s.issueAccessToken(ctx, user, false)
 	if err != nil {
-		logger.Error("Token signing failed", slog.Any("error", err))
-		return "", ErrCannotSignToken
+		logger.Error("Token issuing failed", slog.Any("error", err))
+		return nil, ErrCannotSignToken
 	}
 
 	logger.Info("User logged in successfully", slog.String("userID", user.ID.String()))
+	metrics.RecordLogin(metrics.LoginSucceeded)
 
-	return tokenString, nil
+	return &dto.TokenResponse{Token: tokenString}, nil
 }
 
-func (s *AuthServiceImpl) GetUserByID(ctx context.Context, id uuid.UUID) (*dto.UserResponse, error) {
-	logger := slogger.GetLoggerFromContext(ctx).
-		With(slog.String("op", "services.auth.GetUserByID"))
+// LoginExternalUser signs in a user whose identity was already proven by an
+// external provider. Two-factor authentication still applies.
+func (s *AuthServiceImpl) LoginExternalUser(ctx context.Context, userID uuid.UUID) (_ *dto.TokenResponse, err error) {
+	const op = "services.auth.LoginExternalUser"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotLoginUser
+	}
+
+	if user.TOTPEnabledAt != nil {
+		challengeToken, err := s.issueChallengeToken(user)
+		if err != nil {
+			logger.Error("Challenge token signing failed", slog.Any("error", err))
+			return nil, ErrCannotSignToken
+		}
+		logger.Info("Two-factor challenge issued", slog.String("userID", user.ID.String()))
+		return &dto.TokenResponse{TwoFactorRequired: true, ChallengeToken: challengeToken}, nil
+	}
+
+	tokenString, err := s.issueAccessToken(ctx, user, false)
+	if err != nil {
+		logger.Error("Token issuing failed", slog.Any("error", err))
+		return nil, ErrCannotSignToken
+	}
+
+	logger.Info("User logged in with external identity", slog.String("userID", user.ID.String()))
+	metrics.RecordLogin(metrics.LoginSucceeded)
+
+	return &dto.TokenResponse{Token: tokenString}, nil
+}
+
+func (s *AuthServiceImpl) GetUserByID(ctx context.Context, id uuid.UUID) (_ *dto.UserResponse, err error) {
+	const op = "services.auth.GetUserByID"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
 
 	logger.Info("Fetching user by ID", slog.String("userID", id.String()))
 
@@ -121,9 +274,234 @@ func (s *AuthServiceImpl) GetUserByID(ctx context.Context, id uuid.UUID) (*dto.U
 
 	logger.Info("User fetched successfully", slog.String("userID", user.ID.String()))
 
+	return newUserResponse(user), nil
+}
+
+func newUserResponse(user *entities.User) *dto.UserResponse {
 	return &dto.UserResponse{
-		ID:        user.ID,
-		Login:     user.Login,
-		CreatedAt: user.CreatedAt,
+		ID:               user.ID,
+		Login:            user.Login,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		Role:             string(user.Role),
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+func (s *AuthServiceImpl) issueAccessToken(ctx context.Context, user *entities.User, twoFactorVerified bool) (string, error) {
+	// expires_at is a timestamp without time zone and pgx keeps only the
+	// wall clock of a time, so it is stored in UTC.
+	now := time.Now().UTC()
+	session := entities.Session{
+		UserID:    user.ID,
+		ExpiresAt: now.Add(time.Minute * s.tokenTTLMinutes),
+	}
+	if err := s.sessionRepository.CreateSession(ctx, &session); err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":   accessTokenType,
+		"sub":   user.ID,
+		"sid":   session.ID,
+		"login": user.Login,
+		"role":  user.Role,
+		"mfa":   twoFactorVerified,
+		"iat":   now.Unix(),
+		"exp":   session.ExpiresAt.Unix(),
+	})
+	return token.SignedString([]byte(s.JWTSecret))
+}
+
+func (s *AuthServiceImpl) Authenticate(ctx context.Context, accessToken string) (_ *dto.AuthenticatedUser, err error) {
+	const op = "services.auth.Authenticate"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	claims, err := s.parseToken(accessToken, accessTokenType)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	sid, _ := claims["sid"].(string)
+	login, _ := claims["login"].(string)
+	role, _ := claims["role"].(string)
+	twoFactorVerified, _ := claims["mfa"].(bool)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sessionID, err := uuid.Parse(sid)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	session, err := s.sessionRepository.GetSessionByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		slogger.GetLoggerFromContext(ctx).Error("Session lookup failed",
+			slog.String("op", op),
+			slog.Any("error", err),
+		)
+		return nil, ErrCannotAuthenticate
+	}
+	if session.UserID != userID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	return &dto.AuthenticatedUser{
+		UserID:            userID,
+		Login:             login,
+		Role:              role,
+		SessionID:         sessionID,
+		TwoFactorVerified: twoFactorVerified,
 	}, nil
 }
+
+func (s *AuthServiceImpl) parseToken(tokenString, tokenType string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return []byte(s.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (s *AuthServiceImpl) ChangePassword(ctx context.Context, authUser *dto.AuthenticatedUser, passwordData *dto.PasswordChangeRequest) (err error) {
+	const op = "services.auth.ChangePassword"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Changing password", slog.String("userID", authUser.UserID.String()))
+
+	user, err := s.userRepository.GetUserByID(ctx, authUser.UserID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return ErrCannotChangePassword
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(passwordData.OldPassword))
+	if err != nil {
+		logger.Warn("Invalid old password", slog.String("userID", user.ID.String()))
+		return ErrInvalidCredentials
+	}
+	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(passwordData.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("Password hashing failed", slog.Any("error", err))
+		return ErrPasswordHashing
+	}
+	err = s.sessionRepository.ChangePasswordAndRevokeSessions(ctx, user.ID, string(hashedPasswordBytes), authUser.SessionID)
+	if err != nil {
+		logger.Error("Password change failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return ErrCannotChangePassword
+	}
+
+	logger.Info("Password changed successfully", slog.String("userID", user.ID.String()))
+
+	return nil
+}
+
+func (s *AuthServiceImpl) RequestPasswordReset(ctx context.Context, forgotData *dto.PasswordForgotRequest) (err error) {
+	const op = "services.auth.RequestPasswordReset"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Requesting password reset", slog.String("login", forgotData.Login))
+
+	user, err := s.userRepository.GetUserByLogin(ctx, forgotData.Login)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			logger.Warn("Password reset requested for unknown login", slog.String("login", forgotData.Login))
+			return nil
+		}
+		logger.Error("User lookup failed", slog.Any("error", err))
+		return ErrCannotResetPassword
+	}
+	if user.Email == nil {
+		logger.Warn("Password reset requested for user without email", slog.String("userID", user.ID.String()))
+		return nil
+	}
+
+	// From here on failures are only logged: an error only existing
+	// accounts can get would tell which logins are registered.
+	token, err := generateToken()
+	if err != nil {
+		logger.Error("Reset token generation failed", slog.Any("error", err))
+		return nil
+	}
+	resetToken := entities.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().UTC().Add(time.Minute * s.passwordResetTTLMinutes),
+	}
+	if err = s.sessionRepository.CreatePasswordResetToken(ctx, &resetToken); err != nil {
+		logger.Error("Reset token creation failed", slog.Any("error", err))
+		return nil
+	}
+	err = s.mailer.Send(ctx, &mailer.Message{
+		To:      *user.Email,
+		Subject: "Password reset",
+		Body: "Use the following token to reset your password: " + token + "\n" +
+			"It expires at " + resetToken.ExpiresAt.Format(time.RFC1123) + ".\n" +
+			"If you did not request a password reset, ignore this message.",
+	})
+	if err != nil {
+		logger.Error("Reset mail sending failed", slog.Any("error", err))
+		return nil
+	}
+
+	logger.Info("Password reset mail sent", slog.String("userID", user.ID.String()))
+
+	return nil
+}
+
+func (s *AuthServiceImpl) ResetPassword(ctx context.Context, resetData *dto.PasswordResetRequest) (err error) {
+	const op = "services.auth.ResetPassword"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	// The hash is computed first, so that only the transaction that also
+	// stores the password consumes the token.
+	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte(resetData.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("Password hashing failed", slog.Any("error", err))
+		return ErrPasswordHashing
+	}
+	userID, err := s.sessionRepository.ResetPasswordWithToken(ctx, hashToken(resetData.Token), string(hashedPasswordBytes))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			logger.Warn("Invalid password reset token")
+			return ErrInvalidResetToken
+		}
+		logger.Error("Password reset failed", slog.Any("error", err))
+		return ErrCannotResetPassword
+	}
+
+	logger.Info("Password reset successfully", slog.String("userID", userID.String()))
+
+	return nil
+}
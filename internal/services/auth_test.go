@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/mailer"
+	"marketplace/internal/repositories"
+)
+
+func newRegistrationTest() (*emailVerificationTest, AuthService) {
+	tt := newEmailVerificationTest(0)
+	authService := NewAuthServiceImpl(
+		tt.users, nil, nil, nil, nil, tt.service, tt.mailer,
+		15, 30, LoginAttemptPolicy{}, "secret", "marketplace",
+	)
+	return tt, authService
+}
+
+func TestCreateUserSendsVerificationEmail(t *testing.T) {
+	tt, authService := newRegistrationTest()
+
+	user, err := authService.CreateUser(context.Background(), &dto.UserCreateRequest{
+		Login: "alice", Password: "Password1!", Email: stringPointer("alice@example.com"),
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if user.Email != nil || user.EmailVerified {
+		t.Errorf("CreateUser() = %+v, want no email in the response", user)
+	}
+	stored, err := tt.users.GetUserByLogin(context.Background(), "alice")
+	if err != nil || stored.Email == nil || *stored.Email != "alice@example.com" {
+		t.Fatalf("stored user = %+v, %v, want alice@example.com", stored, err)
+	}
+	messages := tt.mailer.Messages()
+	if len(messages) != 1 || messages[0].Subject != "Confirm your email address" {
+		t.Fatalf("sent %+v, want one verification mail", messages)
+	}
+}
+
+func TestCreateUserWithTakenEmail(t *testing.T) {
+	tt, authService := newRegistrationTest()
+	tt.createUser(t, "alice", stringPointer("alice@example.com"))
+
+	user, err := authService.CreateUser(context.Background(), &dto.UserCreateRequest{
+		Login: "mallory", Password: "Password1!", Email: stringPointer("Alice@example.com"),
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v, want the response of a fresh address", err)
+	}
+	if user.Email != nil || user.EmailVerified {
+		t.Errorf("CreateUser() = %+v, want no email in the response", user)
+	}
+
+	stored, err := tt.users.GetUserByLogin(context.Background(), "mallory")
+	if err != nil {
+		t.Fatalf("GetUserByLogin() error = %v", err)
+	}
+	if stored.Email != nil {
+		t.Errorf("stored email = %q, want none", *stored.Email)
+	}
+	messages := tt.mailer.Messages()
+	if len(messages) != 1 || messages[0].To != "Alice@example.com" || messages[0].Subject != "Registration attempt" {
+		t.Fatalf("sent %+v, want one notice to the address owner", messages)
+	}
+	if len(tt.tokens.tokens) != 0 {
+		t.Error("a verification token was issued for a taken address")
+	}
+}
+
+func TestCreateUserWithTakenLogin(t *testing.T) {
+	tt, authService := newRegistrationTest()
+	tt.createUser(t, "alice", nil)
+
+	_, err := authService.CreateUser(context.Background(), &dto.UserCreateRequest{
+		Login: "alice", Password: "Password1!", Email: stringPointer("other@example.com"),
+	})
+	if !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("CreateUser() error = %v, want %v", err, ErrUserAlreadyExists)
+	}
+	if len(tt.mailer.Messages()) != 0 {
+		t.Errorf("sent %+v, want no mail", tt.mailer.Messages())
+	}
+}
+
+// fakeSessionRepository records reset tokens. Methods the tests do not need
+// panic through the embedded nil interface.
+type fakeSessionRepository struct {
+	repositories.SessionRepository
+
+	resetTokens []entities.PasswordResetToken
+}
+
+func (r *fakeSessionRepository) CreatePasswordResetToken(_ context.Context, token *entities.PasswordResetToken) error {
+	token.ID = uuid.New()
+	r.resetTokens = append(r.resetTokens, *token)
+	return nil
+}
+
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, *mailer.Message) error {
+	return errors.New("connection refused")
+}
+
+func newPasswordResetTest(m mailer.Mailer) (*emailVerificationTest, *fakeSessionRepository, AuthService) {
+	tt := newEmailVerificationTest(0)
+	sessions := &fakeSessionRepository{}
+	authService := NewAuthServiceImpl(
+		tt.users, sessions, nil, nil, nil, tt.service, m,
+		15, 30, LoginAttemptPolicy{}, "secret", "marketplace",
+	)
+	return tt, sessions, authService
+}
+
+func TestRequestPasswordResetSendsToken(t *testing.T) {
+	captureMailer := mailer.NewCaptureMailer()
+	tt, sessions, authService := newPasswordResetTest(captureMailer)
+	tt.createUser(t, "alice", stringPointer("alice@example.com"))
+
+	err := authService.RequestPasswordReset(context.Background(), &dto.PasswordForgotRequest{Login: "alice"})
+	if err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+	messages := captureMailer.Messages()
+	if len(messages) != 1 || messages[0].To != "alice@example.com" || len(sessions.resetTokens) != 1 {
+		t.Fatalf("sent %+v with %d tokens, want one reset mail to alice", messages, len(sessions.resetTokens))
+	}
+	_, token, _ := strings.Cut(messages[0].Body, "reset your password: ")
+	token, _, _ = strings.Cut(token, "\n")
+	if hashToken(token) != sessions.resetTokens[0].TokenHash {
+		t.Error("mailed token does not match the stored hash")
+	}
+}
+
+// A failure that only an existing account can run into must not tell it
+// apart from an unknown login.
+func TestRequestPasswordResetHidesMailFailure(t *testing.T) {
+	tt, _, authService := newPasswordResetTest(failingMailer{})
+	tt.createUser(t, "alice", stringPointer("alice@example.com"))
+
+	for _, login := range []string{"alice", "nobody"} {
+		err := authService.RequestPasswordReset(context.Background(), &dto.PasswordForgotRequest{Login: login})
+		if err != nil {
+			t.Errorf("RequestPasswordReset(%q) error = %v, want nil", login, err)
+		}
+	}
+}
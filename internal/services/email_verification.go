@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/mailer"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+type EmailVerificationServiceImpl struct {
+	userRepository              repositories.UserRepository
+	emailVerificationRepository repositories.EmailVerificationRepository
+	mailer                      mailer.Mailer
+	tokenTTLMinutes             time.Duration
+	resendIntervalSeconds       time.Duration
+}
+
+func NewEmailVerificationServiceImpl(
+	userRepository repositories.UserRepository,
+	emailVerificationRepository repositories.EmailVerificationRepository,
+	mailer mailer.Mailer,
+	tokenTTLMinutes time.Duration,
+	resendIntervalSeconds time.Duration,
+) EmailVerificationService {
+	return &EmailVerificationServiceImpl{
+		userRepository:              userRepository,
+		emailVerificationRepository: emailVerificationRepository,
+		mailer:                      mailer,
+		tokenTTLMinutes:             tokenTTLMinutes,
+		resendIntervalSeconds:       resendIntervalSeconds,
+	}
+}
+
+func (s *EmailVerificationServiceImpl) SendVerificationEmail(ctx context.Context, userID uuid.UUID) (err error) {
+	const op = "services.email_verification.SendVerificationEmail"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Sending verification email", slog.String("userID", userID.String()))
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return ErrCannotSendVerificationEmail
+	}
+	if user.Email == nil {
+		return ErrUserHasNoEmail
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	lastSentAt, err := s.emailVerificationRepository.GetLastEmailVerificationTokenTime(ctx, user.ID)
+	if err != nil {
+		logger.Error("Verification token lookup failed", slog.Any("error", err))
+		return ErrCannotSendVerificationEmail
+	}
+	if lastSentAt != nil && time.Since(*lastSentAt) < time.Second*s.resendIntervalSeconds {
+		logger.Warn("Verification email throttled", slog.String("userID", user.ID.String()))
+		return ErrVerificationEmailThrottled
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		logger.Error("Verification token generation failed", slog.Any("error", err))
+		return ErrCannotSendVerificationEmail
+	}
+	verificationToken := entities.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     *user.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().UTC().Add(time.Minute * s.tokenTTLMinutes),
+	}
+	if err = s.emailVerificationRepository.CreateEmailVerificationToken(ctx, &verificationToken); err != nil {
+		logger.Error("Verification token creation failed", slog.Any("error", err))
+		return ErrCannotSendVerificationEmail
+	}
+	err = s.mailer.Send(ctx, &mailer.Message{
+		To:      *user.Email,
+		Subject: "Confirm your email address",
+		Body: "Use the following token to confirm your email address: " + token + "\n" +
+			"It expires at " + verificationToken.ExpiresAt.Format(time.RFC1123) + ".",
+	})
+	if err != nil {
+		logger.Error("Verification mail sending failed", slog.Any("error", err))
+		return ErrCannotSendVerificationEmail
+	}
+
+	logger.Info("Verification email sent", slog.String("userID", user.ID.String()))
+
+	return nil
+}
+
+func (s *EmailVerificationServiceImpl) VerifyEmail(ctx context.Context, verifyData *dto.EmailVerifyRequest) (err error) {
+	const op = "services.email_verification.VerifyEmail"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	userID, err := s.emailVerificationRepository.UseEmailVerificationToken(ctx, hashToken(verifyData.Token))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			logger.Warn("Invalid email verification token")
+			return ErrInvalidVerificationToken
+		}
+		logger.Error("Email verification failed", slog.Any("error", err))
+		return ErrCannotVerifyEmail
+	}
+
+	logger.Info("Email verified successfully", slog.String("userID", userID.String()))
+
+	return nil
+}
+
+func (s *EmailVerificationServiceImpl) IsEmailVerified(ctx context.Context, userID uuid.UUID) (_ bool, err error) {
+	const op = "services.email_verification.IsEmailVerified"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		slogger.GetLoggerFromContext(ctx).Error("User fetch failed",
+			slog.String("op", op),
+			slog.Any("error", err),
+		)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return false, ErrUserNotFound
+		}
+		return false, ErrCannotVerifyEmail
+	}
+	return user.EmailVerifiedAt != nil, nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/mailer"
+)
+
+type emailVerificationTest struct {
+	users   *fakeUserRepository
+	tokens  *fakeEmailVerificationRepository
+	mailer  *mailer.CaptureMailer
+	service EmailVerificationService
+}
+
+func newEmailVerificationTest(resendInterval time.Duration) *emailVerificationTest {
+	users := newFakeUserRepository()
+	tokens := &fakeEmailVerificationRepository{users: users}
+	captureMailer := mailer.NewCaptureMailer()
+	return &emailVerificationTest{
+		users:   users,
+		tokens:  tokens,
+		mailer:  captureMailer,
+		service: NewEmailVerificationServiceImpl(users, tokens, captureMailer, 30, resendInterval/time.Second),
+	}
+}
+
+func (tt *emailVerificationTest) createUser(t *testing.T, login string, email *string) uuid.UUID {
+	t.Helper()
+	user := entities.User{Login: login, Password: "hash", Email: email}
+	if err := tt.users.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user.ID
+}
+
+// lastToken returns the token of the last verification mail.
+func (tt *emailVerificationTest) lastToken(t *testing.T) string {
+	t.Helper()
+	messages := tt.mailer.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no mail was sent")
+	}
+	_, rest, found := strings.Cut(messages[len(messages)-1].Body, "email address: ")
+	if !found {
+		t.Fatalf("no token in mail body %q", messages[len(messages)-1].Body)
+	}
+	token, _, _ := strings.Cut(rest, "\n")
+	return token
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func TestSendVerificationEmail(t *testing.T) {
+	tt := newEmailVerificationTest(0)
+	userID := tt.createUser(t, "alice", stringPointer("alice@example.com"))
+
+	if err := tt.service.SendVerificationEmail(context.Background(), userID); err != nil {
+		t.Fatalf("SendVerificationEmail() error = %v", err)
+	}
+	messages := tt.mailer.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(messages))
+	}
+	if messages[0].To != "alice@example.com" {
+		t.Errorf("mail sent to %q, want alice@example.com", messages[0].To)
+	}
+	if len(tt.tokens.tokens) != 1 || tt.tokens.tokens[0].TokenHash != hashToken(tt.lastToken(t)) {
+		t.Error("the mailed token is not the stored one")
+	}
+}
+
+func TestSendVerificationEmailRejectsUnsuitableUsers(t *testing.T) {
+	tt := newEmailVerificationTest(0)
+	withoutEmail := tt.createUser(t, "bob", nil)
+	verified := tt.createUser(t, "carol", stringPointer("carol@example.com"))
+	now := time.Now()
+	tt.users.users[verified].EmailVerifiedAt = &now
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   error
+	}{
+		{"unknown user", uuid.New(), ErrUserNotFound},
+		{"user without email", withoutEmail, ErrUserHasNoEmail},
+		{"verified user", verified, ErrEmailAlreadyVerified},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := tt.service.SendVerificationEmail(context.Background(), test.userID)
+			if !errors.Is(err, test.want) {
+				t.Errorf("SendVerificationEmail() error = %v, want %v", err, test.want)
+			}
+		})
+	}
+	if len(tt.mailer.Messages()) != 0 {
+		t.Error("mail was sent")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tt := newEmailVerificationTest(0)
+	userID := tt.createUser(t, "alice", stringPointer("alice@example.com"))
+	if err := tt.service.SendVerificationEmail(context.Background(), userID); err != nil {
+		t.Fatalf("SendVerificationEmail() error = %v", err)
+	}
+	token := tt.lastToken(t)
+
+	if err := tt.service.VerifyEmail(context.Background(), &dto.EmailVerifyRequest{Token: token}); err != nil {
+		t.Fatalf("VerifyEmail() error = %v", err)
+	}
+	verified, err := tt.service.IsEmailVerified(context.Background(), userID)
+	if err != nil || !verified {
+		t.Errorf("IsEmailVerified() = %v, %v, want true", verified, err)
+	}
+
+	err = tt.service.VerifyEmail(context.Background(), &dto.EmailVerifyRequest{Token: token})
+	if !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("second VerifyEmail() error = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+}
+
+func TestVerifyEmailWithUnknownToken(t *testing.T) {
+	tt := newEmailVerificationTest(0)
+
+	err := tt.service.VerifyEmail(context.Background(), &dto.EmailVerifyRequest{Token: "unknown"})
+	if !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail() error = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+}
+
+func TestVerifyEmailWithExpiredToken(t *testing.T) {
+	tt := newEmailVerificationTest(0)
+	userID := tt.createUser(t, "alice", stringPointer("alice@example.com"))
+	if err := tt.service.SendVerificationEmail(context.Background(), userID); err != nil {
+		t.Fatalf("SendVerificationEmail() error = %v", err)
+	}
+	tt.tokens.expireTokens()
+
+	err := tt.service.VerifyEmail(context.Background(), &dto.EmailVerifyRequest{Token: tt.lastToken(t)})
+	if !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail() error = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+	if verified, _ := tt.service.IsEmailVerified(context.Background(), userID); verified {
+		t.Error("email is verified with an expired token")
+	}
+}
+
+func TestVerifyEmailAfterEmailChange(t *testing.T) {
+	tt := newEmailVerificationTest(0)
+	userID := tt.createUser(t, "alice", stringPointer("alice@example.com"))
+	if err := tt.service.SendVerificationEmail(context.Background(), userID); err != nil {
+		t.Fatalf("SendVerificationEmail() error = %v", err)
+	}
+	token := tt.lastToken(t)
+	tt.users.setEmail(userID, "alice@example.org")
+
+	err := tt.service.VerifyEmail(context.Background(), &dto.EmailVerifyRequest{Token: token})
+	if !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail() error = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+	if tt.tokens.tokens[0].UsedAt != nil {
+		t.Error("token for the old address was consumed")
+	}
+}
+
+func TestResendVerificationEmailThrottle(t *testing.T) {
+	tt := newEmailVerificationTest(time.Minute)
+	userID := tt.createUser(t, "alice", stringPointer("alice@example.com"))
+
+	if err := tt.service.SendVerificationEmail(context.Background(), userID); err != nil {
+		t.Fatalf("SendVerificationEmail() error = %v", err)
+	}
+	err := tt.service.SendVerificationEmail(context.Background(), userID)
+	if !errors.Is(err, ErrVerificationEmailThrottled) {
+		t.Fatalf("resend error = %v, want %v", err, ErrVerificationEmailThrottled)
+	}
+	if len(tt.mailer.Messages()) != 1 {
+		t.Errorf("sent %d mails, want 1", len(tt.mailer.Messages()))
+	}
+
+	// Once the interval has passed another mail goes out.
+	tt.tokens.tokens[0].CreatedAt = time.Now().Add(-2 * time.Minute)
+	if err = tt.service.SendVerificationEmail(context.Background(), userID); err != nil {
+		t.Fatalf("resend after the interval error = %v", err)
+	}
+	if len(tt.mailer.Messages()) != 2 {
+		t.Errorf("sent %d mails, want 2", len(tt.mailer.Messages()))
+	}
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+// fakeUserRepository keeps users in memory and enforces the unique login
+// and lower(email) indexes of the users table.
+type fakeUserRepository struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]*entities.User
+}
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{users: make(map[uuid.UUID]*entities.User)}
+}
+
+func (r *fakeUserRepository) CreateUser(_ context.Context, user *entities.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.users {
+		if existing.Login == user.Login {
+			return repositories.ErrAlreadyExists
+		}
+	}
+	for _, existing := range r.users {
+		if existing.Email != nil && user.Email != nil && strings.EqualFold(*existing.Email, *user.Email) {
+			return repositories.ErrEmailAlreadyExists
+		}
+	}
+	user.ID = uuid.New()
+	user.Role = entities.UserRole
+	user.CreatedAt = time.Now()
+	stored := *user
+	r.users[user.ID] = &stored
+	return nil
+}
+
+func (r *fakeUserRepository) GetUserByID(_ context.Context, id uuid.UUID) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *fakeUserRepository) GetUserByLogin(_ context.Context, login string) (*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Login == login {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeUserRepository) UpdateUserProfile(_ context.Context, user *entities.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	stored.DisplayName, stored.Bio, stored.AvatarURL = user.DisplayName, user.Bio, user.AvatarURL
+	return nil
+}
+
+// setEmail changes the address of a user, which the API cannot do yet.
+func (r *fakeUserRepository) setEmail(id uuid.UUID, email string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[id].Email = &email
+	r.users[id].EmailVerifiedAt = nil
+}
+
+// fakeEmailVerificationRepository consumes a token only while the user
+// still has the address it was issued for, like the SQL it stands in for.
+type fakeEmailVerificationRepository struct {
+	mu     sync.Mutex
+	users  *fakeUserRepository
+	tokens []*entities.EmailVerificationToken
+}
+
+func (r *fakeEmailVerificationRepository) CreateEmailVerificationToken(_ context.Context, token *entities.EmailVerificationToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now()
+	stored := *token
+	r.tokens = append(r.tokens, &stored)
+	return nil
+}
+
+func (r *fakeEmailVerificationRepository) GetLastEmailVerificationTokenTime(_ context.Context, userID uuid.UUID) (*time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var last *time.Time
+	for _, token := range r.tokens {
+		if token.UserID == userID && (last == nil || token.CreatedAt.After(*last)) {
+			last = &token.CreatedAt
+		}
+	}
+	return last, nil
+}
+
+func (r *fakeEmailVerificationRepository) UseEmailVerificationToken(_ context.Context, tokenHash string) (uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	for _, token := range r.tokens {
+		if token.TokenHash != tokenHash || token.UsedAt != nil || !token.ExpiresAt.After(time.Now()) {
+			continue
+		}
+		user := r.users.users[token.UserID]
+		if user == nil || user.Email == nil || *user.Email != token.Email {
+			continue
+		}
+		now := time.Now()
+		token.UsedAt = &now
+		user.EmailVerifiedAt = &now
+		return user.ID, nil
+	}
+	return uuid.Nil, repositories.ErrNotFound
+}
+
+// expireTokens moves the expiry of every token into the past.
+func (r *fakeEmailVerificationRepository) expireTokens() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, token := range r.tokens {
+		token.ExpiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+// fakeAdvertisementRepository keeps advertisements in memory and implements
+// the expiry queries against the users of a fakeUserRepository. Methods the
+// tests do not need panic through the embedded nil interface.
+type fakeAdvertisementRepository struct {
+	repositories.AdvertisementRepository
+
+	mu             sync.Mutex
+	users          *fakeUserRepository
+	advertisements []*fakeAdvertisement
+	lastFilter     *repositories.AdvertisementFilter
+}
+
+type fakeAdvertisement struct {
+	entities.Advertisement
+	remindedAt *time.Time
+}
+
+func (r *fakeAdvertisementRepository) add(userID uuid.UUID, title string, expiresAt time.Time) uuid.UUID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	advertisement := &fakeAdvertisement{Advertisement: entities.Advertisement{
+		ID:          uuid.New(),
+		Title:       title,
+		UserID:      userID,
+		CreatedAt:   now,
+		ExpiresAt:   expiresAt,
+		PublishAt:   now,
+		PublishedAt: &now,
+	}}
+	r.advertisements = append(r.advertisements, advertisement)
+	return advertisement.ID
+}
+
+func (r *fakeAdvertisementRepository) get(id uuid.UUID) *fakeAdvertisement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, advertisement := range r.advertisements {
+		if advertisement.ID == id {
+			found := *advertisement
+			return &found
+		}
+	}
+	return nil
+}
+
+func (r *fakeAdvertisementRepository) CreateAdvertisement(_ context.Context, advertisement *entities.Advertisement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	advertisement.ID = uuid.New()
+	advertisement.CreatedAt = time.Now()
+	advertisement.UpdatedAt = advertisement.CreatedAt
+	r.advertisements = append(r.advertisements, &fakeAdvertisement{Advertisement: *advertisement})
+	return nil
+}
+
+func (r *fakeAdvertisementRepository) GetAdvertisementByID(_ context.Context, id uuid.UUID) (*entities.Advertisement, error) {
+	if advertisement := r.get(id); advertisement != nil {
+		return &advertisement.Advertisement, nil
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeAdvertisementRepository) UpdateAdvertisement(_ context.Context, advertisement *entities.Advertisement) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.advertisements {
+		if stored.ID != advertisement.ID || stored.UserID != advertisement.UserID {
+			continue
+		}
+		if stored.PublishedAt != nil && !stored.PublishAt.Equal(advertisement.PublishAt) {
+			break
+		}
+		advertisement.UpdatedAt = time.Now()
+		advertisement.PublishedAt = stored.PublishedAt
+		stored.Advertisement = *advertisement
+		return nil
+	}
+	return repositories.ErrNotFound
+}
+
+func (r *fakeAdvertisementRepository) PublishScheduledAdvertisements(_ context.Context, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	published := 0
+	for _, advertisement := range r.advertisements {
+		if published == limit {
+			break
+		}
+		if advertisement.PublishedAt == nil && !advertisement.PublishAt.After(time.Now()) {
+			now := time.Now()
+			advertisement.PublishedAt = &now
+			published++
+		}
+	}
+	return published, nil
+}
+
+// schedule makes an advertisement wait for publishing at publishAt, which
+// the API only accepts in the future.
+func (r *fakeAdvertisementRepository) schedule(id uuid.UUID, publishAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, advertisement := range r.advertisements {
+		if advertisement.ID == id {
+			advertisement.PublishAt = publishAt
+			advertisement.PublishedAt = nil
+		}
+	}
+}
+
+// publish marks a scheduled advertisement as published, as the scheduler
+// does once its publish time has come.
+func (r *fakeAdvertisementRepository) publish(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, advertisement := range r.advertisements {
+		if advertisement.ID == id {
+			now := time.Now()
+			advertisement.PublishedAt = &now
+		}
+	}
+}
+
+func (r *fakeAdvertisementRepository) RenewAdvertisement(_ context.Context, id, userID uuid.UUID, expiresAt time.Time) (*entities.Advertisement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, advertisement := range r.advertisements {
+		if advertisement.ID == id && advertisement.UserID == userID {
+			advertisement.ExpiresAt = expiresAt
+			advertisement.ArchivedAt = nil
+			advertisement.remindedAt = nil
+			renewed := advertisement.Advertisement
+			return &renewed, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeAdvertisementRepository) GetExpiringAdvertisements(_ context.Context, before time.Time, limit int) ([]*entities.ExpiringAdvertisement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	var expiring []*entities.ExpiringAdvertisement
+	for _, advertisement := range r.advertisements {
+		user := r.users.users[advertisement.UserID]
+		if advertisement.ArchivedAt != nil || advertisement.remindedAt != nil ||
+			!advertisement.ExpiresAt.After(time.Now()) || advertisement.ExpiresAt.After(before) ||
+			user.Email == nil || user.EmailVerifiedAt == nil {
+			continue
+		}
+		if len(expiring) == limit {
+			break
+		}
+		found := entities.ExpiringAdvertisement{Advertisement: advertisement.Advertisement, Email: *user.Email}
+		found.AuthorLogin = user.Login
+		expiring = append(expiring, &found)
+	}
+	return expiring, nil
+}
+
+func (r *fakeAdvertisementRepository) MarkAdvertisementExpiryReminded(_ context.Context, id uuid.UUID, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, advertisement := range r.advertisements {
+		if advertisement.ID == id && advertisement.ExpiresAt.Equal(expiresAt) {
+			now := time.Now()
+			advertisement.remindedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeAdvertisementRepository) ArchiveExpiredAdvertisements(_ context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	archived := 0
+	for _, advertisement := range r.advertisements {
+		if advertisement.ArchivedAt == nil && !advertisement.ExpiresAt.After(time.Now()) {
+			now := time.Now()
+			advertisement.ArchivedAt = &now
+			archived++
+		}
+	}
+	return archived, nil
+}
+
+// verifyEmail sets and verifies the address of a user.
+func (r *fakeUserRepository) verifyEmail(id uuid.UUID, email string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.users[id].Email = &email
+	r.users[id].EmailVerifiedAt = &now
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"marketplace/internal/logger"
+	"marketplace/internal/repositories"
+)
+
+type LoginAttemptPolicy struct {
+	MaxAccountFailures int
+	MaxIPFailures      int
+	Window             time.Duration
+	BaseLockout        time.Duration
+	MaxLockout         time.Duration
+}
+
+// LoginLockedError is returned while an account or a client address is
+// locked out after too many failed logins.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %d seconds", ErrTooManyLoginAttempts, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
+
+var (
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
+// compareDummyPassword spends the same time as a real password check so
+// that missing users cannot be told apart by response latency.
+func compareDummyPassword(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+func accountAttemptKey(login string) string {
+	return "account:" + strings.ToLower(login)
+}
+
+func ipAttemptKey(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	return "ip:" + ip
+}
+
+func (s *AuthServiceImpl) checkLoginLockout(ctx context.Context, keys ...string) error {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		attempt, err := s.loginAttemptRepository.GetLoginAttempt(ctx, key)
+		if err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		if attempt.LockedUntil != nil {
+			if remaining := time.Until(*attempt.LockedUntil); remaining > retryAfter {
+				retryAfter = remaining
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (s *AuthServiceImpl) registerLoginFailure(ctx context.Context, accountKey, ipKey string) {
+	logger := slogger.GetLoggerFromContext(ctx).
+		With(slog.String("op", "services.auth.registerLoginFailure"))
+
+	limits := map[string]int{accountKey: s.loginAttemptPolicy.MaxAccountFailures}
+	if ipKey != "" {
+		limits[ipKey] = s.loginAttemptPolicy.MaxIPFailures
+	}
+	for key, limit := range limits {
+		attempt, err := s.loginAttemptRepository.RegisterFailedLoginAttempt(ctx, key, s.loginAttemptPolicy.Window)
+		if err != nil {
+			logger.Error("Failed login registration failed", slog.Any("error", err))
+			continue
+		}
+		if limit <= 0 || attempt.Failures < limit {
+			continue
+		}
+		lockout := s.loginAttemptPolicy.lockoutDuration(attempt.Failures - limit)
+		// locked_until is a timestamp without time zone and pgx keeps only
+		// the wall clock of a time, so it is stored in UTC.
+		lockedUntil := time.Now().UTC().Add(lockout)
+		if err = s.loginAttemptRepository.LockLoginAttempts(ctx, key, lockedUntil); err != nil {
+			logger.Error("Login lockout failed", slog.Any("error", err))
+			continue
+		}
+		logger.Warn("Login locked out",
+			slog.String("security_event", "login_lockout"),
+			slog.String("key", key),
+			slog.Int("failures", attempt.Failures),
+			slog.Time("locked_until", lockedUntil),
+		)
+	}
+}
+
+func (s *AuthServiceImpl) resetLoginFailures(ctx context.Context, accountKey string) {
+	if err := s.loginAttemptRepository.ResetLoginAttempts(ctx, accountKey); err != nil {
+		slogger.GetLoggerFromContext(ctx).Error("Login attempts reset failed",
+			slog.String("op", "services.auth.resetLoginFailures"),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// lockoutDuration doubles the base lockout for every failure over the limit.
+func (p LoginAttemptPolicy) lockoutDuration(overLimit int) time.Duration {
+	lockout := p.BaseLockout
+	for i := 0; i < overLimit && lockout < p.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if p.MaxLockout > 0 && lockout > p.MaxLockout {
+		lockout = p.MaxLockout
+	}
+	return lockout
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+// fakeLoginAttemptRepository counts failures per key like the Postgres
+// repository, restarting the count once the window has passed.
+type fakeLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]*entities.LoginAttempt
+}
+
+func (r *fakeLoginAttemptRepository) GetLoginAttempt(_ context.Context, key string) (*entities.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, ok := r.attempts[key]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	found := *attempt
+	return &found, nil
+}
+
+func (r *fakeLoginAttemptRepository) RegisterFailedLoginAttempt(_ context.Context, key string, window time.Duration) (*entities.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	attempt, ok := r.attempts[key]
+	if !ok {
+		attempt = &entities.LoginAttempt{Key: key}
+		r.attempts[key] = attempt
+	}
+	if attempt.LastFailureAt.Before(now.Add(-window)) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	found := *attempt
+	return &found, nil
+}
+
+// LockLoginAttempts keeps only the wall clock of lockedUntil and reads it
+// back as UTC, like pgx does with a timestamp without time zone.
+func (r *fakeLoginAttemptRepository) LockLoginAttempts(_ context.Context, key string, lockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if attempt, ok := r.attempts[key]; ok {
+		stored := time.Date(lockedUntil.Year(), lockedUntil.Month(), lockedUntil.Day(),
+			lockedUntil.Hour(), lockedUntil.Minute(), lockedUntil.Second(), lockedUntil.Nanosecond(), time.UTC)
+		attempt.LockedUntil = &stored
+	}
+	return nil
+}
+
+func (r *fakeLoginAttemptRepository) ResetLoginAttempts(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, key)
+	return nil
+}
+
+// lockedFor returns how long key stays locked out.
+func (r *fakeLoginAttemptRepository) lockedFor(key string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, ok := r.attempts[key]
+	if !ok || attempt.LockedUntil == nil {
+		return 0
+	}
+	return time.Until(*attempt.LockedUntil)
+}
+
+// unlock lets the lockout of key pass while keeping its failures.
+func (r *fakeLoginAttemptRepository) unlock(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	past := time.Now().Add(-time.Second)
+	r.attempts[key].LockedUntil = &past
+}
+
+func (r *fakeSessionRepository) CreateSession(_ context.Context, session *entities.Session) error {
+	session.ID = uuid.New()
+	return nil
+}
+
+const testPassword = "Password1!"
+
+var testLoginAttemptPolicy = LoginAttemptPolicy{
+	MaxAccountFailures: 3,
+	MaxIPFailures:      5,
+	Window:             time.Hour,
+	BaseLockout:        30 * time.Second,
+	MaxLockout:         100 * time.Second,
+}
+
+type loginTest struct {
+	users    *fakeUserRepository
+	attempts *fakeLoginAttemptRepository
+	service  AuthService
+}
+
+func newLoginTest(t *testing.T, logins ...string) *loginTest {
+	t.Helper()
+	users := newFakeUserRepository()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	for _, login := range logins {
+		if err = users.CreateUser(context.Background(), &entities.User{Login: login, Password: string(hash)}); err != nil {
+			t.Fatalf("CreateUser() error = %v", err)
+		}
+	}
+	attempts := &fakeLoginAttemptRepository{attempts: make(map[string]*entities.LoginAttempt)}
+	return &loginTest{
+		users:    users,
+		attempts: attempts,
+		service: NewAuthServiceImpl(
+			users, &fakeSessionRepository{}, nil, attempts, nil, nil, nil,
+			15, 30, testLoginAttemptPolicy, "secret", "marketplace",
+		),
+	}
+}
+
+func (tt *loginTest) login(login, password, clientIP string) error {
+	_, err := tt.service.LoginUser(context.Background(), &dto.LoginUserRequest{Login: login, Password: password}, clientIP)
+	return err
+}
+
+// fail runs n logins with a wrong password, each of which must be rejected
+// as invalid credentials rather than locked out.
+func (tt *loginTest) fail(t *testing.T, n int, login, clientIP string) {
+	t.Helper()
+	for range n {
+		if err := tt.login(login, "wrong password", clientIP); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("LoginUser(%q) error = %v, want %v", login, err, ErrInvalidCredentials)
+		}
+	}
+}
+
+func wantLocked(t *testing.T, err error, retryAfter time.Duration) {
+	t.Helper()
+	var lockedErr *LoginLockedError
+	if !errors.As(err, &lockedErr) || !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatalf("LoginUser() error = %v, want a lockout", err)
+	}
+	if lockedErr.RetryAfter > retryAfter || lockedErr.RetryAfter < retryAfter-time.Second {
+		t.Errorf("retry after %v, want %v", lockedErr.RetryAfter, retryAfter)
+	}
+}
+
+func TestLoginLocksAccountAfterFailures(t *testing.T) {
+	tt := newLoginTest(t, "alice")
+	tt.fail(t, 2, "alice", "192.0.2.1")
+	tt.fail(t, 1, "ALICE", "192.0.2.2")
+
+	// The right password does not get past the lockout, from any address.
+	wantLocked(t, tt.login("alice", testPassword, "192.0.2.3"), 30*time.Second)
+	if err := tt.login("alice", testPassword, ""); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("LoginUser() without address error = %v, want %v", err, ErrTooManyLoginAttempts)
+	}
+	if locked := tt.attempts.lockedFor(ipAttemptKey("192.0.2.1")); locked != 0 {
+		t.Errorf("address locked for %v, want it below its limit", locked)
+	}
+}
+
+func TestLoginLocksClientAddressAfterFailures(t *testing.T) {
+	tt := newLoginTest(t, "alice", "bob")
+	tt.fail(t, 2, "alice", "192.0.2.1")
+	tt.fail(t, 2, "bob", "192.0.2.1")
+	tt.fail(t, 1, "nobody", "192.0.2.1")
+
+	wantLocked(t, tt.login("carol", testPassword, "192.0.2.1"), 30*time.Second)
+	if err := tt.login("alice", testPassword, "192.0.2.2"); err != nil {
+		t.Errorf("LoginUser() from another address error = %v, want nil", err)
+	}
+}
+
+func TestLoginLockoutOutsideUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("MSK", 3*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	tt := newLoginTest(t, "alice")
+	tt.fail(t, 3, "alice", "192.0.2.1")
+
+	wantLocked(t, tt.login("alice", testPassword, "192.0.2.1"), 30*time.Second)
+}
+
+func TestLoginLockoutEscalatesUpToMax(t *testing.T) {
+	tt := newLoginTest(t, "alice")
+	key := accountAttemptKey("alice")
+	tt.fail(t, 3, "alice", "")
+
+	for _, want := range []time.Duration{60 * time.Second, 100 * time.Second, 100 * time.Second} {
+		tt.attempts.unlock(key)
+		tt.fail(t, 1, "alice", "")
+		if locked := tt.attempts.lockedFor(key); locked > want || locked < want-time.Second {
+			t.Errorf("locked for %v, want %v", locked, want)
+		}
+	}
+	wantLocked(t, tt.login("alice", testPassword, ""), 100*time.Second)
+}
+
+func TestLoginResetsAccountFailuresOnSuccess(t *testing.T) {
+	tt := newLoginTest(t, "alice")
+	tt.fail(t, 2, "alice", "192.0.2.1")
+	if err := tt.login("alice", testPassword, "192.0.2.1"); err != nil {
+		t.Fatalf("LoginUser() error = %v", err)
+	}
+	tt.fail(t, 2, "alice", "192.0.2.1")
+
+	if err := tt.login("alice", testPassword, "192.0.2.1"); err != nil {
+		t.Errorf("LoginUser() error = %v, want the earlier failures forgotten", err)
+	}
+	// Only the account is reset, the address keeps counting.
+	if attempt, err := tt.attempts.GetLoginAttempt(context.Background(), ipAttemptKey("192.0.2.1")); err != nil || attempt.Failures != 4 {
+		t.Errorf("address attempt = %+v, %v, want 4 failures", attempt, err)
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	policy := LoginAttemptPolicy{BaseLockout: 30 * time.Second, MaxLockout: time.Hour}
+	for overLimit, want := range map[int]time.Duration{
+		0:  30 * time.Second,
+		1:  time.Minute,
+		6:  32 * time.Minute,
+		7:  time.Hour,
+		50: time.Hour,
+	} {
+		if got := policy.lockoutDuration(overLimit); got != want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", overLimit, got, want)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
+	"marketplace/internal/oidc"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+const (
+	minLoginLength            = 3
+	maxGeneratedLoginLength   = 24
+	loginProvisioningAttempts = 5
+)
+
+type OIDCServiceImpl struct {
+	clients                map[string]*oidc.Client
+	providerNames          []string
+	userIdentityRepository repositories.UserIdentityRepository
+	authService            AuthService
+	stateTTLMinutes        time.Duration
+}
+
+func NewOIDCServiceImpl(
+	clients []*oidc.Client,
+	userIdentityRepository repositories.UserIdentityRepository,
+	authService AuthService,
+	stateTTLMinutes time.Duration,
+) OIDCService {
+	s := &OIDCServiceImpl{
+		clients:                make(map[string]*oidc.Client, len(clients)),
+		userIdentityRepository: userIdentityRepository,
+		authService:            authService,
+		stateTTLMinutes:        stateTTLMinutes,
+	}
+	for _, client := range clients {
+		s.clients[client.Name()] = client
+		s.providerNames = append(s.providerNames, client.Name())
+	}
+	return s
+}
+
+func (s *OIDCServiceImpl) GetProviders(ctx context.Context) []*dto.OIDCProviderResponse {
+	const op = "services.oidc.GetProviders"
+	ctx, span := tracing.Start(ctx, op)
+	defer span.End()
+
+	providers := make([]*dto.OIDCProviderResponse, len(s.providerNames))
+	for i, name := range s.providerNames {
+		providers[i] = &dto.OIDCProviderResponse{Name: name}
+	}
+	return providers
+}
+
+// GetAuthorizationURL starts a login with the provider. When linkUserID is
+// set, the callback links the external identity to that user instead. The
+// returned binding must be presented to HandleCallback by the same browser,
+// so that a victim cannot be made to finish a login started by an attacker.
+func (s *OIDCServiceImpl) GetAuthorizationURL(ctx context.Context, provider string, linkUserID *uuid.UUID) (_ *dto.OIDCAuthorizationResponse, err error) {
+	const op = "services.oidc.GetAuthorizationURL"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	client, ok := s.clients[provider]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	logger.Info("Starting OIDC login", slog.String("provider", provider), slog.Bool("link", linkUserID != nil))
+
+	state, err := generateToken()
+	if err != nil {
+		logger.Error("State generation failed", slog.Any("error", err))
+		return nil, ErrCannotStartOIDCLogin
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		logger.Error("Nonce generation failed", slog.Any("error", err))
+		return nil, ErrCannotStartOIDCLogin
+	}
+	codeVerifier, err := generateToken()
+	if err != nil {
+		logger.Error("Code verifier generation failed", slog.Any("error", err))
+		return nil, ErrCannotStartOIDCLogin
+	}
+	binding, err := generateToken()
+	if err != nil {
+		logger.Error("Binding generation failed", slog.Any("error", err))
+		return nil, ErrCannotStartOIDCLogin
+	}
+
+	authorizationURL, err := client.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		logger.Error("Provider discovery failed", slog.Any("error", err))
+		return nil, ErrCannotStartOIDCLogin
+	}
+	err = s.userIdentityRepository.CreateOIDCState(ctx, &entities.OIDCState{
+		StateHash:    hashToken(state),
+		BindingHash:  hashToken(binding),
+		Provider:     provider,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().UTC().Add(s.stateTTLMinutes * time.Minute),
+	})
+	if err != nil {
+		logger.Error("State saving failed", slog.Any("error", err))
+		return nil, ErrCannotStartOIDCLogin
+	}
+
+	return &dto.OIDCAuthorizationResponse{AuthorizationURL: authorizationURL, Binding: binding}, nil
+}
+
+func (s *OIDCServiceImpl) HandleCallback(ctx context.Context, provider string, callbackData *dto.OIDCCallbackRequest) (_ *dto.TokenResponse, err error) {
+	const op = "services.oidc.HandleCallback"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).
+		With(slog.String("op", op), slog.String("provider", provider))
+
+	client, ok := s.clients[provider]
+	if !ok {
+		return nil, ErrOIDCProviderNotFound
+	}
+
+	if callbackData.Binding == "" {
+		logger.Warn("OIDC callback without a binding")
+		return nil, ErrInvalidOIDCState
+	}
+	state, err := s.userIdentityRepository.UseOIDCState(ctx, hashToken(callbackData.State), hashToken(callbackData.Binding), provider)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			logger.Warn("Unknown, expired or unbound OIDC state")
+			return nil, ErrInvalidOIDCState
+		}
+		logger.Error("State lookup failed", slog.Any("error", err))
+		return nil, ErrCannotCompleteOIDCLogin
+	}
+	if callbackData.Error != "" {
+		logger.Warn("Provider returned an error",
+			slog.String("error", callbackData.Error),
+			slog.String("description", callbackData.ErrorDescription),
+		)
+		return nil, ErrOIDCAuthenticationFailed
+	}
+	if callbackData.Code == "" {
+		return nil, ErrOIDCAuthenticationFailed
+	}
+
+	claims, err := client.Exchange(ctx, callbackData.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		logger.Warn("Code exchange failed", slog.Any("error", err))
+		return nil, ErrOIDCAuthenticationFailed
+	}
+
+	var userID uuid.UUID
+	if state.LinkUserID != nil {
+		if err = s.linkIdentity(ctx, *state.LinkUserID, provider, claims); err != nil {
+			return nil, err
+		}
+		userID = *state.LinkUserID
+	} else {
+		identity, err := s.userIdentityRepository.GetUserIdentity(ctx, provider, claims.Subject)
+		switch {
+		case err == nil:
+			userID = identity.UserID
+		case errors.Is(err, repositories.ErrNotFound):
+			user, err := s.provisionUser(ctx, provider, claims)
+			if err != nil {
+				return nil, err
+			}
+			userID = user.ID
+		default:
+			logger.Error("Identity lookup failed", slog.Any("error", err))
+			return nil, ErrCannotCompleteOIDCLogin
+		}
+	}
+
+	return s.authService.LoginExternalUser(ctx, userID)
+}
+
+func (s *OIDCServiceImpl) GetUserIdentities(ctx context.Context, userID uuid.UUID) (_ []*dto.UserIdentityResponse, err error) {
+	const op = "services.oidc.GetUserIdentities"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	identities, err := s.userIdentityRepository.GetUserIdentitiesByUserID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get identities", slog.Any("error", err))
+		return nil, ErrCannotGetUserIdentities
+	}
+
+	identitiesResponse := make([]*dto.UserIdentityResponse, len(identities))
+	for i, identity := range identities {
+		identitiesResponse[i] = &dto.UserIdentityResponse{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		}
+	}
+	return identitiesResponse, nil
+}
+
+func (s *OIDCServiceImpl) linkIdentity(ctx context.Context, userID uuid.UUID, provider string, claims *oidc.Claims) error {
+	logger := slogger.GetLoggerFromContext(ctx).
+		With(slog.String("op", "services.oidc.linkIdentity"))
+
+	identity := entities.UserIdentity{
+		UserID:   userID,
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    optionalString(claims.Email),
+	}
+	if err := s.userIdentityRepository.CreateUserIdentity(ctx, &identity); err != nil {
+		if errors.Is(err, repositories.ErrAlreadyExists) {
+			existing, getErr := s.userIdentityRepository.GetUserIdentity(ctx, provider, claims.Subject)
+			if getErr == nil && existing.UserID == userID {
+				return nil
+			}
+			logger.Warn("Identity is linked to another user", slog.String("userID", userID.String()))
+			return ErrIdentityAlreadyLinked
+		}
+		logger.Error("Identity linking failed", slog.Any("error", err))
+		return ErrCannotCompleteOIDCLogin
+	}
+
+	logger.Info("Identity linked",
+		slog.String("userID", userID.String()),
+		slog.String("provider", provider),
+	)
+	return nil
+}
+
+func (s *OIDCServiceImpl) provisionUser(ctx context.Context, provider string, claims *oidc.Claims) (*entities.User, error) {
+	logger := slogger.GetLoggerFromContext(ctx).
+		With(slog.String("op", "services.oidc.provisionUser"))
+
+	// Provisioned users sign in through the provider only, until they set a
+	// password of their own via the reset flow.
+	password, err := generateToken()
+	if err != nil {
+		logger.Error("Password generation failed", slog.Any("error", err))
+		return nil, ErrCannotCompleteOIDCLogin
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("Password hashing failed", slog.Any("error", err))
+		return nil, ErrPasswordHashing
+	}
+
+	user := entities.User{
+		Login:       loginFromClaims(claims),
+		Password:    string(hashedPassword),
+		DisplayName: truncate(claims.Name, 64),
+	}
+	// An unverified address could belong to someone else, so it is not
+	// taken over; the user can add an email later.
+	if claims.EmailVerified {
+		user.Email = optionalString(claims.Email)
+	}
+	if user.Email != nil {
+		now := time.Now().UTC()
+		user.EmailVerifiedAt = &now
+	}
+	baseLogin := user.Login
+
+	for attempt := 1; attempt <= loginProvisioningAttempts; {
+		identity := entities.UserIdentity{
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    optionalString(claims.Email),
+		}
+		err = s.userIdentityRepository.CreateUserWithIdentity(ctx, &user, &identity)
+		switch {
+		case err == nil:
+			logger.Info("User provisioned from external identity",
+				slog.String("userID", user.ID.String()),
+				slog.String("login", user.Login),
+				slog.String("provider", provider),
+			)
+			metrics.RecordRegistration(metrics.OIDCRegistration)
+			return &user, nil
+		case errors.Is(err, repositories.ErrEmailAlreadyExists) && user.Email != nil:
+			// The address belongs to a local account, which the user can
+			// link the identity to after signing in.
+			logger.Warn("Email of the external identity is in use, provisioning without it",
+				slog.String("provider", provider),
+			)
+			user.Email, user.EmailVerifiedAt = nil, nil
+		case errors.Is(err, repositories.ErrAlreadyExists):
+			// Either the login is taken or a concurrent callback has just
+			// provisioned the same identity.
+			if identity, err := s.userIdentityRepository.GetUserIdentity(ctx, provider, claims.Subject); err == nil {
+				return &entities.User{ID: identity.UserID}, nil
+			}
+			user.Login = fmt.Sprintf("%s%04d", baseLogin, rand.IntN(10000))
+			attempt++
+		default:
+			logger.Error("User provisioning failed", slog.Any("error", err))
+			return nil, ErrCannotCreateUser
+		}
+	}
+
+	logger.Error("No free login found", slog.String("login", baseLogin))
+	return nil, ErrCannotCreateUser
+}
+
+func loginFromClaims(claims *oidc.Claims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+	var login strings.Builder
+	for _, r := range candidate {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			login.WriteRune(r)
+		}
+		if login.Len() == maxGeneratedLoginLength {
+			break
+		}
+	}
+	if login.Len() < minLoginLength {
+		return "user"
+	}
+	return login.String()
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return value
+}
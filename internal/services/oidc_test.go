@@ -0,0 +1,359 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/oidc"
+	"marketplace/internal/oidc/oidctest"
+	"marketplace/internal/repositories"
+)
+
+// fakeUserIdentityRepository keeps states and identities in memory and
+// creates users through fakeUserRepository.
+type fakeUserIdentityRepository struct {
+	mu         sync.Mutex
+	users      *fakeUserRepository
+	states     map[string]*entities.OIDCState
+	identities []*entities.UserIdentity
+}
+
+func (r *fakeUserIdentityRepository) CreateOIDCState(_ context.Context, state *entities.OIDCState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *state
+	r.states[state.StateHash] = &stored
+	return nil
+}
+
+func (r *fakeUserIdentityRepository) UseOIDCState(_ context.Context, stateHash, bindingHash, provider string) (*entities.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.states[stateHash]
+	if !ok || state.BindingHash != bindingHash || state.Provider != provider || !state.ExpiresAt.After(time.Now()) {
+		return nil, repositories.ErrNotFound
+	}
+	delete(r.states, stateHash)
+	return state, nil
+}
+
+func (r *fakeUserIdentityRepository) GetUserIdentity(_ context.Context, provider, subject string) (*entities.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeUserIdentityRepository) GetUserIdentitiesByUserID(_ context.Context, userID uuid.UUID) ([]*entities.UserIdentity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var identities []*entities.UserIdentity
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *fakeUserIdentityRepository) CreateUserIdentity(_ context.Context, identity *entities.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addIdentity(identity)
+}
+
+func (r *fakeUserIdentityRepository) CreateUserWithIdentity(ctx context.Context, user *entities.User, identity *entities.UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return repositories.ErrAlreadyExists
+		}
+	}
+	if err := r.users.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	return r.addIdentity(identity)
+}
+
+func (r *fakeUserIdentityRepository) addIdentity(identity *entities.UserIdentity) error {
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return repositories.ErrAlreadyExists
+		}
+	}
+	identity.ID = uuid.New()
+	identity.CreatedAt = time.Now()
+	stored := *identity
+	r.identities = append(r.identities, &stored)
+	return nil
+}
+
+// externalLoginAuthService records the users signed in by the OIDC service.
+type externalLoginAuthService struct {
+	AuthService
+}
+
+func (s *externalLoginAuthService) LoginExternalUser(_ context.Context, userID uuid.UUID) (*dto.TokenResponse, error) {
+	return &dto.TokenResponse{Token: userID.String()}, nil
+}
+
+type oidcTest struct {
+	issuer     *oidctest.Issuer
+	users      *fakeUserRepository
+	identities *fakeUserIdentityRepository
+	service    OIDCService
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	issuer := oidctest.NewIssuer()
+	t.Cleanup(issuer.Close)
+	users := newFakeUserRepository()
+	identities := &fakeUserIdentityRepository{users: users, states: make(map[string]*entities.OIDCState)}
+	return &oidcTest{
+		issuer:     issuer,
+		users:      users,
+		identities: identities,
+		service: NewOIDCServiceImpl(
+			[]*oidc.Client{oidc.NewClient(issuer.Provider("mock"), nil)},
+			identities,
+			&externalLoginAuthService{},
+			10,
+		),
+	}
+}
+
+// login runs the authorization code flow and returns the signed in user.
+func (tt *oidcTest) login(t *testing.T, linkUserID *uuid.UUID, claims jwt.MapClaims) (uuid.UUID, error) {
+	t.Helper()
+	authorization, err := tt.service.GetAuthorizationURL(context.Background(), "mock", linkUserID)
+	if err != nil {
+		t.Fatalf("GetAuthorizationURL() error = %v", err)
+	}
+	code, state, err := tt.issuer.Authorize(authorization.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	token, err := tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: state, Binding: authorization.Binding})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.MustParse(token.Token), nil
+}
+
+func (tt *oidcTest) claims(subject, username, email string, emailVerified bool) jwt.MapClaims {
+	claims := tt.issuer.Claims(subject)
+	claims["preferred_username"] = username
+	claims["email"] = email
+	claims["email_verified"] = emailVerified
+	return claims
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	userID, err := tt.login(t, nil, tt.claims("subject-1", "alice", "alice@example.com", true))
+	if err != nil {
+		t.Fatalf("login error = %v", err)
+	}
+	user, err := tt.users.GetUserByID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("GetUserByID() error = %v", err)
+	}
+	if user.Login != "alice" || user.Email == nil || *user.Email != "alice@example.com" || user.EmailVerifiedAt == nil {
+		t.Errorf("provisioned %+v, want alice with a verified alice@example.com", user)
+	}
+
+	// The identity signs in to the same account again.
+	again, err := tt.login(t, nil, tt.claims("subject-1", "alice", "alice@example.com", true))
+	if err != nil {
+		t.Fatalf("second login error = %v", err)
+	}
+	if again != userID {
+		t.Errorf("second login signed in %s, want %s", again, userID)
+	}
+}
+
+func TestOIDCLoginIgnoresUnverifiedEmail(t *testing.T) {
+	tt := newOIDCTest(t)
+
+	userID, err := tt.login(t, nil, tt.claims("subject-1", "alice", "alice@example.com", false))
+	if err != nil {
+		t.Fatalf("login error = %v", err)
+	}
+	user, _ := tt.users.GetUserByID(context.Background(), userID)
+	if user.Email != nil {
+		t.Errorf("provisioned email %q, want none", *user.Email)
+	}
+}
+
+func TestOIDCLoginWithEmailOfLocalAccount(t *testing.T) {
+	tt := newOIDCTest(t)
+	local := entities.User{Login: "owner", Password: "hash", Email: stringPointer("alice@example.com")}
+	if err := tt.users.CreateUser(context.Background(), &local); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := tt.login(t, nil, tt.claims("subject-1", "alice", "Alice@example.com", true))
+	if err != nil {
+		t.Fatalf("login error = %v", err)
+	}
+	if userID == local.ID {
+		t.Fatal("signed in to the local account")
+	}
+	user, _ := tt.users.GetUserByID(context.Background(), userID)
+	if user.Email != nil || user.Login != "alice" {
+		t.Errorf("provisioned %+v, want alice without email", user)
+	}
+}
+
+func TestOIDCLoginWithTakenLogin(t *testing.T) {
+	tt := newOIDCTest(t)
+	local := entities.User{Login: "alice", Password: "hash"}
+	if err := tt.users.CreateUser(context.Background(), &local); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := tt.login(t, nil, tt.claims("subject-1", "alice", "alice@example.com", true))
+	if err != nil {
+		t.Fatalf("login error = %v", err)
+	}
+	user, _ := tt.users.GetUserByID(context.Background(), userID)
+	if user.Login == "alice" || len(user.Login) != len("alice")+4 {
+		t.Errorf("provisioned login %q, want alice with a numeric suffix", user.Login)
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	tt := newOIDCTest(t)
+	local := entities.User{Login: "owner", Password: "hash"}
+	if err := tt.users.CreateUser(context.Background(), &local); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, err := tt.login(t, &local.ID, tt.claims("subject-1", "alice", "alice@example.com", true))
+	if err != nil {
+		t.Fatalf("link error = %v", err)
+	}
+	if userID != local.ID {
+		t.Errorf("link signed in %s, want %s", userID, local.ID)
+	}
+
+	other := entities.User{Login: "other", Password: "hash"}
+	if err = tt.users.CreateUser(context.Background(), &other); err != nil {
+		t.Fatal(err)
+	}
+	_, err = tt.login(t, &other.ID, tt.claims("subject-1", "alice", "alice@example.com", true))
+	if !errors.Is(err, ErrIdentityAlreadyLinked) {
+		t.Errorf("second link error = %v, want %v", err, ErrIdentityAlreadyLinked)
+	}
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	tt := newOIDCTest(t)
+	authorization, err := tt.service.GetAuthorizationURL(context.Background(), "mock", nil)
+	if err != nil {
+		t.Fatalf("GetAuthorizationURL() error = %v", err)
+	}
+	code, state, err := tt.issuer.Authorize(authorization.AuthorizationURL, tt.claims("subject-1", "alice", "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: "forged", Binding: authorization.Binding})
+	if !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("forged state error = %v, want %v", err, ErrInvalidOIDCState)
+	}
+	if _, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: state, Binding: authorization.Binding}); err != nil {
+		t.Fatalf("HandleCallback() error = %v", err)
+	}
+	_, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: state, Binding: authorization.Binding})
+	if !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("replayed state error = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+func TestOIDCCallbackRequiresBinding(t *testing.T) {
+	tt := newOIDCTest(t)
+	authorization, err := tt.service.GetAuthorizationURL(context.Background(), "mock", nil)
+	if err != nil {
+		t.Fatalf("GetAuthorizationURL() error = %v", err)
+	}
+	code, state, err := tt.issuer.Authorize(authorization.AuthorizationURL, tt.claims("subject-1", "alice", "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The browser of a victim lured to the callback of a login started by
+	// someone else holds no binding, or the binding of its own login.
+	other, err := tt.service.GetAuthorizationURL(context.Background(), "mock", nil)
+	if err != nil {
+		t.Fatalf("GetAuthorizationURL() error = %v", err)
+	}
+
+	for _, binding := range []string{"", other.Binding} {
+		_, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: state, Binding: binding})
+		if !errors.Is(err, ErrInvalidOIDCState) {
+			t.Errorf("HandleCallback() with binding %q error = %v, want %v", binding, err, ErrInvalidOIDCState)
+		}
+	}
+	if len(tt.identities.identities) != 0 {
+		t.Error("an identity was created")
+	}
+	if _, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: state, Binding: authorization.Binding}); err != nil {
+		t.Errorf("HandleCallback() from the browser that started the login error = %v", err)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	tt := newOIDCTest(t)
+	authorization, err := tt.service.GetAuthorizationURL(context.Background(), "mock", nil)
+	if err != nil {
+		t.Fatalf("GetAuthorizationURL() error = %v", err)
+	}
+	code, state, err := tt.issuer.Authorize(authorization.AuthorizationURL, tt.claims("subject-1", "alice", "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A code injected from another login attempt carries that nonce.
+	tt.identities.states[hashToken(state)].Nonce = "other"
+
+	_, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{Code: code, State: state, Binding: authorization.Binding})
+	if !errors.Is(err, ErrOIDCAuthenticationFailed) {
+		t.Errorf("HandleCallback() error = %v, want %v", err, ErrOIDCAuthenticationFailed)
+	}
+	if len(tt.identities.identities) != 0 {
+		t.Error("an identity was created")
+	}
+}
+
+func TestOIDCCallbackWithProviderError(t *testing.T) {
+	tt := newOIDCTest(t)
+	authorization, err := tt.service.GetAuthorizationURL(context.Background(), "mock", nil)
+	if err != nil {
+		t.Fatalf("GetAuthorizationURL() error = %v", err)
+	}
+	_, state, err := tt.issuer.Authorize(authorization.AuthorizationURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tt.service.HandleCallback(context.Background(), "mock", &dto.OIDCCallbackRequest{State: state, Error: "access_denied", Binding: authorization.Binding})
+	if !errors.Is(err, ErrOIDCAuthenticationFailed) {
+		t.Errorf("HandleCallback() error = %v, want %v", err, ErrOIDCAuthenticationFailed)
+	}
+}
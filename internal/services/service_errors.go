@@ -3,15 +3,77 @@ package services
 import "errors"
 
 var (
-	ErrUserNotFound       = errors.New("user not found")
-	ErrUserAlreadyExists  = errors.New("user already exists")
-	ErrPasswordHashing    = errors.New("password hashing error")
-	ErrCannotCreateUser   = errors.New("cannot create user")
-	ErrCannotFindUser     = errors.New("cannot find user")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrCannotSignToken    = errors.New("cannot sign token")
-	ErrCannotLoginUser    = errors.New("cannot login user")
-
-	ErrCannotCreateAdvertisement = errors.New("cannot create advertisement")
-	ErrCannotGetAdvertisements   = errors.New("cannot get advertisements")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserAlreadyExists    = errors.New("user already exists")
+	ErrPasswordHashing      = errors.New("password hashing error")
+	ErrCannotCreateUser     = errors.New("cannot create user")
+	ErrCannotFindUser       = errors.New("cannot find user")
+	ErrInvalidCredentials   = errors.New("invalid credentials")
+	ErrCannotSignToken      = errors.New("cannot sign token")
+	ErrCannotLoginUser      = errors.New("cannot login user")
+	ErrTooManyLoginAttempts = errors.New("too many login attempts")
+	ErrInvalidToken         = errors.New("invalid token")
+	ErrCannotAuthenticate   = errors.New("cannot authenticate")
+
+	ErrCannotChangePassword = errors.New("cannot change password")
+	ErrCannotResetPassword  = errors.New("cannot reset password")
+	ErrInvalidResetToken    = errors.New("invalid or expired reset token")
+
+	ErrTwoFactorRequired       = errors.New("two-factor authentication required")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrCannotEnrollTwoFactor   = errors.New("cannot enroll two-factor authentication")
+	ErrCannotDisableTwoFactor  = errors.New("cannot disable two-factor authentication")
+	ErrForbidden               = errors.New("forbidden")
+
+	ErrOIDCProviderNotFound     = errors.New("identity provider not found")
+	ErrInvalidOIDCState         = errors.New("invalid or expired login state")
+	ErrOIDCAuthenticationFailed = errors.New("external authentication failed")
+	ErrIdentityAlreadyLinked    = errors.New("identity is already linked to another user")
+	ErrCannotStartOIDCLogin     = errors.New("cannot start external login")
+	ErrCannotCompleteOIDCLogin  = errors.New("cannot complete external login")
+	ErrCannotGetUserIdentities  = errors.New("cannot get linked identities")
+
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKeyExpiry = errors.New("api key expiry must be in the future")
+	ErrCannotCreateAPIKey  = errors.New("cannot create api key")
+	ErrCannotGetAPIKeys    = errors.New("cannot get api keys")
+	ErrCannotRevokeAPIKey  = errors.New("cannot revoke api key")
+
+	ErrUserHasNoEmail              = errors.New("user has no email")
+	ErrEmailAlreadyVerified        = errors.New("email already verified")
+	ErrEmailNotVerified            = errors.New("email not verified")
+	ErrVerificationEmailThrottled  = errors.New("verification email was sent recently, try again later")
+	ErrInvalidVerificationToken    = errors.New("invalid or expired verification token")
+	ErrCannotSendVerificationEmail = errors.New("cannot send verification email")
+	ErrCannotVerifyEmail           = errors.New("cannot verify email")
+
+	ErrCannotCreateAdvertisement     = errors.New("cannot create advertisement")
+	ErrCannotGetAdvertisements       = errors.New("cannot get advertisements")
+	ErrCannotExportAdvertisements    = errors.New("cannot export advertisements")
+	ErrAdvertisementNotFound         = errors.New("advertisement not found")
+	ErrCannotRenewAdvertisement      = errors.New("cannot renew advertisement")
+	ErrCannotUpdateAdvertisement     = errors.New("cannot update advertisement")
+	ErrAdvertisementAlreadyPublished = errors.New("advertisement is already published and cannot be rescheduled")
+
+	ErrCannotImportAdvertisements = errors.New("cannot import advertisements")
+	ErrUnreadableImportFile       = errors.New("import file is unreadable")
+	ErrImportTooLarge             = errors.New("import has too many rows to run without background jobs")
+	ErrImportJobNotFound          = errors.New("import job not found")
+	ErrCannotGetImportJob         = errors.New("cannot get import job")
+
+	ErrWebhookNotFound             = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound     = errors.New("webhook delivery not found")
+	ErrInvalidWebhookURL           = errors.New("webhook url must be an absolute http or https url")
+	ErrInvalidWebhookEventType     = errors.New("unknown webhook event type")
+	ErrCannotCreateWebhook         = errors.New("cannot create webhook")
+	ErrCannotGetWebhooks           = errors.New("cannot get webhooks")
+	ErrCannotUpdateWebhook         = errors.New("cannot update webhook")
+	ErrCannotDeleteWebhook         = errors.New("cannot delete webhook")
+	ErrCannotGetWebhookDeliveries  = errors.New("cannot get webhook deliveries")
+	ErrCannotReplayWebhookDelivery = errors.New("cannot replay webhook delivery")
+
+	ErrCannotGetUserProfile    = errors.New("cannot get user profile")
+	ErrCannotUpdateUserProfile = errors.New("cannot update user profile")
 )
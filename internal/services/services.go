@@ -6,15 +6,94 @@ import (
 	"github.com/google/uuid"
 
 	"marketplace/internal/dto"
+	"marketplace/internal/entities"
 )
 
 type AuthService interface {
 	CreateUser(ctx context.Context, userData *dto.UserCreateRequest) (*dto.UserResponse, error)
-	LoginUser(ctx context.Context, userData *dto.LoginUserRequest) (string, error)
+	LoginUser(ctx context.Context, userData *dto.LoginUserRequest, clientIP string) (*dto.TokenResponse, error)
+	LoginUserWithTwoFactor(ctx context.Context, loginData *dto.TwoFactorLoginRequest, clientIP string) (*dto.TokenResponse, error)
+	LoginExternalUser(ctx context.Context, userID uuid.UUID) (*dto.TokenResponse, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*dto.UserResponse, error)
+	Authenticate(ctx context.Context, accessToken string) (*dto.AuthenticatedUser, error)
+	AuthenticateAPIKey(ctx context.Context, key string) (*dto.AuthenticatedUser, error)
+	ChangePassword(ctx context.Context, authUser *dto.AuthenticatedUser, passwordData *dto.PasswordChangeRequest) error
+	RequestPasswordReset(ctx context.Context, forgotData *dto.PasswordForgotRequest) error
+	ResetPassword(ctx context.Context, resetData *dto.PasswordResetRequest) error
+	EnrollTwoFactor(ctx context.Context, userID uuid.UUID) (*dto.TwoFactorEnrollResponse, error)
+	ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, confirmData *dto.TwoFactorConfirmRequest) (*dto.RecoveryCodesResponse, error)
+	DisableTwoFactor(ctx context.Context, userID uuid.UUID, disableData *dto.TwoFactorDisableRequest) error
+}
+
+type OIDCService interface {
+	GetProviders(ctx context.Context) []*dto.OIDCProviderResponse
+	GetAuthorizationURL(ctx context.Context, provider string, linkUserID *uuid.UUID) (*dto.OIDCAuthorizationResponse, error)
+	HandleCallback(ctx context.Context, provider string, callbackData *dto.OIDCCallbackRequest) (*dto.TokenResponse, error)
+	GetUserIdentities(ctx context.Context, userID uuid.UUID) ([]*dto.UserIdentityResponse, error)
+}
+
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, userID uuid.UUID, apiKeyData *dto.APIKeyCreateRequest) (*dto.APIKeyCreatedResponse, error)
+	GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]*dto.APIKeyResponse, error)
+	RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error
+}
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, authUser *dto.AuthenticatedUser, webhookData *dto.WebhookCreateRequest) (*dto.WebhookCreatedResponse, error)
+	GetWebhooks(ctx context.Context, userID uuid.UUID) ([]*dto.WebhookResponse, error)
+	GetWebhook(ctx context.Context, userID, id uuid.UUID) (*dto.WebhookResponse, error)
+	UpdateWebhook(ctx context.Context, authUser *dto.AuthenticatedUser, id uuid.UUID, webhookData *dto.WebhookUpdateRequest) (*dto.WebhookResponse, error)
+	DeleteWebhook(ctx context.Context, userID, id uuid.UUID) error
+	GetWebhookDeliveries(ctx context.Context, userID, id uuid.UUID, filters *dto.WebhookDeliveryFilters) ([]*dto.WebhookDeliveryResponse, error)
+	ReplayWebhookDelivery(ctx context.Context, userID, id, deliveryID uuid.UUID) (*dto.WebhookDeliveryResponse, error)
+}
+
+type EmailVerificationService interface {
+	SendVerificationEmail(ctx context.Context, userID uuid.UUID) error
+	VerifyEmail(ctx context.Context, verifyData *dto.EmailVerifyRequest) error
+	IsEmailVerified(ctx context.Context, userID uuid.UUID) (bool, error)
 }
 
 type AdvertisementService interface {
 	CreateAdvertisement(ctx context.Context, advertisementData *dto.AdvertisementCreateRequest, userID uuid.UUID) (*dto.AdvertisementResponse, error)
-	GetAdvertisements(ctx context.Context, filters *dto.AdvertisementFilters) ([]*dto.AdvertisementResponse, error)
+	GetAdvertisements(ctx context.Context, filters *dto.AdvertisementPageFilters) ([]*dto.AdvertisementResponse, error)
+	UpdateAdvertisement(ctx context.Context, userID, id uuid.UUID, advertisementData *dto.AdvertisementUpdateRequest) (*dto.AdvertisementResponse, error)
+	RenewAdvertisement(ctx context.Context, userID, id uuid.UUID) (*dto.AdvertisementResponse, error)
+	ExportAdvertisements(
+		ctx context.Context,
+		userID *uuid.UUID,
+		filters *dto.AdvertisementFilters,
+		fn func(row *dto.AdvertisementExportRow) error,
+	) error
+}
+
+type AdvertisementExpiryService interface {
+	SendExpiryReminders(ctx context.Context) (int, error)
+	ArchiveExpiredAdvertisements(ctx context.Context) (int, error)
+}
+
+type AdvertisementPublishingService interface {
+	PublishScheduledAdvertisements(ctx context.Context) (int, error)
+}
+
+type AdvertisementImportService interface {
+	ImportAdvertisements(
+		ctx context.Context,
+		userID uuid.UUID,
+		format entities.ImportFormat,
+		rows dto.ImportRowReader,
+	) (*dto.ImportJobResponse, error)
+	RunImportJob(ctx context.Context, id uuid.UUID, lastAttempt bool) error
+	GetImportJob(ctx context.Context, userID, id uuid.UUID) (*dto.ImportJobResponse, error)
+}
+
+type UserService interface {
+	GetUserProfile(ctx context.Context, login string) (*dto.UserProfileResponse, error)
+	GetUserAdvertisements(
+		ctx context.Context,
+		login string,
+		filters *dto.AdvertisementPageFilters,
+		viewerID *uuid.UUID,
+	) ([]*dto.AdvertisementResponse, error)
+	UpdateUserProfile(ctx context.Context, id uuid.UUID, profileData *dto.UserProfileUpdateRequest) (*dto.UserProfileResponse, error)
 }
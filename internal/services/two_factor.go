@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/metrics"
+	"marketplace/internal/repositories"
+	"marketplace/internal/totp"
+	"marketplace/internal/tracing"
+)
+
+const (
+	accessTokenType    = "access"
+	challengeTokenType = "2fa_challenge"
+	challengeTokenTTL  = 5 * time.Minute
+	recoveryCodesCount = 10
+)
+
+func (s *AuthServiceImpl) issueChallengeToken(user *entities.User) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ": challengeTokenType,
+		"sub": user.ID,
+		"iat": now.Unix(),
+		"exp": now.Add(challengeTokenTTL).Unix(),
+	})
+	return token.SignedString([]byte(s.JWTSecret))
+}
+
+func (s *AuthServiceImpl) LoginUserWithTwoFactor(ctx context.Context, loginData *dto.TwoFactorLoginRequest, clientIP string) (_ *dto.TokenResponse, err error) {
+	const op = "services.auth.LoginUserWithTwoFactor"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	claims, err := s.parseToken(loginData.ChallengeToken, challengeTokenType)
+	if err != nil {
+		logger.Warn("Invalid challenge token")
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, ErrCannotLoginUser
+	}
+
+	accountKey, ipKey := accountAttemptKey(user.Login), ipAttemptKey(clientIP)
+	if err = s.checkLoginLockout(ctx, accountKey, ipKey); err != nil {
+		var lockedErr *LoginLockedError
+		if errors.As(err, &lockedErr) {
+			metrics.RecordLogin(metrics.LoginFailed)
+			logger.Warn("Two-factor attempt while locked out",
+				slog.String("security_event", "login_locked"),
+				slog.String("userID", user.ID.String()),
+				slog.String("ip", clientIP),
+			)
+			return nil, err
+		}
+		logger.Error("Login lockout check failed", slog.Any("error", err))
+		return nil, ErrCannotLoginUser
+	}
+	if err = s.verifySecondFactor(ctx, user, loginData.Code); err != nil {
+		logger.Warn("Invalid two-factor code", slog.String("userID", user.ID.String()), slog.String("ip", clientIP))
+		s.registerLoginFailure(ctx, accountKey, ipKey)
+		metrics.RecordLogin(metrics.LoginFailed)
+		return nil, err
+	}
+	s.resetLoginFailures(ctx, accountKey)
+
+	tokenString, err := s.issueAccessToken(ctx, user, true)
+	if err != nil {
+		logger.Error("Token issuing failed", slog.Any("error", err))
+		return nil, ErrCannotSignToken
+	}
+
+	logger.Info("User logged in with two-factor authentication", slog.String("userID", user.ID.String()))
+	metrics.RecordLogin(metrics.LoginSucceeded)
+
+	return &dto.TokenResponse{Token: tokenString}, nil
+}
+
+func (s *AuthServiceImpl) EnrollTwoFactor(ctx context.Context, userID uuid.UUID) (_ *dto.TwoFactorEnrollResponse, err error) {
+	const op = "services.auth.EnrollTwoFactor"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Enrolling two-factor authentication", slog.String("userID", userID.String()))
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotEnrollTwoFactor
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error("Secret generation failed", slog.Any("error", err))
+		return nil, ErrCannotEnrollTwoFactor
+	}
+	if err = s.twoFactorRepository.SetPendingTOTPSecret(ctx, user.ID, secret); err != nil {
+		logger.Error("Secret saving failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrAlreadyExists) {
+			return nil, ErrTwoFactorAlreadyEnabled
+		}
+		return nil, ErrCannotEnrollTwoFactor
+	}
+
+	return &dto.TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, s.TOTPIssuer, user.Login),
+	}, nil
+}
+
+func (s *AuthServiceImpl) ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, confirmData *dto.TwoFactorConfirmRequest) (_ *dto.RecoveryCodesResponse, err error) {
+	const op = "services.auth.ConfirmTwoFactor"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotEnrollTwoFactor
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	step, ok := totp.Validate(*user.TOTPSecret, confirmData.Code, time.Now())
+	if !ok {
+		logger.Warn("Invalid two-factor code", slog.String("userID", user.ID.String()))
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		logger.Error("Recovery codes generation failed", slog.Any("error", err))
+		return nil, ErrCannotEnrollTwoFactor
+	}
+	if err = s.twoFactorRepository.EnableTOTP(ctx, user.ID, recoveryCodeHashes); err != nil {
+		logger.Error("Two-factor enabling failed", slog.Any("error", err))
+		return nil, ErrCannotEnrollTwoFactor
+	}
+	if err = s.twoFactorRepository.UseTOTPStep(ctx, user.ID, step); err != nil {
+		logger.Warn("Cannot save used two-factor step", slog.Any("error", err))
+	}
+
+	logger.Info("Two-factor authentication enabled", slog.String("userID", user.ID.String()))
+
+	return &dto.RecoveryCodesResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *AuthServiceImpl) DisableTwoFactor(ctx context.Context, userID uuid.UUID, disableData *dto.TwoFactorDisableRequest) (err error) {
+	const op = "services.auth.DisableTwoFactor"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	user, err := s.userRepository.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return ErrCannotDisableTwoFactor
+	}
+	if user.TOTPEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	if user.Role == entities.AdminRole {
+		return ErrTwoFactorRequired
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(disableData.Password))
+	if err != nil {
+		logger.Warn("Invalid credentials", slog.String("userID", user.ID.String()))
+		return ErrInvalidCredentials
+	}
+	if err = s.verifySecondFactor(ctx, user, disableData.Code); err != nil {
+		logger.Warn("Invalid two-factor code", slog.String("userID", user.ID.String()))
+		return err
+	}
+	if err = s.twoFactorRepository.DisableTOTP(ctx, user.ID); err != nil {
+		logger.Error("Two-factor disabling failed", slog.Any("error", err))
+		return ErrCannotDisableTwoFactor
+	}
+
+	logger.Info("Two-factor authentication disabled", slog.String("userID", user.ID.String()))
+
+	return nil
+}
+
+// verifySecondFactor accepts either a TOTP code, which cannot be reused
+// within its validity window, or an unused recovery code.
+func (s *AuthServiceImpl) verifySecondFactor(ctx context.Context, user *entities.User, code string) error {
+	if user.TOTPEnabledAt == nil || user.TOTPSecret == nil {
+		return ErrTwoFactorNotEnabled
+	}
+	if step, ok := totp.Validate(*user.TOTPSecret, code, time.Now()); ok {
+		if err := s.twoFactorRepository.UseTOTPStep(ctx, user.ID, step); err != nil {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	if err := s.twoFactorRepository.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code))); err != nil {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
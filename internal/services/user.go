@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+type UserServiceImpl struct {
+	userRepository          repositories.UserRepository
+	advertisementRepository repositories.AdvertisementRepository
+}
+
+func NewUserServiceImpl(userRepository repositories.UserRepository, advertisementRepository repositories.AdvertisementRepository) UserService {
+	return &UserServiceImpl{
+		userRepository:          userRepository,
+		advertisementRepository: advertisementRepository,
+	}
+}
+
+func (s *UserServiceImpl) GetUserProfile(ctx context.Context, login string) (_ *dto.UserProfileResponse, err error) {
+	const op = "services.user.GetUserProfile"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Fetching user profile", slog.String("login", login))
+
+	user, err := s.userRepository.GetUserByLogin(ctx, login)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotGetUserProfile
+	}
+	activeAdvertisementsCount, err := s.advertisementRepository.CountAdvertisementsByUserID(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to count user advertisements", slog.Any("error", err))
+		return nil, ErrCannotGetUserProfile
+	}
+
+	logger.Info("User profile fetched successfully", slog.String("userID", user.ID.String()))
+
+	return newUserProfileResponse(user, activeAdvertisementsCount), nil
+}
+
+// GetUserAdvertisements lists the advertisements of a user. When the user
+// views their own list, scheduled, expired and archived advertisements are
+// included.
+func (s *UserServiceImpl) GetUserAdvertisements(
+	ctx context.Context,
+	login string,
+	filters *dto.AdvertisementPageFilters,
+	viewerID *uuid.UUID,
+) (_ []*dto.AdvertisementResponse, err error) {
+	const op = "services.user.GetUserAdvertisements"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Fetching user advertisements",
+		slog.String("login", login),
+		slog.Int("page_number", filters.PageNumber),
+		slog.Int("page_size", filters.PageSize),
+	)
+
+	user, err := s.userRepository.GetUserByLogin(ctx, login)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotGetAdvertisements
+	}
+
+	filter := newAdvertisementPageFilter(filters)
+	filter.UserID = &user.ID
+	if viewerID != nil && *viewerID == user.ID {
+		filter.IncludeExpired = true
+		filter.IncludeScheduled = true
+	}
+	advertisements, err := s.advertisementRepository.GetAdvertisements(ctx, filter)
+	if err != nil {
+		logger.Error("Failed to get advertisements", slog.Any("error", err))
+		return nil, ErrCannotGetAdvertisements
+	}
+
+	logger.Info("Successfully fetched user advertisements", slog.Int("count", len(advertisements)))
+
+	return newAdvertisementResponses(advertisements), nil
+}
+
+func (s *UserServiceImpl) UpdateUserProfile(ctx context.Context, id uuid.UUID, profileData *dto.UserProfileUpdateRequest) (_ *dto.UserProfileResponse, err error) {
+	const op = "services.user.UpdateUserProfile"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Updating user profile", slog.String("userID", id.String()))
+
+	user, err := s.userRepository.GetUserByID(ctx, id)
+	if err != nil {
+		logger.Error("User fetch failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotUpdateUserProfile
+	}
+	if profileData.DisplayName != nil {
+		user.DisplayName = *profileData.DisplayName
+	}
+	if profileData.Bio != nil {
+		user.Bio = *profileData.Bio
+	}
+	if profileData.AvatarURL != nil {
+		user.AvatarURL = *profileData.AvatarURL
+	}
+	err = s.userRepository.UpdateUserProfile(ctx, user)
+	if err != nil {
+		logger.Error("User profile update failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, ErrCannotUpdateUserProfile
+	}
+	activeAdvertisementsCount, err := s.advertisementRepository.CountAdvertisementsByUserID(ctx, user.ID)
+	if err != nil {
+		logger.Error("Failed to count user advertisements", slog.Any("error", err))
+		return nil, ErrCannotGetUserProfile
+	}
+
+	logger.Info("User profile updated successfully", slog.String("userID", user.ID.String()))
+
+	return newUserProfileResponse(user, activeAdvertisementsCount), nil
+}
+
+func newUserProfileResponse(user *entities.User, activeAdvertisementsCount int) *dto.UserProfileResponse {
+	return &dto.UserProfileResponse{
+		Login:                     user.Login,
+		DisplayName:               user.DisplayName,
+		Bio:                       user.Bio,
+		AvatarURL:                 user.AvatarURL,
+		Rating:                    user.Rating,
+		ActiveAdvertisementsCount: activeAdvertisementsCount,
+		CreatedAt:                 user.CreatedAt,
+	}
+}
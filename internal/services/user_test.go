@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+func (r *fakeAdvertisementRepository) CountAdvertisementsByUserID(_ context.Context, userID uuid.UUID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, advertisement := range r.advertisements {
+		if advertisement.UserID == userID && advertisement.ArchivedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetAdvertisements records the filter and returns the advertisements of
+// its user, leaving paging and prices to the SQL it stands in for.
+func (r *fakeAdvertisementRepository) GetAdvertisements(_ context.Context, filter *repositories.AdvertisementFilter) ([]*entities.Advertisement, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastFilter = filter
+	var found []*entities.Advertisement
+	for _, advertisement := range r.advertisements {
+		if filter.UserID == nil || advertisement.UserID == *filter.UserID {
+			copied := advertisement.Advertisement
+			found = append(found, &copied)
+		}
+	}
+	return found, nil
+}
+
+type userTest struct {
+	users          *fakeUserRepository
+	advertisements *fakeAdvertisementRepository
+	service        UserService
+}
+
+func newUserTest() *userTest {
+	users := newFakeUserRepository()
+	advertisements := &fakeAdvertisementRepository{users: users}
+	return &userTest{
+		users:          users,
+		advertisements: advertisements,
+		service:        NewUserServiceImpl(users, advertisements),
+	}
+}
+
+func (tt *userTest) createUser(t *testing.T, login string) uuid.UUID {
+	t.Helper()
+	user := entities.User{Login: login, Password: "hash", DisplayName: "Alice A.", Bio: "Sells bikes"}
+	if err := tt.users.CreateUser(context.Background(), &user); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user.ID
+}
+
+func TestGetUserProfile(t *testing.T) {
+	tt := newUserTest()
+	aliceID := tt.createUser(t, "alice")
+	tt.advertisements.add(aliceID, "Bike", time.Now().Add(time.Hour))
+	tt.advertisements.add(aliceID, "Lamp", time.Now().Add(time.Hour))
+	tt.advertisements.add(uuid.New(), "Chair", time.Now().Add(time.Hour))
+
+	profile, err := tt.service.GetUserProfile(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("GetUserProfile() error = %v", err)
+	}
+	if profile.Login != "alice" || profile.DisplayName != "Alice A." || profile.Bio != "Sells bikes" {
+		t.Errorf("profile = %+v, want alice's profile", profile)
+	}
+	if profile.ActiveAdvertisementsCount != 2 || profile.CreatedAt.IsZero() {
+		t.Errorf("profile = %+v, want 2 active advertisements and the join date", profile)
+	}
+
+	if _, err = tt.service.GetUserProfile(context.Background(), "nobody"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserProfile() of unknown login error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestGetUserAdvertisementsShowsHiddenOnlyToOwner(t *testing.T) {
+	tt := newUserTest()
+	aliceID := tt.createUser(t, "alice")
+	tt.advertisements.add(aliceID, "Bike", time.Now().Add(time.Hour))
+	tt.advertisements.add(uuid.New(), "Chair", time.Now().Add(time.Hour))
+	minPrice := decimal.NewFromInt(10)
+	filters := &dto.AdvertisementPageFilters{
+		PageNumber:           3,
+		PageSize:             20,
+		AdvertisementFilters: dto.AdvertisementFilters{MinPrice: &minPrice},
+	}
+	otherID := uuid.New()
+
+	for _, tc := range []struct {
+		name       string
+		viewerID   *uuid.UUID
+		wantHidden bool
+	}{
+		{"anonymous", nil, false},
+		{"other user", &otherID, false},
+		{"owner", &aliceID, true},
+	} {
+		advertisements, err := tt.service.GetUserAdvertisements(context.Background(), "alice", filters, tc.viewerID)
+		if err != nil {
+			t.Fatalf("%s: GetUserAdvertisements() error = %v", tc.name, err)
+		}
+		if len(advertisements) != 1 || advertisements[0].Title != "Bike" {
+			t.Errorf("%s: got %+v, want alice's bike", tc.name, advertisements)
+		}
+		filter := tt.advertisements.lastFilter
+		if filter.UserID == nil || *filter.UserID != aliceID || filter.Offset != 40 || filter.Limit != 20 ||
+			filter.MinPrice == nil || !filter.MinPrice.Equal(minPrice) {
+			t.Errorf("%s: filter = %+v, want page 3 of alice's advertisements from 10", tc.name, filter)
+		}
+		if filter.IncludeExpired != tc.wantHidden || filter.IncludeScheduled != tc.wantHidden {
+			t.Errorf("%s: include expired %v and scheduled %v, want %v",
+				tc.name, filter.IncludeExpired, filter.IncludeScheduled, tc.wantHidden)
+		}
+	}
+
+	_, err := tt.service.GetUserAdvertisements(context.Background(), "nobody", filters, nil)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserAdvertisements() of unknown login error = %v, want %v", err, ErrUserNotFound)
+	}
+}
+
+func TestUpdateUserProfileChangesGivenFields(t *testing.T) {
+	tt := newUserTest()
+	aliceID := tt.createUser(t, "alice")
+
+	profile, err := tt.service.UpdateUserProfile(context.Background(), aliceID, &dto.UserProfileUpdateRequest{
+		Bio:       stringPointer(""),
+		AvatarURL: stringPointer("https://example.com/alice.png"),
+	})
+	if err != nil {
+		t.Fatalf("UpdateUserProfile() error = %v", err)
+	}
+	if profile.DisplayName != "Alice A." || profile.Bio != "" || profile.AvatarURL != "https://example.com/alice.png" {
+		t.Errorf("profile = %+v, want the bio cleared and the avatar set", profile)
+	}
+	stored, err := tt.users.GetUserByID(context.Background(), aliceID)
+	if err != nil || stored.Bio != "" || stored.AvatarURL != "https://example.com/alice.png" {
+		t.Errorf("stored user = %+v, %v, want the update saved", stored, err)
+	}
+
+	_, err = tt.service.UpdateUserProfile(context.Background(), uuid.New(), &dto.UserProfileUpdateRequest{})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdateUserProfile() of unknown user error = %v, want %v", err, ErrUserNotFound)
+	}
+}
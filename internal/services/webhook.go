@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/dto"
+	"marketplace/internal/entities"
+	"marketplace/internal/logger"
+	"marketplace/internal/repositories"
+	"marketplace/internal/tracing"
+)
+
+const webhookSecretPrefix = "whsec_"
+
+type WebhookServiceImpl struct {
+	webhookRepository repositories.WebhookRepository
+}
+
+func NewWebhookServiceImpl(webhookRepository repositories.WebhookRepository) WebhookService {
+	return &WebhookServiceImpl{webhookRepository: webhookRepository}
+}
+
+func (s *WebhookServiceImpl) CreateWebhook(
+	ctx context.Context,
+	authUser *dto.AuthenticatedUser,
+	webhookData *dto.WebhookCreateRequest,
+) (_ *dto.WebhookCreatedResponse, err error) {
+	const op = "services.webhook.CreateWebhook"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Creating webhook",
+		slog.String("userID", authUser.UserID.String()),
+		slog.Any("eventTypes", webhookData.EventTypes),
+	)
+
+	if err := validateWebhook(authUser, webhookData.URL, webhookData.EventTypes); err != nil {
+		return nil, err
+	}
+	token, err := generateToken()
+	if err != nil {
+		logger.Error("Webhook secret generation failed", slog.Any("error", err))
+		return nil, ErrCannotCreateWebhook
+	}
+	endpoint := entities.WebhookEndpoint{
+		UserID:      authUser.UserID,
+		URL:         webhookData.URL,
+		Secret:      webhookSecretPrefix + token,
+		EventTypes:  slices.Compact(slices.Sorted(slices.Values(webhookData.EventTypes))),
+		Description: webhookData.Description,
+	}
+	if err = s.webhookRepository.CreateWebhookEndpoint(ctx, &endpoint); err != nil {
+		logger.Error("Webhook creation failed", slog.Any("error", err))
+		return nil, ErrCannotCreateWebhook
+	}
+
+	logger.Info("Webhook created successfully", slog.String("webhookID", endpoint.ID.String()))
+
+	return &dto.WebhookCreatedResponse{
+		WebhookResponse: *newWebhookResponse(&endpoint),
+		Secret:          endpoint.Secret,
+	}, nil
+}
+
+func (s *WebhookServiceImpl) GetWebhooks(ctx context.Context, userID uuid.UUID) (_ []*dto.WebhookResponse, err error) {
+	const op = "services.webhook.GetWebhooks"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	endpoints, err := s.webhookRepository.GetWebhookEndpointsByUserID(ctx, userID)
+	if err != nil {
+		logger.Error("Failed to get webhooks", slog.Any("error", err))
+		return nil, ErrCannotGetWebhooks
+	}
+
+	webhooksResponse := make([]*dto.WebhookResponse, len(endpoints))
+	for i, endpoint := range endpoints {
+		webhooksResponse[i] = newWebhookResponse(endpoint)
+	}
+	return webhooksResponse, nil
+}
+
+func (s *WebhookServiceImpl) GetWebhook(ctx context.Context, userID, id uuid.UUID) (_ *dto.WebhookResponse, err error) {
+	const op = "services.webhook.GetWebhook"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	endpoint, err := s.getWebhookEndpoint(ctx, logger, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return newWebhookResponse(endpoint), nil
+}
+
+func (s *WebhookServiceImpl) UpdateWebhook(
+	ctx context.Context,
+	authUser *dto.AuthenticatedUser,
+	id uuid.UUID,
+	webhookData *dto.WebhookUpdateRequest,
+) (_ *dto.WebhookResponse, err error) {
+	const op = "services.webhook.UpdateWebhook"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Updating webhook", slog.String("userID", authUser.UserID.String()), slog.String("webhookID", id.String()))
+
+	endpoint, err := s.getWebhookEndpoint(ctx, logger, authUser.UserID, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhookData.URL != nil {
+		endpoint.URL = *webhookData.URL
+	}
+	if webhookData.EventTypes != nil {
+		endpoint.EventTypes = slices.Compact(slices.Sorted(slices.Values(webhookData.EventTypes)))
+	}
+	if webhookData.Description != nil {
+		endpoint.Description = *webhookData.Description
+	}
+	if webhookData.Enabled != nil {
+		switch {
+		case *webhookData.Enabled:
+			endpoint.DisabledAt = nil
+			endpoint.ConsecutiveFailures = 0
+		case endpoint.DisabledAt == nil:
+			now := time.Now()
+			endpoint.DisabledAt = &now
+		}
+	}
+	if err = validateWebhook(authUser, endpoint.URL, endpoint.EventTypes); err != nil {
+		return nil, err
+	}
+	if err = s.webhookRepository.UpdateWebhookEndpoint(ctx, endpoint); err != nil {
+		logger.Error("Webhook update failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, ErrCannotUpdateWebhook
+	}
+
+	logger.Info("Webhook updated successfully", slog.String("webhookID", id.String()))
+
+	return newWebhookResponse(endpoint), nil
+}
+
+func (s *WebhookServiceImpl) DeleteWebhook(ctx context.Context, userID, id uuid.UUID) (err error) {
+	const op = "services.webhook.DeleteWebhook"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Deleting webhook", slog.String("userID", userID.String()), slog.String("webhookID", id.String()))
+
+	err = s.webhookRepository.DeleteWebhookEndpoint(ctx, id, userID)
+	if err != nil {
+		logger.Error("Webhook deletion failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrWebhookNotFound
+		}
+		return ErrCannotDeleteWebhook
+	}
+
+	logger.Info("Webhook deleted successfully", slog.String("webhookID", id.String()))
+
+	return nil
+}
+
+func (s *WebhookServiceImpl) GetWebhookDeliveries(
+	ctx context.Context,
+	userID, id uuid.UUID,
+	filters *dto.WebhookDeliveryFilters,
+) (_ []*dto.WebhookDeliveryResponse, err error) {
+	const op = "services.webhook.GetWebhookDeliveries"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	if _, err := s.getWebhookEndpoint(ctx, logger, userID, id); err != nil {
+		return nil, err
+	}
+	offset := (filters.PageNumber - 1) * filters.PageSize
+	deliveries, err := s.webhookRepository.GetWebhookDeliveries(ctx, id, offset, filters.PageSize)
+	if err != nil {
+		logger.Error("Failed to get webhook deliveries", slog.Any("error", err))
+		return nil, ErrCannotGetWebhookDeliveries
+	}
+
+	deliveriesResponse := make([]*dto.WebhookDeliveryResponse, len(deliveries))
+	for i, delivery := range deliveries {
+		deliveriesResponse[i] = newWebhookDeliveryResponse(delivery)
+	}
+	return deliveriesResponse, nil
+}
+
+func (s *WebhookServiceImpl) ReplayWebhookDelivery(ctx context.Context, userID, id, deliveryID uuid.UUID) (_ *dto.WebhookDeliveryResponse, err error) {
+	const op = "services.webhook.ReplayWebhookDelivery"
+	ctx, span := tracing.Start(ctx, op)
+	defer tracing.End(span, &err)
+
+	logger := slogger.GetLoggerFromContext(ctx).With(slog.String("op", op))
+
+	logger.Info("Replaying webhook delivery",
+		slog.String("userID", userID.String()),
+		slog.String("webhookID", id.String()),
+		slog.String("deliveryID", deliveryID.String()),
+	)
+
+	if _, err := s.getWebhookEndpoint(ctx, logger, userID, id); err != nil {
+		return nil, err
+	}
+	delivery, err := s.webhookRepository.ReplayWebhookDelivery(ctx, deliveryID, id)
+	if err != nil {
+		logger.Error("Webhook delivery replay failed", slog.Any("error", err))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, ErrCannotReplayWebhookDelivery
+	}
+
+	logger.Info("Webhook delivery queued for replay", slog.String("deliveryID", deliveryID.String()))
+
+	return newWebhookDeliveryResponse(delivery), nil
+}
+
+func (s *WebhookServiceImpl) getWebhookEndpoint(ctx context.Context, logger *slog.Logger, userID, id uuid.UUID) (*entities.WebhookEndpoint, error) {
+	endpoint, err := s.webhookRepository.GetWebhookEndpoint(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		logger.Error("Failed to get webhook", slog.Any("error", err))
+		return nil, ErrCannotGetWebhooks
+	}
+	return endpoint, nil
+}
+
+// validateWebhook accepts http(s) URLs only and keeps admin-only event
+// types, such as user registrations, away from regular users.
+func validateWebhook(authUser *dto.AuthenticatedUser, rawURL string, eventTypes []string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	isAdmin := authUser.Role == string(entities.AdminRole) && authUser.TwoFactorVerified
+	for _, eventType := range eventTypes {
+		adminOnly, ok := entities.WebhookEventTypes[eventType]
+		if !ok {
+			return ErrInvalidWebhookEventType
+		}
+		if adminOnly && !isAdmin {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+func newWebhookResponse(endpoint *entities.WebhookEndpoint) *dto.WebhookResponse {
+	return &dto.WebhookResponse{
+		ID:                  endpoint.ID,
+		URL:                 endpoint.URL,
+		EventTypes:          endpoint.EventTypes,
+		Description:         endpoint.Description,
+		Enabled:             endpoint.DisabledAt == nil,
+		ConsecutiveFailures: endpoint.ConsecutiveFailures,
+		DisabledAt:          endpoint.DisabledAt,
+		CreatedAt:           endpoint.CreatedAt,
+		UpdatedAt:           endpoint.UpdatedAt,
+	}
+}
+
+func newWebhookDeliveryResponse(delivery *entities.WebhookDelivery) *dto.WebhookDeliveryResponse {
+	return &dto.WebhookDeliveryResponse{
+		ID:             delivery.ID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Payload:        delivery.Payload,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  delivery.NextAttemptAt,
+		ResponseStatus: delivery.ResponseStatus,
+		ResponseBody:   delivery.ResponseBody,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+}
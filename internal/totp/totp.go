@@ -0,0 +1,86 @@
+// Package totp implements RFC 6238 time-based one-time passwords with the
+// parameters supported by common authenticator apps: HMAC-SHA1, 6 digits
+// and a 30 second period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew is the number of periods accepted before and after the current one.
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningURI returns an otpauth:// URI that can be rendered as a QR code.
+func ProvisioningURI(secret, issuer, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// Step returns the time step number for t.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Code returns the one-time password for the given time step.
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", fmt.Errorf("totp.Code invalid secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Validate checks code against the steps around t and returns the matched
+// step, so that callers can reject reuse of the same code.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,107 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfcVectors are the SHA1 test vectors of RFC 6238 Appendix B truncated from
+// 8 to 6 digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() error = %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("Code() at %d = %q, want %q", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code() error = nil")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range rfcVectors {
+		now := time.Unix(tt.unix, 0)
+		step, ok := Validate(rfcSecret, tt.code, now)
+		if !ok || step != Step(now) {
+			t.Errorf("Validate(%q) at %d = %d, %v, want %d, true", tt.code, tt.unix, step, ok, Step(now))
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	// The code of the 1111111111 vector belongs to step 37037037, which spans
+	// 1111111110 to 1111111139.
+	const code = "050471"
+	const step = 37037037
+	tests := []struct {
+		name   string
+		unix   int64
+		wantOK bool
+	}{
+		{"same step", 1111111111, true},
+		{"one step later", 1111111140, true},
+		{"end of one step later", 1111111169, true},
+		{"two steps later", 1111111170, false},
+		{"one step earlier", 1111111109, true},
+		{"start of one step earlier", 1111111080, true},
+		{"two steps earlier", 1111111079, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Validate(rfcSecret, code, time.Unix(tt.unix, 0))
+			if ok != tt.wantOK {
+				t.Fatalf("Validate() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != step {
+				t.Errorf("Validate() step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, code := range []string{
+		"",
+		"50471",
+		"0504710",
+		// The 8 digit code of RFC 6238 is not accepted either.
+		"14050471",
+		"050472",
+	} {
+		t.Run(code, func(t *testing.T) {
+			if _, ok := Validate(rfcSecret, code, now); ok {
+				t.Errorf("Validate(%q) = true, want false", code)
+			}
+		})
+	}
+}
+
+func TestValidateTrimsSpaces(t *testing.T) {
+	if _, ok := Validate(rfcSecret, " 050471 ", time.Unix(1111111111, 0)); !ok {
+		t.Error("Validate() = false, want true")
+	}
+}
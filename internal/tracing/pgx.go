@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryTracer creates a span for every query and copy run through pgx within
+// a traced operation. Queries of background work outside any trace, such as
+// pool health checks and the pollers of the workers, are not traced, so they
+// do not each start a trace of their own. Query arguments are left out, they
+// may hold passwords and tokens.
+type QueryTracer struct{}
+
+var (
+	_ pgx.QueryTracer    = QueryTracer{}
+	_ pgx.CopyFromTracer = QueryTracer{}
+)
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	operation := queryOperation(data.SQL)
+	ctx, _ = Start(ctx, "db."+strings.ToLower(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+	return ctx
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	endSpan(span, data.Err)
+}
+
+func (QueryTracer) TraceCopyFromStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	ctx, _ = Start(ctx, "db.copy",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName("COPY"),
+			semconv.DBCollectionName(data.TableName.Sanitize()),
+		),
+	)
+	return ctx
+}
+
+func (QueryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	endSpan(span, data.Err)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryOperation returns the leading keyword of a statement, such as SELECT
+// or INSERT. Statements starting with a CTE are reported as WITH.
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,70 @@
+// Package tracing sets up OpenTelemetry tracing. Incoming and outgoing
+// trace context uses the W3C traceparent and baggage headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"marketplace/config"
+)
+
+const instrumentationName = "marketplace"
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes buffered spans and must be called on shutdown. With the
+// none exporter spans are not recorded, but incoming trace context is still
+// propagated, so logs carry the trace id of the caller.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.TracingExporter {
+	case config.OTLPTracingExporter:
+		// The endpoint and headers come from the standard
+		// OTEL_EXPORTER_OTLP_* environment variables.
+		exporter, err = otlptracehttp.New(ctx)
+	case config.StdoutTracingExporter:
+		exporter, err = stdouttrace.New()
+	case config.NoneTracingExporter, "":
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create %s trace exporter: %w", cfg.TracingExporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(cfg.TracingServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named after the operation, the same name the logs use
+// in their op attribute.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends span and marks it as failed when *err is set. Functions returning
+// a named err use it as defer tracing.End(span, &err).
+func End(span trace.Span, err *error) {
+	endSpan(span, *err)
+}
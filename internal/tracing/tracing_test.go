@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestQueryTracerSkipsQueriesOutsideTraces(t *testing.T) {
+	recorder := recordSpans(t)
+	tracer := QueryTracer{}
+
+	ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "select 1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+	ctx = tracer.TraceCopyFromStart(context.Background(), nil, pgx.TraceCopyFromStartData{TableName: pgx.Identifier{"jobs"}})
+	tracer.TraceCopyFromEnd(ctx, nil, pgx.TraceCopyFromEndData{})
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("recorded %d spans, want none", len(spans))
+	}
+}
+
+func TestQueryTracerTracesQueriesOfOperation(t *testing.T) {
+	recorder := recordSpans(t)
+	tracer := QueryTracer{}
+
+	ctx, span := Start(context.Background(), "services.user.GetUserProfile")
+	queryCtx := tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "select * from users"})
+	tracer.TraceQueryEnd(queryCtx, nil, pgx.TraceQueryEndData{Err: errors.New("connection reset")})
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "db.select" || query.Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("span %q with parent %s, want db.select within the operation", query.Name(), query.Parent().SpanID())
+	}
+	if query.Status().Code != codes.Error {
+		t.Errorf("status = %v, want error", query.Status().Code)
+	}
+}
+
+func TestEndRecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+
+	run := func(fail bool) (err error) {
+		_, span := Start(context.Background(), "services.test.Run")
+		defer End(span, &err)
+		if fail {
+			return errors.New("cannot run")
+		}
+		return nil
+	}
+	_ = run(false)
+	_ = run(true)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("status of succeeded span = %v, want unset", spans[0].Status().Code)
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "cannot run" || len(spans[1].Events()) != 1 {
+		t.Errorf("failed span status = %+v with %d events, want the error recorded", spans[1].Status(), len(spans[1].Events()))
+	}
+}
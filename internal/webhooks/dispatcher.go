@@ -0,0 +1,227 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/backoff"
+	"marketplace/internal/entities"
+	"marketplace/internal/outbox"
+	"marketplace/internal/repositories"
+)
+
+const (
+	claimBatchSize       = 50
+	maxStoredResponseLen = 1024
+)
+
+type DispatcherConfig struct {
+	PollInterval         time.Duration
+	MaxAttempts          int
+	RetryBase            time.Duration
+	RetryMax             time.Duration
+	DisableAfterFailures int
+	Timeout              time.Duration
+}
+
+// Dispatcher queues deliveries for events coming from the outbox bus and
+// sends them to subscribed endpoints. Failed deliveries are retried with
+// exponential backoff; endpoints failing DisableAfterFailures times in a
+// row are disabled until their owner enables them again.
+type Dispatcher struct {
+	webhookRepository repositories.WebhookRepository
+	client            *http.Client
+	cfg               DispatcherConfig
+}
+
+func NewDispatcher(webhookRepository repositories.WebhookRepository, client *http.Client, cfg DispatcherConfig) *Dispatcher {
+	return &Dispatcher{webhookRepository: webhookRepository, client: client, cfg: cfg}
+}
+
+// HandleEvent is subscribed to the outbox bus. Events are delivered to the
+// endpoints of the user they belong to, named by the user_id of their
+// payload; admin-only events go to every subscribed endpoint, which only
+// admins can have.
+func (d *Dispatcher) HandleEvent(ctx context.Context, event *entities.OutboxEvent) error {
+	adminOnly, ok := entities.WebhookEventTypes[event.EventType]
+	if !ok {
+		return nil
+	}
+	var ownerID *uuid.UUID
+	if !adminOnly {
+		var owner struct {
+			UserID uuid.UUID `json:"user_id"`
+		}
+		if err := json.Unmarshal(event.Payload, &owner); err != nil || owner.UserID == uuid.Nil {
+			slog.Warn("Webhook event without an owner is not delivered",
+				slog.String("op", "webhooks.Dispatcher.HandleEvent"),
+				slog.String("eventID", event.EventID.String()),
+				slog.String("eventType", event.EventType),
+			)
+			return nil
+		}
+		ownerID = &owner.UserID
+	}
+	payload, err := json.Marshal(outbox.NewEnvelope(event))
+	if err != nil {
+		return err
+	}
+	queued, err := d.webhookRepository.CreateWebhookDeliveries(ctx, event.EventID, event.EventType, ownerID, payload)
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		slog.Debug("Webhook deliveries queued",
+			slog.String("op", "webhooks.Dispatcher.HandleEvent"),
+			slog.String("eventID", event.EventID.String()),
+			slog.Int("count", queued),
+		)
+	}
+	return nil
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	logger := slog.Default().With(slog.String("op", "webhooks.Dispatcher.Run"))
+	logger.Info("Webhook dispatcher started")
+
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		claimed, err := d.dispatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Claiming webhook deliveries failed", slog.Any("error", err))
+		}
+
+		if err == nil && claimed == claimBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch claims a batch of due deliveries and sends them. They are sent
+// concurrently, so all of them get a response or time out within a single
+// request timeout and none is claimed again while its attempt is still
+// running.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, error) {
+	deliveries, err := d.webhookRepository.ClaimWebhookDeliveries(ctx, claimBatchSize, 2*d.cfg.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	var sending sync.WaitGroup
+	for _, delivery := range deliveries {
+		sending.Add(1)
+		go func() {
+			defer sending.Done()
+			d.send(ctx, delivery)
+		}()
+	}
+	sending.Wait()
+	return len(deliveries), nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *entities.WebhookDelivery) {
+	logger := slog.Default().With(
+		slog.String("op", "webhooks.Dispatcher.send"),
+		slog.String("deliveryID", delivery.ID.String()),
+		slog.String("endpointID", delivery.EndpointID.String()),
+	)
+
+	leasedUntil := delivery.NextAttemptAt
+	statusCode, responseBody, err := d.post(ctx, delivery)
+	if ctx.Err() != nil {
+		// Shutting down: the lease expires and the delivery is retried.
+		return
+	}
+
+	// The delivery times are timestamps without time zone compared with
+	// now() in SQL, and pgx keeps only the wall clock of a time, so every
+	// time is stored in UTC.
+	now := time.Now().UTC()
+	if statusCode != 0 {
+		delivery.ResponseStatus = &statusCode
+		delivery.ResponseBody = &responseBody
+	}
+	succeeded := err == nil
+	if succeeded {
+		delivery.Status = entities.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+	} else {
+		lastError := err.Error()
+		delivery.LastError = &lastError
+		if delivery.Attempts >= d.cfg.MaxAttempts {
+			delivery.Status = entities.WebhookDeliveryFailed
+		} else {
+			delivery.NextAttemptAt = now.Add(backoff.Exponential(delivery.Attempts, d.cfg.RetryBase, d.cfg.RetryMax))
+		}
+	}
+
+	disabled, saveErr := d.webhookRepository.SaveWebhookDeliveryResult(ctx, delivery, leasedUntil, succeeded, d.cfg.DisableAfterFailures)
+	if errors.Is(saveErr, repositories.ErrNotFound) {
+		// The lease ran out and the delivery was claimed again or replayed;
+		// the newer attempt records its own result.
+		logger.Warn("Webhook delivery result dropped after its lease ended")
+		return
+	}
+	if saveErr != nil {
+		logger.Error("Saving webhook delivery result failed", slog.Any("error", saveErr))
+		return
+	}
+	switch {
+	case succeeded:
+		logger.Debug("Webhook delivered", slog.Int("status", statusCode))
+	case delivery.Status == entities.WebhookDeliveryFailed:
+		logger.Warn("Webhook delivery failed permanently", slog.Int("attempts", delivery.Attempts), slog.Any("error", err))
+	default:
+		logger.Info("Webhook delivery will be retried",
+			slog.Int("attempts", delivery.Attempts),
+			slog.Time("nextAttemptAt", delivery.NextAttemptAt),
+			slog.Any("error", err),
+		)
+	}
+	if disabled {
+		logger.Warn("Webhook endpoint disabled after repeated failures")
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *entities.WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Marketplace-Webhooks/1.0")
+	req.Header.Set("X-Webhook-ID", delivery.ID.String())
+	req.Header.Set("X-Event-ID", delivery.EventID.String())
+	req.Header.Set("X-Event-Type", delivery.EventType)
+	req.Header.Set(SignatureHeader, Sign(delivery.Endpoint.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxStoredResponseLen))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, string(body), nil
+}
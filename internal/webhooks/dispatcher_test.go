@@ -0,0 +1,440 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"marketplace/internal/entities"
+	"marketplace/internal/repositories"
+)
+
+const testSecret = "whsec_test"
+
+// fakeWebhookRepository keeps endpoints and deliveries in memory and
+// follows the claiming and result rules of the Postgres repository.
+type fakeWebhookRepository struct {
+	repositories.WebhookRepository
+
+	mu         sync.Mutex
+	endpoints  []*entities.WebhookEndpoint
+	deliveries []*entities.WebhookDelivery
+}
+
+func (r *fakeWebhookRepository) CreateWebhookDeliveries(
+	_ context.Context,
+	eventID uuid.UUID,
+	eventType string,
+	ownerID *uuid.UUID,
+	payload []byte,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queued := 0
+	for _, endpoint := range r.endpoints {
+		if endpoint.DisabledAt != nil || !slices.Contains(endpoint.EventTypes, eventType) ||
+			ownerID != nil && endpoint.UserID != *ownerID {
+			continue
+		}
+		if slices.ContainsFunc(r.deliveries, func(d *entities.WebhookDelivery) bool {
+			return d.EndpointID == endpoint.ID && d.EventID == eventID
+		}) {
+			continue
+		}
+		r.deliveries = append(r.deliveries, &entities.WebhookDelivery{
+			ID:            uuid.New(),
+			EndpointID:    endpoint.ID,
+			EventID:       eventID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        entities.WebhookDeliveryPending,
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+		})
+		queued++
+	}
+	return queued, nil
+}
+
+func (r *fakeWebhookRepository) ReplayWebhookDelivery(_ context.Context, id, endpointID uuid.UUID) (*entities.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.ID == id && delivery.EndpointID == endpointID {
+			delivery.Status = entities.WebhookDeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = time.Now()
+			delivery.LastError = nil
+			replayed := *delivery
+			return &replayed, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (r *fakeWebhookRepository) ClaimWebhookDeliveries(_ context.Context, limit int, lease time.Duration) ([]*entities.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var claimed []*entities.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		endpoint := r.endpoint(delivery.EndpointID)
+		if len(claimed) == limit || delivery.Status != entities.WebhookDeliveryPending ||
+			delivery.NextAttemptAt.After(now) || endpoint.DisabledAt != nil {
+			continue
+		}
+		delivery.NextAttemptAt = now.Add(lease)
+		delivery.Attempts++
+		copied := *delivery
+		copied.Endpoint = &entities.WebhookEndpoint{ID: endpoint.ID, URL: endpoint.URL, Secret: endpoint.Secret}
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (r *fakeWebhookRepository) SaveWebhookDeliveryResult(
+	_ context.Context,
+	delivery *entities.WebhookDelivery,
+	leasedUntil time.Time,
+	succeeded bool,
+	disableAfterFailures int,
+) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := slices.IndexFunc(r.deliveries, func(d *entities.WebhookDelivery) bool {
+		return d.ID == delivery.ID && d.Status == entities.WebhookDeliveryPending &&
+			d.Attempts == delivery.Attempts && d.NextAttemptAt.Equal(leasedUntil)
+	})
+	if idx < 0 {
+		return false, repositories.ErrNotFound
+	}
+	stored := r.deliveries[idx]
+	stored.Status = delivery.Status
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.ResponseStatus = delivery.ResponseStatus
+	stored.ResponseBody = delivery.ResponseBody
+	stored.LastError = delivery.LastError
+	stored.DeliveredAt = delivery.DeliveredAt
+
+	endpoint := r.endpoint(delivery.EndpointID)
+	if succeeded {
+		endpoint.ConsecutiveFailures = 0
+		return false, nil
+	}
+	endpoint.ConsecutiveFailures++
+	if endpoint.DisabledAt == nil && endpoint.ConsecutiveFailures >= disableAfterFailures {
+		now := time.Now()
+		endpoint.DisabledAt = &now
+	}
+	return endpoint.DisabledAt != nil, nil
+}
+
+func (r *fakeWebhookRepository) endpoint(id uuid.UUID) *entities.WebhookEndpoint {
+	for _, endpoint := range r.endpoints {
+		if endpoint.ID == id {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+// makeDue lets the backoff of every pending delivery pass.
+func (r *fakeWebhookRepository) makeDue() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		delivery.NextAttemptAt = time.Now()
+	}
+}
+
+func (r *fakeWebhookRepository) delivery(t *testing.T) entities.WebhookDelivery {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.deliveries) != 1 {
+		t.Fatalf("%d deliveries queued, want 1", len(r.deliveries))
+	}
+	return *r.deliveries[0]
+}
+
+type dispatcherTest struct {
+	receiver   *Receiver
+	endpoint   *entities.WebhookEndpoint
+	repository *fakeWebhookRepository
+	dispatcher *Dispatcher
+}
+
+func newDispatcherTest(t *testing.T, cfg DispatcherConfig) *dispatcherTest {
+	t.Helper()
+	receiver := NewReceiver(testSecret)
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	endpoint := &entities.WebhookEndpoint{
+		ID:         uuid.New(),
+		UserID:     uuid.New(),
+		URL:        server.URL,
+		Secret:     testSecret,
+		EventTypes: []string{entities.AdvertisementCreatedEvent},
+	}
+	repository := &fakeWebhookRepository{endpoints: []*entities.WebhookEndpoint{endpoint}}
+	cfg.Timeout = time.Second
+	return &dispatcherTest{
+		receiver:   receiver,
+		endpoint:   endpoint,
+		repository: repository,
+		dispatcher: NewDispatcher(repository, NewHTTPClient(cfg.Timeout, true), cfg),
+	}
+}
+
+// publish hands an event of the endpoint's owner to the dispatcher.
+func (tt *dispatcherTest) publish(t *testing.T, eventType string) uuid.UUID {
+	t.Helper()
+	return tt.publishFor(t, eventType, tt.endpoint.UserID)
+}
+
+func (tt *dispatcherTest) publishFor(t *testing.T, eventType string, userID uuid.UUID) uuid.UUID {
+	t.Helper()
+	event := &entities.OutboxEvent{
+		EventID:       uuid.New(),
+		AggregateType: entities.AdvertisementAggregate,
+		AggregateID:   uuid.New(),
+		EventType:     eventType,
+		Payload:       json.RawMessage(`{"user_id":"` + userID.String() + `","title":"Bike"}`),
+		CreatedAt:     time.Now(),
+	}
+	if err := tt.dispatcher.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	return event.EventID
+}
+
+func (tt *dispatcherTest) dispatch(t *testing.T, want int) {
+	t.Helper()
+	claimed, err := tt.dispatcher.dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("dispatch() error = %v", err)
+	}
+	if claimed != want {
+		t.Fatalf("dispatch() claimed %d deliveries, want %d", claimed, want)
+	}
+}
+
+var testDispatcherConfig = DispatcherConfig{
+	MaxAttempts:          3,
+	RetryBase:            time.Minute,
+	RetryMax:             90 * time.Second,
+	DisableAfterFailures: 10,
+}
+
+func TestDispatcherDeliversSignedEvent(t *testing.T) {
+	tt := newDispatcherTest(t, testDispatcherConfig)
+	eventID := tt.publish(t, entities.AdvertisementCreatedEvent)
+	tt.publish(t, entities.UserRegisteredEvent)
+
+	tt.dispatch(t, 1)
+
+	events := tt.receiver.Events()
+	if len(events) != 1 || events[0].ID != eventID || events[0].Type != entities.AdvertisementCreatedEvent {
+		t.Fatalf("received %+v, want event %s", events, eventID)
+	}
+	if string(events[0].Data) != `{"user_id":"`+tt.endpoint.UserID.String()+`","title":"Bike"}` {
+		t.Errorf("data = %s, want the event payload", events[0].Data)
+	}
+	delivery := tt.repository.delivery(t)
+	if delivery.Status != entities.WebhookDeliverySucceeded || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want succeeded", delivery)
+	}
+	if delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusNoContent {
+		t.Errorf("response status = %v, want %d", delivery.ResponseStatus, http.StatusNoContent)
+	}
+	tt.dispatch(t, 0)
+}
+
+func TestDispatcherDeliversOnlyToEventOwner(t *testing.T) {
+	tt := newDispatcherTest(t, testDispatcherConfig)
+	tt.publishFor(t, entities.AdvertisementCreatedEvent, uuid.New())
+	tt.publishFor(t, entities.AdvertisementCreatedEvent, uuid.Nil)
+
+	tt.dispatch(t, 0)
+	if events := tt.receiver.Events(); len(events) != 0 {
+		t.Errorf("received %+v, want none", events)
+	}
+}
+
+func TestDispatcherDeliversAdminOnlyEventsToSubscribers(t *testing.T) {
+	tt := newDispatcherTest(t, testDispatcherConfig)
+	tt.endpoint.EventTypes = []string{entities.UserRegisteredEvent}
+	eventID := tt.publishFor(t, entities.UserRegisteredEvent, uuid.New())
+
+	tt.dispatch(t, 1)
+	if events := tt.receiver.Events(); len(events) != 1 || events[0].ID != eventID {
+		t.Errorf("received %+v, want event %s", events, eventID)
+	}
+}
+
+func TestDispatcherFailsOnRejectedSignature(t *testing.T) {
+	tt := newDispatcherTest(t, testDispatcherConfig)
+	tt.endpoint.Secret = "rotated"
+	tt.publish(t, entities.AdvertisementCreatedEvent)
+
+	tt.dispatch(t, 1)
+
+	if events := tt.receiver.Events(); len(events) != 0 {
+		t.Errorf("received %+v, want none", events)
+	}
+	delivery := tt.repository.delivery(t)
+	if delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusUnauthorized {
+		t.Errorf("response status = %v, want %d", delivery.ResponseStatus, http.StatusUnauthorized)
+	}
+	if delivery.Status != entities.WebhookDeliveryPending || delivery.LastError == nil {
+		t.Errorf("delivery = %+v, want a pending retry with an error", delivery)
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	tt := newDispatcherTest(t, testDispatcherConfig)
+	tt.receiver.SetStatusCode(http.StatusInternalServerError)
+	tt.publish(t, entities.AdvertisementCreatedEvent)
+
+	for attempt, backoff := range []time.Duration{time.Minute, 90 * time.Second} {
+		start := time.Now()
+		tt.dispatch(t, 1)
+		delivery := tt.repository.delivery(t)
+		if delivery.Status != entities.WebhookDeliveryPending || delivery.Attempts != attempt+1 {
+			t.Fatalf("attempt %d: delivery = %+v, want pending", attempt+1, delivery)
+		}
+		if delivery.NextAttemptAt.Location() != time.UTC {
+			t.Errorf("attempt %d: NextAttemptAt = %v, want UTC", attempt+1, delivery.NextAttemptAt)
+		}
+		if delivery.NextAttemptAt.Before(start.Add(backoff)) || delivery.NextAttemptAt.After(time.Now().Add(backoff)) {
+			t.Errorf("attempt %d: next attempt in %v, want %v", attempt+1, time.Until(delivery.NextAttemptAt), backoff)
+		}
+		// Not due before the backoff has passed.
+		tt.dispatch(t, 0)
+		tt.repository.makeDue()
+	}
+
+	tt.dispatch(t, 1)
+	delivery := tt.repository.delivery(t)
+	if delivery.Status != entities.WebhookDeliveryFailed || delivery.Attempts != 3 {
+		t.Fatalf("delivery = %+v, want failed after 3 attempts", delivery)
+	}
+	tt.repository.makeDue()
+	tt.dispatch(t, 0)
+}
+
+func TestDispatcherDisablesFailingEndpoint(t *testing.T) {
+	cfg := testDispatcherConfig
+	cfg.MaxAttempts = 10
+	cfg.DisableAfterFailures = 2
+	tt := newDispatcherTest(t, cfg)
+	tt.receiver.SetStatusCode(http.StatusServiceUnavailable)
+	tt.publish(t, entities.AdvertisementCreatedEvent)
+
+	tt.dispatch(t, 1)
+	if tt.endpoint.DisabledAt != nil {
+		t.Fatal("endpoint disabled after one failure")
+	}
+	tt.repository.makeDue()
+	tt.dispatch(t, 1)
+	if tt.endpoint.DisabledAt == nil {
+		t.Fatal("endpoint still enabled after two failures in a row")
+	}
+
+	// Neither the pending retry nor new events reach a disabled endpoint.
+	tt.receiver.SetStatusCode(http.StatusNoContent)
+	tt.publish(t, entities.AdvertisementCreatedEvent)
+	tt.repository.makeDue()
+	tt.dispatch(t, 0)
+}
+
+func TestDispatcherResetsFailuresOnSuccess(t *testing.T) {
+	cfg := testDispatcherConfig
+	cfg.DisableAfterFailures = 2
+	tt := newDispatcherTest(t, cfg)
+	tt.receiver.SetStatusCode(http.StatusBadGateway)
+	tt.publish(t, entities.AdvertisementCreatedEvent)
+	tt.dispatch(t, 1)
+
+	tt.receiver.SetStatusCode(http.StatusOK)
+	tt.repository.makeDue()
+	tt.dispatch(t, 1)
+	if tt.endpoint.ConsecutiveFailures != 0 || tt.endpoint.DisabledAt != nil {
+		t.Errorf("endpoint = %+v, want the failures reset", tt.endpoint)
+	}
+}
+
+func TestDispatcherSendsReplayedDelivery(t *testing.T) {
+	cfg := testDispatcherConfig
+	cfg.MaxAttempts = 1
+	tt := newDispatcherTest(t, cfg)
+	tt.receiver.SetStatusCode(http.StatusInternalServerError)
+	eventID := tt.publish(t, entities.AdvertisementCreatedEvent)
+	tt.dispatch(t, 1)
+	failed := tt.repository.delivery(t)
+	if failed.Status != entities.WebhookDeliveryFailed {
+		t.Fatalf("delivery = %+v, want failed", failed)
+	}
+
+	tt.receiver.SetStatusCode(http.StatusNoContent)
+	for range 2 {
+		if _, err := tt.repository.ReplayWebhookDelivery(context.Background(), failed.ID, tt.endpoint.ID); err != nil {
+			t.Fatalf("ReplayWebhookDelivery() error = %v", err)
+		}
+		tt.dispatch(t, 1)
+		delivery := tt.repository.delivery(t)
+		if delivery.Status != entities.WebhookDeliverySucceeded || delivery.Attempts != 1 {
+			t.Errorf("replayed delivery = %+v, want succeeded on its first attempt", delivery)
+		}
+	}
+
+	// A replay is the same event again, so receivers can deduplicate it.
+	events := tt.receiver.Events()
+	if len(events) != 2 || events[0].ID != eventID || events[1].ID != eventID {
+		t.Errorf("received %+v, want event %s twice", events, eventID)
+	}
+}
+
+func TestDispatcherDropsResultOfExpiredLease(t *testing.T) {
+	tt := newDispatcherTest(t, testDispatcherConfig)
+	tt.publish(t, entities.AdvertisementCreatedEvent)
+
+	// A dispatcher claims the delivery and stalls until its lease ends,
+	// while another one claims it again and delivers it.
+	stale, err := tt.repository.ClaimWebhookDeliveries(context.Background(), 1, time.Minute)
+	if err != nil || len(stale) != 1 {
+		t.Fatalf("ClaimWebhookDeliveries() = %v, %v, want one delivery", stale, err)
+	}
+	tt.repository.makeDue()
+	tt.dispatch(t, 1)
+
+	tt.receiver.SetStatusCode(http.StatusInternalServerError)
+	tt.dispatcher.send(context.Background(), stale[0])
+
+	delivery := tt.repository.delivery(t)
+	if delivery.Status != entities.WebhookDeliverySucceeded || delivery.LastError != nil {
+		t.Errorf("delivery = %+v, want the newer success kept", delivery)
+	}
+	if tt.endpoint.ConsecutiveFailures != 0 {
+		t.Errorf("consecutive failures = %d, want 0", tt.endpoint.ConsecutiveFailures)
+	}
+}
+
+func TestHTTPClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(NewReceiver(testSecret))
+	defer server.Close()
+
+	_, err := NewHTTPClient(time.Second, false).Post(server.URL, "application/json", nil)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("Post() error = %v, want %v", err, errPrivateAddress)
+	}
+}
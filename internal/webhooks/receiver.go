@@ -0,0 +1,70 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"marketplace/internal/outbox"
+)
+
+const signatureTolerance = 5 * time.Minute
+
+// Receiver is a minimal webhook endpoint for local testing. It verifies
+// signatures and keeps the events it accepted; StatusCode lets tests make it
+// fail to exercise retries and auto-disabling.
+type Receiver struct {
+	secret string
+
+	mu         sync.Mutex
+	statusCode int
+	events     []*outbox.Envelope
+}
+
+func NewReceiver(secret string) *Receiver {
+	return &Receiver{secret: secret, statusCode: http.StatusNoContent}
+}
+
+// SetStatusCode changes the status returned for correctly signed requests.
+func (r *Receiver) SetStatusCode(statusCode int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statusCode = statusCode
+}
+
+// Events returns the events received so far.
+func (r *Receiver) Events() []*outbox.Envelope {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*outbox.Envelope(nil), r.events...)
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err = Verify(r.secret, req.Header.Get(SignatureHeader), body, signatureTolerance, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var envelope outbox.Envelope
+	if err = json.Unmarshal(body, &envelope); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.statusCode >= 200 && r.statusCode < 300 {
+		r.events = append(r.events, &envelope)
+	}
+	w.WriteHeader(r.statusCode)
+}
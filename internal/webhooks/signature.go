@@ -0,0 +1,58 @@
+// Package webhooks sends domain events to endpoints registered by users.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SignatureHeader = "X-Webhook-Signature"
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header value for body sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">".
+// The timestamp is signed too, so receivers can reject replayed requests.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + computeSignature(secret, unix, body)
+}
+
+// Verify checks a signature header produced by Sign and rejects it when the
+// timestamp is older than tolerance. Receivers written in Go can use it as is.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var unix, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signature = value
+		}
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || signature == "" {
+		return ErrInvalidSignature
+	}
+	if now.Sub(time.Unix(seconds, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(computeSignature(secret, unix, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func computeSignature(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1","type":"advertisement.created"}`)
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign("secret", signedAt, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		wantOK bool
+	}{
+		{"valid", "secret", header, body, signedAt, true},
+		{"within tolerance", "secret", header, body, signedAt.Add(signatureTolerance), true},
+		{"expired", "secret", header, body, signedAt.Add(signatureTolerance + time.Second), false},
+		{"wrong secret", "other", header, body, signedAt, false},
+		{"modified body", "secret", header, []byte(`{"id":"2","type":"advertisement.created"}`), signedAt, false},
+		{"modified timestamp", "secret", strings.Replace(header, "t=1700000000", "t=1700000001", 1), body, signedAt, false},
+		{"missing signature", "secret", "t=1700000000", body, signedAt, false},
+		{"missing timestamp", "secret", header[strings.Index(header, "v1="):], body, signedAt, false},
+		{"empty header", "secret", "", body, signedAt, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, signatureTolerance, tt.now)
+			if tt.wantOK && err != nil {
+				t.Errorf("Verify() error = %v", err)
+			}
+			if !tt.wantOK && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestSignFormat(t *testing.T) {
+	header := Sign("secret", time.Unix(1700000000, 0), []byte("{}"))
+	if !strings.HasPrefix(header, "t=1700000000,v1=") || len(header) != len("t=1700000000,v1=")+64 {
+		t.Errorf("Sign() = %q, want t=<unix>,v1=<hex sha256>", header)
+	}
+}
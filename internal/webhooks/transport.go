@@ -0,0 +1,49 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var errPrivateAddress = errors.New("webhook address is not public")
+
+// NewHTTPClient returns the client deliveries are sent with. Unless
+// allowPrivateNetworks is set, connections to loopback, private and
+// link-local addresses are refused at dial time, so endpoint URLs cannot be
+// used to reach internal services, even through DNS tricks. Redirects are
+// not followed and count as failed deliveries.
+func NewHTTPClient(timeout time.Duration, allowPrivateNetworks bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddress(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast()
+}
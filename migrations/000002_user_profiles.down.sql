@@ -0,0 +1,8 @@
+drop index if exists advertisements_user_id_idx;
+
+alter table users
+    drop column if exists updated_at,
+    drop column if exists rating,
+    drop column if exists avatar_url,
+    drop column if exists bio,
+    drop column if exists display_name;
@@ -0,0 +1,8 @@
+alter table users
+    add column display_name varchar(64) not null default '',
+    add column bio text not null default '',
+    add column avatar_url text not null default '',
+    add column rating numeric(3, 2),
+    add column updated_at timestamp not null default now();
+
+create index if not exists advertisements_user_id_idx on advertisements (user_id);
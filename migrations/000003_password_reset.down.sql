@@ -0,0 +1,6 @@
+drop table if exists password_reset_tokens;
+
+drop table if exists sessions;
+
+alter table users
+    drop column if exists email;
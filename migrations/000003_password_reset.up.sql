@@ -0,0 +1,23 @@
+alter table users
+    add column email varchar(254);
+
+create table sessions (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    created_at timestamp not null default now(),
+    expires_at timestamp not null,
+    revoked_at timestamp,
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index sessions_user_id_idx on sessions (user_id);
+
+create table password_reset_tokens (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    token_hash text not null unique,
+    created_at timestamp not null default now(),
+    expires_at timestamp not null,
+    used_at timestamp,
+    foreign key (user_id) references users (id) on delete cascade
+);
@@ -0,0 +1,6 @@
+drop table if exists email_verification_tokens;
+
+drop index if exists users_email_key;
+
+alter table users
+    drop column if exists email_verified_at;
@@ -0,0 +1,17 @@
+alter table users
+    add column email_verified_at timestamp;
+
+create unique index users_email_key on users (lower(email)) where email is not null;
+
+create table email_verification_tokens (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    email varchar(254) not null,
+    token_hash text not null unique,
+    created_at timestamp not null default now(),
+    expires_at timestamp not null,
+    used_at timestamp,
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index email_verification_tokens_user_id_idx on email_verification_tokens (user_id, created_at desc);
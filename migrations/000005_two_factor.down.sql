@@ -0,0 +1,7 @@
+drop table if exists recovery_codes;
+
+alter table users
+    drop column if exists totp_last_step,
+    drop column if exists totp_enabled_at,
+    drop column if exists totp_secret,
+    drop column if exists role;
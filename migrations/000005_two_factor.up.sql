@@ -0,0 +1,16 @@
+alter table users
+    add column role varchar(16) not null default 'user',
+    add column totp_secret text,
+    add column totp_enabled_at timestamp,
+    add column totp_last_step bigint not null default 0;
+
+create table recovery_codes (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    code_hash text not null,
+    created_at timestamp not null default now(),
+    used_at timestamp,
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index recovery_codes_user_id_idx on recovery_codes (user_id);
@@ -0,0 +1,6 @@
+create table login_attempts (
+    key text primary key,
+    failures int not null default 0,
+    last_failure_at timestamp not null default now(),
+    locked_until timestamp
+);
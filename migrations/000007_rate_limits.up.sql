@@ -0,0 +1,4 @@
+create table rate_limits (
+    key text primary key,
+    tat timestamptz not null
+);
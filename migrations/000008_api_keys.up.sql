@@ -0,0 +1,15 @@
+create table api_keys (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    name varchar(64) not null,
+    prefix varchar(16) not null,
+    key_hash text not null unique,
+    scopes text[] not null default '{}',
+    expires_at timestamp,
+    last_used_at timestamp,
+    created_at timestamp not null default now(),
+    revoked_at timestamp,
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index api_keys_user_id_idx on api_keys (user_id);
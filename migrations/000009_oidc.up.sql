@@ -0,0 +1,24 @@
+create table oidc_states (
+    state_hash text primary key,
+    binding_hash text not null,
+    provider varchar(64) not null,
+    code_verifier text not null,
+    nonce text not null,
+    link_user_id uuid,
+    created_at timestamp not null default now(),
+    expires_at timestamp not null,
+    foreign key (link_user_id) references users (id) on delete cascade
+);
+
+create table user_identities (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    provider varchar(64) not null,
+    subject varchar(255) not null,
+    email varchar(254),
+    created_at timestamp not null default now(),
+    unique (provider, subject),
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index user_identities_user_id_idx on user_identities (user_id);
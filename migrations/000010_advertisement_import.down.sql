@@ -0,0 +1,8 @@
+drop table if exists import_job_rows;
+
+drop table if exists import_jobs;
+
+drop index if exists advertisements_user_id_external_id_idx;
+
+alter table advertisements
+    drop column if exists external_id;
@@ -0,0 +1,36 @@
+alter table advertisements
+    add column external_id varchar(128);
+
+create unique index advertisements_user_id_external_id_idx
+    on advertisements (user_id, external_id)
+    where external_id is not null;
+
+create table import_jobs (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    format varchar(16) not null,
+    status varchar(16) not null default 'pending',
+    total_rows integer not null default 0,
+    imported_rows integer not null default 0,
+    skipped_rows integer not null default 0,
+    failed_rows integer not null default 0,
+    errors jsonb not null default '[]',
+    created_at timestamp not null default now(),
+    started_at timestamp,
+    finished_at timestamp,
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index import_jobs_user_id_idx on import_jobs (user_id);
+
+create table import_job_rows (
+    import_job_id uuid not null,
+    row_index integer not null,
+    title text not null,
+    content text not null,
+    image_url text not null,
+    price numeric(11, 2) not null,
+    external_id varchar(128),
+    primary key (import_job_id, row_index),
+    foreign key (import_job_id) references import_jobs (id) on delete cascade
+);
@@ -0,0 +1,18 @@
+create table outbox_events (
+    id bigserial primary key,
+    event_id uuid not null unique default uuid_generate_v4(),
+    aggregate_type varchar(64) not null,
+    aggregate_id uuid not null,
+    event_type varchar(128) not null,
+    payload jsonb not null,
+    created_at timestamp not null default now(),
+    attempts integer not null default 0,
+    next_attempt_at timestamp not null default now(),
+    last_error text,
+    delivered_at timestamp,
+    dead_lettered_at timestamp
+);
+
+create index outbox_events_pending_idx
+    on outbox_events (aggregate_type, aggregate_id, id)
+    where delivered_at is null and dead_lettered_at is null;
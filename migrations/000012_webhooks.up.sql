@@ -0,0 +1,38 @@
+create table webhook_endpoints (
+    id uuid primary key default uuid_generate_v4(),
+    user_id uuid not null,
+    url text not null,
+    secret text not null,
+    event_types text[] not null,
+    description varchar(255) not null default '',
+    consecutive_failures integer not null default 0,
+    disabled_at timestamp,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now(),
+    foreign key (user_id) references users (id) on delete cascade
+);
+
+create index webhook_endpoints_user_id_idx on webhook_endpoints (user_id);
+
+create table webhook_deliveries (
+    id uuid primary key default uuid_generate_v4(),
+    endpoint_id uuid not null,
+    event_id uuid not null,
+    event_type varchar(128) not null,
+    payload jsonb not null,
+    status varchar(16) not null default 'pending',
+    attempts integer not null default 0,
+    next_attempt_at timestamp not null default now(),
+    response_status integer,
+    response_body text,
+    last_error text,
+    created_at timestamp not null default now(),
+    delivered_at timestamp,
+    unique (endpoint_id, event_id),
+    foreign key (endpoint_id) references webhook_endpoints (id) on delete cascade
+);
+
+create index webhook_deliveries_pending_idx
+    on webhook_deliveries (next_attempt_at)
+    where status = 'pending';
+create index webhook_deliveries_endpoint_id_idx on webhook_deliveries (endpoint_id, created_at);
@@ -0,0 +1,28 @@
+create table jobs (
+    id uuid primary key default uuid_generate_v4(),
+    kind varchar(128) not null,
+    payload jsonb not null,
+    status varchar(16) not null default 'pending',
+    unique_key varchar(255),
+    attempts integer not null default 0,
+    max_attempts integer not null,
+    run_at timestamp not null default now(),
+    locked_until timestamp,
+    last_error text,
+    created_at timestamp not null default now(),
+    finished_at timestamp
+);
+
+create index jobs_due_idx on jobs (kind, run_at) where status in ('pending', 'running');
+create index jobs_finished_idx on jobs (finished_at) where finished_at is not null;
+
+-- A unique key blocks duplicates only while a job is queued or running.
+create unique index jobs_unique_key_idx on jobs (kind, unique_key)
+    where unique_key is not null and status in ('pending', 'running');
+
+create table job_schedules (
+    name varchar(128) primary key,
+    spec varchar(128) not null,
+    next_run_at timestamp not null,
+    last_run_at timestamp
+);
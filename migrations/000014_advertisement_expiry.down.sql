@@ -0,0 +1,6 @@
+drop index if exists advertisements_expires_at_idx;
+
+alter table advertisements
+    drop column if exists archived_at,
+    drop column if exists expiry_reminded_at,
+    drop column if exists expires_at;
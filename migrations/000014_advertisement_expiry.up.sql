@@ -0,0 +1,12 @@
+alter table advertisements
+    add column expires_at timestamp,
+    add column expiry_reminded_at timestamp,
+    add column archived_at timestamp;
+
+-- Advertisements posted before expiry existed get a month to be renewed.
+update advertisements set expires_at = now() + interval '30 days';
+
+alter table advertisements
+    alter column expires_at set not null;
+
+create index advertisements_expires_at_idx on advertisements (expires_at) where archived_at is null;
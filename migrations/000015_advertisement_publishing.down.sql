@@ -0,0 +1,5 @@
+drop index if exists advertisements_scheduled_idx;
+
+alter table advertisements
+    drop column if exists published_at,
+    drop column if exists publish_at;
@@ -0,0 +1,11 @@
+alter table advertisements
+    add column publish_at timestamp,
+    add column published_at timestamp;
+
+update advertisements set publish_at = created_at, published_at = created_at;
+
+alter table advertisements
+    alter column publish_at set not null,
+    alter column publish_at set default now();
+
+create index advertisements_scheduled_idx on advertisements (publish_at) where published_at is null;
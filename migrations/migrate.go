@@ -2,17 +2,21 @@ package migrations
 
 import (
 	"errors"
+	"io/fs"
 	"log"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/golang-migrate/migrate/v4/source/github"
 )
 
+const sourceURL = "file://migrations"
+
 func Migrate(DBURL string) {
 	m, err := migrate.New(
-		"file://migrations",
+		sourceURL,
 		DBURL,
 	)
 	if err != nil {
@@ -24,3 +28,28 @@ func Migrate(DBURL string) {
 		log.Fatalf("Migration error: %s", err)
 	}
 }
+
+// LatestVersion returns the version of the last migration, the one the
+// database is at after Migrate.
+func LatestVersion() (uint, error) {
+	src, err := source.Open(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}